@@ -12,24 +12,26 @@ import (
 func init() { //nolint:gochecknoinits
 	var eventType string
 	var eventFilePath string
+	var diffReportFile string
 	eventCmd := &cobra.Command{
 		Use:   "event",
 		Short: "Handles a GitHub event based on event JSON file",
 		Long:  "Handles a GitHub event based on event JSON file.\nThis operation mode was was built with GitHub Actions in mind",
 		Args:  cobra.ExactArgs(0),
 		Run: func(cmd *cobra.Command, args []string) {
-			event(eventType, eventFilePath)
+			event(eventType, eventFilePath, diffReportFile)
 		},
 	}
 	eventCmd.Flags().StringVarP(&eventType, "type", "t", getEnv("GITHUB_EVENT_NAME", ""), "Event type, defaults to GITHUB_EVENT_NAME env var")
 	eventCmd.Flags().StringVarP(&eventFilePath, "file", "f", getEnv("GITHUB_EVENT_PATH", ""), "File path for event JSON, defaults to GITHUB_EVENT_PATH env var")
+	eventCmd.Flags().StringVar(&diffReportFile, "diff-report-file", getEnv("DIFF_REPORT_FILE", ""), "Write the ArgoCD diff of the PR as a JSON document to this file, defaults to DIFF_REPORT_FILE env var")
 	rootCmd.AddCommand(eventCmd)
 }
 
-func event(eventType string, eventFilePath string) {
+func event(eventType string, eventFilePath string, diffReportFile string) {
 	mainGhClientCache, _ := lru.New[string, githubapi.GhClientPair](128)
 	prApproverGhClientCache, _ := lru.New[string, githubapi.GhClientPair](128)
-	githubapi.ReciveEventFile(eventFilePath, eventType, mainGhClientCache, prApproverGhClientCache)
+	githubapi.ReciveEventFile(eventType, eventFilePath, diffReportFile, mainGhClientCache, prApproverGhClientCache)
 }
 
 func getEnv(key, fallback string) string {
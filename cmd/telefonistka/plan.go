@@ -0,0 +1,90 @@
+package telefonistka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/githubapi"
+)
+
+// This is still(https://github.com/spf13/cobra/issues/1862) the documented way to use cobra
+func init() { //nolint:gochecknoinits
+	var repoDir string
+	var changedFiles []string
+	var labels []string
+	var output string
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Simulate a promotion plan against a local checkout",
+		Long: `Simulate a promotion plan against a local checkout.
+This reads telefonistka.yaml and in-component configuration files from the local repo directory instead of the GitHub API,
+and prints the promotion PRs that would be opened if a PR changing the provided files was merged.
+`,
+		Args: cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			plan(repoDir, changedFiles, labels, output)
+		},
+	}
+	planCmd.Flags().StringVarP(&repoDir, "repo-dir", "d", ".", "Local checkout of the GitOps repo.")
+	planCmd.Flags().StringSliceVarP(&changedFiles, "changed-file", "f", nil, "Repo relative path of a changed file, can be repeated or comma separated.")
+	planCmd.Flags().StringSliceVarP(&labels, "label", "l", nil, "Label of the simulated PR, used for promotionPaths conditions, can be repeated or comma separated.")
+	planCmd.Flags().StringVarP(&output, "output", "o", "text", "Output format, \"text\" renders the dry-run PR comment template, \"json\" prints the raw plan.")
+	rootCmd.AddCommand(planCmd)
+}
+
+func plan(repoDir string, changedFiles []string, labels []string, output string) {
+	configFile := filepath.Join(repoDir, "telefonistka.yaml")
+	b, err := os.ReadFile(configFile)
+	if err != nil {
+		log.Errorf("Failed to read file %s, %v", configFile, err)
+		os.Exit(1)
+	}
+	config, err := cfg.ParseConfigFromYaml(string(b))
+	if err != nil {
+		log.Errorf("Failed to parse %s, %v", configFile, err)
+		os.Exit(1)
+	}
+
+	ghPrClientDetails := githubapi.GhPrClientDetails{
+		Ctx:      context.Background(),
+		PrLogger: log.WithFields(log.Fields{"repo_dir": repoDir}),
+	}
+	for _, l := range labels {
+		ghPrClientDetails.Labels = append(ghPrClientDetails.Labels, &github.Label{Name: github.String(l)})
+	}
+
+	src := githubapi.LocalPlanSource{RepoDir: repoDir, Files: changedFiles}
+	promotions, err := githubapi.GeneratePromotionPlanFromSource(ghPrClientDetails, src, config, "")
+	if err != nil {
+		log.Errorf("Failed to generate promotion plan: %v", err)
+		os.Exit(1)
+	}
+
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false) // plan keys include ">"
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(promotions); err != nil {
+			log.Errorf("Failed to serialize promotion plan: %v", err)
+			os.Exit(1)
+		}
+	case "text":
+		renderedPlan, err := githubapi.RenderPromotionPlan(promotions)
+		if err != nil {
+			log.Errorf("Failed to render promotion plan, TEMPLATES_PATH might need to be set: %v", err)
+			os.Exit(1)
+		}
+		fmt.Println(renderedPlan)
+	default:
+		log.Errorf("Unknown output format %s", output)
+		os.Exit(1)
+	}
+}
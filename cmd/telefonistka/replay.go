@@ -0,0 +1,98 @@
+package telefonistka
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/githubapi"
+)
+
+// This is still(https://github.com/spf13/cobra/issues/1862) the documented way to use cobra
+func init() { //nolint:gochecknoinits
+	var since string
+	var until string
+	var repos []string
+	var skipDeliveries bool
+	var all bool
+	var dryRun bool
+	replayCmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replays GitHub webhook deliveries Telefonistka failed to handle",
+		Long: "Replays GitHub webhook deliveries Telefonistka failed to handle.\n" +
+			"Failed deliveries are found with the GitHub App deliveries API and handled like the event command handles an event file.\n" +
+			"With --repo, PRs merged in the time range that have no promotion PR yet are handled as if their merge webhook was just received.",
+		Args: cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			replay(since, until, repos, skipDeliveries, all, dryRun)
+		},
+	}
+	replayCmd.Flags().StringVar(&since, "since", "24h", "Start of the time range, an RFC 3339 timestamp or a duration before now like 6h")
+	replayCmd.Flags().StringVar(&until, "until", "", "End of the time range, an RFC 3339 timestamp or a duration before now, defaults to now")
+	replayCmd.Flags().StringSliceVarP(&repos, "repo", "r", nil, "owner/repo to scan for merged PRs without a promotion PR, can be repeated")
+	replayCmd.Flags().BoolVar(&skipDeliveries, "skip-deliveries", false, "Don't replay webhook deliveries, only scan the --repo repositories")
+	replayCmd.Flags().BoolVar(&all, "all", false, "Replay every webhook delivery in the time range, not only the failed ones")
+	replayCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Only log what would be replayed")
+	rootCmd.AddCommand(replayCmd)
+}
+
+// parseReplayTime accepts an RFC 3339 timestamp or a duration before now
+func parseReplayTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return now, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 timestamp nor a duration", s)
+	}
+	return t, nil
+}
+
+func replay(since string, until string, repos []string, skipDeliveries bool, all bool, dryRun bool) {
+	now := time.Now()
+	opts := githubapi.ReplayOptions{All: all, DryRun: dryRun}
+	var err error
+	if opts.Since, err = parseReplayTime(since, now); err != nil {
+		log.Fatalf("Invalid --since: %v", err)
+	}
+	if opts.Until, err = parseReplayTime(until, now); err != nil {
+		log.Fatalf("Invalid --until: %v", err)
+	}
+	if !opts.Until.After(opts.Since) {
+		log.Fatalf("--until %s must be after --since %s", opts.Until.Format(time.RFC3339), opts.Since.Format(time.RFC3339))
+	}
+
+	mainGhClientCache, _ := lru.New[string, githubapi.GhClientPair](128)
+	prApproverGhClientCache, _ := lru.New[string, githubapi.GhClientPair](128)
+	ctx := context.Background()
+	failed := false
+	if !skipDeliveries {
+		if err := githubapi.ReplayHookDeliveries(ctx, opts, mainGhClientCache, prApproverGhClientCache); err != nil {
+			log.Errorf("Replaying webhook deliveries failed: %v", err)
+			failed = true
+		}
+	}
+	for _, repo := range repos {
+		owner, name, ok := strings.Cut(repo, "/")
+		if !ok || owner == "" || name == "" {
+			log.Errorf("Invalid --repo %q, expected owner/repo", repo)
+			failed = true
+			continue
+		}
+		if err := githubapi.ReplayMergedPrs(ctx, owner, name, opts, mainGhClientCache, prApproverGhClientCache); err != nil {
+			log.Errorf("Replaying merged PRs of %s failed: %v", repo, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -1,8 +1,12 @@
 package telefonistka
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexliesenfeld/health"
@@ -10,6 +14,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
 	"github.com/wayfair-incubator/telefonistka/internal/pkg/githubapi"
 )
 
@@ -36,9 +43,9 @@ func init() { //nolint:gochecknoinits
 	rootCmd.AddCommand(serveCmd)
 }
 
-func handleWebhook(githubWebhookSecret []byte, mainGhClientCache *lru.Cache[string, githubapi.GhClientPair], prApproverGhClientCache *lru.Cache[string, githubapi.GhClientPair]) func(http.ResponseWriter, *http.Request) {
+func handleWebhook(githubWebhookSecret []byte, eventQueue githubapi.EventEnqueuer) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		err := githubapi.ReciveWebhook(r, mainGhClientCache, prApproverGhClientCache, githubWebhookSecret)
+		err := githubapi.ReciveWebhook(r, eventQueue, githubWebhookSecret)
 		if err != nil {
 			log.Errorf("error handling webhook: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -48,10 +55,50 @@ func handleWebhook(githubWebhookSecret []byte, mainGhClientCache *lru.Cache[stri
 	}
 }
 
+func newEventQueue() *eventqueue.FileQueue {
+	opts := eventqueue.DefaultOptions()
+	if v := getEnv("EVENT_QUEUE_MAX_ATTEMPTS", ""); v != "" {
+		maxAttempts, err := strconv.Atoi(v)
+		if err != nil || maxAttempts < 1 {
+			log.Fatalf("EVENT_QUEUE_MAX_ATTEMPTS must be a positive integer, got %q", v)
+		}
+		opts.MaxAttempts = maxAttempts
+	}
+	// Queued events and held merges are only as durable as this directory, so there is no default
+	eventQueueDir := getCrucialEnv("EVENT_QUEUE_DIR")
+	if isUnderDir(eventQueueDir, os.TempDir()) {
+		log.Warnf("EVENT_QUEUE_DIR(%s) is in the temporary directory, queued events and merges held for a deployment window are lost on restart unless it's a persistent volume", eventQueueDir)
+	}
+	eventQueue, err := eventqueue.NewFileQueue(eventQueueDir, opts)
+	if err != nil {
+		log.Fatalf("Failed to open event queue: %v", err)
+	}
+	return eventQueue
+}
+
+func isUnderDir(path string, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func serve() {
 	githubWebhookSecret := []byte(getCrucialEnv("GITHUB_WEBHOOK_SECRET"))
 	livenessChecker := health.NewChecker() // No checks for the moment, other then the http server availability
-	readinessChecker := health.NewChecker()
+	// Only deployments that point Telefonistka at ArgoCD instances depend on them being reachable
+	argoCdClientManagers := argocd.StartClientManagers()
+	readinessCheckerOptions := []health.CheckerOption{}
+	for instance, argoCdClientManager := range argoCdClientManagers {
+		checkName := "argocd"
+		if instance.Name != "" {
+			checkName = "argocd-" + instance.Name
+		}
+		readinessCheckerOptions = append(readinessCheckerOptions, health.WithPeriodicCheck(30*time.Second, 0, health.Check{
+			Name:    checkName,
+			Timeout: 10 * time.Second,
+			Check:   argoCdClientManager.Check,
+		}))
+	}
+	readinessChecker := health.NewChecker(readinessCheckerOptions...)
 
 	// mainGhClientCache := map[string]githubapi.GhClientPair{} //GH apps use a per-account/org client
 	mainGhClientCache, _ := lru.New[string, githubapi.GhClientPair](128)
@@ -59,8 +106,26 @@ func serve() {
 
 	go githubapi.MainGhMetricsLoop(mainGhClientCache)
 
+	if indexApps, _ := strconv.ParseBool(getEnv("ARGOCD_APP_INDEX", "false")); indexApps {
+		// The default instance is indexed even without ARGOCD_SERVER_ADDR, it has a default address
+		indexedInstances := []configuration.ArgocdInstance{{}}
+		for instance := range argoCdClientManagers {
+			if instance.Name != "" {
+				indexedInstances = append(indexedInstances, instance)
+			}
+		}
+		for _, instance := range indexedInstances {
+			if err := argocd.StartAppIndex(context.Background(), instance); err != nil {
+				log.Errorf("Failed to start the ArgoCD instance %q application index, applications will be looked up with the ArgoCD API: %v", instance.Name, err)
+			}
+		}
+	}
+
+	eventQueue := newEventQueue()
+	go eventQueue.Run(context.Background(), githubapi.NewEventHandler(mainGhClientCache, prApproverGhClientCache, eventQueue))
+
 	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", handleWebhook(githubWebhookSecret, mainGhClientCache, prApproverGhClientCache))
+	mux.HandleFunc("/webhook", handleWebhook(githubWebhookSecret, eventQueue))
 	mux.Handle("/metrics", promhttp.Handler())
 	mux.Handle("/live", health.NewHandler(livenessChecker))
 	mux.Handle("/ready", health.NewHandler(readinessChecker))
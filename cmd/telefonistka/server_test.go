@@ -0,0 +1,32 @@
+package telefonistka
+
+import (
+	"testing"
+)
+
+func TestIsUnderDir(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		path string
+		dir  string
+		want bool
+	}{
+		{name: "Sub directory", path: "/tmp/telefonistka-events", dir: "/tmp", want: true},
+		{name: "Same directory", path: "/tmp/", dir: "/tmp", want: true},
+		{name: "Other directory", path: "/var/lib/telefonistka", dir: "/tmp", want: false},
+		{name: "Sibling with the same prefix", path: "/tmpfs/events", dir: "/tmp", want: false},
+		{name: "Relative path escaping the directory", path: "/tmp/../data", dir: "/tmp", want: false},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isUnderDir(tt.path, tt.dir); got != tt.want {
+				t.Errorf("isUnderDir(%q, %q) = %v, want %v", tt.path, tt.dir, got, tt.want)
+			}
+		})
+	}
+}
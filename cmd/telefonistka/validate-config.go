@@ -0,0 +1,50 @@
+package telefonistka
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+// This is still(https://github.com/spf13/cobra/issues/1862) the documented way to use cobra
+func init() { //nolint:gochecknoinits
+	var file string
+	var component bool
+	validateCmd := &cobra.Command{
+		Use:   "validate-config",
+		Short: "Validate a Telefonistka configuration file",
+		Long:  "Validate a Telefonistka configuration file.\nUnknown keys, invalid regexes, empty targetPaths and overlapping sourcePaths are reported with their line numbers.",
+		Args:  cobra.ExactArgs(0),
+		Run: func(cmd *cobra.Command, args []string) {
+			validateConfig(file, component)
+		},
+	}
+	validateCmd.Flags().StringVarP(&file, "file", "f", "telefonistka.yaml", "Configuration file path.")
+	validateCmd.Flags().BoolVar(&component, "component", false, "Validate the file as a component level configuration file, defaults to false.")
+	rootCmd.AddCommand(validateCmd)
+}
+
+func validateConfig(file string, component bool) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		log.Errorf("Failed to read file %s, %v", file, err)
+		os.Exit(1)
+	}
+
+	var validationErrors cfg.ValidationErrors
+	if component {
+		validationErrors = cfg.ValidateComponentConfig(string(b))
+	} else {
+		validationErrors = cfg.ValidateConfig(string(b))
+	}
+
+	if len(validationErrors) > 0 {
+		for _, e := range validationErrors {
+			log.Errorf("%s: %s", file, e)
+		}
+		os.Exit(1)
+	}
+	log.Infof("%s is valid", file)
+}
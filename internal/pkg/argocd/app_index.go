@@ -0,0 +1,291 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/cenkalti/backoff/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	componentPathSHA1Label          = "telefonistka.io/component-path-sha1"
+	manifestGeneratePathsAnnotation = "argocd.argoproj.io/manifest-generate-paths"
+	// appIndexResyncPeriod bounds how long changes the watch stream didn't deliver, like the ones made between the listing and the start of the watch, stay out of the index
+	appIndexResyncPeriod = 30 * time.Minute
+)
+
+// errAppIndexResync ends a listAndWatch cycle that reached the resync period without errors
+var errAppIndexResync = errors.New("application index resync period reached")
+
+// appIndex is an in-process index of ArgoCD applications by their component path SHA1 label and manifest-generate-paths annotation.
+// It's populated by listing all applications and kept fresh with the ArgoCD application watch stream, so discovery doesn't list every application of the repo on every PR event.
+// The full listing is repeated every resyncPeriod to pick up changes the watch stream missed.
+type appIndex struct {
+	// instance is the ArgoCD instance name used in logs, empty for the default instance
+	instance  string
+	appClient application.ApplicationServiceClient
+	// resyncPeriod is how long a watch stream is followed before all applications are listed again
+	resyncPeriod time.Duration
+	// clients, when set, provides a fresh appClient before every listing so the index follows reconnections of the shared client manager
+	clients func() (argoCdClients, error)
+
+	mu sync.RWMutex
+	// synced is false until the initial listing is done and while the watch stream is down, lookups fall back to the ArgoCD API meanwhile
+	synced bool
+	// apps is keyed by namespace/name
+	apps           map[string]*argoappv1.Application
+	bySHA1Label    map[string]map[string]struct{}
+	byManifestPath map[string]map[string]struct{}
+}
+
+var (
+	activeAppIndexesMu sync.RWMutex
+	// activeAppIndexes is keyed by the instance environment variable suffix, like the shared client managers
+	activeAppIndexes = map[string]*appIndex{}
+)
+
+// StartAppIndex starts indexing the applications of an ArgoCD instance in the background until ctx is done.
+// Application discovery for diffs, branch sync and the decision to create temporary apps uses the index of the component's instance once it's synced.
+func StartAppIndex(ctx context.Context, instance configuration.ArgocdInstance) error {
+	ac, err := GetInstanceClients(instance)
+	if err != nil {
+		return fmt.Errorf("Error creating ArgoCD clients: %w", err)
+	}
+	idx := newAppIndex(ac.app)
+	idx.instance = instance.Name
+	if m := getSharedClientManager(instance); m != nil {
+		idx.clients = m.Clients
+	}
+	activeAppIndexesMu.Lock()
+	activeAppIndexes[instance.EnvSuffix()] = idx
+	activeAppIndexesMu.Unlock()
+	go idx.run(ctx)
+	return nil
+}
+
+func getActiveAppIndex(instance configuration.ArgocdInstance) *appIndex {
+	activeAppIndexesMu.RLock()
+	defer activeAppIndexesMu.RUnlock()
+	return activeAppIndexes[instance.EnvSuffix()]
+}
+
+func newAppIndex(appClient application.ApplicationServiceClient) *appIndex {
+	return &appIndex{
+		appClient:      appClient,
+		resyncPeriod:   appIndexResyncPeriod,
+		apps:           map[string]*argoappv1.Application{},
+		bySHA1Label:    map[string]map[string]struct{}{},
+		byManifestPath: map[string]map[string]struct{}{},
+	}
+}
+
+func (idx *appIndex) run(ctx context.Context) {
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = 5 * time.Minute
+	b.MaxElapsedTime = 0
+	for {
+		err := idx.listAndWatch(ctx, b.Reset)
+		if errors.Is(err, errAppIndexResync) {
+			// The index keeps serving lookups until the new listing replaces it
+			log.Debugf("Re-listing ArgoCD instance %q applications after %s", idx.instance, idx.resyncPeriod)
+			continue
+		}
+		idx.mu.Lock()
+		idx.synced = false
+		idx.mu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		wait := b.NextBackOff()
+		log.Errorf("ArgoCD instance %q application index watch failed, re-listing applications in %s: %v", idx.instance, wait, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// listAndWatch lists all applications and applies the watch events that follow the listing, it returns when the watch stream breaks or errAppIndexResync once resyncPeriod passed.
+func (idx *appIndex) listAndWatch(ctx context.Context, onSynced func()) error {
+	if idx.clients != nil {
+		ac, err := idx.clients()
+		if err != nil {
+			return err
+		}
+		idx.appClient = ac.app
+	}
+	listStart := time.Now()
+	list, err := idx.appClient.List(ctx, &application.ApplicationQuery{})
+	if err != nil {
+		return fmt.Errorf("listing applications: %w", err)
+	}
+	idx.replace(list.Items)
+	log.Infof("Indexed %d ArgoCD instance %q applications in %v ms", len(list.Items), idx.instance, time.Since(listStart).Milliseconds())
+	onSynced()
+
+	// Events of applications that didn't change since the listing are skipped by the ArgoCD server
+	watchCtx, cancel := context.WithTimeout(ctx, idx.resyncPeriod)
+	defer cancel()
+	stream, err := idx.appClient.Watch(watchCtx, &application.ApplicationQuery{ResourceVersion: &list.ResourceVersion})
+	if err != nil {
+		return fmt.Errorf("watching applications: %w", err)
+	}
+	for {
+		event, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(watchCtx.Err(), context.DeadlineExceeded) {
+				return errAppIndexResync
+			}
+			return fmt.Errorf("receiving application watch event: %w", err)
+		}
+		if event == nil {
+			return errors.New("application watch stream closed")
+		}
+		idx.apply(event)
+	}
+}
+
+func appKey(app *argoappv1.Application) string {
+	return app.Namespace + "/" + app.Name
+}
+
+// manifestPathKeys returns the paths the app is indexed under, relative manifest-generate-paths elements are resolved against every source path since the source of the PR repo isn't known yet.
+func manifestPathKeys(app *argoappv1.Application) []string {
+	keys := []string{}
+	for _, element := range strings.Split(app.Annotations[manifestGeneratePathsAnnotation], ";") {
+		if element == "" {
+			continue
+		}
+		if !strings.HasPrefix(element, ".") {
+			keys = append(keys, filepath.Clean(element))
+			continue
+		}
+		sources := app.Spec.GetSources()
+		if len(sources) == 0 {
+			keys = append(keys, filepath.Clean(element))
+		}
+		for _, source := range sources {
+			keys = append(keys, filepath.Join(source.Path, element))
+		}
+	}
+	return keys
+}
+
+func addToIndex(index map[string]map[string]struct{}, value string, key string) {
+	if index[value] == nil {
+		index[value] = map[string]struct{}{}
+	}
+	index[value][key] = struct{}{}
+}
+
+func removeFromIndex(index map[string]map[string]struct{}, value string, key string) {
+	delete(index[value], key)
+	if len(index[value]) == 0 {
+		delete(index, value)
+	}
+}
+
+func (idx *appIndex) addLocked(app *argoappv1.Application) {
+	key := appKey(app)
+	idx.removeLocked(key)
+	idx.apps[key] = app
+	if sha1, ok := app.Labels[componentPathSHA1Label]; ok {
+		addToIndex(idx.bySHA1Label, sha1, key)
+	}
+	for _, p := range manifestPathKeys(app) {
+		addToIndex(idx.byManifestPath, p, key)
+	}
+}
+
+func (idx *appIndex) removeLocked(key string) {
+	app, ok := idx.apps[key]
+	if !ok {
+		return
+	}
+	delete(idx.apps, key)
+	if sha1, ok := app.Labels[componentPathSHA1Label]; ok {
+		removeFromIndex(idx.bySHA1Label, sha1, key)
+	}
+	for _, p := range manifestPathKeys(app) {
+		removeFromIndex(idx.byManifestPath, p, key)
+	}
+}
+
+func (idx *appIndex) replace(apps []argoappv1.Application) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.apps = map[string]*argoappv1.Application{}
+	idx.bySHA1Label = map[string]map[string]struct{}{}
+	idx.byManifestPath = map[string]map[string]struct{}{}
+	for i := range apps {
+		idx.addLocked(&apps[i])
+	}
+	idx.synced = true
+}
+
+func (idx *appIndex) apply(event *argoappv1.ApplicationWatchEvent) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	app := event.Application
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		idx.addLocked(&app)
+	case watch.Deleted:
+		idx.removeLocked(appKey(&app))
+	}
+}
+
+// find returns the applications of componentPath, ok is false when the index isn't synced and the ArgoCD API should be used instead.
+// Matches are filtered by repo the same way the ArgoCD server and listRepoApps do, multi-source apps that don't have repo as their first source are only returned when no other app matches.
+func (idx *appIndex) find(componentPath string, repo string, useSHALabelForArgoDicovery bool) (apps []argoappv1.Application, ok bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	if !idx.synced {
+		return nil, false
+	}
+
+	candidates := map[string]struct{}{}
+	if useSHALabelForArgoDicovery {
+		candidates = idx.bySHA1Label[componentPathSHA1(componentPath)]
+	} else {
+		// An app matches when one of its manifest paths is componentPath or one of its parent directories
+		for p := filepath.Clean(componentPath); ; p = filepath.Dir(p) {
+			for key := range idx.byManifestPath[p] {
+				candidates[key] = struct{}{}
+			}
+			if p == "." || p == "/" {
+				break
+			}
+		}
+	}
+
+	for _, multiSource := range []bool{false, true} {
+		for key := range candidates {
+			app := idx.apps[key]
+			if !appMatchesRepoFilter(app, repo, multiSource) {
+				continue
+			}
+			if !useSHALabelForArgoDicovery && !appMatchesManifestPaths(app, componentPath, repo) {
+				continue
+			}
+			apps = append(apps, *app.DeepCopy())
+		}
+		if len(apps) > 0 {
+			break
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return appKey(&apps[i]) < appKey(&apps[j]) })
+	return apps, true
+}
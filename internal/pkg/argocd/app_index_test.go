@@ -0,0 +1,239 @@
+package argocd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/mocks"
+	"google.golang.org/grpc"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const indexTestRepo = "https://github.com/AnOwner/gitops"
+
+func indexedApp(name string, annotation string, sourcePath string) argoappv1.Application {
+	app := argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd"},
+		Spec:       argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{RepoURL: indexTestRepo, Path: sourcePath}},
+	}
+	if annotation != "" {
+		app.Annotations = map[string]string{manifestGeneratePathsAnnotation: annotation}
+	}
+	return app
+}
+
+func appNames(apps []argoappv1.Application) []string {
+	names := []string{}
+	for _, app := range apps {
+		names = append(names, app.Name)
+	}
+	return names
+}
+
+func TestAppIndexFind(t *testing.T) {
+	t.Parallel()
+	labeledApp := func(name string, componentPath string) argoappv1.Application {
+		app := indexedApp(name, "", componentPath)
+		app.Labels = map[string]string{componentPathSHA1Label: componentPathSHA1(componentPath)}
+		return app
+	}
+	otherRepoApp := indexedApp("other-repo", "clusters/prod/foo", "clusters/prod/foo")
+	otherRepoApp.Spec.Source.RepoURL = "https://github.com/AnOwner/other"
+	multiSource := multiSourceApp("multi-source")
+	multiSource.Namespace = "argocd"
+
+	idx := newAppIndex(nil)
+	idx.replace([]argoappv1.Application{
+		indexedApp("foo", "clusters/prod/foo", "clusters/prod/foo"),
+		indexedApp("foo-relative", ".", "clusters/prod/foo"),
+		indexedApp("prod-wide", "/unrelated;clusters/prod", "clusters/prod"),
+		indexedApp("no-annotation", "", "clusters/prod/bar"),
+		labeledApp("bar-cluster-a", "clusters/prod/bar"),
+		labeledApp("bar-cluster-b", "clusters/prod/bar"),
+		otherRepoApp,
+		multiSource,
+	})
+
+	tests := map[string]struct {
+		componentPath   string
+		useSHALabel     bool
+		expectedAppsIDs []string
+	}{
+		"Annotation, exact, relative and parent paths": {
+			componentPath:   "clusters/prod/foo",
+			expectedAppsIDs: []string{"foo", "foo-relative", "prod-wide"},
+		},
+		"Annotation, apps without the annotation don't match": {
+			componentPath:   "clusters/prod/bar",
+			expectedAppsIDs: []string{"prod-wide"},
+		},
+		"Annotation, no match": {
+			componentPath:   "clusters/staging/foo",
+			expectedAppsIDs: []string{},
+		},
+		"SHA1 label, all apps of the component": {
+			componentPath:   "clusters/prod/bar",
+			useSHALabel:     true,
+			expectedAppsIDs: []string{"bar-cluster-a", "bar-cluster-b"},
+		},
+		"SHA1 label, no match": {
+			componentPath:   "clusters/prod/foo",
+			useSHALabel:     true,
+			expectedAppsIDs: []string{},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			apps, ok := idx.find(tc.componentPath, indexTestRepo, tc.useSHALabel)
+			assert.True(t, ok)
+			assert.Equal(t, tc.expectedAppsIDs, appNames(apps))
+		})
+	}
+
+	// The multi-source app takes clusters/prod/foo from a later source, the server repo filter wouldn't have returned it
+	multiSourceOnly := newAppIndex(nil)
+	multiSourceOnly.replace([]argoappv1.Application{multiSource, otherRepoApp})
+	apps, ok := multiSourceOnly.find("clusters/prod/foo", indexTestRepo, false)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"multi-source"}, appNames(apps))
+}
+
+func TestAppIndexNotSynced(t *testing.T) {
+	t.Parallel()
+	idx := newAppIndex(nil)
+	_, ok := idx.find("clusters/prod/foo", indexTestRepo, false)
+	assert.False(t, ok, "Lookups should fall back to the ArgoCD API until the index is synced")
+}
+
+type fakeWatchClient struct {
+	grpc.ClientStream
+	ctx    context.Context //nolint:containedctx
+	events chan *argoappv1.ApplicationWatchEvent
+}
+
+func (f *fakeWatchClient) Recv() (*argoappv1.ApplicationWatchEvent, error) {
+	select {
+	case e := <-f.events:
+		return e, nil
+	case <-f.ctx.Done():
+		return nil, f.ctx.Err()
+	}
+}
+
+func TestAppIndexWatch(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockApplicationClient := mocks.NewMockApplicationServiceClient(ctrl)
+	events := make(chan *argoappv1.ApplicationWatchEvent)
+
+	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "42"},
+		Items:    []argoappv1.Application{indexedApp("foo", "clusters/prod/foo", "clusters/prod/foo")},
+	}, nil)
+	mockApplicationClient.EXPECT().Watch(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, q *application.ApplicationQuery, _ ...grpc.CallOption) (application.ApplicationService_WatchClient, error) {
+		assert.Equal(t, "42", q.GetResourceVersion())
+		return &fakeWatchClient{ctx: ctx, events: events}, nil
+	})
+
+	idx := newAppIndex(mockApplicationClient)
+	done := make(chan error)
+	go func() { done <- idx.listAndWatch(ctx, func() {}) }()
+
+	// Sending on the unbuffered channel returns once the previous event was applied
+	events <- &argoappv1.ApplicationWatchEvent{Type: watch.Added, Application: indexedApp("foo-new-cluster", "clusters/prod/foo", "clusters/prod/foo")}
+	events <- &argoappv1.ApplicationWatchEvent{Type: watch.Modified, Application: indexedApp("foo", "clusters/prod/moved", "clusters/prod/moved")}
+	events <- &argoappv1.ApplicationWatchEvent{Type: watch.Deleted, Application: indexedApp("foo-new-cluster", "clusters/prod/foo", "clusters/prod/foo")}
+	events <- &argoappv1.ApplicationWatchEvent{Type: watch.Added, Application: indexedApp("bar", "clusters/prod/bar", "clusters/prod/bar")}
+
+	assert.Eventually(t, func() bool {
+		apps, _ := idx.find("clusters/prod/bar", indexTestRepo, false)
+		return len(apps) == 1
+	}, 5*time.Second, time.Millisecond)
+	apps, ok := idx.find("clusters/prod/foo", indexTestRepo, false)
+	assert.True(t, ok)
+	assert.Empty(t, apps)
+	apps, _ = idx.find("clusters/prod/moved", indexTestRepo, false)
+	assert.Equal(t, []string{"foo"}, appNames(apps))
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestAppIndexResync(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockApplicationClient := mocks.NewMockApplicationServiceClient(ctrl)
+
+	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "42"},
+		Items:    []argoappv1.Application{indexedApp("foo", "clusters/prod/foo", "clusters/prod/foo")},
+	}, nil)
+	// bar was created before the watch started, so its event was never sent
+	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{
+		ListMeta: metav1.ListMeta{ResourceVersion: "43"},
+		Items: []argoappv1.Application{
+			indexedApp("foo", "clusters/prod/foo", "clusters/prod/foo"),
+			indexedApp("bar", "clusters/prod/bar", "clusters/prod/bar"),
+		},
+	}, nil).AnyTimes()
+	mockApplicationClient.EXPECT().Watch(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, _ *application.ApplicationQuery, _ ...grpc.CallOption) (application.ApplicationService_WatchClient, error) {
+		return &fakeWatchClient{ctx: ctx, events: make(chan *argoappv1.ApplicationWatchEvent)}, nil
+	}).AnyTimes()
+
+	idx := newAppIndex(mockApplicationClient)
+	idx.resyncPeriod = 10 * time.Millisecond
+	done := make(chan struct{})
+	go func() {
+		idx.run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool {
+		apps, _ := idx.find("clusters/prod/bar", indexTestRepo, false)
+		return len(apps) == 1
+	}, 5*time.Second, time.Millisecond, "Applications the watch stream missed should be indexed by the next listing")
+	_, ok := idx.find("clusters/prod/foo", indexTestRepo, false)
+	assert.True(t, ok, "The index should stay synced across resyncs")
+
+	cancel()
+	<-done
+}
+
+func TestFindArgocdAppsUsesTheIndexOfTheInstance(t *testing.T) {
+	t.Parallel()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	idx := newAppIndex(nil)
+	idx.replace([]argoappv1.Application{indexedApp("foo-eu", "clusters/prod/foo", "clusters/prod/foo")})
+	activeAppIndexesMu.Lock()
+	activeAppIndexes[configuration.ArgocdInstance{Name: "index-test-eu"}.EnvSuffix()] = idx
+	activeAppIndexesMu.Unlock()
+
+	apps, err := findArgocdApps(context.Background(), "clusters/prod/foo", indexTestRepo, argoCdClients{instance: "index-test-eu"}, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"foo-eu"}, appNames(apps))
+	}
+
+	// Other instances aren't looked up in the index of another instance
+	mockApplicationClient := mocks.NewMockApplicationServiceClient(ctrl)
+	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{}, nil).AnyTimes()
+	apps, err = findArgocdApps(context.Background(), "clusters/prod/foo", indexTestRepo, argoCdClients{instance: "index-test-us", app: mockApplicationClient}, false)
+	if assert.NoError(t, err) {
+		assert.Empty(t, apps)
+	}
+}
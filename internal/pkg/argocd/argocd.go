@@ -5,12 +5,17 @@ import (
 	"crypto/sha1" //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/argoproj/argo-cd/v2/applicationset/utils"
@@ -23,9 +28,12 @@ import (
 	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	argodiff "github.com/argoproj/argo-cd/v2/util/argo/diff"
 	"github.com/argoproj/argo-cd/v2/util/argo/normalizers"
+	"github.com/argoproj/argo-cd/v2/util/git"
+	gitopsdiff "github.com/argoproj/gitops-engine/pkg/diff"
 	"github.com/argoproj/gitops-engine/pkg/sync/hook"
 	log "github.com/sirupsen/logrus"
 	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd/diff"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
 	yaml2 "gopkg.in/yaml.v2"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
@@ -34,10 +42,12 @@ import (
 const ctxLines = 10
 
 type argoCdClients struct {
-	app     application.ApplicationServiceClient
-	project projectpkg.ProjectServiceClient
-	setting settings.SettingsServiceClient
-	appSet  applicationsetpkg.ApplicationSetServiceClient
+	// instance is the name of the ArgoCD instance the clients talk to, empty for the default instance
+	instance string
+	app      application.ApplicationServiceClient
+	project  projectpkg.ProjectServiceClient
+	setting  settings.SettingsServiceClient
+	appSet   applicationsetpkg.ApplicationSetServiceClient
 }
 
 // DiffElement struct to store diff element details, this represents a single k8s object
@@ -46,11 +56,29 @@ type DiffElement struct {
 	ObjectName      string
 	ObjectKind      string
 	ObjectNamespace string
-	Diff            string
+	// ChangeType is one of the ChangeType* constants, it's empty for objects that don't change
+	ChangeType string
+	Diff       string
+	// ChangedFields are the changed field paths of semantic diffs without their values, the concise diff comment lists them
+	ChangedFields []string
+	// LiveReplicas and TargetReplicas are the spec.replicas of the object, nil when it's not set or the object doesn't exist
+	LiveReplicas   *int64
+	TargetReplicas *int64
+	// ImageChanged and ResourceRequestsChanged are set for modified objects whose container images or resource requests change
+	ImageChanged            bool
+	ResourceRequestsChanged bool
 }
 
+const (
+	ChangeTypeAdded    = "added"
+	ChangeTypeRemoved  = "removed"
+	ChangeTypeModified = "modified"
+)
+
 // DiffResult struct to store diff result
 type DiffResult struct {
+	// ArgoCdInstance is the name of the ArgoCD instance of the app, empty for the default instance
+	ArgoCdInstance           string
 	ComponentPath            string
 	ArgoCdAppName            string
 	ArgoCdAppURL             string
@@ -59,14 +87,34 @@ type DiffResult struct {
 	DiffError                error
 	AppWasTemporarilyCreated bool
 	AppSyncedFromPRBranch    bool
+	// IgnoredResources counts the objects whose changes are all ignored by the app or component ignoreDifferences, they are hidden from the diff
+	IgnoredResources int
+	// UnfilteredChanges are the changed objects compared without ignoreDifferences and without diff content.
+	// Diff policies and blocked kinds are checked against them, so ignoreDifferences set in the PR branch can't hide changes from them.
+	UnfilteredChanges []DiffElement
+	// DiffFormat is the format of the DiffElements diffs, one of the configuration.DiffFormat* constants, empty when the diff content is redacted
+	DiffFormat string
+	Stats      DiffStats
+}
+
+// DiffSettings control how the ArgoCD apps of a component are diffed
+type DiffSettings struct {
+	// IgnoreDifferences of the component are applied on top of the app ignoreDifferences
+	IgnoreDifferences []configuration.IgnoreDifference
+	// RedactionRules are applied on top of the built-in secret redaction rules
+	RedactionRules []configuration.RedactionRule
+	// DiffFormat is one of the configuration.DiffFormat* constants, empty for configuration.DiffFormatUnified
+	DiffFormat string
 }
 
 // Mostly copied from  https://github.com/argoproj/argo-cd/blob/4f6a8dce80f0accef7ed3b5510e178a6b398b331/cmd/argocd/commands/app.go#L1255C6-L1338
 // But instead of printing the diff to stdout, we return it as a string in a struct so we can format it in a nice PR comment.
-func generateArgocdAppDiff(ctx context.Context, keepDiffData bool, app *argoappv1.Application, proj *argoappv1.AppProject, resources *application.ManagedResourcesResponse, argoSettings *settings.Settings, diffOptions *DifferenceOption) (foundDiffs bool, diffElements []DiffElement, err error) {
+// ignoredResources counts the objects that only have differences ignored by the app or diffSettings ignoreDifferences.
+// unfilteredChanges are the changed objects compared without any ignoreDifferences, they carry no diff content.
+func generateArgocdAppDiff(ctx context.Context, keepDiffData bool, app *argoappv1.Application, proj *argoappv1.AppProject, resources *application.ManagedResourcesResponse, argoSettings *settings.Settings, diffOptions *DifferenceOption, diffSettings DiffSettings) (foundDiffs bool, diffElements []DiffElement, unfilteredChanges []DiffElement, ignoredResources int, err error) {
 	liveObjs, err := cmdutil.LiveObjects(resources.Items)
 	if err != nil {
-		return false, nil, fmt.Errorf("Failed to get live objects: %w", err)
+		return false, nil, nil, 0, fmt.Errorf("Failed to get live objects: %w", err)
 	}
 
 	items := make([]objKeyLiveTarget, 0)
@@ -74,19 +122,20 @@ func generateArgocdAppDiff(ctx context.Context, keepDiffData bool, app *argoappv
 	for _, mfst := range diffOptions.res.Manifests {
 		obj, err := argoappv1.UnmarshalToUnstructured(mfst)
 		if err != nil {
-			return false, nil, fmt.Errorf("Failed to unmarshal manifest: %w", err)
+			return false, nil, nil, 0, fmt.Errorf("Failed to unmarshal manifest: %w", err)
 		}
 		unstructureds = append(unstructureds, obj)
 	}
 	groupedObjs, err := groupObjsByKey(unstructureds, liveObjs, app.Spec.Destination.Namespace)
 	if err != nil {
-		return false, nil, fmt.Errorf("Failed to group objects by key: %w", err)
+		return false, nil, nil, 0, fmt.Errorf("Failed to group objects by key: %w", err)
 	}
 	items, err = groupObjsForDiff(resources, groupedObjs, items, argoSettings, app.InstanceName(argoSettings.ControllerNamespace), app.Spec.Destination.Namespace)
 	if err != nil {
-		return false, nil, fmt.Errorf("Failed to group objects for diff: %w", err)
+		return false, nil, nil, 0, fmt.Errorf("Failed to group objects for diff: %w", err)
 	}
 
+	ignoreDifferences := append(slices.Clone(app.Spec.IgnoreDifferences), argoIgnoreDifferences(diffSettings.IgnoreDifferences)...)
 	for _, item := range items {
 		var diffElement DiffElement
 		if item.target != nil && hook.IsHook(item.target) || item.live != nil && hook.IsHook(item.live) {
@@ -98,56 +147,156 @@ func generateArgocdAppDiff(ctx context.Context, keepDiffData bool, app *argoappv
 			overrides[k] = *val
 		}
 
-		ignoreAggregatedRoles := false
-		ignoreNormalizerOpts := normalizers.IgnoreNormalizerOpts{}
-		diffConfig, err := argodiff.NewDiffConfigBuilder().
-			WithDiffSettings(app.Spec.IgnoreDifferences, overrides, ignoreAggregatedRoles, ignoreNormalizerOpts).
-			WithTracking(argoSettings.AppLabelKey, argoSettings.TrackingMethod).
-			WithNoCache().
-			Build()
+		diffConfig, err := buildDiffConfig(ignoreDifferences, overrides, argoSettings)
 		if err != nil {
-			return false, nil, fmt.Errorf("Failed to build diff config: %w", err)
+			return false, nil, nil, 0, fmt.Errorf("Failed to build diff config: %w", err)
 		}
 		diffRes, err := argodiff.StateDiff(item.live, item.target, diffConfig)
 		if err != nil {
-			return false, nil, fmt.Errorf("Failed to diff objects: %w", err)
+			return false, nil, nil, 0, fmt.Errorf("Failed to diff objects: %w", err)
+		}
+		unfilteredDiffRes := diffRes
+		if item.target != nil && item.live != nil && len(ignoreDifferences) > 0 {
+			// Diffing again without the ignoreDifferences tells whether the object is unchanged or only has ignored differences,
+			// it also keeps the ignored changes visible to the diff policies and blocked kinds
+			unfilteredDiffConfig, err := buildDiffConfig(nil, overrides, argoSettings)
+			if err != nil {
+				return false, nil, nil, 0, fmt.Errorf("Failed to build diff config: %w", err)
+			}
+			unfilteredDiffRes, err = argodiff.StateDiff(item.live, item.target, unfilteredDiffConfig)
+			if err != nil {
+				return false, nil, nil, 0, fmt.Errorf("Failed to diff objects: %w", err)
+			}
+			if !diffRes.Modified && unfilteredDiffRes.Modified {
+				ignoredResources++
+			}
+		}
+		if unfilteredDiffRes.Modified || item.target == nil || item.live == nil {
+			unfilteredChange, _, _, err := changedObject(item, unfilteredDiffRes)
+			if err != nil {
+				return false, nil, nil, 0, err
+			}
+			unfilteredChanges = append(unfilteredChanges, unfilteredChange)
 		}
 
 		if diffRes.Modified || item.target == nil || item.live == nil {
-			diffElement.ObjectGroup = item.key.Group
-			diffElement.ObjectKind = item.key.Kind
-			diffElement.ObjectNamespace = item.key.Namespace
-			diffElement.ObjectName = item.key.Name
-
 			var live *unstructured.Unstructured
 			var target *unstructured.Unstructured
-			if item.target != nil && item.live != nil {
-				target = &unstructured.Unstructured{}
-				live = item.live
-				err = json.Unmarshal(diffRes.PredictedLive, target)
-				if err != nil {
-					return false, nil, fmt.Errorf("Failed to unmarshal predicted live object: %w", err)
-				}
-			} else {
-				live = item.live
-				target = item.target
+			diffElement, live, target, err = changedObject(item, diffRes)
+			if err != nil {
+				return false, nil, nil, 0, err
 			}
 			if !foundDiffs {
 				foundDiffs = true
 			}
 
 			if keepDiffData {
-				diffElement.Diff, err = diffLiveVsTargetObject(live, target)
+				redactedLive, redactedTarget := redactObjects(live, target, diffSettings.RedactionRules)
+				if diffSettings.DiffFormat == configuration.DiffFormatSemantic {
+					diffElement.Diff, diffElement.ChangedFields = semanticDiff(redactedLive, redactedTarget)
+				} else {
+					diffElement.Diff, err = diffLiveVsTargetObject(redactedLive, redactedTarget)
+				}
 			} else {
 				diffElement.Diff = "✂️ ✂️  Redacted ✂️ ✂️ \nUnset component-level configuration key `disableArgoCDDiff` to see diff content."
 			}
 			if err != nil {
-				return false, nil, fmt.Errorf("Failed to diff live objects: %w", err)
+				return false, nil, nil, 0, fmt.Errorf("Failed to diff live objects: %w", err)
 			}
 		}
 		diffElements = append(diffElements, diffElement)
 	}
-	return foundDiffs, diffElements, nil
+	return foundDiffs, diffElements, unfilteredChanges, ignoredResources, nil
+}
+
+// changedObject describes the change of an added, removed or modified object without its diff content, it also returns the compared live and target objects.
+// The live and target objects of modified objects are normalized by diffRes, so the differences it ignores don't show up.
+func changedObject(item objKeyLiveTarget, diffRes gitopsdiff.DiffResult) (diffElement DiffElement, live *unstructured.Unstructured, target *unstructured.Unstructured, err error) {
+	diffElement.ObjectGroup = item.key.Group
+	diffElement.ObjectKind = item.key.Kind
+	diffElement.ObjectNamespace = item.key.Namespace
+	diffElement.ObjectName = item.key.Name
+	switch {
+	case item.live == nil:
+		diffElement.ChangeType = ChangeTypeAdded
+	case item.target == nil:
+		diffElement.ChangeType = ChangeTypeRemoved
+	default:
+		diffElement.ChangeType = ChangeTypeModified
+	}
+
+	if item.target != nil && item.live != nil {
+		// The normalized live object has the ignored differences removed, like the predicted live object, so they don't show up in the diff
+		live, err = unmarshalDiffObject(diffRes.NormalizedLive)
+		if err != nil {
+			return DiffElement{}, nil, nil, fmt.Errorf("Failed to unmarshal normalized live object: %w", err)
+		}
+		target, err = unmarshalDiffObject(diffRes.PredictedLive)
+		if err != nil {
+			return DiffElement{}, nil, nil, fmt.Errorf("Failed to unmarshal predicted live object: %w", err)
+		}
+	} else {
+		live = item.live
+		target = item.target
+	}
+	diffElement.LiveReplicas = objectReplicas(live)
+	diffElement.TargetReplicas = objectReplicas(target)
+	if diffElement.ChangeType == ChangeTypeModified {
+		diffElement.ImageChanged = containerFieldsChanged(live, target, "image")
+		diffElement.ResourceRequestsChanged = containerFieldsChanged(live, target, "resources", "requests")
+	}
+	return diffElement, live, target, nil
+}
+
+// buildDiffConfig builds the config of an ArgoCD diff that ignores ignoreDifferences on top of the ArgoCD resource overrides
+func buildDiffConfig(ignoreDifferences []argoappv1.ResourceIgnoreDifferences, overrides map[string]argoappv1.ResourceOverride, argoSettings *settings.Settings) (argodiff.DiffConfig, error) {
+	ignoreAggregatedRoles := false
+	ignoreNormalizerOpts := normalizers.IgnoreNormalizerOpts{}
+	return argodiff.NewDiffConfigBuilder().
+		WithDiffSettings(ignoreDifferences, overrides, ignoreAggregatedRoles, ignoreNormalizerOpts).
+		WithTracking(argoSettings.AppLabelKey, argoSettings.TrackingMethod).
+		WithNoCache().
+		Build()
+}
+
+// argoIgnoreDifferences converts component ignore rules to ArgoCD ignoreDifferences entries
+func argoIgnoreDifferences(ignoreRules []configuration.IgnoreDifference) []argoappv1.ResourceIgnoreDifferences {
+	ignoreDifferences := make([]argoappv1.ResourceIgnoreDifferences, 0, len(ignoreRules))
+	for _, rule := range ignoreRules {
+		ignoreDifferences = append(ignoreDifferences, argoappv1.ResourceIgnoreDifferences{
+			Group:                 rule.Group,
+			Kind:                  rule.Kind,
+			Name:                  rule.Name,
+			Namespace:             rule.Namespace,
+			JSONPointers:          rule.JSONPointers,
+			JQPathExpressions:     rule.JQPathExpressions,
+			ManagedFieldsManagers: rule.ManagedFieldsManagers,
+		})
+	}
+	return ignoreDifferences
+}
+
+// unmarshalDiffObject unmarshals an object of an ArgoCD diff result, it's nil when the object doesn't exist on that side of the diff
+func unmarshalDiffObject(data []byte) (*unstructured.Unstructured, error) {
+	if string(data) == "null" {
+		return nil, nil
+	}
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(data, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func objectReplicas(obj *unstructured.Unstructured) *int64 {
+	if obj == nil {
+		return nil
+	}
+	replicas, found, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !found || err != nil {
+		return nil
+	}
+	return &replicas
 }
 
 // diffLiveVsTargetObject returns the diff of live and target in a format that
@@ -172,43 +321,103 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// instanceEnvKey returns the name of the key environment variable of an ArgoCD instance, like ARGOCD_SERVER_ADDR_<NAME> for key ARGOCD_SERVER_ADDR.
+// The default instance uses key as is.
+func instanceEnvKey(instance configuration.ArgocdInstance, key string) string {
+	if instance.Name == "" {
+		return key
+	}
+	return key + "_" + instance.EnvSuffix()
+}
+
+// argoCdToken returns the authentication token of an ArgoCD instance, token files are re-read on every call so a rotated token is picked up without a restart.
+// The default instance uses ARGOCD_TOKEN_FILE/ARGOCD_TOKEN, named instances use ARGOCD_TOKEN_FILE_<NAME>/ARGOCD_TOKEN_<NAME>.
+func argoCdToken(instance configuration.ArgocdInstance) (string, error) {
+	tokenFileEnv, tokenEnv := instanceEnvKey(instance, "ARGOCD_TOKEN_FILE"), instanceEnvKey(instance, "ARGOCD_TOKEN")
+	if tokenFile := getEnv(tokenFileEnv, ""); tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("Error reading ArgoCD token file: %w", err)
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	return getEnv(tokenEnv, ""), nil
+}
+
+// CreateArgoCdClients creates new clients of the default ArgoCD instance, each with its own gRPC connection.
+// Long running processes should use GetArgoCdClients to reuse the connections of the shared client manager.
 func CreateArgoCdClients() (ac argoCdClients, err error) {
-	plaintext, _ := strconv.ParseBool(getEnv("ARGOCD_PLAINTEXT", "false"))
-	insecure, _ := strconv.ParseBool(getEnv("ARGOCD_INSECURE", "false"))
+	return createInstanceClients(configuration.ArgocdInstance{})
+}
+
+func createInstanceClients(instance configuration.ArgocdInstance) (ac argoCdClients, err error) {
+	token, err := argoCdToken(instance)
+	if err != nil {
+		return ac, err
+	}
+	ac, _, err = createArgoCdClients(instance, token)
+	return ac, err
+}
 
-	opts := &apiclient.ClientOptions{
-		ServerAddr: getEnv("ARGOCD_SERVER_ADDR", "localhost:8080"),
-		AuthToken:  getEnv("ARGOCD_TOKEN", ""),
+// argoCdClientOptions reads the endpoint of an ArgoCD instance from the server environment, the repo configuration only names the instance.
+// Named instances have no default address, an instance the server doesn't know about fails instead of sending its token elsewhere.
+func argoCdClientOptions(instance configuration.ArgocdInstance, authToken string) (*apiclient.ClientOptions, error) {
+	serverAddrEnv := instanceEnvKey(instance, "ARGOCD_SERVER_ADDR")
+	serverAddr := getEnv(serverAddrEnv, "")
+	if serverAddr == "" {
+		if instance.Name != "" {
+			return nil, fmt.Errorf("ArgoCD instance %q isn't configured, %s is not set", instance.Name, serverAddrEnv)
+		}
+		serverAddr = "localhost:8080"
+	}
+	plaintext, _ := strconv.ParseBool(getEnv(instanceEnvKey(instance, "ARGOCD_PLAINTEXT"), "false"))
+	insecure, _ := strconv.ParseBool(getEnv(instanceEnvKey(instance, "ARGOCD_INSECURE"), "false"))
+
+	return &apiclient.ClientOptions{
+		ServerAddr: serverAddr,
+		AuthToken:  authToken,
 		PlainText:  plaintext,
 		Insecure:   insecure,
-	}
+	}, nil
+}
 
-	client, err := apiclient.NewClient(opts)
+func createArgoCdClients(instance configuration.ArgocdInstance, authToken string) (ac argoCdClients, closers []io.Closer, err error) {
+	ac.instance = instance.Name
+	clientOptions, err := argoCdClientOptions(instance, authToken)
 	if err != nil {
-		return ac, fmt.Errorf("Error creating ArgoCD API client: %w", err)
+		return ac, nil, err
+	}
+	client, err := apiclient.NewClient(clientOptions)
+	if err != nil {
+		return ac, nil, fmt.Errorf("Error creating ArgoCD API client: %w", err)
 	}
 
-	_, ac.app, err = client.NewApplicationClient()
+	var closer io.Closer
+	closer, ac.app, err = client.NewApplicationClient()
 	if err != nil {
-		return ac, fmt.Errorf("Error creating ArgoCD app client: %w", err)
+		return ac, closers, fmt.Errorf("Error creating ArgoCD app client: %w", err)
 	}
+	closers = append(closers, closer)
 
-	_, ac.project, err = client.NewProjectClient()
+	closer, ac.project, err = client.NewProjectClient()
 	if err != nil {
-		return ac, fmt.Errorf("Error creating ArgoCD project client: %w", err)
+		return ac, closers, fmt.Errorf("Error creating ArgoCD project client: %w", err)
 	}
+	closers = append(closers, closer)
 
-	_, ac.setting, err = client.NewSettingsClient()
+	closer, ac.setting, err = client.NewSettingsClient()
 	if err != nil {
-		return ac, fmt.Errorf("Error creating ArgoCD settings client: %w", err)
+		return ac, closers, fmt.Errorf("Error creating ArgoCD settings client: %w", err)
 	}
+	closers = append(closers, closer)
 
-	_, ac.appSet, err = client.NewApplicationSetClient()
+	closer, ac.appSet, err = client.NewApplicationSetClient()
 	if err != nil {
-		return ac, fmt.Errorf("Error creating ArgoCD appSet client: %w", err)
+		return ac, closers, fmt.Errorf("Error creating ArgoCD appSet client: %w", err)
 	}
+	closers = append(closers, closer)
 
-	return
+	return ac, closers, nil
 }
 
 // This function will search for an ApplicationSet by the componentPath and repo name by comparing the componentPath with the ApplicationSet's spec.generators.[]git.directories
@@ -238,118 +447,226 @@ func findRelevantAppSetByPath(ctx context.Context, componentPath string, repo st
 	return nil, fmt.Errorf("No ArgoCD ApplicationSet found for component path %s(repo %s)", componentPath, repo)
 }
 
-// findArgocdAppBySHA1Label finds an ArgoCD application by the SHA1 label of the component path it's supposed to avoid performance issues with the "manifest-generate-paths" annotation method which requires pulling all ArgoCD applications(!) on every PR event.
-// The SHA1 label is assumed to be populated by the ApplicationSet controller(or apps of apps  or similar).
-func findArgocdAppBySHA1Label(ctx context.Context, componentPath string, repo string, appClient application.ApplicationServiceClient) (app *argoappv1.Application, err error) {
-	// Calculate sha1 of component path to use in a label selector
-	cPathBa := []byte(componentPath)
-	hasher := sha1.New() //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
-	hasher.Write(cPathBa)
-	componentPathSha1 := hex.EncodeToString(hasher.Sum(nil))
-	labelSelector := fmt.Sprintf("telefonistka.io/component-path-sha1=%s", componentPathSha1)
-	log.Debugf("Using label selector: %s", labelSelector)
-	appLabelQuery := application.ApplicationQuery{
-		Selector: &labelSelector,
-		Repo:     &repo,
+// repoSourceIndexes returns the indexes of the app sources that are taken from repo, these are the sources that should follow the PR branch.
+// Multi-source apps can mix the PR repo with Helm chart repos or other git repos(like a chart with values from a git "ref" source).
+// Single source apps were already matched to the repo during discovery, so their only source is always included.
+func repoSourceIndexes(app *argoappv1.Application, repo string) []int {
+	if !app.Spec.HasMultipleSources() {
+		if app.Spec.Source == nil {
+			return nil
+		}
+		return []int{0}
 	}
-	foundApps, err := appClient.List(ctx, &appLabelQuery)
-	if err != nil {
-		return nil, fmt.Errorf("Error listing ArgoCD applications: %w", err)
+	indexes := []int{}
+	for i, source := range app.Spec.Sources {
+		if git.SameURL(source.RepoURL, repo) {
+			indexes = append(indexes, i)
+		}
 	}
-	if len(foundApps.Items) == 0 {
-		log.Infof("No ArgoCD application found for component path sha1 %s(repo %s), used this label selector: %s", componentPathSha1, repo, labelSelector)
-		return nil, nil
+	return indexes
+}
+
+// repoSourcePath returns the path of the first app source taken from repo, "ref" only sources of multi-source apps have no path.
+func repoSourcePath(app *argoappv1.Application, repo string) string {
+	for _, i := range repoSourceIndexes(app, repo) {
+		if p := app.Spec.GetSourcePtrByIndex(i).Path; p != "" {
+			return p
+		}
+	}
+	return ""
+}
+
+// appTracksRevision is true when all the app sources taken from repo have revision as their targetRevision
+func appTracksRevision(app *argoappv1.Application, repo string, revision string) bool {
+	indexes := repoSourceIndexes(app, repo)
+	for _, i := range indexes {
+		if app.Spec.GetSourcePtrByIndex(i).TargetRevision != revision {
+			return false
+		}
 	}
+	return len(indexes) > 0
+}
 
-	// we expect only one app with this label and repo selectors
-	return &foundApps.Items[0], nil
+// setRepoSourcesRevision sets the targetRevision of the app sources taken from repo
+func setRepoSourcesRevision(app *argoappv1.Application, repo string, revision string) {
+	for _, i := range repoSourceIndexes(app, repo) {
+		app.Spec.GetSourcePtrByIndex(i).TargetRevision = revision
+	}
 }
 
-// findArgocdAppByManifestPathAnnotation is the default method to find an ArgoCD application by the manifest-generate-paths annotation.
-// It assumes the ArgoCD (optional) manifest-generate-paths annotation is set on all relevant apps.
-// Notice that this method includes a full list of all ArgoCD applications in the repo, this could be a performance issue if there are many apps in the repo.
-func findArgocdAppByManifestPathAnnotation(ctx context.Context, componentPath string, repo string, appClient application.ApplicationServiceClient) (app *argoappv1.Application, err error) {
-	// argocd.argoproj.io/manifest-generate-paths
+// listRepoApps lists ArgoCD applications of repo, optionally filtered by a label selector.
+// The ArgoCD server repo filter only looks at the first source of multi-source apps, so with multiSource set the apps are listed without it and only multi-source apps with any source from repo are returned.
+func listRepoApps(ctx context.Context, appClient application.ApplicationServiceClient, selector *string, repo string, multiSource bool) ([]argoappv1.Application, error) {
 	appQuery := application.ApplicationQuery{
-		Repo: &repo,
+		Selector: selector,
+	}
+	if !multiSource {
+		appQuery.Repo = &repo
 	}
 	// AFAIKT I can't use standard grpc instrumentation here, since the argocd client abstracts too much (including the choice between Grpc and Grpc-web)
 	// I'll just manually log the time it takes to get the apps for now
 	getAppsStart := time.Now()
-	allRepoApps, err := appClient.List(ctx, &appQuery)
-	getAppsDuration := time.Since(getAppsStart).Milliseconds()
-	log.Debugf("Got %v ArgoCD applications for repo %s in %v ms", len(allRepoApps.Items), repo, getAppsDuration)
+	foundApps, err := appClient.List(ctx, &appQuery)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("Error listing ArgoCD applications: %w", err)
+	}
+	log.Debugf("Got %v ArgoCD applications for repo %s in %v ms(multi-source: %v)", len(foundApps.Items), repo, time.Since(getAppsStart).Milliseconds(), multiSource)
+	if !multiSource {
+		return foundApps.Items, nil
+	}
+	apps := []argoappv1.Application{}
+	for _, app := range foundApps.Items {
+		if appMatchesRepoFilter(&app, repo, true) {
+			apps = append(apps, app)
+		}
 	}
-	for _, app := range allRepoApps.Items {
-		// Check if the app has the annotation
-		// https://argo-cd.readthedocs.io/en/stable/operator-manual/high_availability/#manifest-paths-annotation
-		// Consider the annotation content can a semi-colon separated list of paths, an absolute path or a relative path(start with a ".")  and the manifest-paths-annotation could be a subpath of componentPath.
-		// We need to check if the annotation is a subpath of componentPath
+	return apps, nil
+}
 
-		appManifestPathsAnnotation := app.Annotations["argocd.argoproj.io/manifest-generate-paths"]
+// appMatchesRepoFilter mirrors the ArgoCD server repo filter, which only looks at the first source, or with multiSource set matches multi-source apps that have any source from repo.
+func appMatchesRepoFilter(app *argoappv1.Application, repo string, multiSource bool) bool {
+	if !multiSource {
+		return app.Spec.GetSource().RepoURL == repo
+	}
+	return app.Spec.HasMultipleSources() && len(repoSourceIndexes(app, repo)) > 0
+}
 
-		for _, manifetsPathElement := range strings.Split(appManifestPathsAnnotation, ";") {
-			// if `manifest-generate-paths` element starts with a "." it is a relative path(relative to repo root), we need to join it with the app source path
-			if strings.HasPrefix(manifetsPathElement, ".") {
-				manifetsPathElement = filepath.Join(app.Spec.Source.Path, manifetsPathElement)
-			}
+func componentPathSHA1(componentPath string) string {
+	hasher := sha1.New() //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
+	hasher.Write([]byte(componentPath))
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// findArgocdAppsBySHA1Label finds the ArgoCD applications by the SHA1 label of the component path it's supposed to avoid performance issues with the "manifest-generate-paths" annotation method which requires pulling all ArgoCD applications(!) on every PR event.
+// The SHA1 label is assumed to be populated by the ApplicationSet controller(or apps of apps  or similar).
+// A component can feed several apps, like an ApplicationSet with a cluster generator creating one app per cluster, all of them are returned.
+func findArgocdAppsBySHA1Label(ctx context.Context, componentPath string, repo string, appClient application.ApplicationServiceClient) (apps []argoappv1.Application, err error) {
+	// Calculate sha1 of component path to use in a label selector
+	componentPathSha1 := componentPathSHA1(componentPath)
+	labelSelector := fmt.Sprintf("%s=%s", componentPathSHA1Label, componentPathSha1)
+	log.Debugf("Using label selector: %s", labelSelector)
+	// Multi-source apps that don't have repo as their first source are only looked for when no other app has the label
+	for _, multiSource := range []bool{false, true} {
+		foundApps, err := listRepoApps(ctx, appClient, &labelSelector, repo, multiSource)
+		if err != nil {
+			return nil, err
+		}
+		if len(foundApps) > 0 {
+			return foundApps, nil
+		}
+	}
+	log.Infof("No ArgoCD application found for component path sha1 %s(repo %s), used this label selector: %s", componentPathSha1, repo, labelSelector)
+	return nil, nil
+}
+
+// appMatchesManifestPaths checks if componentPath is a subpath of one of the app manifest-generate-paths annotation elements
+func appMatchesManifestPaths(app *argoappv1.Application, componentPath string, repo string) bool {
+	// Check if the app has the annotation
+	// https://argo-cd.readthedocs.io/en/stable/operator-manual/high_availability/#manifest-paths-annotation
+	// Consider the annotation content can a semi-colon separated list of paths, an absolute path or a relative path(start with a ".")  and the manifest-paths-annotation could be a subpath of componentPath.
+	// We need to check if the annotation is a subpath of componentPath
+
+	appManifestPathsAnnotation := app.Annotations[manifestGeneratePathsAnnotation]
+
+	for _, manifetsPathElement := range strings.Split(appManifestPathsAnnotation, ";") {
+		// filepath.Rel treats an empty path as ".", apps without the annotation would match every component
+		if manifetsPathElement == "" {
+			continue
+		}
+		// if `manifest-generate-paths` element starts with a "." it is a relative path(relative to repo root), we need to join it with the app source path
+		if strings.HasPrefix(manifetsPathElement, ".") {
+			manifetsPathElement = filepath.Join(repoSourcePath(app, repo), manifetsPathElement)
+		}
 
-			// Checking is componentPath is a subpath of the manifetsPathElement
-			// Using filepath.Rel solves all kinds of path issues, like double slashes, etc.
-			rel, err := filepath.Rel(manifetsPathElement, componentPath)
-			if !strings.HasPrefix(rel, "..") && err == nil {
-				log.Debugf("Found app %s with manifest-generate-paths(\"%s\") annotation that matches %s", app.Name, appManifestPathsAnnotation, componentPath)
-				return &app, nil
+		// Checking is componentPath is a subpath of the manifetsPathElement
+		// Using filepath.Rel solves all kinds of path issues, like double slashes, etc.
+		rel, err := filepath.Rel(manifetsPathElement, componentPath)
+		if !strings.HasPrefix(rel, "..") && err == nil {
+			log.Debugf("Found app %s with manifest-generate-paths(\"%s\") annotation that matches %s", app.Name, appManifestPathsAnnotation, componentPath)
+			return true
+		}
+	}
+	return false
+}
+
+// findArgocdAppsByManifestPathAnnotation is the default method to find the ArgoCD applications of a component by the manifest-generate-paths annotation.
+// It assumes the ArgoCD (optional) manifest-generate-paths annotation is set on all relevant apps.
+// Notice that this method includes a full list of all ArgoCD applications in the repo, this could be a performance issue if there are many apps in the repo.
+// When no app matches, all ArgoCD applications are listed to look for multi-source apps that don't have repo as their first source.
+func findArgocdAppsByManifestPathAnnotation(ctx context.Context, componentPath string, repo string, appClient application.ApplicationServiceClient) (apps []argoappv1.Application, err error) {
+	checkedApps := 0
+	for _, multiSource := range []bool{false, true} {
+		allRepoApps, err := listRepoApps(ctx, appClient, nil, repo, multiSource)
+		if err != nil {
+			return nil, err
+		}
+		checkedApps += len(allRepoApps)
+		for _, app := range allRepoApps {
+			if appMatchesManifestPaths(&app, componentPath, repo) {
+				apps = append(apps, app)
 			}
 		}
+		if len(apps) > 0 {
+			return apps, nil
+		}
 	}
-	log.Infof("No ArgoCD application found with manifest-generate-paths annotation that matches %s(looked at repo %s, checked %v apps)", componentPath, repo, len(allRepoApps.Items))
+	log.Infof("No ArgoCD application found with manifest-generate-paths annotation that matches %s(looked at repo %s, checked %v apps)", componentPath, repo, checkedApps)
 	return nil, nil
 }
 
-func findArgocdApp(ctx context.Context, componentPath string, repo string, appClient application.ApplicationServiceClient, useSHALabelForArgoDicovery bool) (app *argoappv1.Application, err error) {
-	f := findArgocdAppByManifestPathAnnotation
+func findArgocdApps(ctx context.Context, componentPath string, repo string, ac argoCdClients, useSHALabelForArgoDicovery bool) (apps []argoappv1.Application, err error) {
+	if idx := getActiveAppIndex(configuration.ArgocdInstance{Name: ac.instance}); idx != nil {
+		if apps, ok := idx.find(componentPath, repo, useSHALabelForArgoDicovery); ok {
+			log.Debugf("Found %d ArgoCD applications for component path %s(repo %s) in the application index", len(apps), componentPath, repo)
+			return apps, nil
+		}
+	}
+	f := findArgocdAppsByManifestPathAnnotation
 	if useSHALabelForArgoDicovery {
-		f = findArgocdAppBySHA1Label
+		f = findArgocdAppsBySHA1Label
 	}
-	return f(ctx, componentPath, repo, appClient)
+	return f(ctx, componentPath, repo, ac.app)
 }
 
-func SetArgoCDAppRevision(ctx context.Context, componentPath string, revision string, repo string, useSHALabelForArgoDicovery bool) error {
-	var foundApp *argoappv1.Application
-	var err error
-	ac, err := CreateArgoCdClients()
+// SetArgoCDAppRevision sets the target revision of all the ArgoCD applications of componentPath in the ArgoCD instance
+func SetArgoCDAppRevision(ctx context.Context, instance configuration.ArgocdInstance, componentPath string, revision string, repo string, useSHALabelForArgoDicovery bool) error {
+	ac, err := GetInstanceClients(instance)
 	if err != nil {
 		return fmt.Errorf("Error creating ArgoCD clients: %w", err)
 	}
-	foundApp, err = findArgocdApp(ctx, componentPath, repo, ac.app, useSHALabelForArgoDicovery)
+	foundApps, err := findArgocdApps(ctx, componentPath, repo, ac, useSHALabelForArgoDicovery)
 	if err != nil {
 		return fmt.Errorf("error finding ArgoCD application for component path %s: %w", componentPath, err)
 	}
-	if foundApp == nil {
+	if len(foundApps) == 0 {
 		return fmt.Errorf("no ArgoCD application was found for component path: %s", componentPath)
 	}
-	if foundApp.Spec.Source.TargetRevision == revision {
+	var errs []error
+	for i := range foundApps {
+		if err := setAppRevision(ctx, ac.app, &foundApps[i], revision, repo); err != nil {
+			errs = append(errs, fmt.Errorf("app %s: %w", foundApps[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setAppRevision patches the target revision of the app sources taken from repo
+func setAppRevision(ctx context.Context, appClient application.ApplicationServiceClient, foundApp *argoappv1.Application, revision string, repo string) error {
+	if len(repoSourceIndexes(foundApp, repo)) == 0 {
+		return fmt.Errorf("ArgoCD application %s has no source from repo %s", foundApp.Name, repo)
+	}
+	if appTracksRevision(foundApp, repo, revision) {
 		log.Infof("App %s already has revision %s", foundApp.Name, revision)
 		return nil
 	}
 
-	patchObject := struct {
-		Spec struct {
-			Source struct {
-				TargetRevision string `json:"targetRevision"`
-			} `json:"source"`
-		} `json:"spec"`
-	}{}
-	patchObject.Spec.Source.TargetRevision = revision
-	patchJson, _ := json.Marshal(patchObject)
-	patch := string(patchJson)
+	patchType, patch, err := revisionPatch(foundApp, repo, revision)
+	if err != nil {
+		return fmt.Errorf("generating revision patch: %w", err)
+	}
 	log.Debugf("Patching app %s/%s with: %s", foundApp.Namespace, foundApp.Name, patch)
 
-	patchType := "merge"
-	_, err = ac.app.Patch(ctx, &application.ApplicationPatchRequest{
+	_, err = appClient.Patch(ctx, &application.ApplicationPatchRequest{
 		Name:         &foundApp.Name,
 		AppNamespace: &foundApp.Namespace,
 		PatchType:    &patchType,
@@ -364,6 +681,35 @@ func SetArgoCDAppRevision(ctx context.Context, componentPath string, revision st
 	return err
 }
 
+// revisionPatch generates the patch that sets the targetRevision of the app sources taken from repo.
+// A merge patch would replace the whole spec.sources list of multi-source apps, so these are patched by index with a JSON patch.
+func revisionPatch(app *argoappv1.Application, repo string, revision string) (patchType string, patch string, err error) {
+	if !app.Spec.HasMultipleSources() {
+		patchObject := struct {
+			Spec struct {
+				Source struct {
+					TargetRevision string `json:"targetRevision"`
+				} `json:"source"`
+			} `json:"spec"`
+		}{}
+		patchObject.Spec.Source.TargetRevision = revision
+		patchJson, err := json.Marshal(patchObject)
+		return "merge", string(patchJson), err
+	}
+
+	type jsonPatchOperation struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value string `json:"value"`
+	}
+	operations := []jsonPatchOperation{}
+	for _, i := range repoSourceIndexes(app, repo) {
+		operations = append(operations, jsonPatchOperation{Op: "replace", Path: fmt.Sprintf("/spec/sources/%d/targetRevision", i), Value: revision})
+	}
+	patchJson, err := json.Marshal(operations)
+	return "json", string(patchJson), err
+}
+
 // copied form https://github.com/argoproj/argo-cd/blob/v2.11.4/applicationset/controllers/applicationset_controller.go#L493C1-L503C2
 func getTempApplication(applicationSetTemplate argoappv1.ApplicationSetTemplate) *argoappv1.Application {
 	var tmplApplication argoappv1.Application
@@ -411,7 +757,7 @@ func createTempAppObjectFroNewApp(ctx context.Context, componentPath string, rep
 		newAppObject.Name = tempAppName
 		// We need to remove the automated sync policy, we just want to create a temporary app object, run a diff and remove it.
 		newAppObject.Spec.SyncPolicy.Automated = nil
-		newAppObject.Spec.Source.TargetRevision = prBranch
+		setRepoSourcesRevision(newAppObject, repo, prBranch)
 
 		validateTempApp := false
 		appCreateRequest := application.ApplicationCreateRequest{
@@ -427,55 +773,64 @@ func createTempAppObjectFroNewApp(ctx context.Context, componentPath string, rep
 	}
 }
 
-func generateDiffOfAComponent(ctx context.Context, commentDiff bool, componentPath string, prBranch string, repo string, ac argoCdClients, argoSettings *settings.Settings, useSHALabelForArgoDicovery bool, createTempAppObjectFromNewApps bool) (componentDiffResult DiffResult) {
-	componentDiffResult.ComponentPath = componentPath
-
-	// Find ArgoCD application by the path SHA1 label selector and repo name
-	// At the moment we assume one to one mapping between Telefonistka components and ArgoCD application
-
-	var app *argoappv1.Application
-	var err error
-	if useSHALabelForArgoDicovery {
-		app, err = findArgocdAppBySHA1Label(ctx, componentPath, repo, ac.app)
-		if err != nil {
-			componentDiffResult.DiffError = err
-			return componentDiffResult
+// generateDiffOfAComponent diffs all the ArgoCD applications of a component, a component can feed several apps(like one per cluster), so there is one result per app.
+func generateDiffOfAComponent(ctx context.Context, commentDiff bool, diffSettings DiffSettings, componentPath string, prBranch string, repo string, ac argoCdClients, argoSettings *settings.Settings, useSHALabelForArgoDicovery bool, createTempAppObjectFromNewApps bool) (componentDiffResults []DiffResult) {
+	apps, err := findArgocdApps(ctx, componentPath, repo, ac, useSHALabelForArgoDicovery)
+	if err != nil {
+		return []DiffResult{{ComponentPath: componentPath, DiffError: err}}
+	}
+	if len(apps) == 0 {
+		if !createTempAppObjectFromNewApps {
+			return []DiffResult{{ComponentPath: componentPath, DiffError: fmt.Errorf("no ArgoCD application found for component path %s(repo %s)", componentPath, repo)}}
 		}
-	} else {
-		app, err = findArgocdAppByManifestPathAnnotation(ctx, componentPath, repo, ac.app)
+		app, err := createTempAppObjectFroNewApp(ctx, componentPath, repo, prBranch, ac)
 		if err != nil {
-			componentDiffResult.DiffError = err
-			return componentDiffResult
+			log.Errorf("Error creating temporary app object: %v", err)
+			return []DiffResult{{ComponentPath: componentPath, DiffError: err}}
 		}
+		log.Debugf("Created temporary app object: %s", app.Name)
+		return []DiffResult{generateDiffOfAnApp(ctx, commentDiff, diffSettings, componentPath, prBranch, repo, ac, argoSettings, app, true)}
 	}
-	if app == nil {
-		if createTempAppObjectFromNewApps {
-			app, err = createTempAppObjectFroNewApp(ctx, componentPath, repo, prBranch, ac)
 
-			if err != nil {
-				log.Errorf("Error creating temporary app object: %v", err)
-				componentDiffResult.DiffError = err
-				return componentDiffResult
-			} else {
-				log.Debugf("Created temporary app object: %s", app.Name)
-				componentDiffResult.AppWasTemporarilyCreated = true
-			}
-		} else {
-			componentDiffResult.DiffError = fmt.Errorf("no ArgoCD application found for component path %s(repo %s)", componentPath, repo)
-			return
+	componentDiffResults = make([]DiffResult, len(apps))
+	var wg sync.WaitGroup
+	for i := range apps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			componentDiffResults[i] = generateDiffOfAnApp(ctx, commentDiff, diffSettings, componentPath, prBranch, repo, ac, argoSettings, &apps[i], false)
+		}(i)
+	}
+	wg.Wait()
+	return componentDiffResults
+}
+
+// generateDiffOfAnApp diffs a single ArgoCD application of a component, appWasTemporarilyCreated is set for apps created just for this diff, these are deleted once the diff is generated.
+func generateDiffOfAnApp(ctx context.Context, commentDiff bool, diffSettings DiffSettings, componentPath string, prBranch string, repo string, ac argoCdClients, argoSettings *settings.Settings, app *argoappv1.Application, appWasTemporarilyCreated bool) (componentDiffResult DiffResult) {
+	componentDiffResult.ComponentPath = componentPath
+	componentDiffResult.AppWasTemporarilyCreated = appWasTemporarilyCreated
+	if commentDiff {
+		componentDiffResult.DiffFormat = configuration.DiffFormatUnified
+		if diffSettings.DiffFormat != "" {
+			componentDiffResult.DiffFormat = diffSettings.DiffFormat
 		}
-	} else {
+	}
+
+	var err error
+	if !appWasTemporarilyCreated {
 		// Get the application and its resources, resources are the live state of the application objects.
 		// The 2nd "app fetch" is needed for the "refreshTypeHard", we don't want to do that to non-relevant apps"
 		refreshType := string(argoappv1.RefreshTypeHard)
 		appNameQuery := application.ApplicationQuery{
-			Name:    &app.Name, // we expect only one app with this label and repo selectors
-			Refresh: &refreshType,
+			Name:         &app.Name,
+			AppNamespace: &app.Namespace,
+			Refresh:      &refreshType,
 		}
 		app, err = ac.app.Get(ctx, &appNameQuery)
 		if err != nil {
+			componentDiffResult.ArgoCdAppName = *appNameQuery.Name
 			componentDiffResult.DiffError = err
-			log.Errorf("Error getting app(HardRefresh) %v: %v", appNameQuery.Name, err)
+			log.Errorf("Error getting app(HardRefresh) %v: %v", *appNameQuery.Name, err)
 			return componentDiffResult
 		}
 		log.Debugf("Got ArgoCD app %s", app.Name)
@@ -483,7 +838,7 @@ func generateDiffOfAComponent(ctx context.Context, commentDiff bool, componentPa
 	componentDiffResult.ArgoCdAppName = app.Name
 	componentDiffResult.ArgoCdAppURL = fmt.Sprintf("%s/applications/%s", argoSettings.URL, app.Name)
 
-	if app.Spec.Source.TargetRevision == prBranch && app.Spec.SyncPolicy.Automated != nil {
+	if appTracksRevision(app, repo, prBranch) && app.Spec.SyncPolicy != nil && app.Spec.SyncPolicy.Automated != nil {
 		componentDiffResult.DiffError = nil
 		componentDiffResult.AppSyncedFromPRBranch = true
 
@@ -503,9 +858,17 @@ func generateDiffOfAComponent(ctx context.Context, commentDiff bool, componentPa
 
 	manifestQuery := application.ApplicationManifestQuery{
 		Name:         &app.Name,
-		Revision:     &prBranch,
 		AppNamespace: &app.Namespace,
 	}
+	if app.Spec.HasMultipleSources() {
+		// Only the sources taken from the PR repo are rendered from the PR branch, the others(like Helm charts) keep their revision
+		for _, i := range repoSourceIndexes(app, repo) {
+			manifestQuery.SourcePositions = append(manifestQuery.SourcePositions, int64(i+1))
+			manifestQuery.Revisions = append(manifestQuery.Revisions, prBranch)
+		}
+	} else {
+		manifestQuery.Revision = &prBranch
+	}
 	manifests, err := ac.app.GetManifests(ctx, &manifestQuery)
 	if err != nil {
 		componentDiffResult.DiffError = err
@@ -525,7 +888,8 @@ func generateDiffOfAComponent(ctx context.Context, commentDiff bool, componentPa
 	}
 
 	log.Debugf("Generating diff for component %s", componentPath)
-	componentDiffResult.HasDiff, componentDiffResult.DiffElements, componentDiffResult.DiffError = generateArgocdAppDiff(ctx, commentDiff, app, detailedProject.Project, resources, argoSettings, diffOption)
+	componentDiffResult.HasDiff, componentDiffResult.DiffElements, componentDiffResult.UnfilteredChanges, componentDiffResult.IgnoredResources, componentDiffResult.DiffError = generateArgocdAppDiff(ctx, commentDiff, app, detailedProject.Project, resources, argoSettings, diffOption, diffSettings)
+	componentDiffResult.Stats = newDiffStats(componentDiffResult.DiffElements)
 
 	// only delete the temprorary app object if it was created and there was no error on diff
 	// otherwise let's keep it for investigation
@@ -543,8 +907,9 @@ func generateDiffOfAComponent(ctx context.Context, commentDiff bool, componentPa
 	return componentDiffResult
 }
 
-// GenerateDiffOfChangedComponents generates diff of changed components
-func GenerateDiffOfChangedComponents(ctx context.Context, componentsToDiff map[string]bool, prBranch string, repo string, useSHALabelForArgoDicovery bool, createTempAppObjectFromNewApps bool, argoClients argoCdClients) (hasComponentDiff bool, hasComponentDiffErrors bool, diffResults []DiffResult, err error) {
+// GenerateDiffOfChangedComponents generates diff of changed components, all of them are diffed against the ArgoCD instance of argoClients.
+// diffSettings are the DiffSettings of the components, by component path.
+func GenerateDiffOfChangedComponents(ctx context.Context, componentsToDiff map[string]bool, diffSettings map[string]DiffSettings, prBranch string, repo string, useSHALabelForArgoDicovery bool, createTempAppObjectFromNewApps bool, argoClients argoCdClients) (hasComponentDiff bool, hasComponentDiffErrors bool, diffResults []DiffResult, err error) {
 	hasComponentDiff = false
 	hasComponentDiffErrors = false
 
@@ -554,24 +919,79 @@ func GenerateDiffOfChangedComponents(ctx context.Context, componentsToDiff map[s
 		return false, true, nil, err
 	}
 
-	diffResult := make(chan DiffResult)
+	diffResult := make(chan []DiffResult)
 	for componentPath, shouldIDiff := range componentsToDiff {
 		go func(componentPath string, shouldDiff bool) {
-			diffResult <- generateDiffOfAComponent(ctx, shouldIDiff, componentPath, prBranch, repo, argoClients, argoSettings, useSHALabelForArgoDicovery, createTempAppObjectFromNewApps)
+			diffResult <- generateDiffOfAComponent(ctx, shouldDiff, diffSettings[componentPath], componentPath, prBranch, repo, argoClients, argoSettings, useSHALabelForArgoDicovery, createTempAppObjectFromNewApps)
 		}(componentPath, shouldIDiff)
 	}
 
 	for range componentsToDiff {
-		currentDiffResult := <-diffResult
-		if currentDiffResult.DiffError != nil {
-			log.Errorf("Error generating diff for component %s: %v", currentDiffResult.ComponentPath, currentDiffResult.DiffError)
-			hasComponentDiffErrors = true
-			err = currentDiffResult.DiffError
-		}
-		if currentDiffResult.HasDiff {
-			hasComponentDiff = true
+		for _, currentDiffResult := range <-diffResult {
+			currentDiffResult.ArgoCdInstance = argoClients.instance
+			if currentDiffResult.DiffError != nil {
+				log.Errorf("Error generating diff for component %s(app %s): %v", currentDiffResult.ComponentPath, currentDiffResult.ArgoCdAppName, currentDiffResult.DiffError)
+				hasComponentDiffErrors = true
+				err = currentDiffResult.DiffError
+			}
+			if currentDiffResult.HasDiff {
+				hasComponentDiff = true
+			}
+			diffResults = append(diffResults, currentDiffResult)
 		}
-		diffResults = append(diffResults, currentDiffResult)
 	}
+	// Components are diffed concurrently, sorting keeps the PR comment stable and the apps of a component next to each other
+	sort.SliceStable(diffResults, func(i, j int) bool {
+		if diffResults[i].ComponentPath != diffResults[j].ComponentPath {
+			return diffResults[i].ComponentPath < diffResults[j].ComponentPath
+		}
+		return diffResults[i].ArgoCdAppName < diffResults[j].ArgoCdAppName
+	})
 	return hasComponentDiff, hasComponentDiffErrors, diffResults, err
 }
+
+// ComponentDiffResults are the diff results of all the ArgoCD applications of a single component in an ArgoCD instance
+type ComponentDiffResults struct {
+	ArgoCdInstance string
+	ComponentPath  string
+	AppDiffResults []DiffResult
+}
+
+// InstanceDiffResults are the diff results of the components of a single ArgoCD instance
+type InstanceDiffResults struct {
+	ArgoCdInstance string
+	ComponentDiffs []ComponentDiffResults
+}
+
+// GroupDiffResultsByComponent groups diff results by their ArgoCD instance and component path, keeping the order in which components first appear.
+func GroupDiffResultsByComponent(diffResults []DiffResult) []ComponentDiffResults {
+	groups := []ComponentDiffResults{}
+	index := map[[2]string]int{}
+	for _, diffResult := range diffResults {
+		key := [2]string{diffResult.ArgoCdInstance, diffResult.ComponentPath}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, ComponentDiffResults{ArgoCdInstance: diffResult.ArgoCdInstance, ComponentPath: diffResult.ComponentPath})
+		}
+		groups[i].AppDiffResults = append(groups[i].AppDiffResults, diffResult)
+	}
+	return groups
+}
+
+// GroupDiffResultsByInstance groups diff results by their ArgoCD instance and then by component, keeping the order in which instances and components first appear.
+func GroupDiffResultsByInstance(diffResults []DiffResult) []InstanceDiffResults {
+	groups := []InstanceDiffResults{}
+	index := map[string]int{}
+	for _, componentDiff := range GroupDiffResultsByComponent(diffResults) {
+		i, ok := index[componentDiff.ArgoCdInstance]
+		if !ok {
+			i = len(groups)
+			index[componentDiff.ArgoCdInstance] = i
+			groups = append(groups, InstanceDiffResults{ArgoCdInstance: componentDiff.ArgoCdInstance})
+		}
+		groups[i].ComponentDiffs = append(groups[i].ComponentDiffs, componentDiff)
+	}
+	return groups
+}
@@ -18,6 +18,7 @@ import (
 	reposerverApiClient "github.com/argoproj/argo-cd/v2/reposerver/apiclient"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
 	"github.com/wayfair-incubator/telefonistka/internal/pkg/mocks"
 	"github.com/wayfair-incubator/telefonistka/internal/pkg/testutils"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -129,11 +130,11 @@ func TestFindArgocdAppBySHA1Label(t *testing.T) {
 
 	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil)
 
-	app, err := findArgocdAppBySHA1Label(ctx, "random/path", "some-repo", mockApplicationClient)
+	apps, err := findArgocdAppsBySHA1Label(ctx, "random/path", "some-repo", mockApplicationClient)
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
-	if app.Name != "right-app" {
+	if len(apps) != 1 || apps[0].Name != "right-app" {
 		t.Errorf("App name is not right-app")
 	}
 }
@@ -167,7 +168,7 @@ func TestFindArgocdAppByPathAnnotation(t *testing.T) {
 
 	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil)
 
-	apps, err := findArgocdAppByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
+	apps, err := findArgocdAppsByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
@@ -204,11 +205,11 @@ func TestFindArgocdAppByPathAnnotationSemiColon(t *testing.T) {
 
 	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil)
 
-	app, err := findArgocdAppByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
+	apps, err := findArgocdAppsByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
-	if app.Name != "right-app" {
+	if len(apps) != 1 || apps[0].Name != "right-app" {
 		t.Errorf("App name is not right-app")
 	}
 }
@@ -240,10 +241,10 @@ func TestFindArgocdAppByPathAnnotationRelative(t *testing.T) {
 	}
 
 	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil)
-	app, err := findArgocdAppByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
+	apps, err := findArgocdAppsByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
 	if err != nil {
 		t.Errorf("Error: %v", err)
-	} else if app.Name != "right-app" {
+	} else if len(apps) != 1 || apps[0].Name != "right-app" {
 		t.Errorf("App name is not right-app")
 	}
 }
@@ -275,10 +276,10 @@ func TestFindArgocdAppByPathAnnotationRelative2(t *testing.T) {
 	}
 
 	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil)
-	app, err := findArgocdAppByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
+	apps, err := findArgocdAppsByManifestPathAnnotation(ctx, "right/path", "some-repo", mockApplicationClient)
 	if err != nil {
 		t.Errorf("Error: %v", err)
-	} else if app.Name != "right-app" {
+	} else if len(apps) != 1 || apps[0].Name != "right-app" {
 		t.Errorf("App name is not right-app")
 	}
 }
@@ -309,12 +310,13 @@ func TestFindArgocdAppByPathAnnotationNotFound(t *testing.T) {
 		},
 	}
 
-	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil)
-	app, err := findArgocdAppByManifestPathAnnotation(ctx, "non-existing/path", "some-repo", mockApplicationClient)
+	// The 2nd call lists all apps, looking for multi-source apps that don't have the repo as their first source
+	mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(expectedResponse, nil).Times(2)
+	apps, err := findArgocdAppsByManifestPathAnnotation(ctx, "non-existing/path", "some-repo", mockApplicationClient)
 	if err != nil {
 		t.Errorf("Error: %v", err)
 	}
-	if app != nil {
+	if len(apps) != 0 {
 		log.Fatal("expected the application to be nil")
 	}
 }
@@ -419,6 +421,7 @@ func TestFetchArgoDiffConcurrently(t *testing.T) {
 	_, _, diffResults, _ := GenerateDiffOfChangedComponents( //nolint:dogsled
 		context.TODO(),
 		makeComponents(numComponents),
+		nil,
 		"test-pr-branch",
 		"test-repo",
 		true,
@@ -432,3 +435,362 @@ func TestFetchArgoDiffConcurrently(t *testing.T) {
 	// assert that the entire run takes less than numComponents * 1 second
 	assert.Less(t, elapsed, time.Duration(numComponents)*time.Second)
 }
+
+func multiSourceApp(name string) argoappv1.Application {
+	return argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Annotations: map[string]string{
+				"argocd.argoproj.io/manifest-generate-paths": ".",
+			},
+		},
+		Spec: argoappv1.ApplicationSpec{
+			Sources: argoappv1.ApplicationSources{
+				{RepoURL: "https://charts.example.com", Chart: "foo", TargetRevision: "1.2.3", Helm: &argoappv1.ApplicationSourceHelm{ValueFiles: []string{"$values/clusters/prod/foo/values.yaml"}}},
+				{RepoURL: "https://github.com/AnOwner/gitops.git", TargetRevision: "HEAD", Ref: "values"},
+				{RepoURL: "https://github.com/AnOwner/gitops", TargetRevision: "HEAD", Path: "clusters/prod/foo"},
+			},
+		},
+	}
+}
+
+func TestRepoSources(t *testing.T) {
+	t.Parallel()
+	singleSourceApp := argoappv1.Application{Spec: argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{TargetRevision: "HEAD", Path: "clusters/prod/bar"}}}
+	tests := map[string]struct {
+		app               argoappv1.Application
+		expectedIndexes   []int
+		expectedPath      string
+		expectedPatchType string
+		expectedPatch     string
+	}{
+		"Single source": {
+			app:               singleSourceApp,
+			expectedIndexes:   []int{0},
+			expectedPath:      "clusters/prod/bar",
+			expectedPatchType: "merge",
+			expectedPatch:     `{"spec":{"source":{"targetRevision":"my-branch"}}}`,
+		},
+		"Helm chart with values from the repo": {
+			app:               multiSourceApp("foo"),
+			expectedIndexes:   []int{1, 2},
+			expectedPath:      "clusters/prod/foo",
+			expectedPatchType: "json",
+			expectedPatch:     `[{"op":"replace","path":"/spec/sources/1/targetRevision","value":"my-branch"},{"op":"replace","path":"/spec/sources/2/targetRevision","value":"my-branch"}]`,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			repo := "https://github.com/AnOwner/gitops"
+			assert.Equal(t, tc.expectedIndexes, repoSourceIndexes(&tc.app, repo))
+			assert.Equal(t, tc.expectedPath, repoSourcePath(&tc.app, repo))
+			patchType, patch, err := revisionPatch(&tc.app, repo, "my-branch")
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPatchType, patchType)
+			assert.Equal(t, tc.expectedPatch, patch)
+
+			assert.False(t, appTracksRevision(&tc.app, repo, "my-branch"))
+			app := tc.app.DeepCopy()
+			setRepoSourcesRevision(app, repo, "my-branch")
+			assert.True(t, appTracksRevision(app, repo, "my-branch"))
+			if app.Spec.HasMultipleSources() {
+				assert.Equal(t, "1.2.3", app.Spec.Sources[0].TargetRevision, "Sources from other repos should keep their revision")
+			}
+		})
+	}
+}
+
+func TestFindArgocdAppBySHA1LabelMultiSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockApplicationClient := mocks.NewMockApplicationServiceClient(ctrl)
+	otherRepoApp := multiSourceApp("other-repo-app")
+	otherRepoApp.Spec.Sources = otherRepoApp.Spec.Sources[:1]
+
+	gomock.InOrder(
+		// The ArgoCD server repo filter only matches the first source, so the multi-source app isn't returned
+		mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{}, nil),
+		mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, q *application.ApplicationQuery, _ ...any) (*argoappv1.ApplicationList, error) {
+			assert.Nil(t, q.Repo)
+			assert.NotNil(t, q.Selector)
+			return &argoappv1.ApplicationList{Items: []argoappv1.Application{otherRepoApp, multiSourceApp("right-app")}}, nil
+		}),
+	)
+
+	apps, err := findArgocdAppsBySHA1Label(ctx, "clusters/prod/foo", "https://github.com/AnOwner/gitops", mockApplicationClient)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if assert.Len(t, apps, 1) {
+		assert.Equal(t, "right-app", apps[0].Name)
+	}
+}
+
+func TestFindArgocdAppByPathAnnotationMultiSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockApplicationClient := mocks.NewMockApplicationServiceClient(ctrl)
+	gomock.InOrder(
+		mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{}, nil),
+		mockApplicationClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{Items: []argoappv1.Application{multiSourceApp("right-app")}}, nil),
+	)
+
+	// The relative annotation is resolved against the path of the source from the repo, not the Helm chart source
+	apps, err := findArgocdAppsByManifestPathAnnotation(ctx, "clusters/prod/foo", "https://github.com/AnOwner/gitops", mockApplicationClient)
+	if err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if assert.Len(t, apps, 1) {
+		assert.Equal(t, "right-app", apps[0].Name)
+	}
+}
+
+func TestGenerateDiffOfAComponentMultiSource(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAppServiceClient := mocks.NewMockApplicationServiceClient(ctrl)
+	mockProjectServiceClient := mocks.NewMockProjectServiceClient(ctrl)
+	argoClients := argoCdClients{
+		app:     mockAppServiceClient,
+		project: mockProjectServiceClient,
+	}
+	app := multiSourceApp("foo")
+
+	mockAppServiceClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{Items: []argoappv1.Application{app}}, nil)
+	mockAppServiceClient.EXPECT().Get(gomock.Any(), gomock.Any()).Return(&app, nil)
+	mockAppServiceClient.EXPECT().ManagedResources(gomock.Any(), gomock.Any()).Return(&application.ManagedResourcesResponse{}, nil)
+	mockAppServiceClient.EXPECT().GetManifests(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, q *application.ApplicationManifestQuery, _ ...any) (*reposerverApiClient.ManifestResponse, error) {
+		assert.Nil(t, q.Revision)
+		assert.Equal(t, []int64{2, 3}, q.SourcePositions)
+		assert.Equal(t, []string{"my-branch", "my-branch"}, q.Revisions)
+		return &reposerverApiClient.ManifestResponse{}, nil
+	})
+	mockProjectServiceClient.EXPECT().GetDetailedProject(gomock.Any(), gomock.Any()).Return(&project.DetailedProjectsResponse{}, nil)
+
+	results := generateDiffOfAComponent(ctx, true, DiffSettings{}, "clusters/prod/foo", "my-branch", "https://github.com/AnOwner/gitops", argoClients, &settings.Settings{URL: "https://argocd.example.com"}, true, false)
+	if assert.Len(t, results, 1) {
+		assert.NoError(t, results[0].DiffError)
+		assert.Equal(t, "foo", results[0].ArgoCdAppName)
+		assert.False(t, results[0].AppSyncedFromPRBranch)
+	}
+}
+
+func TestGenerateDiffOfAComponentWithMultipleApps(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockAppServiceClient := mocks.NewMockApplicationServiceClient(ctrl)
+	mockProjectServiceClient := mocks.NewMockProjectServiceClient(ctrl)
+	argoClients := argoCdClients{
+		app:     mockAppServiceClient,
+		project: mockProjectServiceClient,
+	}
+	clusterApp := func(name string) argoappv1.Application {
+		return argoappv1.Application{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "argocd"},
+			Spec:       argoappv1.ApplicationSpec{Source: &argoappv1.ApplicationSource{TargetRevision: "HEAD", Path: "clusters/prod/us-east/foo"}},
+		}
+	}
+
+	// An ApplicationSet cluster generator creates one app per cluster from the same component
+	mockAppServiceClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.ApplicationList{Items: []argoappv1.Application{clusterApp("foo-cluster-a"), clusterApp("foo-cluster-b")}}, nil)
+	mockAppServiceClient.EXPECT().Get(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, q *application.ApplicationQuery, _ ...any) (*argoappv1.Application, error) {
+		app := clusterApp(*q.Name)
+		return &app, nil
+	}).Times(2)
+	mockAppServiceClient.EXPECT().ManagedResources(gomock.Any(), gomock.Any()).Return(&application.ManagedResourcesResponse{}, nil).Times(2)
+	mockAppServiceClient.EXPECT().GetManifests(gomock.Any(), gomock.Any()).Return(&reposerverApiClient.ManifestResponse{}, nil).Times(2)
+	mockProjectServiceClient.EXPECT().GetDetailedProject(gomock.Any(), gomock.Any()).Return(&project.DetailedProjectsResponse{}, nil).Times(2)
+
+	results := generateDiffOfAComponent(ctx, true, DiffSettings{}, "clusters/prod/us-east/foo", "my-branch", "https://github.com/AnOwner/gitops", argoClients, &settings.Settings{URL: "https://argocd.example.com"}, true, false)
+	appNames := []string{}
+	for _, result := range results {
+		assert.NoError(t, result.DiffError)
+		assert.Equal(t, "clusters/prod/us-east/foo", result.ComponentPath)
+		appNames = append(appNames, result.ArgoCdAppName)
+	}
+	assert.Equal(t, []string{"foo-cluster-a", "foo-cluster-b"}, appNames)
+}
+
+func TestGenerateArgocdAppDiffIgnoreDifferences(t *testing.T) {
+	t.Parallel()
+	deployment := func(name string, image string, checksum string) string {
+		return fmt.Sprintf(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"%s","namespace":"foo","labels":{"app.kubernetes.io/instance":"foo"}},"spec":{"replicas":2,"template":{"metadata":{"annotations":{"checksum/config":"%s"}},"spec":{"containers":[{"name":"app","image":"%s"}]}}}}`, name, checksum, image)
+	}
+	configMap := func(generated string) string {
+		return fmt.Sprintf(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"baz","namespace":"foo","labels":{"app.kubernetes.io/instance":"foo"}},"data":{"generated":"%s"}}`, generated)
+	}
+	liveState := func(group string, kind string, name string, state string) *argoappv1.ResourceDiff {
+		return &argoappv1.ResourceDiff{Group: group, Kind: kind, Namespace: "foo", Name: name, LiveState: state, NormalizedLiveState: state}
+	}
+	app := &argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec: argoappv1.ApplicationSpec{
+			Destination:       argoappv1.ApplicationDestination{Namespace: "foo"},
+			IgnoreDifferences: []argoappv1.ResourceIgnoreDifferences{{Kind: "ConfigMap", JSONPointers: []string{"/data/generated"}}},
+		},
+	}
+	resources := &application.ManagedResourcesResponse{Items: []*argoappv1.ResourceDiff{
+		liveState("apps", "Deployment", "foo", deployment("foo", "foo:v1", "aaa")),
+		liveState("apps", "Deployment", "bar", deployment("bar", "bar:v1", "aaa")),
+		liveState("", "ConfigMap", "baz", configMap("aaa")),
+	}}
+	diffOptions := &DifferenceOption{res: &reposerverApiClient.ManifestResponse{Manifests: []string{
+		deployment("foo", "foo:v2", "bbb"),
+		deployment("bar", "bar:v1", "bbb"),
+		configMap("bbb"),
+	}}}
+	diffSettings := DiffSettings{IgnoreDifferences: []configuration.IgnoreDifference{{Group: "apps", Kind: "Deployment", JSONPointers: []string{"/spec/template/metadata/annotations/checksum~1config"}}}}
+
+	foundDiffs, diffElements, _, ignoredResources, err := generateArgocdAppDiff(context.Background(), true, app, nil, resources, &settings.Settings{AppLabelKey: "app.kubernetes.io/instance"}, diffOptions, diffSettings)
+	if err != nil {
+		t.Fatalf("generateArgocdAppDiff failed: %v", err)
+	}
+	assert.True(t, foundDiffs)
+	assert.Equal(t, 2, ignoredResources, "The bar Deployment and the baz ConfigMap only have ignored differences")
+	changed := map[string]DiffElement{}
+	for _, diffElement := range diffElements {
+		if diffElement.ChangeType != "" {
+			changed[diffElement.ObjectName] = diffElement
+		}
+	}
+	if assert.Len(t, changed, 1) {
+		assert.Equal(t, ChangeTypeModified, changed["foo"].ChangeType)
+		assert.Contains(t, changed["foo"].Diff, "+        - image: foo:v2")
+		assert.NotContains(t, changed["foo"].Diff, "checksum/config")
+	}
+}
+
+func TestGenerateArgocdAppDiffIgnoredReplicasDecrease(t *testing.T) {
+	t.Parallel()
+	deployment := func(replicas int) string {
+		return fmt.Sprintf(`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"foo","namespace":"foo","labels":{"app.kubernetes.io/instance":"foo"}},"spec":{"replicas":%d,"template":{"spec":{"containers":[{"name":"app","image":"foo:v1"}]}}}}`, replicas)
+	}
+	app := &argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Namespace: "foo"}},
+	}
+	resources := &application.ManagedResourcesResponse{Items: []*argoappv1.ResourceDiff{
+		{Group: "apps", Kind: "Deployment", Namespace: "foo", Name: "foo", LiveState: deployment(3), NormalizedLiveState: deployment(3)},
+	}}
+	diffOptions := &DifferenceOption{res: &reposerverApiClient.ManifestResponse{Manifests: []string{deployment(1)}}}
+	// The PR scales the Deployment down and adds an ignore rule for the replicas to its own component configuration
+	diffSettings := DiffSettings{IgnoreDifferences: []configuration.IgnoreDifference{{Group: "apps", Kind: "Deployment", JSONPointers: []string{"/spec/replicas"}}}}
+
+	foundDiffs, _, unfilteredChanges, ignoredResources, err := generateArgocdAppDiff(context.Background(), true, app, nil, resources, &settings.Settings{AppLabelKey: "app.kubernetes.io/instance"}, diffOptions, diffSettings)
+	if err != nil {
+		t.Fatalf("generateArgocdAppDiff failed: %v", err)
+	}
+	assert.False(t, foundDiffs, "The replicas change is hidden from the diff")
+	assert.Equal(t, 1, ignoredResources)
+	diffResult := DiffResult{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", UnfilteredChanges: unfilteredChanges}
+	scaleDownPolicy := configuration.DiffPolicy{Kinds: []string{"Deployment"}, ReplicasDecrease: true, RequireLabel: "approved-scale-down"}
+	assert.Equal(t, []DiffPolicyViolation{
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "foo", Reason: "decreasing replicas from 3 to 1 requires the `approved-scale-down` label"},
+	}, DiffPolicyViolations(diffResult, []configuration.DiffPolicy{scaleDownPolicy}, nil), "Ignored differences shouldn't hide changes from the diff policies")
+}
+
+func TestGenerateArgocdAppDiffRedactsSecrets(t *testing.T) {
+	t.Parallel()
+	sealedSecret := func(encrypted string) string {
+		return fmt.Sprintf(`{"apiVersion":"bitnami.com/v1alpha1","kind":"SealedSecret","metadata":{"name":"foo","namespace":"foo","labels":{"app.kubernetes.io/instance":"foo"}},"spec":{"encryptedData":{"password":"%s"}}}`, encrypted)
+	}
+	externalSecret := func(templated string) string {
+		return fmt.Sprintf(`{"apiVersion":"external-secrets.io/v1beta1","kind":"ExternalSecret","metadata":{"name":"bar","namespace":"foo","labels":{"app.kubernetes.io/instance":"foo"}},"spec":{"target":{"template":{"data":{"config.yaml":"%s"}}}}}`, templated)
+	}
+	vaultSecret := func(values string) string {
+		return fmt.Sprintf(`{"apiVersion":"vault.example.com/v1","kind":"VaultSecret","metadata":{"name":"baz","namespace":"foo","labels":{"app.kubernetes.io/instance":"foo"}},"spec":{"values":"%s"}}`, values)
+	}
+	liveState := func(group string, kind string, name string, state string) *argoappv1.ResourceDiff {
+		return &argoappv1.ResourceDiff{Group: group, Kind: kind, Namespace: "foo", Name: name, LiveState: state, NormalizedLiveState: state}
+	}
+	app := &argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+		Spec:       argoappv1.ApplicationSpec{Destination: argoappv1.ApplicationDestination{Namespace: "foo"}},
+	}
+	resources := &application.ManagedResourcesResponse{Items: []*argoappv1.ResourceDiff{
+		liveState("bitnami.com", "SealedSecret", "foo", sealedSecret("plaintext-sealed-old")),
+		liveState("vault.example.com", "VaultSecret", "baz", vaultSecret("plaintext-vault-old")),
+	}}
+	diffOptions := &DifferenceOption{res: &reposerverApiClient.ManifestResponse{Manifests: []string{
+		sealedSecret("plaintext-sealed-new"),
+		externalSecret("plaintext-templated-new"),
+		vaultSecret("plaintext-vault-new"),
+	}}}
+	diffSettings := DiffSettings{RedactionRules: []configuration.RedactionRule{{Group: "vault.example.com", Kind: "VaultSecret", JSONPointers: []string{"/spec/values"}}}}
+
+	_, diffElements, _, _, err := generateArgocdAppDiff(context.Background(), true, app, nil, resources, &settings.Settings{AppLabelKey: "app.kubernetes.io/instance"}, diffOptions, diffSettings)
+	if err != nil {
+		t.Fatalf("generateArgocdAppDiff failed: %v", err)
+	}
+	changeTypes := map[string]string{}
+	for _, diffElement := range diffElements {
+		changeTypes[diffElement.ObjectKind] = diffElement.ChangeType
+		assert.NotContains(t, diffElement.Diff, "plaintext", "%s/%s diff has a plain value", diffElement.ObjectKind, diffElement.ObjectName)
+	}
+	assert.Equal(t, map[string]string{"SealedSecret": ChangeTypeModified, "ExternalSecret": ChangeTypeAdded, "VaultSecret": ChangeTypeModified}, changeTypes)
+}
+
+func TestGroupDiffResultsByComponent(t *testing.T) {
+	t.Parallel()
+	groups := GroupDiffResultsByComponent([]DiffResult{
+		{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar"},
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo-cluster-a"},
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo-cluster-b"},
+	})
+	assert.Equal(t, []ComponentDiffResults{
+		{ComponentPath: "clusters/prod/bar", AppDiffResults: []DiffResult{{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar"}}},
+		{ComponentPath: "clusters/prod/foo", AppDiffResults: []DiffResult{
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo-cluster-a"},
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo-cluster-b"},
+		}},
+	}, groups)
+}
+
+func TestGroupDiffResultsByInstance(t *testing.T) {
+	t.Parallel()
+	groups := GroupDiffResultsByInstance([]DiffResult{
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo"},
+		{ArgoCdInstance: "eu", ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo-eu"},
+		{ArgoCdInstance: "eu", ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar-eu"},
+	})
+	assert.Equal(t, []InstanceDiffResults{
+		{ComponentDiffs: []ComponentDiffResults{
+			{ComponentPath: "clusters/prod/foo", AppDiffResults: []DiffResult{{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo"}}},
+		}},
+		{ArgoCdInstance: "eu", ComponentDiffs: []ComponentDiffResults{
+			{ArgoCdInstance: "eu", ComponentPath: "clusters/prod/foo", AppDiffResults: []DiffResult{{ArgoCdInstance: "eu", ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo-eu"}}},
+			{ArgoCdInstance: "eu", ComponentPath: "clusters/prod/bar", AppDiffResults: []DiffResult{{ArgoCdInstance: "eu", ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar-eu"}}},
+		}},
+	}, groups)
+}
+
+func TestArgoCdClientOptionsOfNamedInstance(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("ARGOCD_SERVER_ADDR_OPTIONS_TEST_EU", "argocd-eu.example.com:443"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	if err := os.Setenv("ARGOCD_INSECURE_OPTIONS_TEST_EU", "true"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	clientOptions, err := argoCdClientOptions(configuration.ArgocdInstance{Name: "options-test-eu"}, "eu-token")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "argocd-eu.example.com:443", clientOptions.ServerAddr)
+		assert.Equal(t, "eu-token", clientOptions.AuthToken)
+		assert.True(t, clientOptions.Insecure)
+		assert.False(t, clientOptions.PlainText)
+	}
+
+	_, err = argoCdClientOptions(configuration.ArgocdInstance{Name: "options-test-unknown"}, "token")
+	assert.EqualError(t, err, "ArgoCD instance \"options-test-unknown\" isn't configured, ARGOCD_SERVER_ADDR_OPTIONS_TEST_UNKNOWN is not set")
+}
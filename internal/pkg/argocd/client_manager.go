@@ -0,0 +1,194 @@
+package argocd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	projectpkg "github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
+	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// closeGracePeriod is how long replaced connections are kept open so in-flight diffs and syncs using them can finish.
+const closeGracePeriod = 5 * time.Minute
+
+// ClientManager holds long-lived ArgoCD API clients that are shared by all PR events.
+// The clients are recreated when the ArgoCD token is rotated or when the ArgoCD API rejects the token or is unreachable.
+type ClientManager struct {
+	// instance is the ArgoCD instance name used in logs and metrics, empty for the default instance
+	instance         string
+	connect          func(authToken string) (argoCdClients, []io.Closer, error)
+	token            func() (string, error)
+	closeGracePeriod time.Duration
+
+	mu      sync.Mutex
+	clients argoCdClients
+	closers []io.Closer
+	// reconnectReason is set when the clients should be recreated on the next use, it's "initial" until the first successful connection
+	reconnectReason string
+	authToken       string
+}
+
+var (
+	sharedClientManagersMu sync.Mutex
+	// sharedClientManagers is nil until StartClientManagers is called, CLI commands create new clients instead.
+	// It's keyed by the instance environment variable suffix, names that share the endpoint environment variables share the manager.
+	sharedClientManagers map[string]*ClientManager
+)
+
+// StartClientManagers enables sharing ArgoCD clients between PR events and returns the client managers of the instances configured in the server environment, see ConfiguredInstances.
+// Managers of other instances are created on first use, connections are established on first use too.
+func StartClientManagers() map[configuration.ArgocdInstance]*ClientManager {
+	sharedClientManagersMu.Lock()
+	defer sharedClientManagersMu.Unlock()
+	if sharedClientManagers == nil {
+		sharedClientManagers = map[string]*ClientManager{}
+	}
+	managers := map[configuration.ArgocdInstance]*ClientManager{}
+	for _, instance := range ConfiguredInstances() {
+		managers[instance] = sharedClientManagerLocked(instance)
+	}
+	return managers
+}
+
+// ConfiguredInstances returns the ArgoCD instances the server environment has an address for, the default instance when ARGOCD_SERVER_ADDR is set
+// and a named instance for every ARGOCD_SERVER_ADDR_<NAME>. The repo configuration isn't known at startup, so named instances are named after the lower-cased <NAME>.
+func ConfiguredInstances() []configuration.ArgocdInstance {
+	instances := []configuration.ArgocdInstance{}
+	if _, ok := os.LookupEnv("ARGOCD_SERVER_ADDR"); ok {
+		instances = append(instances, configuration.ArgocdInstance{})
+	}
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if suffix, ok := strings.CutPrefix(key, "ARGOCD_SERVER_ADDR_"); ok && suffix != "" {
+			instances = append(instances, configuration.ArgocdInstance{Name: strings.ToLower(suffix)})
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+	return instances
+}
+
+func sharedClientManagerLocked(instance configuration.ArgocdInstance) *ClientManager {
+	m, ok := sharedClientManagers[instance.EnvSuffix()]
+	if !ok {
+		m = newClientManager(
+			func(authToken string) (argoCdClients, []io.Closer, error) {
+				return createArgoCdClients(instance, authToken)
+			},
+			func() (string, error) { return argoCdToken(instance) },
+		)
+		m.instance = instance.Name
+		sharedClientManagers[instance.EnvSuffix()] = m
+	}
+	return m
+}
+
+// getSharedClientManager returns the shared client manager of instance, or nil when clients aren't shared.
+func getSharedClientManager(instance configuration.ArgocdInstance) *ClientManager {
+	sharedClientManagersMu.Lock()
+	defer sharedClientManagersMu.Unlock()
+	if sharedClientManagers == nil {
+		return nil
+	}
+	return sharedClientManagerLocked(instance)
+}
+
+// GetArgoCdClients returns the clients of the default ArgoCD instance.
+func GetArgoCdClients() (argoCdClients, error) {
+	return GetInstanceClients(configuration.ArgocdInstance{})
+}
+
+// GetInstanceClients returns the clients of the shared client manager of instance, or new clients when no manager was started(CLI commands).
+func GetInstanceClients(instance configuration.ArgocdInstance) (argoCdClients, error) {
+	if m := getSharedClientManager(instance); m != nil {
+		return m.Clients()
+	}
+	return createInstanceClients(instance)
+}
+
+func newClientManager(connect func(authToken string) (argoCdClients, []io.Closer, error), token func() (string, error)) *ClientManager {
+	return &ClientManager{
+		connect:          connect,
+		token:            token,
+		closeGracePeriod: closeGracePeriod,
+		reconnectReason:  "initial",
+	}
+}
+
+// Clients returns the shared ArgoCD clients, (re)connecting first if needed.
+func (m *ClientManager) Clients() (argoCdClients, error) {
+	token, err := m.token()
+	if err != nil {
+		return argoCdClients{}, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reason := m.reconnectReason
+	if reason == "" && token != m.authToken {
+		reason = "token_rotated"
+	}
+	if reason == "" {
+		return m.clients, nil
+	}
+
+	clients, closers, err := m.connect(token)
+	prom.InstrumentArgoCdConnect(m.instance, reason, err == nil)
+	if err != nil {
+		closeAll(closers)
+		return argoCdClients{}, fmt.Errorf("Error connecting to ArgoCD instance %q(%s): %w", m.instance, reason, err)
+	}
+	if m.closers != nil {
+		log.Infof("Reconnected to ArgoCD instance %q(%s)", m.instance, reason)
+		oldClosers := m.closers
+		time.AfterFunc(m.closeGracePeriod, func() { closeAll(oldClosers) })
+	}
+	m.clients, m.closers, m.authToken, m.reconnectReason = clients, closers, token, ""
+	return m.clients, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for _, c := range closers {
+		if err := c.Close(); err != nil {
+			log.Debugf("Error closing ArgoCD connection: %v", err)
+		}
+	}
+}
+
+// Check verifies the ArgoCD API is reachable and accepts the token, it's meant for the readiness health check.
+// Listing projects is used as settings are readable without authentication.
+func (m *ClientManager) Check(ctx context.Context) error {
+	ac, err := m.Clients()
+	if err == nil {
+		_, err = ac.project.List(ctx, &projectpkg.ProjectQuery{})
+	}
+	prom.InstrumentArgoCdHealthCheck(m.instance, err == nil)
+	if err == nil {
+		return nil
+	}
+
+	switch status.Code(err) {
+	case codes.Unauthenticated:
+		m.markForReconnect("unauthenticated")
+	case codes.Unavailable:
+		m.markForReconnect("unavailable")
+	}
+	return fmt.Errorf("ArgoCD instance %q API check failed: %w", m.instance, err)
+}
+
+func (m *ClientManager) markForReconnect(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reconnectReason == "" {
+		m.reconnectReason = reason
+	}
+}
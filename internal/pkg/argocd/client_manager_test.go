@@ -0,0 +1,139 @@
+package argocd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/mocks"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type countingCloser struct {
+	closed atomic.Int32
+}
+
+func (c *countingCloser) Close() error {
+	c.closed.Add(1)
+	return nil
+}
+
+type fakeConnector struct {
+	tokens  []string
+	closers []*countingCloser
+	clients argoCdClients
+	err     error
+}
+
+func (f *fakeConnector) connect(authToken string) (argoCdClients, []io.Closer, error) {
+	if f.err != nil {
+		return argoCdClients{}, nil, f.err
+	}
+	f.tokens = append(f.tokens, authToken)
+	c := &countingCloser{}
+	f.closers = append(f.closers, c)
+	return f.clients, []io.Closer{c}, nil
+}
+
+func TestClientManagerReusesConnections(t *testing.T) {
+	t.Parallel()
+	connector := &fakeConnector{}
+	token := "token-a"
+	m := newClientManager(connector.connect, func() (string, error) { return token, nil })
+	m.closeGracePeriod = 0
+
+	for i := 0; i < 3; i++ {
+		_, err := m.Clients()
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"token-a"}, connector.tokens, "Clients should connect once")
+
+	token = "token-b"
+	_, err := m.Clients()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"token-a", "token-b"}, connector.tokens, "A rotated token should trigger a reconnection")
+	assert.Eventually(t, func() bool { return connector.closers[0].closed.Load() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(0), connector.closers[1].closed.Load())
+}
+
+func TestClientManagerConnectionError(t *testing.T) {
+	t.Parallel()
+	connector := &fakeConnector{err: errors.New("bad address")}
+	m := newClientManager(connector.connect, func() (string, error) { return "token", nil })
+
+	_, err := m.Clients()
+	assert.ErrorContains(t, err, "bad address")
+
+	connector.err = nil
+	_, err = m.Clients()
+	assert.NoError(t, err, "A failed connection should be retried on the next use")
+	assert.Len(t, connector.tokens, 1)
+}
+
+func TestClientManagerCheck(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		listErr            error
+		expectedReconnects int
+	}{
+		"Healthy": {
+			expectedReconnects: 0,
+		},
+		"Rejected token": {
+			listErr:            status.Error(codes.Unauthenticated, "invalid session"),
+			expectedReconnects: 1,
+		},
+		"Unreachable server": {
+			listErr:            status.Error(codes.Unavailable, "connection refused"),
+			expectedReconnects: 1,
+		},
+		"Permission denied": {
+			listErr:            status.Error(codes.PermissionDenied, "permission denied"),
+			expectedReconnects: 0,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			mockProjectClient := mocks.NewMockProjectServiceClient(ctrl)
+			mockProjectClient.EXPECT().List(gomock.Any(), gomock.Any()).Return(&argoappv1.AppProjectList{}, tc.listErr)
+			connector := &fakeConnector{clients: argoCdClients{project: mockProjectClient}}
+			m := newClientManager(connector.connect, func() (string, error) { return "token", nil })
+
+			err := m.Check(context.Background())
+			if tc.listErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tc.listErr)
+			}
+
+			_, err = m.Clients()
+			assert.NoError(t, err)
+			assert.Len(t, connector.tokens, 1+tc.expectedReconnects)
+		})
+	}
+}
+
+func TestConfiguredInstances(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("ARGOCD_SERVER_ADDR_CONFIGURED_TEST_EU", "argocd-eu.example.com:443"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	instances := ConfiguredInstances()
+	assert.Contains(t, instances, configuration.ArgocdInstance{Name: "configured_test_eu"})
+	// The repo configuration name of the instance shares its environment variables
+	assert.Equal(t, configuration.ArgocdInstance{Name: "configured-test-eu"}.EnvSuffix(), configuration.ArgocdInstance{Name: "configured_test_eu"}.EnvSuffix())
+}
@@ -0,0 +1,78 @@
+package argocd
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+// DiffPolicyViolation is a changed object that breaks a diff policy of its component.
+type DiffPolicyViolation struct {
+	ArgoCdInstance  string
+	ComponentPath   string
+	ArgoCdAppName   string
+	ObjectKind      string
+	ObjectNamespace string
+	ObjectName      string
+	// Reason explains what is wrong with the change, like "decreasing replicas from 3 to 1 requires the `approved-scale-down` label"
+	Reason string
+}
+
+// DiffPolicyViolations returns the objects of diffResult that break policies, prLabels are the PR labels allowing changes that require them.
+// The objects are compared without ignoreDifferences, so ignoring a field doesn't hide its changes from the policies.
+func DiffPolicyViolations(diffResult DiffResult, policies []configuration.DiffPolicy, prLabels []string) []DiffPolicyViolation {
+	var violations []DiffPolicyViolation
+	for _, diffElement := range diffResult.UnfilteredChanges {
+		for _, policy := range policies {
+			if policy.RequireLabel != "" && slices.Contains(prLabels, policy.RequireLabel) {
+				continue
+			}
+			change, ok := policyMatch(policy, diffElement)
+			if !ok {
+				continue
+			}
+			reason := change + " is not allowed"
+			if policy.RequireLabel != "" {
+				reason = fmt.Sprintf("%s requires the `%s` label", change, policy.RequireLabel)
+			}
+			violations = append(violations, DiffPolicyViolation{
+				ArgoCdInstance:  diffResult.ArgoCdInstance,
+				ComponentPath:   diffResult.ComponentPath,
+				ArgoCdAppName:   diffResult.ArgoCdAppName,
+				ObjectKind:      diffElement.ObjectKind,
+				ObjectNamespace: diffElement.ObjectNamespace,
+				ObjectName:      diffElement.ObjectName,
+				Reason:          reason,
+			})
+			// One violation per object is enough
+			break
+		}
+	}
+	return violations
+}
+
+// policyMatch returns a description of the diffElement change when policy matches it.
+func policyMatch(policy configuration.DiffPolicy, diffElement DiffElement) (string, bool) {
+	if diffElement.ChangeType == "" || !slices.Contains(policy.Kinds, diffElement.ObjectKind) {
+		return "", false
+	}
+	if len(policy.ChangeTypes) > 0 && !slices.Contains(policy.ChangeTypes, diffElement.ChangeType) {
+		return "", false
+	}
+	if policy.ReplicasDecrease {
+		// Removed objects aren't scaled down, a policy can match them with the "removed" change type
+		if diffElement.LiveReplicas == nil || diffElement.TargetReplicas == nil || *diffElement.TargetReplicas >= *diffElement.LiveReplicas {
+			return "", false
+		}
+		return fmt.Sprintf("decreasing replicas from %d to %d", *diffElement.LiveReplicas, *diffElement.TargetReplicas), true
+	}
+	switch diffElement.ChangeType {
+	case ChangeTypeAdded:
+		return "adding it", true
+	case ChangeTypeRemoved:
+		return "removing it", true
+	default:
+		return "modifying it", true
+	}
+}
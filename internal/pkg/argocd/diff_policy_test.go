@@ -0,0 +1,67 @@
+package argocd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
+
+func TestDiffPolicyViolations(t *testing.T) {
+	t.Parallel()
+	diffResult := DiffResult{
+		ComponentPath: "clusters/prod/foo",
+		ArgoCdAppName: "foo",
+		HasDiff:       true,
+		UnfilteredChanges: []DiffElement{
+			{ObjectKind: "CustomResourceDefinition", ObjectName: "foos.example.com", ChangeType: ChangeTypeModified},
+			{ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "scaled-down", ChangeType: ChangeTypeModified, LiveReplicas: int64Ptr(3), TargetReplicas: int64Ptr(1)},
+			{ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "scaled-up", ChangeType: ChangeTypeModified, LiveReplicas: int64Ptr(1), TargetReplicas: int64Ptr(3)},
+			{ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "removed", ChangeType: ChangeTypeRemoved, LiveReplicas: int64Ptr(3)},
+			{ObjectKind: "Namespace", ObjectName: "unchanged"},
+		},
+	}
+	crdPolicy := configuration.DiffPolicy{Kinds: []string{"CustomResourceDefinition"}, RequireLabel: "approved-crd-change"}
+	scaleDownPolicy := configuration.DiffPolicy{Kinds: []string{"Deployment", "StatefulSet"}, ReplicasDecrease: true}
+
+	tests := map[string]struct {
+		policies           []configuration.DiffPolicy
+		prLabels           []string
+		expectedViolations []DiffPolicyViolation
+	}{
+		"Required label missing": {
+			policies: []configuration.DiffPolicy{crdPolicy},
+			expectedViolations: []DiffPolicyViolation{
+				{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", ObjectKind: "CustomResourceDefinition", ObjectName: "foos.example.com", Reason: "modifying it requires the `approved-crd-change` label"},
+			},
+		},
+		"Required label present": {
+			policies: []configuration.DiffPolicy{crdPolicy},
+			prLabels: []string{"approved-crd-change"},
+		},
+		"Replicas decrease": {
+			policies: []configuration.DiffPolicy{scaleDownPolicy},
+			expectedViolations: []DiffPolicyViolation{
+				{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "scaled-down", Reason: "decreasing replicas from 3 to 1 is not allowed"},
+			},
+		},
+		"Change types": {
+			policies: []configuration.DiffPolicy{{Kinds: []string{"Deployment", "Namespace"}, ChangeTypes: []string{"removed"}}},
+			expectedViolations: []DiffPolicyViolation{
+				{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "removed", Reason: "removing it is not allowed"},
+			},
+		},
+		"No policies": {},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expectedViolations, DiffPolicyViolations(diffResult, tc.policies, tc.prLabels))
+		})
+	}
+}
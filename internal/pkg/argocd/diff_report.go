@@ -0,0 +1,102 @@
+package argocd
+
+// DiffReportSchemaVersion is bumped on breaking changes of the DiffReport JSON document
+const DiffReportSchemaVersion = 1
+
+// DiffReport is the machine readable form of the diff results of a PR, meant for policy tooling(cost estimation, OPA...) that needs to know what will change in the clusters.
+type DiffReport struct {
+	SchemaVersion int             `json:"schemaVersion"`
+	Repo          string          `json:"repo,omitempty"`
+	PrNumber      int             `json:"prNumber,omitempty"`
+	Revision      string          `json:"revision,omitempty"`
+	CommitSHA     string          `json:"commitSHA,omitempty"`
+	HasDiff       bool            `json:"hasDiff"`
+	HasErrors     bool            `json:"hasErrors"`
+	Apps          []DiffReportApp `json:"apps"`
+}
+
+type DiffReportApp struct {
+	ArgoCdInstance           string               `json:"argoCdInstance,omitempty"`
+	ComponentPath            string               `json:"componentPath"`
+	AppName                  string               `json:"appName,omitempty"`
+	AppURL                   string               `json:"appURL,omitempty"`
+	HasDiff                  bool                 `json:"hasDiff"`
+	Error                    string               `json:"error,omitempty"`
+	AppWasTemporarilyCreated bool                 `json:"appWasTemporarilyCreated,omitempty"`
+	AppSyncedFromPRBranch    bool                 `json:"appSyncedFromPRBranch,omitempty"`
+	IgnoredResources         int                  `json:"ignoredResources,omitempty"`
+	DiffFormat               string               `json:"diffFormat,omitempty"`
+	LinesAdded               int                  `json:"linesAdded,omitempty"`
+	LinesRemoved             int                  `json:"linesRemoved,omitempty"`
+	NotableChanges           []string             `json:"notableChanges,omitempty"`
+	Resources                []DiffReportResource `json:"resources"`
+}
+
+type DiffReportResource struct {
+	Group      string `json:"group,omitempty"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+	ChangeType string `json:"changeType"`
+	Diff       string `json:"diff,omitempty"`
+}
+
+// NewDiffReport converts diff results to a DiffReport, objects that don't change are left out.
+func NewDiffReport(diffResults []DiffResult) DiffReport {
+	report := DiffReport{SchemaVersion: DiffReportSchemaVersion, Apps: []DiffReportApp{}}
+	for _, dr := range diffResults {
+		app := DiffReportApp{
+			ArgoCdInstance:           dr.ArgoCdInstance,
+			ComponentPath:            dr.ComponentPath,
+			AppName:                  dr.ArgoCdAppName,
+			AppURL:                   dr.ArgoCdAppURL,
+			HasDiff:                  dr.HasDiff,
+			AppWasTemporarilyCreated: dr.AppWasTemporarilyCreated,
+			AppSyncedFromPRBranch:    dr.AppSyncedFromPRBranch,
+			IgnoredResources:         dr.IgnoredResources,
+			DiffFormat:               dr.DiffFormat,
+			LinesAdded:               dr.Stats.LinesAdded,
+			LinesRemoved:             dr.Stats.LinesRemoved,
+			NotableChanges:           dr.Stats.NotableChanges(),
+			Resources:                []DiffReportResource{},
+		}
+		if dr.DiffError != nil {
+			app.Error = dr.DiffError.Error()
+			report.HasErrors = true
+		}
+		if dr.HasDiff {
+			report.HasDiff = true
+		}
+		for _, de := range dr.DiffElements {
+			if de.ChangeType == "" {
+				continue
+			}
+			app.Resources = append(app.Resources, DiffReportResource{
+				Group:      de.ObjectGroup,
+				Kind:       de.ObjectKind,
+				Namespace:  de.ObjectNamespace,
+				Name:       de.ObjectName,
+				ChangeType: de.ChangeType,
+				Diff:       de.Diff,
+			})
+		}
+		report.Apps = append(report.Apps, app)
+	}
+	return report
+}
+
+// WithoutDiffs returns a copy of the report without the textual diffs, for destinations with a size limit.
+func (r DiffReport) WithoutDiffs() DiffReport {
+	apps := make([]DiffReportApp, len(r.Apps))
+	for i, app := range r.Apps {
+		resources := make([]DiffReportResource, len(app.Resources))
+		for j, resource := range app.Resources {
+			resource.Diff = ""
+			resources[j] = resource
+		}
+		app.Resources = resources
+		apps[i] = app
+	}
+	r.Apps = apps
+	return r
+}
@@ -0,0 +1,52 @@
+package argocd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDiffReport(t *testing.T) {
+	t.Parallel()
+	report := NewDiffReport([]DiffResult{
+		{
+			ArgoCdInstance: "eu",
+			ComponentPath:  "clusters/prod/foo",
+			ArgoCdAppName:  "foo",
+			ArgoCdAppURL:   "https://argocd.example.com/applications/foo",
+			HasDiff:        true,
+			DiffElements: []DiffElement{
+				{ObjectGroup: "apps", ObjectKind: "Deployment", ObjectNamespace: "foo", ObjectName: "foo", ChangeType: ChangeTypeModified, Diff: "-replicas: 2\n+replicas: 3\n"},
+				{}, // Unchanged object
+				{ObjectKind: "ConfigMap", ObjectNamespace: "foo", ObjectName: "foo-config", ChangeType: ChangeTypeAdded, Diff: "+data: {}\n"},
+			},
+		},
+		{ComponentPath: "clusters/prod/bar", DiffError: errors.New("no ArgoCD application found")},
+	})
+
+	assert.Equal(t, DiffReport{
+		SchemaVersion: DiffReportSchemaVersion,
+		HasDiff:       true,
+		HasErrors:     true,
+		Apps: []DiffReportApp{
+			{
+				ArgoCdInstance: "eu",
+				ComponentPath:  "clusters/prod/foo",
+				AppName:        "foo",
+				AppURL:         "https://argocd.example.com/applications/foo",
+				HasDiff:        true,
+				Resources: []DiffReportResource{
+					{Group: "apps", Kind: "Deployment", Namespace: "foo", Name: "foo", ChangeType: ChangeTypeModified, Diff: "-replicas: 2\n+replicas: 3\n"},
+					{Kind: "ConfigMap", Namespace: "foo", Name: "foo-config", ChangeType: ChangeTypeAdded, Diff: "+data: {}\n"},
+				},
+			},
+			{ComponentPath: "clusters/prod/bar", Error: "no ArgoCD application found", Resources: []DiffReportResource{}},
+		},
+	}, report)
+
+	withoutDiffs := report.WithoutDiffs()
+	assert.Empty(t, withoutDiffs.Apps[0].Resources[0].Diff)
+	assert.Equal(t, "Deployment", withoutDiffs.Apps[0].Resources[0].Kind)
+	assert.NotEmpty(t, report.Apps[0].Resources[0].Diff, "WithoutDiffs shouldn't modify the original report")
+}
@@ -0,0 +1,160 @@
+package argocd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// DiffStats summarize the changed objects of a DiffResult
+type DiffStats struct {
+	// Kinds are the changed objects counts of each kind, sorted by kind
+	Kinds    []KindDiffStats
+	Added    int
+	Removed  int
+	Modified int
+	// LinesAdded and LinesRemoved are counted on the rendered diffs, a modified field of a semantic diff counts as both
+	LinesAdded   int
+	LinesRemoved int
+	// ImageChanged, ReplicasChanged and ResourceRequestsChanged are set when a modified object changes its container images, spec.replicas or container resource requests
+	ImageChanged            bool
+	ReplicasChanged         bool
+	ResourceRequestsChanged bool
+}
+
+// KindDiffStats are the changed objects counts of a single kind
+type KindDiffStats struct {
+	Kind     string
+	Added    int
+	Removed  int
+	Modified int
+}
+
+// String returns the non zero counts, like "Deployment: 1 added, 2 modified"
+func (k KindDiffStats) String() string {
+	var counts []string
+	for _, c := range []struct {
+		count      int
+		changeType string
+	}{{k.Added, ChangeTypeAdded}, {k.Removed, ChangeTypeRemoved}, {k.Modified, ChangeTypeModified}} {
+		if c.count > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", c.count, c.changeType))
+		}
+	}
+	return fmt.Sprintf("%s: %s", k.Kind, strings.Join(counts, ", "))
+}
+
+// NotableChanges lists the changes reviewers should look at, like "image" when container images change
+func (s DiffStats) NotableChanges() []string {
+	var changes []string
+	if s.ImageChanged {
+		changes = append(changes, "image")
+	}
+	if s.ReplicasChanged {
+		changes = append(changes, "replicas")
+	}
+	if s.ResourceRequestsChanged {
+		changes = append(changes, "resource requests")
+	}
+	return changes
+}
+
+// newDiffStats computes the stats of the changed objects of diffElements
+func newDiffStats(diffElements []DiffElement) DiffStats {
+	stats := DiffStats{}
+	kinds := map[string]*KindDiffStats{}
+	for _, diffElement := range diffElements {
+		if diffElement.ChangeType == "" {
+			continue
+		}
+		kindStats, ok := kinds[diffElement.ObjectKind]
+		if !ok {
+			kindStats = &KindDiffStats{Kind: diffElement.ObjectKind}
+			kinds[diffElement.ObjectKind] = kindStats
+		}
+		switch diffElement.ChangeType {
+		case ChangeTypeAdded:
+			kindStats.Added++
+			stats.Added++
+		case ChangeTypeRemoved:
+			kindStats.Removed++
+			stats.Removed++
+		case ChangeTypeModified:
+			kindStats.Modified++
+			stats.Modified++
+			if diffElement.LiveReplicas != nil && diffElement.TargetReplicas != nil && *diffElement.LiveReplicas != *diffElement.TargetReplicas {
+				stats.ReplicasChanged = true
+			}
+		}
+		stats.ImageChanged = stats.ImageChanged || diffElement.ImageChanged
+		stats.ResourceRequestsChanged = stats.ResourceRequestsChanged || diffElement.ResourceRequestsChanged
+		added, removed := countDiffLines(diffElement.Diff)
+		stats.LinesAdded += added
+		stats.LinesRemoved += removed
+	}
+	for _, kindStats := range kinds {
+		stats.Kinds = append(stats.Kinds, *kindStats)
+	}
+	sort.Slice(stats.Kinds, func(i, j int) bool { return stats.Kinds[i].Kind < stats.Kinds[j].Kind })
+	return stats
+}
+
+// countDiffLines counts the added and removed lines of a unified or semantic diff
+func countDiffLines(diff string) (added int, removed int) {
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		// The unified diff header
+		case line == "--- live" || line == "+++ target":
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		// Modified semantic diff fields, multi-line strings have a "! path:" line followed by their own line diff
+		case strings.HasPrefix(line, "! ") && strings.Contains(line, " → "):
+			added++
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// containerFields returns the value of the fields path of every container of obj, by container location and name.
+// Containers are taken from any "containers" or "initContainers" list, so Pods, workloads, CronJobs and custom resources are covered alike.
+func containerFields(obj *unstructured.Unstructured, fields ...string) map[string]interface{} {
+	values := map[string]interface{}{}
+	if obj != nil {
+		collectContainerFields(obj.Object, "", fields, values)
+	}
+	return values
+}
+
+func collectContainerFields(value interface{}, path string, fields []string, values map[string]interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			containers, ok := child.([]interface{})
+			if ok && (key == "containers" || key == "initContainers") {
+				for _, c := range containers {
+					if container, ok := c.(map[string]interface{}); ok {
+						fieldValue, _, _ := unstructured.NestedFieldNoCopy(container, fields...)
+						values[fmt.Sprintf("%s.%s[%v]", path, key, container["name"])] = fieldValue
+					}
+				}
+				continue
+			}
+			collectContainerFields(child, path+"."+key, fields, values)
+		}
+	case []interface{}:
+		for i, child := range v {
+			collectContainerFields(child, fmt.Sprintf("%s[%d]", path, i), fields, values)
+		}
+	}
+}
+
+// containerFieldsChanged reports whether the fields path of any container differs between live and target
+func containerFieldsChanged(live, target *unstructured.Unstructured, fields ...string) bool {
+	return !reflect.DeepEqual(containerFields(live, fields...), containerFields(target, fields...))
+}
@@ -0,0 +1,124 @@
+package argocd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestNewDiffStats(t *testing.T) {
+	t.Parallel()
+	replicas := func(r int64) *int64 { return &r }
+	tests := map[string]struct {
+		diffElements []DiffElement
+		expected     DiffStats
+	}{
+		"Counts by kind and lines": {
+			diffElements: []DiffElement{
+				{ObjectKind: "Deployment", ChangeType: ChangeTypeModified, LiveReplicas: replicas(2), TargetReplicas: replicas(3), ImageChanged: true, Diff: "--- live\n+++ target\n@@ -1,3 +1,3 @@\n spec:\n-  replicas: 2\n+  replicas: 3\n"},
+				{ObjectKind: "ConfigMap", ChangeType: ChangeTypeAdded, Diff: "--- live\n+++ target\n@@ -0,0 +1,2 @@\n+kind: ConfigMap\n+data: {}\n"},
+				{ObjectKind: "ConfigMap", ChangeType: ChangeTypeRemoved, Diff: "- kind: ConfigMap\n"},
+				{ObjectKind: "Service", ChangeType: ChangeTypeModified, Diff: "! spec.ports[0].port: 80 → 8080\n+ spec.type: NodePort\n"},
+				{ObjectKind: "Service"},
+			},
+			expected: DiffStats{
+				Kinds: []KindDiffStats{
+					{Kind: "ConfigMap", Added: 1, Removed: 1},
+					{Kind: "Deployment", Modified: 1},
+					{Kind: "Service", Modified: 1},
+				},
+				Added:           1,
+				Removed:         1,
+				Modified:        2,
+				LinesAdded:      5,
+				LinesRemoved:    3,
+				ImageChanged:    true,
+				ReplicasChanged: true,
+			},
+		},
+		"Unchanged replicas": {
+			diffElements: []DiffElement{
+				{ObjectKind: "Deployment", ChangeType: ChangeTypeModified, LiveReplicas: replicas(2), TargetReplicas: replicas(2), ResourceRequestsChanged: true},
+			},
+			expected: DiffStats{
+				Kinds:                   []KindDiffStats{{Kind: "Deployment", Modified: 1}},
+				Modified:                1,
+				ResourceRequestsChanged: true,
+			},
+		},
+		"No changes": {
+			expected: DiffStats{},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, newDiffStats(tc.diffElements))
+		})
+	}
+}
+
+func TestKindDiffStatsString(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "Deployment: 1 added, 2 modified", KindDiffStats{Kind: "Deployment", Added: 1, Modified: 2}.String())
+	assert.Equal(t, "ConfigMap: 3 removed", KindDiffStats{Kind: "ConfigMap", Removed: 3}.String())
+}
+
+func TestContainerFieldsChanged(t *testing.T) {
+	t.Parallel()
+	object := func(t *testing.T, s string) *unstructured.Unstructured {
+		t.Helper()
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(s), &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+	tests := map[string]struct {
+		live     string
+		target   string
+		fields   []string
+		expected bool
+	}{
+		"Deployment image": {
+			live:     `{"spec":{"template":{"spec":{"containers":[{"name":"app","image":"app:v1"}]}}}}`,
+			target:   `{"spec":{"template":{"spec":{"containers":[{"name":"app","image":"app:v2"}]}}}}`,
+			fields:   []string{"image"},
+			expected: true,
+		},
+		"CronJob init container image": {
+			live:     `{"spec":{"jobTemplate":{"spec":{"template":{"spec":{"initContainers":[{"name":"init","image":"init:v1"}]}}}}}}`,
+			target:   `{"spec":{"jobTemplate":{"spec":{"template":{"spec":{"initContainers":[{"name":"init","image":"init:v2"}]}}}}}}`,
+			fields:   []string{"image"},
+			expected: true,
+		},
+		"Reordered containers": {
+			live:     `{"spec":{"containers":[{"name":"a","image":"a:v1"},{"name":"b","image":"b:v1"}]}}`,
+			target:   `{"spec":{"containers":[{"name":"b","image":"b:v1"},{"name":"a","image":"a:v1"}]}}`,
+			fields:   []string{"image"},
+			expected: false,
+		},
+		"Resource requests": {
+			live:     `{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"100m"},"limits":{"cpu":"1"}}}]}}`,
+			target:   `{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"200m"},"limits":{"cpu":"1"}}}]}}`,
+			fields:   []string{"resources", "requests"},
+			expected: true,
+		},
+		"Resource limits only": {
+			live:     `{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"100m"},"limits":{"cpu":"1"}}}]}}`,
+			target:   `{"spec":{"containers":[{"name":"app","resources":{"requests":{"cpu":"100m"},"limits":{"cpu":"2"}}}]}}`,
+			fields:   []string{"resources", "requests"},
+			expected: false,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, containerFieldsChanged(object(t, tc.live), object(t, tc.target), tc.fields...))
+		})
+	}
+}
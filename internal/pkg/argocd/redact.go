@@ -0,0 +1,152 @@
+package argocd
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Redacted values are replaced by markers rather than hashes, a hash of a short secret can be brute forced
+const (
+	redactedValue        = "<redacted>"
+	changedRedactedValue = "<changed>"
+)
+
+// lastAppliedConfigurationPointer is redacted in every object with redacted fields, kubectl copies the whole object to this annotation
+const lastAppliedConfigurationPointer = "/metadata/annotations/kubectl.kubernetes.io~1last-applied-configuration"
+
+// builtinRedactionRules redact the data of the common secret kinds, configured rules are added to them
+var builtinRedactionRules = []configuration.RedactionRule{
+	{Kind: "Secret", JSONPointers: []string{"/data", "/stringData"}},
+	{Group: "bitnami.com", Kind: "SealedSecret", JSONPointers: []string{"/spec/encryptedData", "/spec/template/data"}},
+	{Group: "external-secrets.io", Kind: "ExternalSecret", JSONPointers: []string{"/spec/target/template/data"}},
+}
+
+// redactObjects returns copies of live and target where the values of the fields matched by the built-in rules and rules are replaced by markers.
+// Fields holding a map, like Secret data, are redacted key by key so the diff still shows which keys are added, removed or changed.
+func redactObjects(live, target *unstructured.Unstructured, rules []configuration.RedactionRule) (*unstructured.Unstructured, *unstructured.Unstructured) {
+	obj := live
+	if obj == nil {
+		obj = target
+	}
+	if obj == nil {
+		return live, target
+	}
+	pointers := redactedPointers(obj.GroupVersionKind().Group, obj.GetKind(), rules)
+	if len(pointers) == 0 {
+		return live, target
+	}
+	if live != nil {
+		live = live.DeepCopy()
+	}
+	if target != nil {
+		target = target.DeepCopy()
+	}
+	for _, pointer := range pointers {
+		redactField(live, target, pointerFields(pointer))
+	}
+	return live, target
+}
+
+// redactedPointers returns the JSON pointers of the fields to redact in objects of group and kind
+func redactedPointers(group string, kind string, rules []configuration.RedactionRule) []string {
+	var pointers []string
+	for _, rule := range append(slices.Clone(builtinRedactionRules), rules...) {
+		if rule.Group == group && rule.Kind == kind {
+			pointers = append(pointers, rule.JSONPointers...)
+		}
+	}
+	if len(pointers) > 0 {
+		pointers = append(pointers, lastAppliedConfigurationPointer)
+	}
+	return pointers
+}
+
+// pointerFields splits a JSON pointer to the unescaped names of the nested fields
+func pointerFields(pointer string) []string {
+	fields := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, field := range fields {
+		fields[i] = strings.ReplaceAll(strings.ReplaceAll(field, "~1", "/"), "~0", "~")
+	}
+	return fields
+}
+
+// redactField replaces the value of the fields path in live and target, target values that differ from the live ones are marked as changed.
+func redactField(live, target *unstructured.Unstructured, fields []string) {
+	liveValue, liveFound := nestedField(live, fields)
+	targetValue, targetFound := nestedField(target, fields)
+	liveMap, liveIsMap := liveValue.(map[string]interface{})
+	targetMap, targetIsMap := targetValue.(map[string]interface{})
+	if (liveIsMap || !liveFound) && (targetIsMap || !targetFound) {
+		for key, value := range targetMap {
+			liveKeyValue, inLive := liveMap[key]
+			targetMap[key] = redactedMarker(liveKeyValue, value, inLive)
+		}
+		for key := range liveMap {
+			liveMap[key] = redactedValue
+		}
+		return
+	}
+	if targetFound {
+		setNestedField(target, redactedMarker(liveValue, targetValue, liveFound), fields)
+	}
+	if liveFound {
+		setNestedField(live, redactedValue, fields)
+	}
+}
+
+// redactedMarker returns the marker of a target value, inLive is false for values missing from the live object
+func redactedMarker(liveValue interface{}, targetValue interface{}, inLive bool) string {
+	if inLive && reflect.DeepEqual(liveValue, targetValue) {
+		return redactedValue
+	}
+	return changedRedactedValue
+}
+
+// nestedField returns the value of the fields path in obj, without copying it. Fields of a list are indexes, like "0" in /spec/data/0/value.
+func nestedField(obj *unstructured.Unstructured, fields []string) (interface{}, bool) {
+	if obj == nil {
+		return nil, false
+	}
+	var value interface{} = obj.Object
+	for _, field := range fields {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, ok := v[field]
+			if !ok {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setNestedField replaces the value of the fields path in obj, the path has to exist
+func setNestedField(obj *unstructured.Unstructured, value interface{}, fields []string) {
+	parent, found := nestedField(obj, fields[:len(fields)-1])
+	if !found {
+		return
+	}
+	field := fields[len(fields)-1]
+	switch p := parent.(type) {
+	case map[string]interface{}:
+		p[field] = value
+	case []interface{}:
+		if i, err := strconv.Atoi(field); err == nil && i >= 0 && i < len(p) {
+			p[i] = value
+		}
+	}
+}
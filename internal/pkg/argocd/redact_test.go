@@ -0,0 +1,132 @@
+package argocd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRedactObjects(t *testing.T) {
+	t.Parallel()
+	secret := func(data map[string]interface{}, stringData map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "Secret",
+			"metadata": map[string]interface{}{
+				"name": "foo",
+				"annotations": map[string]interface{}{
+					"kubectl.kubernetes.io/last-applied-configuration": `{"data":{"password":"cGxhaW50ZXh0LW9sZA=="}}`,
+				},
+			},
+		}}
+		if data != nil {
+			obj.Object["data"] = data
+		}
+		if stringData != nil {
+			obj.Object["stringData"] = stringData
+		}
+		return obj
+	}
+	vaultSecret := func(values string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "vault.example.com/v1",
+			"kind":       "VaultSecret",
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"spec":       map[string]interface{}{"path": "secret/foo", "values": values},
+		}}
+	}
+	vaultRules := []configuration.RedactionRule{{Group: "vault.example.com", Kind: "VaultSecret", JSONPointers: []string{"/spec/values"}}}
+	credentials := func(password string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "db.example.com/v1",
+			"kind":       "Credentials",
+			"metadata":   map[string]interface{}{"name": "foo"},
+			"spec": map[string]interface{}{"data": []interface{}{
+				map[string]interface{}{"name": "password", "value": password},
+				map[string]interface{}{"name": "username", "value": "admin"},
+			}},
+		}}
+	}
+	credentialsRules := []configuration.RedactionRule{{Group: "db.example.com", Kind: "Credentials", JSONPointers: []string{"/spec/data/0/value", "/spec/data/5/value"}}}
+
+	tests := map[string]struct {
+		live           *unstructured.Unstructured
+		target         *unstructured.Unstructured
+		rules          []configuration.RedactionRule
+		plainValues    []string
+		expectedInDiff []string
+	}{
+		"Secret data keys are redacted one by one": {
+			live: secret(map[string]interface{}{
+				"password": "cGxhaW50ZXh0LW9sZA==",
+				"username": "cGxhaW50ZXh0LXVzZXI=",
+				"token":    "cGxhaW50ZXh0LXRva2Vu",
+			}, nil),
+			target: secret(map[string]interface{}{
+				"password": "cGxhaW50ZXh0LW5ldw==",
+				"username": "cGxhaW50ZXh0LXVzZXI=",
+				"apiKey":   "cGxhaW50ZXh0LWtleQ==",
+			}, map[string]interface{}{"extra": "plaintext-extra"}),
+			plainValues:    []string{"cGxhaW50ZXh0LW9sZA==", "cGxhaW50ZXh0LW5ldw==", "cGxhaW50ZXh0LXVzZXI=", "cGxhaW50ZXh0LXRva2Vu", "cGxhaW50ZXh0LWtleQ==", "plaintext-extra"},
+			expectedInDiff: []string{"-    password: <redacted>", "+    password: <changed>", "+    apiKey: <changed>", "-    token: <redacted>", "+    extra: <changed>"},
+		},
+		"Added Secret": {
+			target:         secret(map[string]interface{}{"password": "cGxhaW50ZXh0LW5ldw=="}, nil),
+			plainValues:    []string{"cGxhaW50ZXh0LW5ldw==", "cGxhaW50ZXh0LW9sZA=="},
+			expectedInDiff: []string{"+    password: <changed>"},
+		},
+		"Removed Secret": {
+			live:           secret(map[string]interface{}{"password": "cGxhaW50ZXh0LW9sZA=="}, nil),
+			plainValues:    []string{"cGxhaW50ZXh0LW9sZA=="},
+			expectedInDiff: []string{"-    password: <redacted>"},
+		},
+		"Configured kind and path": {
+			live:           vaultSecret("plaintext-old"),
+			target:         vaultSecret("plaintext-new"),
+			rules:          vaultRules,
+			plainValues:    []string{"plaintext-old", "plaintext-new"},
+			expectedInDiff: []string{"-    values: <redacted>", "+    values: <changed>"},
+		},
+		"Configured path through a list": {
+			live:           credentials("plaintext-old"),
+			target:         credentials("plaintext-new"),
+			rules:          credentialsRules,
+			plainValues:    []string{"plaintext-old", "plaintext-new"},
+			expectedInDiff: []string{"-      value: <redacted>", "+      value: <changed>", "      value: admin"},
+		},
+		"Configured rules only match their kind": {
+			live:           vaultSecret("not-a-secret-old"),
+			target:         vaultSecret("not-a-secret-new"),
+			expectedInDiff: []string{"-    values: not-a-secret-old", "+    values: not-a-secret-new"},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var liveBefore, targetBefore *unstructured.Unstructured
+			if tc.live != nil {
+				liveBefore = tc.live.DeepCopy()
+			}
+			if tc.target != nil {
+				targetBefore = tc.target.DeepCopy()
+			}
+
+			live, target := redactObjects(tc.live, tc.target, tc.rules)
+			diff, err := diffLiveVsTargetObject(live, target)
+			if err != nil {
+				t.Fatalf("diffLiveVsTargetObject failed: %v", err)
+			}
+			for _, plainValue := range tc.plainValues {
+				assert.NotContains(t, diff, plainValue)
+			}
+			for _, expected := range tc.expectedInDiff {
+				assert.Contains(t, diff, expected)
+			}
+			assert.Equal(t, liveBefore, tc.live, "The live object shouldn't be changed")
+			assert.Equal(t, targetBefore, tc.target, "The target object shouldn't be changed")
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package argocd
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd/diff"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// semanticDiffCtxLines is the context of the line diffs of multi-line strings, like files embedded in ConfigMaps
+const semanticDiffCtxLines = 3
+
+// listItemKeys are the fields that identify list items, like containers or env variables, tried in order
+var listItemKeys = []string{"name", "key"}
+
+// plainFieldName matches field names that don't need to be quoted in field paths
+var plainFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// semanticDiff returns the changed fields of live and target, one per line, prefixed like a diff so GitHub highlights them:
+// "+" for added fields, "-" for removed fields and "!" for modified fields, like "! spec.template.spec.containers[name=app].image: app:v1 → app:v2".
+// List items are matched by their name or key, multi-line strings get a line diff under their field path.
+// changedFields are the prefixed field paths of the changes without their values, like "! spec.template.spec.containers[name=app].image".
+func semanticDiff(live, target *unstructured.Unstructured) (diffText string, changedFields []string) {
+	var liveObject, targetObject interface{}
+	if live != nil {
+		liveObject = live.Object
+	}
+	if target != nil {
+		targetObject = target.Object
+	}
+	var c fieldChanges
+	walkFieldChanges(&c, "", liveObject, targetObject)
+	return c.b.String(), c.fields
+}
+
+// fieldChanges collects the output of semanticDiff
+type fieldChanges struct {
+	b      strings.Builder
+	fields []string
+}
+
+// add writes a changed field, prefix is one of "+", "-" or "!" and value is what follows the field path on its diff line
+func (c *fieldChanges) add(prefix string, path string, value string) {
+	fmt.Fprintf(&c.b, "%s %s:%s\n", prefix, path, value)
+	c.fields = append(c.fields, prefix+" "+path)
+}
+
+// walkFieldChanges writes the changes of the field at path, a nil value means the field doesn't exist on that side
+func walkFieldChanges(c *fieldChanges, path string, live, target interface{}) {
+	if reflect.DeepEqual(live, target) {
+		return
+	}
+	liveMap, liveIsMap := live.(map[string]interface{})
+	targetMap, targetIsMap := target.(map[string]interface{})
+	liveList, liveIsList := live.([]interface{})
+	targetList, targetIsList := target.([]interface{})
+	switch {
+	case (liveIsMap || live == nil) && (targetIsMap || target == nil) && len(liveMap)+len(targetMap) > 0:
+		keys := map[string]bool{}
+		for key := range liveMap {
+			keys[key] = true
+		}
+		for key := range targetMap {
+			keys[key] = true
+		}
+		for _, key := range sortedKeys(keys) {
+			walkFieldChanges(c, fieldPath(path, key), liveMap[key], targetMap[key])
+		}
+	case (liveIsList || live == nil) && (targetIsList || target == nil) && len(liveList)+len(targetList) > 0:
+		walkListChanges(c, path, liveList, targetList)
+	case live == nil:
+		c.add("+", path, " "+fieldValue(target))
+	case target == nil:
+		c.add("-", path, " "+fieldValue(live))
+	default:
+		liveString, liveIsString := live.(string)
+		targetString, targetIsString := target.(string)
+		if liveIsString && targetIsString && (strings.Contains(liveString, "\n") || strings.Contains(targetString, "\n")) {
+			c.add("!", path, "")
+			c.b.WriteString(multiLineDiff(liveString, targetString))
+			return
+		}
+		c.add("!", path, fmt.Sprintf(" %s → %s", fieldValue(live), fieldValue(target)))
+	}
+}
+
+// walkListChanges matches the items of live and target by their key field, or by their index when they don't all have one
+func walkListChanges(c *fieldChanges, path string, live, target []interface{}) {
+	key := listItemKey(live, target)
+	if key == "" {
+		for i := 0; i < len(live) || i < len(target); i++ {
+			var liveItem, targetItem interface{}
+			if i < len(live) {
+				liveItem = live[i]
+			}
+			if i < len(target) {
+				targetItem = target[i]
+			}
+			walkFieldChanges(c, fmt.Sprintf("%s[%d]", path, i), liveItem, targetItem)
+		}
+		return
+	}
+	liveItems := map[string]interface{}{}
+	var itemNames []string
+	for _, item := range live {
+		name := item.(map[string]interface{})[key].(string)
+		liveItems[name] = item
+		itemNames = append(itemNames, name)
+	}
+	targetItems := map[string]interface{}{}
+	for _, item := range target {
+		name := item.(map[string]interface{})[key].(string)
+		targetItems[name] = item
+		if _, ok := liveItems[name]; !ok {
+			itemNames = append(itemNames, name)
+		}
+	}
+	// Removed and modified items keep the live order, added items are last in the target order
+	for _, name := range itemNames {
+		walkFieldChanges(c, fmt.Sprintf("%s[%s=%s]", path, key, name), liveItems[name], targetItems[name])
+	}
+}
+
+// listItemKey returns the first of listItemKeys that all the items of live and target have, with unique values in each list, empty when there is none
+func listItemKey(live, target []interface{}) string {
+	for _, key := range listItemKeys {
+		if isListItemKey(key, live) && isListItemKey(key, target) {
+			return key
+		}
+	}
+	return ""
+}
+
+func isListItemKey(key string, items []interface{}) bool {
+	seen := map[string]bool{}
+	for _, item := range items {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		value, ok := itemMap[key].(string)
+		if !ok || seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// fieldPath appends key to path, keys that aren't plain names, like annotations, are quoted
+func fieldPath(path string, key string) string {
+	if !plainFieldName.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// fieldValue renders a value on a single line
+func fieldValue(value interface{}) string {
+	if s, ok := value.(string); ok && !strings.Contains(s, "\n") {
+		return s
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(b)
+}
+
+// multiLineDiff returns the line diff of two multi-line strings, without the file names header
+func multiLineDiff(live, target string) string {
+	patch := string(diff.Diff(semanticDiffCtxLines, "live", []byte(live), "target", []byte(target)))
+	// The header is the "diff live target", "--- live" and "+++ target" lines
+	lines := strings.SplitN(patch, "\n", 4)
+	if len(lines) < 4 {
+		return ""
+	}
+	return lines[3]
+}
+
+func sortedKeys(keys map[string]bool) []string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,87 @@
+package argocd
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestSemanticDiff(t *testing.T) {
+	t.Parallel()
+	object := func(t *testing.T, s string) *unstructured.Unstructured {
+		t.Helper()
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(s), &obj.Object); err != nil {
+			t.Fatal(err)
+		}
+		return obj
+	}
+	tests := map[string]struct {
+		live     string
+		target   string
+		expected string
+		// expectedFields are only checked when set
+		expectedFields []string
+	}{
+		"List items are matched by name, whatever their order": {
+			live: `{"kind":"Deployment","spec":{"template":{"spec":{"containers":[
+				{"name":"sidecar","image":"proxy:v1"},
+				{"name":"app","image":"app:v1","env":[{"name":"FOO","value":"foo"},{"name":"BAR","value":"bar"}]}
+			]}}}}`,
+			target: `{"kind":"Deployment","spec":{"template":{"spec":{"containers":[
+				{"name":"app","image":"app:v2","env":[{"name":"FOO","value":"foo"},{"name":"BAZ","value":"baz"}]},
+				{"name":"sidecar","image":"proxy:v1"}
+			]}}}}`,
+			expected: "- spec.template.spec.containers[name=app].env[name=BAR].name: BAR\n" +
+				"- spec.template.spec.containers[name=app].env[name=BAR].value: bar\n" +
+				"+ spec.template.spec.containers[name=app].env[name=BAZ].name: BAZ\n" +
+				"+ spec.template.spec.containers[name=app].env[name=BAZ].value: baz\n" +
+				"! spec.template.spec.containers[name=app].image: app:v1 → app:v2\n",
+		},
+		"List items without names are matched by index": {
+			live:           `{"spec":{"args":["--foo","--bar"],"items":[{"key":"a","path":"a"},{"key":"a","path":"b"}]}}`,
+			target:         `{"spec":{"args":["--foo","--baz","--qux"],"items":[{"key":"a","path":"a"},{"key":"a","path":"c"}]}}`,
+			expected:       "! spec.args[1]: --bar → --baz\n+ spec.args[2]: --qux\n! spec.items[1].path: b → c\n",
+			expectedFields: []string{"! spec.args[1]", "+ spec.args[2]", "! spec.items[1].path"},
+		},
+		"Field names that aren't plain are quoted": {
+			live:     `{"metadata":{"annotations":{"checksum/config":"aaa","app.kubernetes.io/version":"1"}},"spec":{"replicas":2}}`,
+			target:   `{"metadata":{"annotations":{"checksum/config":"bbb"}},"spec":{"replicas":3,"selector":{}}}`,
+			expected: "- metadata.annotations[\"app.kubernetes.io/version\"]: 1\n! metadata.annotations[\"checksum/config\"]: aaa → bbb\n! spec.replicas: 2 → 3\n+ spec.selector: {}\n",
+		},
+		"Multi-line strings get a line diff": {
+			live:           `{"kind":"ConfigMap","data":{"config.yaml":"a: 1\nb: 2\nc: 3\n","name":"foo"}}`,
+			target:         `{"kind":"ConfigMap","data":{"config.yaml":"a: 1\nb: 20\nc: 3\n","name":"foo"}}`,
+			expected:       "! data[\"config.yaml\"]:\n@@ -1,3 +1,3 @@\n a: 1\n-b: 2\n+b: 20\n c: 3\n",
+			expectedFields: []string{"! data[\"config.yaml\"]"},
+		},
+		"Added object": {
+			target:   `{"kind":"ConfigMap","metadata":{"name":"foo","labels":{"app":"foo"}},"data":{"ports":[80,443]}}`,
+			expected: "+ data.ports[0]: 80\n+ data.ports[1]: 443\n+ kind: ConfigMap\n+ metadata.labels.app: foo\n+ metadata.name: foo\n",
+		},
+		"Removed object": {
+			live:     `{"kind":"ConfigMap","metadata":{"name":"foo"}}`,
+			expected: "- kind: ConfigMap\n- metadata.name: foo\n",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var live, target *unstructured.Unstructured
+			if tc.live != "" {
+				live = object(t, tc.live)
+			}
+			if tc.target != "" {
+				target = object(t, tc.target)
+			}
+			diffText, changedFields := semanticDiff(live, target)
+			assert.Equal(t, tc.expected, diffText)
+			if tc.expectedFields != nil {
+				assert.Equal(t, tc.expectedFields, changedFields)
+			}
+		})
+	}
+}
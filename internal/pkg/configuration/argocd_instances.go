@@ -0,0 +1,41 @@
+package configuration
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// EnvSuffix returns the suffix of the environment variables holding the instance endpoint and token, the upper-cased name with every non-alphanumeric character replaced by "_".
+func (i ArgocdInstance) EnvSuffix() string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, i.Name)
+}
+
+// InstanceForComponent returns the ArgoCD instance of componentPath, the zero ArgocdInstance is the default instance.
+func (c ArgocdConfig) InstanceForComponent(componentPath string) (ArgocdInstance, error) {
+	for _, ci := range c.ComponentInstances {
+		r, err := regexp.Compile(ci.ComponentPathRegex)
+		if err != nil {
+			return ArgocdInstance{}, fmt.Errorf("invalid ArgoCD componentPathRegex %q: %w", ci.ComponentPathRegex, err)
+		}
+		if !r.MatchString(componentPath) {
+			continue
+		}
+		for _, instance := range c.Instances {
+			if instance.Name == ci.Instance {
+				return instance, nil
+			}
+		}
+		return ArgocdInstance{}, fmt.Errorf("unknown ArgoCD instance %q for component %s", ci.Instance, componentPath)
+	}
+	return ArgocdInstance{}, nil
+}
@@ -0,0 +1,55 @@
+package configuration
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceForComponent(t *testing.T) {
+	t.Parallel()
+	eu := ArgocdInstance{Name: "eu"}
+	config := ArgocdConfig{
+		Instances: []ArgocdInstance{eu},
+		ComponentInstances: []ArgocdComponentInstance{
+			{ComponentPathRegex: "^clusters/eu-[^/]*/", Instance: "eu"},
+			{ComponentPathRegex: "^clusters/ap-[^/]*/", Instance: "ap"},
+		},
+	}
+	tests := map[string]struct {
+		componentPath    string
+		expectedInstance ArgocdInstance
+		expectedError    string
+	}{
+		"Mapped component": {
+			componentPath:    "clusters/eu-west1/foo",
+			expectedInstance: eu,
+		},
+		"Unmapped component uses the default instance": {
+			componentPath:    "clusters/us-east1/foo",
+			expectedInstance: ArgocdInstance{},
+		},
+		"Unknown instance": {
+			componentPath: "clusters/ap-south1/foo",
+			expectedError: "unknown ArgoCD instance \"ap\" for component clusters/ap-south1/foo",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			instance, err := config.InstanceForComponent(tc.componentPath)
+			if tc.expectedError != "" {
+				assert.EqualError(t, err, tc.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedInstance, instance)
+		})
+	}
+}
+
+func TestEnvSuffix(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "EU_WEST_1", ArgocdInstance{Name: "eu-west.1"}.EnvSuffix())
+}
@@ -0,0 +1,31 @@
+package configuration
+
+import "slices"
+
+const (
+	defaultCommitStatusContext     = "telefonistka"
+	defaultCommitStatusDescription = "Telefonistka GitOps Bot"
+	// CommitStatusDescriptionMaxLength is the GitHub limit of a commit status description
+	CommitStatusDescriptionMaxLength = 140
+)
+
+// ContextName returns the commit status context, "telefonistka" unless configured.
+func (c CommitStatusConfig) ContextName() string {
+	if c.Context == "" {
+		return defaultCommitStatusContext
+	}
+	return c.Context
+}
+
+// DescriptionText returns the commit status description, "Telefonistka GitOps Bot" unless configured.
+func (c CommitStatusConfig) DescriptionText() string {
+	if c.Description == "" {
+		return defaultCommitStatusDescription
+	}
+	return c.Description
+}
+
+// IsBlockedKind reports whether changes to objects of kind fail the commit status.
+func (f CommitStatusFailOn) IsBlockedKind(kind string) bool {
+	return slices.Contains(f.BlockedKinds, kind)
+}
@@ -13,6 +13,41 @@ type ComponentConfig struct {
 	PromotionTargetAllowList []string `yaml:"promotionTargetAllowList"`
 	PromotionTargetBlockList []string `yaml:"promotionTargetBlockList"`
 	DisableArgoCDDiff        bool     `yaml:"disableArgoCDDiff"`
+	// DiffPolicies are checked against the ArgoCD diff of the component, violations fail the commit status
+	DiffPolicies []DiffPolicy `yaml:"diffPolicies"`
+	// IgnoreDifferences are added to the ignoreDifferences of the component ArgoCD apps when diffing them
+	IgnoreDifferences []IgnoreDifference `yaml:"ignoreDifferences"`
+	// DiffFormat is how the ArgoCD diff of changed objects is rendered, one of the DiffFormat* constants, DiffFormatUnified by default
+	DiffFormat string `yaml:"diffFormat"`
+}
+
+const (
+	// DiffFormatUnified renders a line based diff of the object YAML
+	DiffFormatUnified = "unified"
+	// DiffFormatSemantic renders the changed fields of the object, like "spec.replicas: 2 → 3"
+	DiffFormatSemantic = "semantic"
+)
+
+// DiffPolicy matches changed objects in the ArgoCD diff, every matching object is a violation unless the PR has RequireLabel.
+type DiffPolicy struct {
+	Kinds []string `yaml:"kinds"`
+	// ChangeTypes limits the policy to "added", "removed" or "modified" objects, any change matches by default
+	ChangeTypes []string `yaml:"changeTypes"`
+	// ReplicasDecrease limits the policy to objects whose spec.replicas decreases
+	ReplicasDecrease bool   `yaml:"replicasDecrease"`
+	RequireLabel     string `yaml:"requireLabel"`
+}
+
+// IgnoreDifference has the fields of an ArgoCD app ignoreDifferences entry, Group and Kind accept globs.
+type IgnoreDifference struct {
+	Group             string   `yaml:"group"`
+	Kind              string   `yaml:"kind"`
+	Name              string   `yaml:"name"`
+	Namespace         string   `yaml:"namespace"`
+	JSONPointers      []string `yaml:"jsonPointers"`
+	JQPathExpressions []string `yaml:"jqPathExpressions"`
+	// ManagedFieldsManagers are the managers whose fields are ignored, like "kube-controller-manager"
+	ManagedFieldsManagers []string `yaml:"managedFieldsManagers"`
 }
 
 type Condition struct {
@@ -23,6 +58,10 @@ type Condition struct {
 type PromotionPr struct {
 	TargetDescription string   `yaml:"targetDescription"`
 	TargetPaths       []string `yaml:"targetPaths"`
+	// DeploymentWindows limit when the promotion PR can be auto merged, no windows means any time
+	DeploymentWindows []DeploymentWindow `yaml:"deploymentWindows"`
+	// FreezeCalendars are names of Config.FreezeCalendars entries that block auto merge while one of their periods is in effect
+	FreezeCalendars []string `yaml:"freezeCalendars"`
 }
 
 type PromotionPath struct {
@@ -30,6 +69,8 @@ type PromotionPath struct {
 	ComponentPathExtraDepth int           `yaml:"componentPathExtraDepth"`
 	SourcePath              string        `yaml:"sourcePath"`
 	PromotionPrs            []PromotionPr `yaml:"promotionPrs"`
+	// UpdateExistingPromotionPrs pushes new sync commits to an open promotion PR of the same source and targets instead of opening a new one
+	UpdateExistingPromotionPrs bool `yaml:"updateExistingPromotionPrs"`
 }
 
 type Config struct {
@@ -44,6 +85,47 @@ type Config struct {
 	WebhookEndpointRegexs        []WebhookEndpointRegex `yaml:"webhookEndpointRegexs"`
 	WhProxtSkipTLSVerifyUpstream bool                   `yaml:"whProxtSkipTLSVerifyUpstream"`
 	Argocd                       ArgocdConfig           `yaml:"argocd"`
+	// Named freeze calendars, referenced by promotionPrs[].freezeCalendars
+	FreezeCalendars map[string][]FreezePeriod `yaml:"freezeCalendars"`
+	CheckRuns       CheckRunsConfig           `yaml:"checkRuns"`
+	CommitStatus    CommitStatusConfig        `yaml:"commitStatus"`
+	Comments        CommentsConfig            `yaml:"comments"`
+}
+
+// DefaultStickyCommentMaxRevisions is the number of previous revisions kept in sticky comments when comments.maxRevisions isn't set
+const DefaultStickyCommentMaxRevisions = 5
+
+// CommentsConfig controls how the ArgoCD diff and drift comments are posted on PRs.
+type CommentsConfig struct {
+	// Sticky edits a single comment of each kind(plus the overflow parts of large diffs) on every PR change instead of minimizing the old comments and posting new ones
+	Sticky bool `yaml:"sticky"`
+	// MaxRevisions is the number of previous revisions kept in a collapsible section of sticky comments, defaults to DefaultStickyCommentMaxRevisions
+	MaxRevisions int `yaml:"maxRevisions"`
+}
+
+// CommitStatusConfig controls the commit status set on the PRs handled by Telefonistka.
+type CommitStatusConfig struct {
+	// Context defaults to "telefonistka"
+	Context string `yaml:"context"`
+	// Description defaults to "Telefonistka GitOps Bot"
+	Description string             `yaml:"description"`
+	FailOn      CommitStatusFailOn `yaml:"failOn"`
+}
+
+// CommitStatusFailOn lists the PR conditions that set the commit status to failure instead of success.
+type CommitStatusFailOn struct {
+	DiffErrors bool `yaml:"diffErrors"`
+	Drift      bool `yaml:"drift"`
+	// BlockedKinds are Kubernetes object kinds, like CustomResourceDefinition or Namespace, the ArgoCD diff shouldn't add, remove or modify
+	BlockedKinds []string `yaml:"blockedKinds"`
+}
+
+// CheckRunsConfig controls the check runs created for each phase of the PR handling: config validation, promotion plan, ArgoCD diff and drift detection.
+// Check runs are only supported on GitHub.
+type CheckRunsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// LargeArgocdDiffInCheckRun keeps ArgoCD diffs that don't fit a single PR comment in the ArgoCD diff check run, the PR gets one concise comment instead of a comment per component
+	LargeArgocdDiffInCheckRun bool `yaml:"largeArgocdDiffInCheckRun"`
 }
 
 type ArgocdConfig struct {
@@ -52,6 +134,33 @@ type ArgocdConfig struct {
 	AllowSyncfromBranchPathRegex  string `yaml:"allowSyncfromBranchPathRegex"`
 	UseSHALabelForAppDiscovery    bool   `yaml:"useSHALabelForAppDiscovery"`
 	CreateTempAppObjectFroNewApps bool   `yaml:"createTempAppObjectFromNewApps"`
+	// DiffReportCheckRun publishes the diff as a JSON document in a check run, for tools that need to know what will change in the clusters
+	DiffReportCheckRun bool `yaml:"diffReportCheckRun"`
+	// Instances are named ArgoCD API endpoints in addition to the default one configured with the ARGOCD_* environment variables
+	Instances []ArgocdInstance `yaml:"instances"`
+	// ComponentInstances maps component paths to Instances, the first matching regex wins and components that match none use the default instance
+	ComponentInstances []ArgocdComponentInstance `yaml:"componentInstances"`
+	// RedactionRules redact fields of the diff in addition to the data of Secret, SealedSecret and ExternalSecret objects
+	RedactionRules []RedactionRule `yaml:"redactionRules"`
+}
+
+// RedactionRule matches objects by group(empty for the core group) and kind, the values of their JSONPointers fields are never shown in the diff.
+type RedactionRule struct {
+	Group        string   `yaml:"group"`
+	Kind         string   `yaml:"kind"`
+	JSONPointers []string `yaml:"jsonPointers"`
+}
+
+// ArgocdInstance is a named ArgoCD API endpoint. The repo configuration only refers to it by name, its address, TLS settings and token
+// are read from the ARGOCD_*_<NAME> environment variables of the Telefonistka server so a repo can't send a token to another endpoint.
+// The zero value is the default instance.
+type ArgocdInstance struct {
+	Name string `yaml:"name"`
+}
+
+type ArgocdComponentInstance struct {
+	ComponentPathRegex string `yaml:"componentPathRegex"`
+	Instance           string `yaml:"instance"`
 }
 
 func ParseConfigFromYaml(y string) (*Config, error) {
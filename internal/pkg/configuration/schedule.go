@@ -0,0 +1,236 @@
+package configuration
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DeploymentWindow is a recurring weekly time range in which promotion PRs can be auto merged, like Mon-Thu 09:00-16:00 America/New_York.
+type DeploymentWindow struct {
+	// Days are English weekday names, "Mon" or "Monday", empty means every day
+	Days []string `yaml:"days"`
+	// Start and End are "HH:MM" wall clock times, an End that isn't after Start means the window ends on the next day
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// Timezone is an IANA time zone name, defaults to UTC
+	Timezone string `yaml:"timezone"`
+}
+
+// FreezePeriod is a one-off time range in which promotion PRs must not be auto merged.
+type FreezePeriod struct {
+	// Start and End are RFC 3339 timestamps, like 2024-12-20T00:00:00-05:00
+	Start  string `yaml:"start"`
+	End    string `yaml:"end"`
+	Reason string `yaml:"reason"`
+}
+
+var weekdayNames = map[string]time.Weekday{}
+
+func init() {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		weekdayNames[strings.ToLower(d.String())] = d
+		weekdayNames[strings.ToLower(d.String()[:3])] = d
+	}
+}
+
+type parsedWindow struct {
+	days          map[time.Weekday]bool
+	start, end    time.Duration // offset from midnight
+	loc           *time.Location
+	spansMidnight bool
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w DeploymentWindow) parse() (parsedWindow, error) {
+	pw := parsedWindow{days: map[time.Weekday]bool{}, loc: time.UTC}
+	for _, d := range w.Days {
+		wd, ok := weekdayNames[strings.ToLower(d)]
+		if !ok {
+			return pw, fmt.Errorf("invalid day %q", d)
+		}
+		pw.days[wd] = true
+	}
+	if len(w.Days) == 0 {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			pw.days[d] = true
+		}
+	}
+	var err error
+	if pw.start, err = parseClock(w.Start); err != nil {
+		return pw, fmt.Errorf("start: %w", err)
+	}
+	if pw.end, err = parseClock(w.End); err != nil {
+		return pw, fmt.Errorf("end: %w", err)
+	}
+	pw.spansMidnight = pw.end <= pw.start
+	if w.Timezone != "" {
+		if pw.loc, err = time.LoadLocation(w.Timezone); err != nil {
+			return pw, fmt.Errorf("invalid timezone %q: %w", w.Timezone, err)
+		}
+	}
+	return pw, nil
+}
+
+// at returns the wall clock time offset on the day of t, in the window time zone
+func (pw parsedWindow) at(t time.Time, offset time.Duration) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, pw.loc)
+}
+
+func (pw parsedWindow) contains(t time.Time) bool {
+	t = t.In(pw.loc)
+	start := pw.at(t, pw.start)
+	if !pw.spansMidnight {
+		return pw.days[t.Weekday()] && !t.Before(start) && t.Before(pw.at(t, pw.end))
+	}
+	if pw.days[t.Weekday()] && !t.Before(start) {
+		return true
+	}
+	// The tail of a window that started on the previous day
+	return pw.days[t.AddDate(0, 0, -1).Weekday()] && t.Before(pw.at(t, pw.end))
+}
+
+func (f FreezePeriod) parse() (start time.Time, end time.Time, err error) {
+	if start, err = time.Parse(time.RFC3339, f.Start); err != nil {
+		return start, end, fmt.Errorf("start: invalid RFC 3339 timestamp %q", f.Start)
+	}
+	if end, err = time.Parse(time.RFC3339, f.End); err != nil {
+		return start, end, fmt.Errorf("end: invalid RFC 3339 timestamp %q", f.End)
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("end %q must be after start %q", f.End, f.Start)
+	}
+	return start, end, nil
+}
+
+// DeploymentSchedule is the combination of deployment windows and freeze calendars that applies to a single promotion PR.
+type DeploymentSchedule struct {
+	Windows []DeploymentWindow
+	// Freezes is keyed by freeze calendar name
+	Freezes map[string][]FreezePeriod
+}
+
+// DeploymentSchedule returns the schedule of ppr, unknown freeze calendar names are ignored, ValidateConfig reports them.
+func (c *Config) DeploymentSchedule(ppr PromotionPr) DeploymentSchedule {
+	s := DeploymentSchedule{Windows: ppr.DeploymentWindows}
+	for _, name := range ppr.FreezeCalendars {
+		if periods, ok := c.FreezeCalendars[name]; ok {
+			if s.Freezes == nil {
+				s.Freezes = map[string][]FreezePeriod{}
+			}
+			s.Freezes[name] = periods
+		}
+	}
+	return s
+}
+
+// IsEmpty is true when the schedule never blocks auto merge
+func (s DeploymentSchedule) IsEmpty() bool {
+	return len(s.Windows) == 0 && len(s.Freezes) == 0
+}
+
+// ScheduleStatus describes whether a DeploymentSchedule allows auto merging at a point in time.
+type ScheduleStatus struct {
+	Open bool
+	// Reason explains why the schedule is closed
+	Reason string
+	// NextOpen is the next time the schedule opens, zero when it's open or never opens again
+	NextOpen time.Time
+}
+
+type freezeRange struct {
+	calendar   string
+	reason     string
+	start, end time.Time
+}
+
+// Status evaluates the schedule at now.
+func (s DeploymentSchedule) Status(now time.Time) (ScheduleStatus, error) {
+	windows := make([]parsedWindow, 0, len(s.Windows))
+	for _, w := range s.Windows {
+		pw, err := w.parse()
+		if err != nil {
+			return ScheduleStatus{}, err
+		}
+		windows = append(windows, pw)
+	}
+	calendars := make([]string, 0, len(s.Freezes))
+	for name := range s.Freezes {
+		calendars = append(calendars, name)
+	}
+	sort.Strings(calendars)
+	freezes := []freezeRange{}
+	for _, name := range calendars {
+		for _, f := range s.Freezes[name] {
+			start, end, err := f.parse()
+			if err != nil {
+				return ScheduleStatus{}, fmt.Errorf("freeze calendar %s: %w", name, err)
+			}
+			freezes = append(freezes, freezeRange{calendar: name, reason: f.Reason, start: start, end: end})
+		}
+	}
+
+	// reason is empty when t is open
+	reasonAt := func(t time.Time) string {
+		for _, f := range freezes {
+			if !t.Before(f.start) && t.Before(f.end) {
+				if f.reason != "" {
+					return fmt.Sprintf("the %s freeze calendar is in effect until %s (%s)", f.calendar, f.end.Format(time.RFC3339), f.reason)
+				}
+				return fmt.Sprintf("the %s freeze calendar is in effect until %s", f.calendar, f.end.Format(time.RFC3339))
+			}
+		}
+		if len(windows) == 0 {
+			return ""
+		}
+		for _, w := range windows {
+			if w.contains(t) {
+				return ""
+			}
+		}
+		return "the current time is outside of the deployment windows"
+	}
+
+	reason := reasonAt(now)
+	if reason == "" {
+		return ScheduleStatus{Open: true}, nil
+	}
+
+	// The schedule can only open when a freeze ends or a window starts, so these are the only candidates to check.
+	horizon := now
+	candidates := []time.Time{}
+	for _, f := range freezes {
+		if f.end.After(now) {
+			candidates = append(candidates, f.end)
+			if f.end.After(horizon) {
+				horizon = f.end
+			}
+		}
+	}
+	horizon = horizon.AddDate(0, 0, 8)
+	for _, w := range windows {
+		for day := now.In(w.loc).AddDate(0, 0, -1); !day.After(horizon); day = day.AddDate(0, 0, 1) {
+			if w.days[day.Weekday()] {
+				if start := w.at(day, w.start); start.After(now) {
+					candidates = append(candidates, start)
+				}
+			}
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Before(candidates[j]) })
+	for _, c := range candidates {
+		if reasonAt(c) == "" {
+			return ScheduleStatus{Reason: reason, NextOpen: c}, nil
+		}
+	}
+	return ScheduleStatus{Reason: reason}, nil
+}
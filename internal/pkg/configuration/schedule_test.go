@@ -0,0 +1,88 @@
+package configuration
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeploymentScheduleStatus(t *testing.T) {
+	t.Parallel()
+	businessHours := DeploymentWindow{Days: []string{"Mon", "Tue", "Wed", "Thu"}, Start: "09:00", End: "16:00", Timezone: "America/New_York"}
+	overnight := DeploymentWindow{Days: []string{"Friday"}, Start: "22:00", End: "02:00"}
+	holidays := map[string][]FreezePeriod{
+		"holidays": {{Start: "2024-12-20T00:00:00-05:00", End: "2025-01-02T00:00:00-05:00", Reason: "Winter holidays"}},
+	}
+	tests := map[string]struct {
+		schedule       DeploymentSchedule
+		now            string
+		expectedStatus ScheduleStatus
+	}{
+		"Empty schedule is always open": {
+			schedule:       DeploymentSchedule{},
+			now:            "2024-06-01T03:00:00Z",
+			expectedStatus: ScheduleStatus{Open: true},
+		},
+		"Inside window": {
+			schedule:       DeploymentSchedule{Windows: []DeploymentWindow{businessHours}},
+			now:            "2024-06-04T10:00:00-04:00", // Tuesday
+			expectedStatus: ScheduleStatus{Open: true},
+		},
+		"Window end is exclusive": {
+			schedule: DeploymentSchedule{Windows: []DeploymentWindow{businessHours}},
+			now:      "2024-06-04T16:00:00-04:00",
+			expectedStatus: ScheduleStatus{
+				Reason:   "the current time is outside of the deployment windows",
+				NextOpen: time.Date(2024, 6, 5, 13, 0, 0, 0, time.UTC),
+			},
+		},
+		"Thursday evening waits for Monday": {
+			schedule: DeploymentSchedule{Windows: []DeploymentWindow{businessHours}},
+			now:      "2024-06-06T17:00:00-04:00",
+			expectedStatus: ScheduleStatus{
+				Reason:   "the current time is outside of the deployment windows",
+				NextOpen: time.Date(2024, 6, 10, 13, 0, 0, 0, time.UTC),
+			},
+		},
+		"Window spanning midnight": {
+			schedule:       DeploymentSchedule{Windows: []DeploymentWindow{overnight}},
+			now:            "2024-06-08T01:00:00Z", // Saturday
+			expectedStatus: ScheduleStatus{Open: true},
+		},
+		"Freeze overrides window": {
+			schedule: DeploymentSchedule{Windows: []DeploymentWindow{businessHours}, Freezes: holidays},
+			now:      "2024-12-23T10:00:00-05:00", // Monday
+			expectedStatus: ScheduleStatus{
+				Reason:   "the holidays freeze calendar is in effect until 2025-01-02T00:00:00-05:00 (Winter holidays)",
+				NextOpen: time.Date(2025, 1, 2, 14, 0, 0, 0, time.UTC),
+			},
+		},
+		"Freeze without windows opens when it ends": {
+			schedule: DeploymentSchedule{Freezes: holidays},
+			now:      "2024-12-23T10:00:00-05:00",
+			expectedStatus: ScheduleStatus{
+				Reason:   "the holidays freeze calendar is in effect until 2025-01-02T00:00:00-05:00 (Winter holidays)",
+				NextOpen: time.Date(2025, 1, 2, 5, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			now, err := time.Parse(time.RFC3339, tc.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status, err := tc.schedule.Status(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedStatus.Open, status.Open)
+			assert.Equal(t, tc.expectedStatus.Reason, status.Reason)
+			assert.True(t, tc.expectedStatus.NextOpen.Equal(status.NextOpen), "expected next open %s, got %s", tc.expectedStatus.NextOpen, status.NextOpen)
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package configuration
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ValidationError describes a single problem found in a configuration file.
+// Line is 1-based and is 0 when the problem can't be tied to a specific line.
+type ValidationError struct {
+	Line    int
+	Path    string
+	Message string
+}
+
+func (e ValidationError) Error() string {
+	var sb strings.Builder
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, "line %d: ", e.Line)
+	}
+	if e.Path != "" {
+		fmt.Fprintf(&sb, "%s: ", e.Path)
+	}
+	sb.WriteString(e.Message)
+	return sb.String()
+}
+
+// ValidationErrors is the list of problems found in a configuration file, it's an error so callers can return it as-is.
+type ValidationErrors []ValidationError
+
+func (ve ValidationErrors) Error() string {
+	s := make([]string, 0, len(ve))
+	for _, e := range ve {
+		s = append(s, e.Error())
+	}
+	return strings.Join(s, "\n")
+}
+
+// yaml.v2 prefixes errors with the line number, like "line 3: field foo not found in type configuration.Config"
+var yamlErrorLineRegex = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+func yamlErrorToValidationError(msg string) ValidationError {
+	m := yamlErrorLineRegex.FindStringSubmatch(msg)
+	if m == nil {
+		return ValidationError{Message: strings.TrimPrefix(msg, "yaml: ")}
+	}
+	line, _ := strconv.Atoi(m[1])
+	return ValidationError{Line: line, Message: m[2]}
+}
+
+// strictUnmarshal decodes y into out, rejecting unknown keys.
+// Type errors are collected and returned as validation errors, the rest of the document is still decoded into out.
+// ok is false on syntax errors, as there is nothing to validate beyond that point.
+func strictUnmarshal(y string, out interface{}) (ve ValidationErrors, ok bool) {
+	err := yaml.UnmarshalStrict([]byte(y), out)
+	if err == nil {
+		return nil, true
+	}
+	var typeErr *yaml.TypeError
+	if errors.As(err, &typeErr) {
+		for _, e := range typeErr.Errors {
+			ve = append(ve, yamlErrorToValidationError(e))
+		}
+		return ve, true
+	}
+	return append(ve, yamlErrorToValidationError(err.Error())), false
+}
+
+// yamlNodeLine returns the line of the node found by walking the document with path elements, strings for mapping keys and ints for sequence indices.
+// It returns the line of the deepest node found so errors on missing keys still point to their parent.
+func yamlNodeLine(doc *yamlv3.Node, path ...interface{}) int {
+	if doc == nil {
+		return 0
+	}
+	n := doc
+	if n.Kind == yamlv3.DocumentNode && len(n.Content) > 0 {
+		n = n.Content[0]
+	}
+	line := n.Line
+	for _, p := range path {
+		var next *yamlv3.Node
+		switch key := p.(type) {
+		case string:
+			if n.Kind != yamlv3.MappingNode {
+				return line
+			}
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				if n.Content[i].Value == key {
+					next = n.Content[i+1]
+					break
+				}
+			}
+		case int:
+			if n.Kind != yamlv3.SequenceNode || key >= len(n.Content) {
+				return line
+			}
+			next = n.Content[key]
+		}
+		if next == nil {
+			return line
+		}
+		n = next
+		line = n.Line
+	}
+	return line
+}
+
+type validator struct {
+	doc    *yamlv3.Node
+	errors ValidationErrors
+}
+
+func (v *validator) add(message string, path ...interface{}) {
+	var sb strings.Builder
+	for _, p := range path {
+		switch key := p.(type) {
+		case string:
+			if sb.Len() > 0 {
+				sb.WriteString(".")
+			}
+			sb.WriteString(key)
+		case int:
+			fmt.Fprintf(&sb, "[%d]", key)
+		}
+	}
+	v.errors = append(v.errors, ValidationError{
+		Line:    yamlNodeLine(v.doc, path...),
+		Path:    sb.String(),
+		Message: message,
+	})
+}
+
+func (v *validator) checkRegex(expression string, path ...interface{}) {
+	if _, err := regexp.Compile(expression); err != nil {
+		v.add(fmt.Sprintf("invalid regex %q: %v", expression, err), path...)
+	}
+}
+
+// newValidator parses y into a yaml.v3 node tree, yaml.v2 doesn't expose node positions and we want line numbers for semantic errors too.
+func newValidator(y string, ve ValidationErrors) *validator {
+	v := &validator{doc: &yamlv3.Node{}, errors: ve}
+	if err := yamlv3.Unmarshal([]byte(y), v.doc); err != nil {
+		v.doc = nil
+	}
+	return v
+}
+
+// ValidateConfig strictly validates the content of a repo level telefonistka.yaml file.
+// Unlike ParseConfigFromYaml it rejects unknown keys, compiles every regex and looks for promotion paths that can never be reached.
+func ValidateConfig(y string) ValidationErrors {
+	config := &Config{}
+	ve, ok := strictUnmarshal(y, config)
+	if !ok {
+		return ve
+	}
+	v := newValidator(y, ve)
+
+	for i, pp := range config.PromotionPaths {
+		if pp.SourcePath == "" {
+			v.add("sourcePath is required", "promotionPaths", i, "sourcePath")
+		} else {
+			// sourcePath is used as a prefix regex when matching changed files
+			v.checkRegex("^"+pp.SourcePath, "promotionPaths", i, "sourcePath")
+		}
+		if pp.ComponentPathExtraDepth < 0 {
+			v.add("componentPathExtraDepth can't be negative", "promotionPaths", i, "componentPathExtraDepth")
+		}
+		if len(pp.PromotionPrs) == 0 {
+			v.add("at least one promotionPrs element is required", "promotionPaths", i)
+		}
+		for j, ppr := range pp.PromotionPrs {
+			if len(ppr.TargetPaths) == 0 {
+				v.add("targetPaths can't be empty", "promotionPaths", i, "promotionPrs", j)
+			}
+			for k, tp := range ppr.TargetPaths {
+				if tp == "" {
+					v.add("target path can't be an empty string", "promotionPaths", i, "promotionPrs", j, "targetPaths", k)
+				}
+			}
+			for k, w := range ppr.DeploymentWindows {
+				if _, err := w.parse(); err != nil {
+					v.add(err.Error(), "promotionPaths", i, "promotionPrs", j, "deploymentWindows", k)
+				}
+			}
+			for k, name := range ppr.FreezeCalendars {
+				if _, ok := config.FreezeCalendars[name]; !ok {
+					v.add(fmt.Sprintf("unknown freeze calendar %q", name), "promotionPaths", i, "promotionPrs", j, "freezeCalendars", k)
+				}
+			}
+		}
+	}
+	v.checkOverlappingSourcePaths(config.PromotionPaths)
+
+	calendars := make([]string, 0, len(config.FreezeCalendars))
+	for name := range config.FreezeCalendars {
+		calendars = append(calendars, name)
+	}
+	slices.Sort(calendars)
+	for _, name := range calendars {
+		for i, f := range config.FreezeCalendars[name] {
+			if _, _, err := f.parse(); err != nil {
+				v.add(err.Error(), "freezeCalendars", name, i)
+			}
+		}
+	}
+
+	for i, wer := range config.WebhookEndpointRegexs {
+		if wer.Expression == "" {
+			v.add("expression is required", "webhookEndpointRegexs", i)
+		} else {
+			v.checkRegex(wer.Expression, "webhookEndpointRegexs", i, "expression")
+		}
+		if len(wer.Replacements) == 0 {
+			v.add("at least one replacement is required", "webhookEndpointRegexs", i)
+		}
+	}
+
+	if config.Argocd.AllowSyncfromBranchPathRegex != "" {
+		v.checkRegex(config.Argocd.AllowSyncfromBranchPathRegex, "argocd", "allowSyncfromBranchPathRegex")
+	}
+	instances := map[string]bool{}
+	for i, instance := range config.Argocd.Instances {
+		if instance.Name == "" {
+			v.add("name is required", "argocd", "instances", i)
+		} else if instances[instance.Name] {
+			v.add(fmt.Sprintf("duplicate instance name %q", instance.Name), "argocd", "instances", i, "name")
+		}
+		instances[instance.Name] = true
+	}
+	for i, ci := range config.Argocd.ComponentInstances {
+		if ci.ComponentPathRegex == "" {
+			v.add("componentPathRegex is required", "argocd", "componentInstances", i)
+		} else {
+			v.checkRegex(ci.ComponentPathRegex, "argocd", "componentInstances", i, "componentPathRegex")
+		}
+		if !instances[ci.Instance] || ci.Instance == "" {
+			v.add(fmt.Sprintf("unknown instance %q", ci.Instance), "argocd", "componentInstances", i, "instance")
+		}
+	}
+	for i, rule := range config.Argocd.RedactionRules {
+		if rule.Kind == "" {
+			v.add("kind is required", "argocd", "redactionRules", i)
+		}
+		if len(rule.JSONPointers) == 0 {
+			v.add("at least one JSON pointer is required", "argocd", "redactionRules", i)
+		}
+		for j, pointer := range rule.JSONPointers {
+			if !strings.HasPrefix(pointer, "/") {
+				v.add(fmt.Sprintf("JSON pointer %q must start with /", pointer), "argocd", "redactionRules", i, "jsonPointers", j)
+			}
+		}
+	}
+
+	if len(config.CommitStatus.Description) > CommitStatusDescriptionMaxLength {
+		v.add(fmt.Sprintf("description can't be longer than %d characters", CommitStatusDescriptionMaxLength), "commitStatus", "description")
+	}
+	for i, kind := range config.CommitStatus.FailOn.BlockedKinds {
+		if kind == "" {
+			v.add("kind can't be an empty string", "commitStatus", "failOn", "blockedKinds", i)
+		}
+	}
+
+	if config.CheckRuns.LargeArgocdDiffInCheckRun && !config.CheckRuns.Enabled {
+		v.add("largeArgocdDiffInCheckRun requires check runs to be enabled", "checkRuns", "largeArgocdDiffInCheckRun")
+	}
+
+	if config.Comments.MaxRevisions < 0 {
+		v.add("maxRevisions can't be negative", "comments", "maxRevisions")
+	}
+	if config.Comments.MaxRevisions > 0 && !config.Comments.Sticky {
+		v.add("maxRevisions requires sticky comments", "comments", "maxRevisions")
+	}
+
+	return v.errors
+}
+
+// checkOverlappingSourcePaths reports promotion paths that are shadowed by an earlier one.
+// Promotion paths are evaluated in order and the first match wins, so a later path is unreachable if an earlier path
+// without label conditions already matches its sourcePath, or if an identical sourcePath with the same conditions appears before it.
+func (v *validator) checkOverlappingSourcePaths(promotionPaths []PromotionPath) {
+	for i, later := range promotionPaths {
+		if later.SourcePath == "" {
+			continue
+		}
+		for j, earlier := range promotionPaths[:i] {
+			if earlier.SourcePath == "" {
+				continue
+			}
+			sameConditions := slices.Equal(earlier.Conditions.PrHasLabels, later.Conditions.PrHasLabels)
+			if earlier.SourcePath == later.SourcePath && sameConditions {
+				v.add(fmt.Sprintf("sourcePath %q duplicates promotionPaths[%d] with the same conditions, this promotion path will never be used", later.SourcePath, j), "promotionPaths", i, "sourcePath")
+				break
+			}
+			if len(earlier.Conditions.PrHasLabels) > 0 {
+				continue
+			}
+			earlierRegex, err := regexp.Compile("^" + earlier.SourcePath)
+			if err != nil {
+				continue // already reported
+			}
+			if earlier.SourcePath != later.SourcePath && earlierRegex.MatchString(later.SourcePath) {
+				v.add(fmt.Sprintf("sourcePath %q overlaps with promotionPaths[%d] (%q) which is evaluated first, this promotion path will never be used", later.SourcePath, j, earlier.SourcePath), "promotionPaths", i, "sourcePath")
+				break
+			}
+		}
+	}
+}
+
+// ValidateComponentConfig strictly validates the content of a component level telefonistka.yaml file.
+func ValidateComponentConfig(y string) ValidationErrors {
+	componentConfig := &ComponentConfig{}
+	ve, ok := strictUnmarshal(y, componentConfig)
+	if !ok {
+		return ve
+	}
+	v := newValidator(y, ve)
+
+	for i, r := range componentConfig.PromotionTargetAllowList {
+		v.checkRegex(r, "promotionTargetAllowList", i)
+	}
+	for i, r := range componentConfig.PromotionTargetBlockList {
+		v.checkRegex(r, "promotionTargetBlockList", i)
+	}
+	for i, policy := range componentConfig.DiffPolicies {
+		if len(policy.Kinds) == 0 {
+			v.add("at least one kind is required", "diffPolicies", i)
+		}
+		for j, changeType := range policy.ChangeTypes {
+			if !slices.Contains([]string{"added", "removed", "modified"}, changeType) {
+				v.add(fmt.Sprintf("unknown change type %q, expected added, removed or modified", changeType), "diffPolicies", i, "changeTypes", j)
+			}
+		}
+	}
+	for i, ignoreDifference := range componentConfig.IgnoreDifferences {
+		if ignoreDifference.Kind == "" {
+			v.add("kind is required", "ignoreDifferences", i)
+		}
+		if len(ignoreDifference.JSONPointers) == 0 && len(ignoreDifference.JQPathExpressions) == 0 && len(ignoreDifference.ManagedFieldsManagers) == 0 {
+			v.add("at least one of jsonPointers, jqPathExpressions or managedFieldsManagers is required", "ignoreDifferences", i)
+		}
+		for j, pointer := range ignoreDifference.JSONPointers {
+			if !strings.HasPrefix(pointer, "/") {
+				v.add(fmt.Sprintf("JSON pointer %q must start with /", pointer), "ignoreDifferences", i, "jsonPointers", j)
+			}
+		}
+	}
+	if !slices.Contains([]string{"", DiffFormatUnified, DiffFormatSemantic}, componentConfig.DiffFormat) {
+		v.add(fmt.Sprintf("unknown diff format %q, expected %s or %s", componentConfig.DiffFormat, DiffFormatUnified, DiffFormatSemantic), "diffFormat")
+	}
+
+	return v.errors
+}
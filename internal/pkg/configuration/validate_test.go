@@ -0,0 +1,291 @@
+package configuration
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateConfig(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		config         string
+		expectedErrors []string
+	}{
+		"Valid configuration": {
+			config: `
+promotionPaths:
+  - sourcePath: "clusters/staging/[^/]*/[^/]*"
+    conditions:
+      prHasLabels:
+        - "quick_promotion"
+    promotionPrs:
+      - targetPaths:
+        - "clusters/prod/us-west1/c2"
+  - sourcePath: "clusters/staging/[^/]*/[^/]*"
+    promotionPrs:
+      - targetPaths:
+        - "clusters/prod/us-west1/c2"
+webhookEndpointRegexs:
+  - expression: "^workspace/[^/]*/.*"
+    replacements:
+      - "https://example.com"
+argocd:
+  allowSyncfromBranchPathRegex: '^workspace/.*$'
+`,
+			expectedErrors: nil,
+		},
+		"Unknown keys": {
+			config: `
+promotionPaths:
+  - sourcePath: "workspace/"
+    promotionPrs:
+      - targetPaths:
+        - "env/staging/"
+promtionPrLables:
+  - "promotion"
+`,
+			expectedErrors: []string{
+				"line 7: field promtionPrLables not found in type configuration.Config",
+			},
+		},
+		"Bad regexes": {
+			config: `
+promotionPaths:
+  - sourcePath: "workspace/(["
+    promotionPrs:
+      - targetPaths:
+        - "env/staging/"
+webhookEndpointRegexs:
+  - expression: "*"
+    replacements:
+      - "https://example.com"
+argocd:
+  allowSyncfromBranchPathRegex: '^workspace/(.*$'
+`,
+			expectedErrors: []string{
+				"line 3: promotionPaths[0].sourcePath: invalid regex \"^workspace/([\": error parsing regexp: missing closing ]: `[`",
+				"line 8: webhookEndpointRegexs[0].expression: invalid regex \"*\": error parsing regexp: missing argument to repetition operator: `*`",
+				"line 12: argocd.allowSyncfromBranchPathRegex: invalid regex \"^workspace/(.*$\": error parsing regexp: missing closing ): `^workspace/(.*$`",
+			},
+		},
+		"Empty target paths": {
+			config: `
+promotionPaths:
+  - sourcePath: "workspace/"
+    promotionPrs:
+      - targetDescription: "nothing"
+  - sourcePath: "env/staging/"
+`,
+			expectedErrors: []string{
+				"line 5: promotionPaths[0].promotionPrs[0]: targetPaths can't be empty",
+				"line 6: promotionPaths[1]: at least one promotionPrs element is required",
+			},
+		},
+		"Overlapping source paths": {
+			config: `
+promotionPaths:
+  - sourcePath: "workspace/"
+    promotionPrs:
+      - targetPaths:
+        - "env/staging/"
+  - sourcePath: "workspace/team-a/"
+    promotionPrs:
+      - targetPaths:
+        - "env/prod/"
+  - sourcePath: "workspace/"
+    promotionPrs:
+      - targetPaths:
+        - "env/prod/"
+`,
+			expectedErrors: []string{
+				"line 7: promotionPaths[1].sourcePath: sourcePath \"workspace/team-a/\" overlaps with promotionPaths[0] (\"workspace/\") which is evaluated first, this promotion path will never be used",
+				"line 11: promotionPaths[2].sourcePath: sourcePath \"workspace/\" duplicates promotionPaths[0] with the same conditions, this promotion path will never be used",
+			},
+		},
+		"Deployment windows and freeze calendars": {
+			config: `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+        - "env/prod/"
+        deploymentWindows:
+          - days: ["Mon", "Tuesday", "Funday"]
+            start: "09:00"
+            end: "16:00"
+          - start: "9am"
+            end: "16:00"
+            timezone: "America/New_York"
+          - start: "22:00"
+            end: "02:00"
+            timezone: "Mars/Olympus_Mons"
+        freezeCalendars:
+          - "holidays"
+          - "missing"
+freezeCalendars:
+  holidays:
+    - start: "2024-12-20T00:00:00Z"
+      end: "2025-01-02T00:00:00Z"
+    - start: "2025-07-04"
+      end: "2025-07-05T00:00:00Z"
+`,
+			expectedErrors: []string{
+				"line 8: promotionPaths[0].promotionPrs[0].deploymentWindows[0]: invalid day \"Funday\"",
+				"line 11: promotionPaths[0].promotionPrs[0].deploymentWindows[1]: start: invalid time \"9am\", expected HH:MM",
+				"line 14: promotionPaths[0].promotionPrs[0].deploymentWindows[2]: invalid timezone \"Mars/Olympus_Mons\": unknown time zone Mars/Olympus_Mons",
+				"line 19: promotionPaths[0].promotionPrs[0].freezeCalendars[1]: unknown freeze calendar \"missing\"",
+				"line 24: freezeCalendars.holidays[1]: start: invalid RFC 3339 timestamp \"2025-07-04\"",
+			},
+		},
+		"ArgoCD instances": {
+			config: `
+argocd:
+  instances:
+    - name: "eu"
+    - name: "eu"
+    - name: "us"
+      serverAddr: "argocd-us.example.com:443"
+    - {}
+  componentInstances:
+    - componentPathRegex: "^clusters/eu-.*"
+      instance: "eu"
+    - componentPathRegex: "^clusters/(ap-.*"
+      instance: "ap"
+`,
+			expectedErrors: []string{
+				"line 7: field serverAddr not found in type configuration.ArgocdInstance",
+				"line 5: argocd.instances[1].name: duplicate instance name \"eu\"",
+				"line 8: argocd.instances[3]: name is required",
+				"line 12: argocd.componentInstances[1].componentPathRegex: invalid regex \"^clusters/(ap-.*\": error parsing regexp: missing closing ): `^clusters/(ap-.*`",
+				"line 13: argocd.componentInstances[1].instance: unknown instance \"ap\"",
+			},
+		},
+		"Check runs": {
+			config: `
+checkRuns:
+  largeArgocdDiffInCheckRun: true
+`,
+			expectedErrors: []string{
+				"line 3: checkRuns.largeArgocdDiffInCheckRun: largeArgocdDiffInCheckRun requires check runs to be enabled",
+			},
+		},
+		"Comments": {
+			config: `
+comments:
+  maxRevisions: -1
+`,
+			expectedErrors: []string{
+				"line 3: comments.maxRevisions: maxRevisions can't be negative",
+			},
+		},
+		"Revisions of comments that aren't sticky": {
+			config: `
+comments:
+  maxRevisions: 3
+`,
+			expectedErrors: []string{
+				"line 3: comments.maxRevisions: maxRevisions requires sticky comments",
+			},
+		},
+		"Commit status": {
+			config: `
+commitStatus:
+  context: "gitops/telefonistka"
+  description: "` + strings.Repeat("x", 141) + `"
+  failOn:
+    drift: true
+    blockedKinds:
+      - "CustomResourceDefinition"
+      - ""
+`,
+			expectedErrors: []string{
+				"line 4: commitStatus.description: description can't be longer than 140 characters",
+				"line 9: commitStatus.failOn.blockedKinds[1]: kind can't be an empty string",
+			},
+		},
+		"Redaction rules": {
+			config: `
+argocd:
+  redactionRules:
+    - group: vault.example.com
+      kind: VaultSecret
+      jsonPointers:
+        - /spec/values
+    - kind: ConfigMap
+      jsonPointers:
+        - data/password
+    - group: example.com
+`,
+			expectedErrors: []string{
+				"line 10: argocd.redactionRules[1].jsonPointers[0]: JSON pointer \"data/password\" must start with /",
+				"line 11: argocd.redactionRules[2]: kind is required",
+				"line 11: argocd.redactionRules[2]: at least one JSON pointer is required",
+			},
+		},
+		"Syntax error": {
+			config: `
+promotionPaths:
+  - sourcePath: "workspace/"
+   promotionPrs:
+`,
+			expectedErrors: []string{
+				"line 3: did not find expected '-' indicator",
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			for _, e := range ValidateConfig(tc.config) {
+				got = append(got, e.Error())
+			}
+			assert.Equal(t, tc.expectedErrors, got)
+		})
+	}
+}
+
+func TestValidateComponentConfig(t *testing.T) {
+	t.Parallel()
+	componentConfig := `
+promotionTargetBlockList:
+  - env/staging/europe-west4/c1.*
+promotionTargetAllowList:
+  - env/prod/(.*
+disableArgoCDiff: true
+diffPolicies:
+  - kinds:
+      - CustomResourceDefinition
+    requireLabel: approved-crd-change
+  - changeTypes:
+      - deleted
+ignoreDifferences:
+  - kind: Deployment
+    jsonPointers:
+      - /spec/replicas
+  - group: apps
+    jsonPointers:
+      - spec/template/metadata/annotations
+  - kind: "*"
+diffFormat: fields
+`
+	var got []string
+	for _, e := range ValidateComponentConfig(componentConfig) {
+		got = append(got, e.Error())
+	}
+	expected := []string{
+		"line 6: field disableArgoCDiff not found in type configuration.ComponentConfig",
+		"line 5: promotionTargetAllowList[0]: invalid regex \"env/prod/(.*\": error parsing regexp: missing closing ): `env/prod/(.*`",
+		"line 11: diffPolicies[1]: at least one kind is required",
+		"line 12: diffPolicies[1].changeTypes[0]: unknown change type \"deleted\", expected added, removed or modified",
+		"line 17: ignoreDifferences[1]: kind is required",
+		"line 19: ignoreDifferences[1].jsonPointers[0]: JSON pointer \"spec/template/metadata/annotations\" must start with /",
+		"line 20: ignoreDifferences[2]: at least one of jsonPointers, jqPathExpressions or managedFieldsManagers is required",
+		"line 21: diffFormat: unknown diff format \"fields\", expected unified or semantic",
+	}
+	assert.Equal(t, expected, got)
+}
@@ -0,0 +1,475 @@
+// Package eventqueue persists received webhook events on disk so they survive handling failures and restarts.
+package eventqueue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
+)
+
+const (
+	pendingDir   = "pending"
+	deadDir      = "dead"
+	processedDir = "processed"
+)
+
+// Event is a received webhook, stored verbatim so it can be handled again.
+type Event struct {
+	// ID is the idempotency key, it's derived from the webhook delivery ID so redeliveries of a handled event are ignored
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Type   string `json:"type"`
+	// Headers are kept as some handlers(the webhook proxy) forward them
+	Headers    http.Header `json:"headers"`
+	Payload    []byte      `json:"payload"`
+	ReceivedAt time.Time   `json:"receivedAt"`
+
+	// Key serializes handling, events with the same key are handled one at a time in the order they were received
+	Key string `json:"key,omitempty"`
+	// SupersedeKey makes the event supersede older events with the same SupersedeKey,
+	// pending ones are dropped and the context of an in flight one is cancelled
+	SupersedeKey string `json:"supersedeKey,omitempty"`
+	// NotBefore delays the first handling attempt, events scheduled ahead(like held merges) survive restarts until they are due
+	NotBefore time.Time `json:"notBefore,omitempty"`
+
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"nextAttemptAt"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// Handler handles a single event, a returned error means the event is retried unless it's wrapped with Permanent.
+type Handler func(ctx context.Context, e Event) error
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err to signal retrying the event won't help, the event goes straight to the dead-letter store.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+type Options struct {
+	// Workers is the number of events handled concurrently
+	Workers int
+	// MaxAttempts is the number of handling attempts before an event is moved to the dead-letter store
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// HandlerTimeout bounds a single handling attempt
+	HandlerTimeout time.Duration
+	// ProcessedRetention is how long IDs of handled events are remembered for deduplication
+	ProcessedRetention time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Workers:            10,
+		MaxAttempts:        5,
+		InitialBackoff:     30 * time.Second,
+		MaxBackoff:         30 * time.Minute,
+		HandlerTimeout:     5 * time.Minute,
+		ProcessedRetention: 7 * 24 * time.Hour,
+	}
+}
+
+// FileQueue is a work queue backed by a local directory, every event is a JSON file under pending/ or dead/.
+// Handled events leave an empty marker file under processed/ for deduplication.
+type FileQueue struct {
+	dir  string
+	opts Options
+
+	mu       sync.Mutex
+	pending  map[string]*Event // keyed by file name
+	inFlight map[string]context.CancelFunc
+	// superseded holds in flight events that were superseded, their outcome is ignored
+	superseded map[string]bool
+	wake       chan struct{}
+}
+
+// NewFileQueue opens the queue in dir, creating it if needed, events left pending by a previous process are replayed once Run is called.
+func NewFileQueue(dir string, opts Options) (*FileQueue, error) {
+	q := &FileQueue{
+		dir:        dir,
+		opts:       opts,
+		pending:    map[string]*Event{},
+		inFlight:   map[string]context.CancelFunc{},
+		superseded: map[string]bool{},
+		wake:       make(chan struct{}, 1),
+	}
+	for _, d := range []string{pendingDir, deadDir, processedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0o750); err != nil {
+			return nil, fmt.Errorf("creating event queue directory: %w", err)
+		}
+	}
+	entries, err := os.ReadDir(filepath.Join(dir, pendingDir))
+	if err != nil {
+		return nil, fmt.Errorf("reading pending events: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		e, err := readEvent(filepath.Join(dir, pendingDir, entry.Name()))
+		if err != nil {
+			log.Errorf("Skipping unreadable queued event %s: err=%v", entry.Name(), err)
+			continue
+		}
+		q.pending[entry.Name()] = e
+	}
+	if len(q.pending) > 0 {
+		log.Infof("Replaying %d pending events from %s", len(q.pending), dir)
+	}
+	q.publishDepth()
+	return q, nil
+}
+
+func fileName(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:]) + ".json"
+}
+
+func readEvent(path string) (*Event, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	e := &Event{}
+	err = json.Unmarshal(b, e)
+	return e, err
+}
+
+// writeEvent writes through a temporary file so a crash never leaves a partial event behind
+func writeEvent(path string, e *Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Enqueue persists e, enqueued is false when an event with the same ID is already queued, dead-lettered or was handled.
+func (q *FileQueue) Enqueue(e Event) (enqueued bool, err error) {
+	if e.ID == "" {
+		return false, errors.New("event ID is required")
+	}
+	name := fileName(e.ID)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.pending[name]; ok || exists(filepath.Join(q.dir, deadDir, name)) || exists(filepath.Join(q.dir, processedDir, name)) {
+		prom.InstrumentQueuedEvent("duplicate")
+		return false, nil
+	}
+	if e.ReceivedAt.IsZero() {
+		e.ReceivedAt = time.Now()
+	}
+	e.Attempts = 0
+	e.NextAttemptAt = e.ReceivedAt
+	if e.NotBefore.After(e.NextAttemptAt) {
+		e.NextAttemptAt = e.NotBefore
+	}
+	e.LastError = ""
+	if err := writeEvent(filepath.Join(q.dir, pendingDir, name), &e); err != nil {
+		return false, fmt.Errorf("persisting event %s: %w", e.ID, err)
+	}
+	q.pending[name] = &e
+	prom.InstrumentQueuedEvent("enqueued")
+	if e.SupersedeKey != "" {
+		q.supersedeLocked(&e)
+	}
+	q.publishDepthLocked()
+	q.notify()
+	return true, nil
+}
+
+// supersedeLocked drops or cancels the events e supersedes
+func (q *FileQueue) supersedeLocked(e *Event) {
+	for name, older := range q.pending {
+		if older.SupersedeKey != e.SupersedeKey || !older.ReceivedAt.Before(e.ReceivedAt) {
+			continue
+		}
+		if cancel, ok := q.inFlight[name]; ok {
+			if !q.superseded[name] {
+				log.Infof("Event %s supersedes in flight event %s, cancelling it", e.ID, older.ID)
+				q.superseded[name] = true
+				if cancel != nil {
+					cancel()
+				}
+			}
+			continue
+		}
+		log.Infof("Event %s supersedes pending event %s, dropping it", e.ID, older.ID)
+		q.completeLocked(name, older, "superseded")
+	}
+}
+
+// completeLocked removes a handled(or superseded) event from the queue, remembering its ID for deduplication
+func (q *FileQueue) completeLocked(name string, e *Event, result string) {
+	if err := os.WriteFile(filepath.Join(q.dir, processedDir, name), nil, 0o600); err != nil {
+		log.Errorf("Failed to record handled event %s: err=%v", e.ID, err)
+	}
+	if err := os.Remove(filepath.Join(q.dir, pendingDir, name)); err != nil {
+		log.Errorf("Failed to remove handled event %s: err=%v", e.ID, err)
+	}
+	delete(q.pending, name)
+	prom.InstrumentQueuedEvent(result)
+}
+
+func (q *FileQueue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run handles queued events until ctx is done, events being handled at that point are left pending and replayed by the next process.
+func (q *FileQueue) Run(ctx context.Context, handler Handler) {
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < q.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				q.process(name, handler)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	q.pruneProcessed()
+	pruneTicker := time.NewTicker(time.Hour)
+	defer pruneTicker.Stop()
+	for {
+		ready, nextAttemptAt := q.takeReady(time.Now())
+		for _, name := range ready {
+			select {
+			case jobs <- name:
+			case <-ctx.Done():
+				return
+			}
+		}
+		wait := time.Hour
+		if !nextAttemptAt.IsZero() {
+			wait = time.Until(nextAttemptAt)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-q.wake:
+		case <-timer.C:
+		case <-pruneTicker.C:
+			q.pruneProcessed()
+		}
+		timer.Stop()
+	}
+}
+
+// takeReady marks the events due at now as in flight and returns them, along with the earliest attempt time of the rest.
+// Only the oldest event of a key can be taken, and only when no other event of that key is in flight,
+// an event waiting for its retry holds back the newer events of its key.
+func (q *FileQueue) takeReady(now time.Time) (ready []string, nextAttemptAt time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	names := make([]string, 0, len(q.pending))
+	blockedKeys := map[string]bool{}
+	for name, e := range q.pending {
+		if _, ok := q.inFlight[name]; ok {
+			if e.Key != "" {
+				blockedKeys[e.Key] = true
+			}
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return q.pending[names[i]].ReceivedAt.Before(q.pending[names[j]].ReceivedAt) })
+	for _, name := range names {
+		e := q.pending[name]
+		if e.Key != "" {
+			if blockedKeys[e.Key] {
+				continue
+			}
+			blockedKeys[e.Key] = true
+		}
+		if !e.NextAttemptAt.After(now) {
+			q.inFlight[name] = nil // the cancel function is set once handling starts
+			ready = append(ready, name)
+		} else if nextAttemptAt.IsZero() || e.NextAttemptAt.Before(nextAttemptAt) {
+			nextAttemptAt = e.NextAttemptAt
+		}
+	}
+	return ready, nextAttemptAt
+}
+
+func (q *FileQueue) backoff(attempts int) time.Duration {
+	d := q.opts.InitialBackoff
+	for i := 1; i < attempts && d < q.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.opts.MaxBackoff {
+		d = q.opts.MaxBackoff
+	}
+	return d
+}
+
+func callHandler(ctx context.Context, handler Handler, e Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("event handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, e)
+}
+
+func (q *FileQueue) process(name string, handler Handler) {
+	// Handling isn't bound to Run's context, an attempt that already started is allowed to finish
+	ctx, cancel := context.WithTimeout(context.Background(), q.opts.HandlerTimeout)
+	q.mu.Lock()
+	e := *q.pending[name]
+	q.inFlight[name] = cancel
+	skip := q.superseded[name]
+	q.mu.Unlock()
+
+	var err error
+	if !skip {
+		err = callHandler(ctx, handler, e)
+	}
+	cancel()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	defer q.notify()
+	delete(q.inFlight, name)
+	pendingPath := filepath.Join(q.dir, pendingDir, name)
+
+	if q.superseded[name] {
+		delete(q.superseded, name)
+		q.completeLocked(name, &e, "superseded")
+		q.publishDepthLocked()
+		return
+	}
+	if err == nil {
+		q.completeLocked(name, &e, "handled")
+		q.publishDepthLocked()
+		return
+	}
+
+	e.Attempts++
+	e.LastError = err.Error()
+	var permanent *permanentError
+	if errors.As(err, &permanent) || e.Attempts >= q.opts.MaxAttempts {
+		log.Errorf("Moving event %s(%s %s) to the dead-letter store after %d attempts: err=%v", e.ID, e.Source, e.Type, e.Attempts, err)
+		if err := writeEvent(filepath.Join(q.dir, deadDir, name), &e); err != nil {
+			log.Errorf("Failed to dead-letter event %s, it will be retried: err=%v", e.ID, err)
+			e.NextAttemptAt = time.Now().Add(q.backoff(e.Attempts))
+			q.pending[name] = &e
+			return
+		}
+		if err := os.Remove(pendingPath); err != nil {
+			log.Errorf("Failed to remove dead-lettered event %s: err=%v", e.ID, err)
+		}
+		delete(q.pending, name)
+		prom.InstrumentQueuedEvent("dead_lettered")
+		q.publishDepthLocked()
+		return
+	}
+
+	e.NextAttemptAt = time.Now().Add(q.backoff(e.Attempts))
+	log.Warnf("Handling event %s(%s %s) failed, retrying at %s: err=%v", e.ID, e.Source, e.Type, e.NextAttemptAt.Format(time.RFC3339), err)
+	if err := writeEvent(pendingPath, &e); err != nil {
+		log.Errorf("Failed to persist retry state of event %s: err=%v", e.ID, err)
+	}
+	q.pending[name] = &e
+	prom.InstrumentQueuedEvent("retried")
+}
+
+// DeadLetters returns the events that exhausted their attempts, oldest first.
+// Moving a file from dead/ back to pending/ and restarting re-queues it.
+func (q *FileQueue) DeadLetters() ([]Event, error) {
+	entries, err := os.ReadDir(filepath.Join(q.dir, deadDir))
+	if err != nil {
+		return nil, err
+	}
+	events := []Event{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		e, err := readEvent(filepath.Join(q.dir, deadDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *e)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].ReceivedAt.Before(events[j].ReceivedAt) })
+	return events, nil
+}
+
+func (q *FileQueue) pruneProcessed() {
+	entries, err := os.ReadDir(filepath.Join(q.dir, processedDir))
+	if err != nil {
+		log.Errorf("Failed to list handled events: err=%v", err)
+		return
+	}
+	cutoff := time.Now().Add(-q.opts.ProcessedRetention)
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || !info.ModTime().Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(q.dir, processedDir, entry.Name())); err != nil {
+			log.Errorf("Failed to prune handled event marker %s: err=%v", entry.Name(), err)
+		}
+	}
+}
+
+func (q *FileQueue) publishDepth() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.publishDepthLocked()
+}
+
+func (q *FileQueue) publishDepthLocked() {
+	dead := 0
+	if entries, err := os.ReadDir(filepath.Join(q.dir, deadDir)); err == nil {
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".json") && !strings.HasPrefix(entry.Name(), ".") {
+				dead++
+			}
+		}
+	}
+	prom.PublishEventQueueDepth(len(q.pending), dead)
+}
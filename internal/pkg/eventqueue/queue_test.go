@@ -0,0 +1,295 @@
+package eventqueue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testOptions() Options {
+	opts := DefaultOptions()
+	opts.Workers = 2
+	opts.MaxAttempts = 3
+	opts.InitialBackoff = time.Millisecond
+	opts.MaxBackoff = 5 * time.Millisecond
+	return opts
+}
+
+// recordingHandler fails each event ID the given number of times before succeeding
+type recordingHandler struct {
+	mu       sync.Mutex
+	failures map[string]int
+	err      error
+	attempts map[string]int
+	handled  chan string
+}
+
+func newRecordingHandler(failures map[string]int, err error) *recordingHandler {
+	return &recordingHandler{failures: failures, err: err, attempts: map[string]int{}, handled: make(chan string, 10)}
+}
+
+func (h *recordingHandler) handle(_ context.Context, e Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.attempts[e.ID]++
+	if h.attempts[e.ID] <= h.failures[e.ID] {
+		if h.attempts[e.ID] == h.failures[e.ID] {
+			defer func() { h.handled <- e.ID }()
+		}
+		return h.err
+	}
+	h.handled <- e.ID
+	return nil
+}
+
+func (h *recordingHandler) attemptsOf(id string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.attempts[id]
+}
+
+func waitFor(t *testing.T, ch chan string, expected string) {
+	t.Helper()
+	select {
+	case id := <-ch:
+		assert.Equal(t, expected, id)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", expected)
+	}
+}
+
+func runQueue(t *testing.T, q *FileQueue, handler Handler) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		q.Run(ctx, handler)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func TestFileQueueRetriesUntilHandled(t *testing.T) {
+	t.Parallel()
+	q, err := NewFileQueue(t.TempDir(), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := newRecordingHandler(map[string]int{"github/1": 2}, errors.New("GitHub returned 502"))
+	runQueue(t, q, handler.handle)
+
+	enqueued, err := q.Enqueue(Event{ID: "github/1", Source: "github", Type: "pull_request", Payload: []byte(`{}`)})
+	assert.NoError(t, err)
+	assert.True(t, enqueued)
+	waitFor(t, handler.handled, "github/1") // last failure
+	waitFor(t, handler.handled, "github/1") // success
+	assert.Equal(t, 3, handler.attemptsOf("github/1"))
+
+	// Redeliveries of a handled event are ignored
+	assert.Eventually(t, func() bool {
+		enqueued, err := q.Enqueue(Event{ID: "github/1"})
+		return err == nil && !enqueued
+	}, 5*time.Second, time.Millisecond)
+	deadLetters, err := q.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetters)
+}
+
+func TestFileQueueDeadLetters(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		err              error
+		failures         int
+		expectedAttempts int
+	}{
+		"Retries exhausted": {
+			err:              errors.New("ArgoCD timeout"),
+			failures:         3,
+			expectedAttempts: 3,
+		},
+		"Permanent error": {
+			err:              Permanent(errors.New("telefonistka.yaml not found")),
+			failures:         1,
+			expectedAttempts: 1,
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			q, err := NewFileQueue(t.TempDir(), testOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			handler := newRecordingHandler(map[string]int{"gitlab/1": tc.failures}, tc.err)
+			runQueue(t, q, handler.handle)
+
+			_, err = q.Enqueue(Event{ID: "gitlab/1", Source: "gitlab", Type: "Merge Request Hook"})
+			assert.NoError(t, err)
+			waitFor(t, handler.handled, "gitlab/1")
+
+			var deadLetters []Event
+			assert.Eventually(t, func() bool {
+				deadLetters, _ = q.DeadLetters()
+				return len(deadLetters) == 1
+			}, 5*time.Second, time.Millisecond)
+			assert.Equal(t, "gitlab/1", deadLetters[0].ID)
+			assert.Equal(t, tc.expectedAttempts, deadLetters[0].Attempts)
+			assert.Equal(t, tc.err.Error(), deadLetters[0].LastError)
+			assert.Equal(t, tc.expectedAttempts, handler.attemptsOf("gitlab/1"))
+
+			enqueued, err := q.Enqueue(Event{ID: "gitlab/1"})
+			assert.NoError(t, err)
+			assert.False(t, enqueued, "Dead-lettered events shouldn't be queued again by a redelivery")
+		})
+	}
+}
+
+func TestFileQueueReplaysPendingEventsOnStartup(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	// The first process persists the event but exits before handling it
+	q, err := NewFileQueue(dir, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Enqueue(Event{ID: "gitea/1", Source: "gitea", Type: "pull_request", Payload: []byte(`{"action":"closed"}`)})
+	assert.NoError(t, err)
+
+	q, err = NewFileQueue(dir, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueued, err := q.Enqueue(Event{ID: "gitea/1"})
+	assert.NoError(t, err)
+	assert.False(t, enqueued, "Replayed events should still be deduplicated")
+
+	var received Event
+	handled := make(chan string, 1)
+	runQueue(t, q, func(_ context.Context, e Event) error {
+		received = e
+		handled <- e.ID
+		return nil
+	})
+	waitFor(t, handled, "gitea/1")
+	assert.Equal(t, []byte(`{"action":"closed"}`), received.Payload)
+}
+
+func TestFileQueueDelaysEventsUntilNotBefore(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	notBefore := time.Now().Add(200 * time.Millisecond)
+	// The first process persists the delayed event and exits
+	q, err := NewFileQueue(dir, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = q.Enqueue(Event{ID: "windowed-merge/1", NotBefore: notBefore})
+	assert.NoError(t, err)
+
+	q, err = NewFileQueue(dir, testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handled := make(chan string, 1)
+	var handledAt time.Time
+	runQueue(t, q, func(_ context.Context, e Event) error {
+		handledAt = time.Now()
+		handled <- e.ID
+		return nil
+	})
+	waitFor(t, handled, "windowed-merge/1")
+	assert.False(t, handledAt.Before(notBefore), "Delayed events shouldn't be handled before they are due")
+}
+
+func TestFileQueueSerializesEventsOfTheSameKey(t *testing.T) {
+	t.Parallel()
+	q, err := NewFileQueue(t.TempDir(), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	runQueue(t, q, func(_ context.Context, e Event) error {
+		started <- e.ID
+		if e.ID == "opened" {
+			<-release
+		}
+		return nil
+	})
+
+	receivedAt := time.Now()
+	for i, e := range []Event{
+		{ID: "opened", Key: "github/AnOwner/Arepo#1"},
+		{ID: "labeled", Key: "github/AnOwner/Arepo#1"},
+		{ID: "other-pr", Key: "github/AnOwner/Arepo#2"},
+	} {
+		e.ReceivedAt = receivedAt.Add(time.Duration(i) * time.Millisecond)
+		_, err := q.Enqueue(e)
+		assert.NoError(t, err)
+	}
+
+	waitFor(t, started, "opened")
+	waitFor(t, started, "other-pr")
+	select {
+	case id := <-started:
+		t.Fatalf("%s started while an older event of its PR is in flight", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	waitFor(t, started, "labeled")
+}
+
+func TestFileQueueSupersedesOlderEvents(t *testing.T) {
+	t.Parallel()
+	q, err := NewFileQueue(t.TempDir(), testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	started := make(chan string, 10)
+	cancelled := make(chan string, 10)
+	runQueue(t, q, func(ctx context.Context, e Event) error {
+		started <- e.ID
+		if e.ID == "sha1" {
+			<-ctx.Done()
+			cancelled <- e.ID
+			return ctx.Err()
+		}
+		return nil
+	})
+
+	event := func(id string, offset time.Duration) Event {
+		return Event{ID: id, Key: "github/AnOwner/Arepo#1", SupersedeKey: "github/AnOwner/Arepo#1/changed", ReceivedAt: time.Now().Add(offset)}
+	}
+	_, err = q.Enqueue(event("sha1", 0))
+	assert.NoError(t, err)
+	waitFor(t, started, "sha1")
+	// Queued behind sha1, and superseded before it gets a chance to run
+	_, err = q.Enqueue(event("sha2", time.Millisecond))
+	assert.NoError(t, err)
+	_, err = q.Enqueue(event("sha3", 2*time.Millisecond))
+	assert.NoError(t, err)
+
+	waitFor(t, cancelled, "sha1")
+	waitFor(t, started, "sha3")
+	select {
+	case id := <-started:
+		t.Fatalf("superseded event %s was handled", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+	deadLetters, err := q.DeadLetters()
+	assert.NoError(t, err)
+	assert.Empty(t, deadLetters, "Cancelled events shouldn't be retried or dead-lettered")
+	for _, id := range []string{"sha1", "sha2"} {
+		enqueued, err := q.Enqueue(Event{ID: id})
+		assert.NoError(t, err)
+		assert.False(t, enqueued, "Superseded events shouldn't be queued again by a redelivery")
+	}
+}
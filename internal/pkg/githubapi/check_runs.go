@@ -0,0 +1,267 @@
+package githubapi
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+// Check runs created for each phase of the PR handling when checkRuns.enabled is set
+const (
+	configValidationCheckRunName = "Telefonistka config validation"
+	promotionPlanCheckRunName    = "Telefonistka promotion plan"
+	argocdDiffCheckRunName       = "Telefonistka ArgoCD diff"
+	driftCheckRunName            = "Telefonistka drift detection"
+
+	checkRunTruncatedNote = "\n\n⚠️ Truncated, see the PR comments for the full content.\n"
+)
+
+func checkRunsEnabled(config *cfg.Config) bool {
+	return config != nil && config.CheckRuns.Enabled
+}
+
+// createCheckRun creates checkRun on the PR head commit, nothing is done when the repo provider doesn't support check runs.
+func createCheckRun(ghPrClientDetails GhPrClientDetails, checkRun CheckRun) error {
+	checkRunCreator, ok := ghPrClientDetails.repoProvider().(CheckRunCreator)
+	if !ok {
+		ghPrClientDetails.PrLogger.Debugf("Repo provider doesn't support check runs, skipping the %q check run", checkRun.Name)
+		return nil
+	}
+	checkRun.HeadSHA = ghPrClientDetails.PrSHA
+	if len(checkRun.Summary) > githubCheckRunTextMaxSize {
+		checkRun.Summary = checkRun.Summary[:githubCheckRunTextMaxSize-len(checkRunTruncatedNote)] + checkRunTruncatedNote
+	}
+	return checkRunCreator.CreateCheckRun(ghPrClientDetails.Ctx, checkRun)
+}
+
+// publishPhaseCheckRun creates the check run of a PR handling phase when check runs are enabled.
+// Failures are only logged, the check runs report on the PR handling and shouldn't fail it.
+func publishPhaseCheckRun(ghPrClientDetails GhPrClientDetails, config *cfg.Config, checkRun CheckRun) {
+	if !checkRunsEnabled(config) {
+		return
+	}
+	if err := createCheckRun(ghPrClientDetails, checkRun); err != nil {
+		ghPrClientDetails.PrLogger.Errorf("Failed to create %q check run: err=%s\n", checkRun.Name, err)
+	}
+}
+
+// failedPhaseCheckRun reports a phase that couldn't complete.
+func failedPhaseCheckRun(name string, title string, err error) CheckRun {
+	return CheckRun{
+		Name:       name,
+		Conclusion: "failure",
+		Title:      title,
+		Summary:    fmt.Sprintf("```\n%s\n```\n", err),
+	}
+}
+
+// configValidationCheckRun fails when one of the changed configuration files has problems, each problem is annotated on its file and line.
+// renderedResults is the PR comment rendering of results.
+func configValidationCheckRun(results []configValidationResult, renderedResults string) CheckRun {
+	checkRun := CheckRun{Name: configValidationCheckRunName, Conclusion: "success", Summary: renderedResults}
+	if len(results) == 0 {
+		checkRun.Conclusion = "skipped"
+		checkRun.Title = "No configuration files changed"
+		checkRun.Summary = "This PR doesn't change Telefonistka configuration files."
+		return checkRun
+	}
+
+	problems := 0
+	for _, result := range results {
+		for _, validationError := range result.Errors {
+			problems++
+			message := validationError.Message
+			if validationError.Path != "" {
+				message = validationError.Path + ": " + message
+			}
+			checkRun.Annotations = append(checkRun.Annotations, CheckRunAnnotation{
+				Path: result.FilePath,
+				// Problems without a line, like an empty file, are reported on the first line
+				Line:    max(validationError.Line, 1),
+				Level:   "failure",
+				Title:   "Invalid Telefonistka configuration",
+				Message: message,
+			})
+		}
+	}
+	if problems > 0 {
+		checkRun.Conclusion = "failure"
+		checkRun.Title = fmt.Sprintf("Found %d problem(s) in %d configuration file(s)", problems, len(results))
+	} else {
+		checkRun.Title = fmt.Sprintf("%d configuration file(s) are valid", len(results))
+	}
+	return checkRun
+}
+
+// promotionPlanCheckRun lists the promotion PRs that will be opened when the PR is merged, renderedPlan is the dry-run comment rendering of promotions.
+func promotionPlanCheckRun(promotions map[string]PromotionInstance, renderedPlan string) CheckRun {
+	if len(promotions) == 0 {
+		return CheckRun{
+			Name:       promotionPlanCheckRunName,
+			Conclusion: "skipped",
+			Title:      "No promotions",
+			Summary:    "This PR doesn't change any promotion source path.",
+		}
+	}
+	return CheckRun{
+		Name:       promotionPlanCheckRunName,
+		Conclusion: "success",
+		Title:      fmt.Sprintf("%d promotion PR(s) will be opened once merged", len(promotions)),
+		Summary:    renderedPlan,
+	}
+}
+
+// argocdDiffCheckRun fails when the diff of an ArgoCD app couldn't be generated, the error is annotated on the first file the PR changed in the app component.
+// diffText is the rendered diff, it's left out if it doesn't fit the check run.
+func argocdDiffCheckRun(diffResults []argocd.DiffResult, changedFiles []string, diffText string) CheckRun {
+	report := argocd.NewDiffReport(diffResults)
+	checkRun := CheckRun{
+		Name:       argocdDiffCheckRunName,
+		Conclusion: "success",
+		Title:      argocdDiffCheckRunTitle(report),
+		Summary:    argocdDiffCheckRunSummary(report),
+	}
+	if len(report.Apps) == 0 {
+		checkRun.Conclusion = "skipped"
+		checkRun.Title = "No ArgoCD applications affected"
+		return checkRun
+	}
+	if report.HasErrors {
+		checkRun.Conclusion = "failure"
+	}
+	if len(diffText) <= githubCheckRunTextMaxSize {
+		checkRun.Text = diffText
+	} else {
+		checkRun.Summary += "\nThe diff is too large for a check run, see the PR comments.\n"
+	}
+
+	for _, app := range report.Apps {
+		if app.Error == "" {
+			continue
+		}
+		for _, changedFile := range changedFiles {
+			if strings.HasPrefix(changedFile, app.ComponentPath+"/") {
+				checkRun.Annotations = append(checkRun.Annotations, CheckRunAnnotation{
+					Path:    changedFile,
+					Line:    1,
+					Level:   "failure",
+					Title:   "ArgoCD diff failed",
+					Message: fmt.Sprintf("Failed to get the ArgoCD diff of %s: %s", app.ComponentPath, app.Error),
+				})
+				break
+			}
+		}
+	}
+	return checkRun
+}
+
+func argocdDiffCheckRunTitle(report argocd.DiffReport) string {
+	changedApps := 0
+	for _, app := range report.Apps {
+		if app.HasDiff && app.Error == "" {
+			changedApps++
+		}
+	}
+	title := fmt.Sprintf("%d of %d ArgoCD applications will change", changedApps, len(report.Apps))
+	if report.HasErrors {
+		title += ", some diffs failed"
+	}
+	return title
+}
+
+// argocdDiffCheckRunSummary lists the apps that will change or failed to diff.
+func argocdDiffCheckRunSummary(report argocd.DiffReport) string {
+	var summary strings.Builder
+	for _, app := range report.Apps {
+		switch {
+		case app.Error != "":
+			fmt.Fprintf(&summary, "* ❌ `%s` @ `%s`: error getting diff\n", app.AppName, app.ComponentPath)
+		case app.HasDiff:
+			fmt.Fprintf(&summary, "* `%s` @ `%s`: %d changed objects\n", app.AppName, app.ComponentPath, len(app.Resources))
+		}
+	}
+	if summary.Len() == 0 {
+		return "No changes."
+	}
+	return summary.String()
+}
+
+// driftCheckRun is neutral when drift was found as it doesn't come from the PR changes, renderedDrift is the drift PR comment rendering.
+func driftCheckRun(driftedPaths int, renderedDrift string) CheckRun {
+	if driftedPaths == 0 {
+		return CheckRun{
+			Name:       driftCheckRunName,
+			Conclusion: "success",
+			Title:      "No drift found",
+			Summary:    "The promotion targets of this PR match their sources.",
+		}
+	}
+	return CheckRun{
+		Name:       driftCheckRunName,
+		Conclusion: "neutral",
+		Title:      fmt.Sprintf("Found drift in %d promotion target(s)", driftedPaths),
+		Summary:    renderedDrift,
+	}
+}
+
+// publishPromotionPlanCheckRun creates the promotion plan check run, the plan is otherwise only commented on PRs labeled with show-plan.
+func publishPromotionPlanCheckRun(ghPrClientDetails GhPrClientDetails, config *cfg.Config) {
+	promotions, err := GeneratePromotionPlan(ghPrClientDetails, config, ghPrClientDetails.Ref)
+	var renderedPlan string
+	if err == nil {
+		renderedPlan, err = RenderPromotionPlan(promotions)
+	}
+	if err != nil {
+		publishPhaseCheckRun(ghPrClientDetails, config, failedPhaseCheckRun(promotionPlanCheckRunName, "Failed to generate the promotion plan", err))
+		return
+	}
+	publishPhaseCheckRun(ghPrClientDetails, config, promotionPlanCheckRun(promotions, renderedPlan))
+}
+
+// publishArgoCdDiffCheckRun creates the ArgoCD diff check run and returns whether the full diff is in it.
+func publishArgoCdDiffCheckRun(ghPrClientDetails GhPrClientDetails, diffCommentData DiffCommentData) bool {
+	if _, ok := ghPrClientDetails.repoProvider().(CheckRunCreator); !ok {
+		ghPrClientDetails.PrLogger.Debugf("Repo provider doesn't support check runs, skipping the %q check run", argocdDiffCheckRunName)
+		return false
+	}
+	var diffText string
+	var changedFiles []string
+	for _, diffResult := range diffCommentData.DiffOfChangedComponents {
+		if diffResult.DiffError != nil {
+			// The diff errors are annotated on the changed files
+			changedFiles, _ = ghPlanSource{ghPrClientDetails}.ChangedFiles()
+			break
+		}
+	}
+	if len(diffCommentData.DiffOfChangedComponents) > 0 {
+		// The branch sync checkbox only works in PR comments
+		diffCommentData.DisplaySyncBranchCheckBox = false
+		var err error
+		diffText, err = executeTemplate("argoCdDiff", defaultTemplatesFullPath("argoCD-diff-pr-comment.gotmpl"), diffCommentData)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Failed to render the ArgoCD diff check run: err=%s\n", err)
+		}
+	}
+	checkRun := argocdDiffCheckRun(diffCommentData.DiffOfChangedComponents, changedFiles, diffText)
+	if err := createCheckRun(ghPrClientDetails, checkRun); err != nil {
+		ghPrClientDetails.PrLogger.Errorf("Failed to create %q check run: err=%s\n", checkRun.Name, err)
+		return false
+	}
+	return checkRun.Text != ""
+}
+
+// checkRunArgoCdDiffComments replaces the per component diff comments with a single concise comment pointing at the ArgoCD diff check run.
+// The per component comments are kept when even the concise comment is too large.
+func checkRunArgoCdDiffComments(diffCommentData DiffCommentData, splitComments []string) ([]string, error) {
+	diffCommentData.FullDiffCheckRunName = argocdDiffCheckRunName
+	templateOutput, err := executeTemplate("argoCdDiffConcise", defaultTemplatesFullPath("argoCD-diff-pr-comment-concise.gotmpl"), diffCommentData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ArgoCD diff comment template: %w", err)
+	}
+	if len(templateOutput) >= githubCommentMaxSize {
+		return splitComments, nil
+	}
+	return []string{templateOutput}, nil
+}
@@ -0,0 +1,141 @@
+package githubapi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+)
+
+func TestPhaseCheckRuns(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+checkRuns:
+  enabled: true
+`,
+		"env/staging/app1/values.yaml":       "replicas: 2\n",
+		"env/staging/app1/telefonistka.yaml": "disableArgoCDDiff: true\npromotionTargetAlowList: []\n",
+		"env/prod/app1/values.yaml":          "replicas: 1\n",
+	})
+	repo.AddPullRequest(
+		PullRequest{Number: 1, State: "open", HeadRef: "main", BaseRef: "main"},
+		[]ChangedFile{
+			{Filename: "env/staging/app1/values.yaml", Status: "modified"},
+			{Filename: "env/staging/app1/telefonistka.yaml", Status: "added"},
+		},
+	)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 1,
+		Ref:      "main",
+		PrSHA:    "c0ffee",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	eventPayload := &github.PullRequestEvent{PullRequest: &github.PullRequest{Number: github.Int(1)}}
+
+	_, err := handleChangedPREvent(context.Background(), GhClientPair{}, ghPrClientDetails, eventPayload)
+	if err != nil {
+		t.Fatalf("handleChangedPREvent failed: %v", err)
+	}
+
+	checkRuns := map[string]CheckRun{}
+	for _, checkRun := range repo.CheckRuns("c0ffee") {
+		checkRuns[checkRun.Name] = checkRun
+	}
+	assert.Len(t, checkRuns, 3, "The ArgoCD diff check run should only be created when commentDiffonPR is set")
+
+	validation := checkRuns[configValidationCheckRunName]
+	assert.Equal(t, "failure", validation.Conclusion)
+	assert.Equal(t, "Found 1 problem(s) in 1 configuration file(s)", validation.Title)
+	assert.Equal(t, []CheckRunAnnotation{{
+		Path:    "env/staging/app1/telefonistka.yaml",
+		Line:    2,
+		Level:   "failure",
+		Title:   "Invalid Telefonistka configuration",
+		Message: "field promotionTargetAlowList not found in type configuration.ComponentConfig",
+	}}, validation.Annotations)
+
+	plan := checkRuns[promotionPlanCheckRunName]
+	assert.Equal(t, "success", plan.Conclusion)
+	assert.Equal(t, "1 promotion PR(s) will be opened once merged", plan.Title)
+	assert.Contains(t, plan.Summary, "env/staging/app1 ➡️  env/prod/app1")
+
+	drift := checkRuns[driftCheckRunName]
+	assert.Equal(t, "neutral", drift.Conclusion)
+	assert.Equal(t, "Found drift in 1 promotion target(s)", drift.Title)
+}
+
+func TestArgocdDiffCheckRun(t *testing.T) {
+	t.Parallel()
+	diffResults := []argocd.DiffResult{
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", HasDiff: true, DiffElements: []argocd.DiffElement{
+			{ObjectKind: "Deployment", ObjectName: "foo", ChangeType: argocd.ChangeTypeModified, Diff: "-replicas: 2\n+replicas: 3\n"},
+		}},
+		{ComponentPath: "clusters/prod/bar", DiffError: errors.New("no ArgoCD application found")},
+	}
+	changedFiles := []string{"clusters/prod/foo/values.yaml", "clusters/prod/bar/values.yaml", "clusters/prod/bar/other.yaml"}
+
+	tests := map[string]struct {
+		diffResults         []argocd.DiffResult
+		diffText            string
+		expectedConclusion  string
+		expectedTitle       string
+		expectedText        string
+		expectedAnnotations []CheckRunAnnotation
+	}{
+		"Diff with errors": {
+			diffResults:        diffResults,
+			diffText:           "the diff",
+			expectedConclusion: "failure",
+			expectedTitle:      "1 of 2 ArgoCD applications will change, some diffs failed",
+			expectedText:       "the diff",
+			expectedAnnotations: []CheckRunAnnotation{{
+				Path:    "clusters/prod/bar/values.yaml",
+				Line:    1,
+				Level:   "failure",
+				Title:   "ArgoCD diff failed",
+				Message: "Failed to get the ArgoCD diff of clusters/prod/bar: no ArgoCD application found",
+			}},
+		},
+		"Diff too large for the check run": {
+			diffResults:        diffResults[:1],
+			diffText:           strings.Repeat("x", githubCheckRunTextMaxSize+1),
+			expectedConclusion: "success",
+			expectedTitle:      "1 of 1 ArgoCD applications will change",
+		},
+		"No apps": {
+			expectedConclusion: "skipped",
+			expectedTitle:      "No ArgoCD applications affected",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			checkRun := argocdDiffCheckRun(tc.diffResults, changedFiles, tc.diffText)
+			assert.Equal(t, argocdDiffCheckRunName, checkRun.Name)
+			assert.Equal(t, tc.expectedConclusion, checkRun.Conclusion)
+			assert.Equal(t, tc.expectedTitle, checkRun.Title)
+			assert.Equal(t, tc.expectedText, checkRun.Text)
+			assert.Equal(t, tc.expectedAnnotations, checkRun.Annotations)
+		})
+	}
+}
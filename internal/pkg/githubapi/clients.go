@@ -37,23 +37,32 @@ type GhClientPair struct {
 	v4Client *githubv4.Client
 }
 
-func getAppInstallationId(githubAppPrivateKeyPath string, githubAppId int64, githubRestAltURL string, ctx context.Context, owner string) (int64, error) {
+// createGithubAppJWTClient creates a client authenticated as the GitHub App itself rather than one of its installations, required by the /app endpoints
+func createGithubAppJWTClient(githubAppPrivateKeyPath string, githubAppId int64, githubRestAltURL string) (*github.Client, error) {
 	atr, err := ghinstallation.NewAppsTransportKeyFromFile(http.DefaultTransport, githubAppId, githubAppPrivateKeyPath)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	tempClient := github.NewClient(
+	client := github.NewClient(
 		&http.Client{
 			Transport: atr,
 			Timeout:   time.Second * 30,
 		})
 
 	if githubRestAltURL != "" {
-		tempClient, err = tempClient.WithEnterpriseURLs(githubRestAltURL, githubRestAltURL)
+		client, err = client.WithEnterpriseURLs(githubRestAltURL, githubRestAltURL)
 		if err != nil {
-			log.Fatalf("failed to create git client for app: %v\n", err)
+			return nil, fmt.Errorf("failed to create git client for app: %w", err)
 		}
 	}
+	return client, nil
+}
+
+func getAppInstallationId(githubAppPrivateKeyPath string, githubAppId int64, githubRestAltURL string, ctx context.Context, owner string) (int64, error) {
+	tempClient, err := createGithubAppJWTClient(githubAppPrivateKeyPath, githubAppId, githubRestAltURL)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	installations, _, err := tempClient.Apps.ListInstallations(ctx, &github.ListOptions{})
 	if err != nil {
@@ -0,0 +1,51 @@
+package githubapi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+// diffStatusFailures returns the ArgoCD diff conditions that fail the commit status according to failOn.
+func diffStatusFailures(failOn cfg.CommitStatusFailOn, hasDiffErrors bool, diffResults []argocd.DiffResult) []string {
+	var failures []string
+	if failOn.DiffErrors && hasDiffErrors {
+		failures = append(failures, "ArgoCD diff errors")
+	}
+	if kinds := blockedKindsInDiff(failOn, diffResults); len(kinds) > 0 {
+		failures = append(failures, "changes to "+strings.Join(kinds, ", "))
+	}
+	return failures
+}
+
+// blockedKindsInDiff returns the blocked kinds with added, removed or modified objects, sorted.
+// Changes hidden from the diff by ignoreDifferences count too.
+func blockedKindsInDiff(failOn cfg.CommitStatusFailOn, diffResults []argocd.DiffResult) []string {
+	blocked := map[string]bool{}
+	for _, diffResult := range diffResults {
+		for _, diffElement := range diffResult.UnfilteredChanges {
+			// Unchanged objects have no change type
+			if diffElement.ChangeType != "" && failOn.IsBlockedKind(diffElement.ObjectKind) {
+				blocked[diffElement.ObjectKind] = true
+			}
+		}
+	}
+	kinds := make([]string, 0, len(blocked))
+	for kind := range blocked {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// commitStatusFailureDescription appends the failure reasons to the configured description, within the GitHub description length limit.
+func commitStatusFailureDescription(statusConfig cfg.CommitStatusConfig, failures []string) string {
+	description := fmt.Sprintf("%s: failed on %s", statusConfig.DescriptionText(), strings.Join(failures, "; "))
+	if runes := []rune(description); len(runes) > cfg.CommitStatusDescriptionMaxLength {
+		description = string(runes[:cfg.CommitStatusDescriptionMaxLength-1]) + "…"
+	}
+	return description
+}
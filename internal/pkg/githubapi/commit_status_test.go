@@ -0,0 +1,135 @@
+package githubapi
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+func TestHandlePREventCommitStatus(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	tests := map[string]struct {
+		commitStatusConfig  string
+		expectedContext     string
+		expectedState       string
+		expectedDescription string
+	}{
+		"Defaults, drift doesn't fail the status": {
+			expectedContext:     "telefonistka",
+			expectedState:       "success",
+			expectedDescription: "Telefonistka GitOps Bot",
+		},
+		"Fail on drift": {
+			commitStatusConfig: `
+commitStatus:
+  context: "gitops/telefonistka"
+  description: "GitOps promotion bot"
+  failOn:
+    drift: true
+`,
+			expectedContext:     "gitops/telefonistka",
+			expectedState:       "failure",
+			expectedDescription: "GitOps promotion bot: failed on drift between environments",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			repo := NewInMemoryRepoProvider("main", map[string]string{
+				"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+` + tc.commitStatusConfig,
+				"env/staging/app1/values.yaml": "replicas: 2\n",
+				"env/prod/app1/values.yaml":    "replicas: 1\n",
+			})
+			repo.AddPullRequest(
+				PullRequest{Number: 1, State: "open", HeadRef: "main", BaseRef: "main"},
+				[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+			)
+			ghPrClientDetails := GhPrClientDetails{
+				Ctx:      context.Background(),
+				Provider: repo,
+				Owner:    "AnOwner",
+				Repo:     "Arepo",
+				PrNumber: 1,
+				Ref:      "main",
+				PrSHA:    "c0ffee",
+				PrLogger: log.WithFields(log.Fields{}),
+			}
+			eventPayload := &github.PullRequestEvent{
+				Action:      github.String("synchronize"),
+				PullRequest: &github.PullRequest{Number: github.Int(1), Body: github.String("")},
+			}
+
+			err := HandlePREvent(eventPayload, ghPrClientDetails, GhClientPair{}, repo, context.Background())
+			if err != nil {
+				t.Fatalf("HandlePREvent failed: %v", err)
+			}
+
+			statuses, _ := repo.ListCommitStatuses(context.Background(), "c0ffee")
+			if assert.Len(t, statuses, 2) {
+				assert.Equal(t, "pending", statuses[1].State)
+				assert.Equal(t, tc.expectedContext, statuses[1].Context)
+				assert.Equal(t, tc.expectedState, statuses[0].State)
+				assert.Equal(t, tc.expectedContext, statuses[0].Context)
+				assert.Equal(t, tc.expectedDescription, statuses[0].Description)
+			}
+		})
+	}
+}
+
+func TestDiffStatusFailures(t *testing.T) {
+	t.Parallel()
+	diffResults := []argocd.DiffResult{
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", HasDiff: true, UnfilteredChanges: []argocd.DiffElement{
+			{ObjectKind: "Namespace", ObjectName: "foo"},
+			{ObjectKind: "CustomResourceDefinition", ObjectName: "foos.example.com", ChangeType: argocd.ChangeTypeModified},
+			{ObjectKind: "Deployment", ObjectName: "foo", ChangeType: argocd.ChangeTypeAdded},
+		}},
+		{ComponentPath: "clusters/prod/bar", DiffError: errors.New("no ArgoCD application found")},
+	}
+	tests := map[string]struct {
+		failOn           cfg.CommitStatusFailOn
+		expectedFailures []string
+	}{
+		"Nothing fails by default": {},
+		"Diff errors": {
+			failOn:           cfg.CommitStatusFailOn{DiffErrors: true},
+			expectedFailures: []string{"ArgoCD diff errors"},
+		},
+		"Blocked kinds, unchanged objects are ignored": {
+			failOn:           cfg.CommitStatusFailOn{BlockedKinds: []string{"Namespace", "Deployment", "CustomResourceDefinition"}},
+			expectedFailures: []string{"changes to CustomResourceDefinition, Deployment"},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expectedFailures, diffStatusFailures(tc.failOn, true, diffResults))
+		})
+	}
+}
+
+func TestCommitStatusFailureDescription(t *testing.T) {
+	t.Parallel()
+	description := commitStatusFailureDescription(cfg.CommitStatusConfig{}, []string{"ArgoCD diff errors", "changes to " + strings.Repeat("CustomResourceDefinition, ", 10)})
+	assert.Len(t, []rune(description), cfg.CommitStatusDescriptionMaxLength)
+	assert.True(t, strings.HasPrefix(description, "Telefonistka GitOps Bot: failed on ArgoCD diff errors; changes to CustomResourceDefinition"))
+}
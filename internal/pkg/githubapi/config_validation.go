@@ -0,0 +1,64 @@
+package githubapi
+
+import (
+	"fmt"
+	"path"
+
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+const configFileName = "telefonistka.yaml"
+
+type configValidationResult struct {
+	FilePath string
+	Errors   cfg.ValidationErrors
+}
+
+// validateConfigFile validates the content of a Telefonistka configuration file, the repo root file is the main configuration and every other file is a component configuration.
+func validateConfigFile(filePath string, content string) configValidationResult {
+	result := configValidationResult{FilePath: filePath}
+	if filePath == configFileName {
+		result.Errors = cfg.ValidateConfig(content)
+	} else {
+		result.Errors = cfg.ValidateComponentConfig(content)
+	}
+	return result
+}
+
+// validateChangedConfigFiles validates every Telefonistka configuration file changed in the PR and comments the result in the PR.
+// Nothing is commented if the PR doesn't touch configuration files, the config validation check run is created either way when check runs are enabled.
+// config is the default branch configuration, it's nil when it couldn't be read.
+func validateChangedConfigFiles(ghPrClientDetails GhPrClientDetails, config *cfg.Config) error {
+	prFiles, err := getPrFiles(ghPrClientDetails)
+	if err != nil {
+		return err
+	}
+
+	var results []configValidationResult
+	for _, prFile := range prFiles {
+		if path.Base(prFile.Filename) != configFileName || prFile.Status == "removed" {
+			continue
+		}
+		content, _, err := GetFileContent(ghPrClientDetails, ghPrClientDetails.Ref, prFile.Filename)
+		if err != nil {
+			return fmt.Errorf("get %s content: %w", prFile.Filename, err)
+		}
+		result := validateConfigFile(prFile.Filename, content)
+		if len(result.Errors) > 0 {
+			ghPrClientDetails.PrLogger.Infof("Found %d problems in %s", len(result.Errors), result.FilePath)
+		}
+		results = append(results, result)
+	}
+
+	if len(results) == 0 {
+		publishPhaseCheckRun(ghPrClientDetails, config, configValidationCheckRun(nil, ""))
+		return nil
+	}
+
+	templateOutput, err := executeTemplate("configValidation", defaultTemplatesFullPath("config-validation-pr-comment.gotmpl"), results)
+	if err != nil {
+		return fmt.Errorf("generate config validation comment: %w", err)
+	}
+	publishPhaseCheckRun(ghPrClientDetails, config, configValidationCheckRun(results, templateOutput))
+	return commentPR(ghPrClientDetails, templateOutput)
+}
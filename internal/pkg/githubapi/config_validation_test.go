@@ -0,0 +1,38 @@
+package githubapi
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigValidationComment(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	results := []configValidationResult{
+		validateConfigFile("telefonistka.yaml", `
+promotionPaths:
+  - sourcePath: "workspace/"
+    promotionPrs:
+      - targetPaths:
+        - "env/staging/"
+promtionPrLables:
+  - "promotion"
+`),
+		validateConfigFile("workspace/app1/telefonistka.yaml", "disableArgoCDDiff: true\n"),
+	}
+
+	comment, err := executeTemplate("configValidation", defaultTemplatesFullPath("config-validation-pr-comment.gotmpl"), results)
+	if err != nil {
+		t.Fatalf("Error generating config validation comment: %s", err)
+	}
+	expected := "\n## Telefonistka Configuration Validation\n\n" +
+		"❌ `telefonistka.yaml` has 1 problem(s):\n\n" +
+		"```\nline 7: field promtionPrLables not found in type configuration.Config\n```\n\n" +
+		"✅ `workspace/app1/telefonistka.yaml` is valid\n\n"
+	assert.Equal(t, expected, comment)
+}
@@ -0,0 +1,288 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+)
+
+// blockedByWindowLabel marks promotion PRs whose auto merge is held until their deployment window opens
+const blockedByWindowLabel = "blocked-by-window"
+
+// promotionScheduleByKey finds the deployment schedule of the promotion PR config that produced promotion key,
+// the key is stored in the promotion PR metadata so the current schedule can be found when the queued merge is due.
+func promotionScheduleByKey(config *cfg.Config, key string) (cfg.DeploymentSchedule, bool) {
+	for _, pp := range config.PromotionPaths {
+		for _, ppr := range pp.PromotionPrs {
+			if promotionKey(pp.SourcePath, ppr.TargetPaths) == key {
+				return config.DeploymentSchedule(ppr), true
+			}
+		}
+	}
+	return cfg.DeploymentSchedule{}, false
+}
+
+func configHasDeploymentSchedules(config *cfg.Config) bool {
+	for _, pp := range config.PromotionPaths {
+		for _, ppr := range pp.PromotionPrs {
+			if !config.DeploymentSchedule(ppr).IsEmpty() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// autoMergePromotionPr merges a promotion PR with autoMerge if schedule is open at now, otherwise the merge is held until the deployment window opens
+func autoMergePromotionPr(ghPrClientDetails GhPrClientDetails, pull *PullRequest, schedule cfg.DeploymentSchedule, now time.Time) error {
+	scheduleStatus, err := schedule.Status(now)
+	if err != nil {
+		ghPrClientDetails.PrLogger.Errorf("Failed to evaluate deployment schedule: err=%v", err)
+		return err
+	}
+	if !scheduleStatus.Open {
+		// The PR is still opened, only the merge waits for the deployment window
+		err = holdPromotionPrAutoMerge(ghPrClientDetails, pull, scheduleStatus)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Holding PR auto merge failed: err=%v", err)
+		}
+		return err
+	}
+	ghPrClientDetails.PrLogger.Infof("Auto-merging PR %d", pull.Number)
+	templateData := map[string]interface{}{
+		"prNumber": pull.Number,
+	}
+	templateOutput, err := executeTemplate("autoMerge", defaultTemplatesFullPath("auto-merge-comment.gotmpl"), templateData)
+	if err != nil {
+		return err
+	}
+	err = commentPR(ghPrClientDetails, templateOutput)
+	if err != nil {
+		return err
+	}
+
+	err = MergePr(ghPrClientDetails, &pull.Number)
+	if err != nil {
+		ghPrClientDetails.PrLogger.Errorf("PR auto merge failed: err=%v", err)
+	}
+	return err
+}
+
+// mergeNoDiffPromotionPr merges a promotion PR whose ArgoCD diff is empty, it follows the deployment schedule of the PR promotion like autoMergePromotionPr.
+// PRs already held for their deployment window are left to the queued merge.
+func mergeNoDiffPromotionPr(ghPrClientDetails GhPrClientDetails, config *cfg.Config, now time.Time) error {
+	pull, err := ghPrClientDetails.repoProvider().GetPullRequest(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber)
+	if err != nil {
+		return fmt.Errorf("getting PR %d: %w", ghPrClientDetails.PrNumber, err)
+	}
+	if pull.State != "open" || slices.Contains(pull.Labels, blockedByWindowLabel) {
+		return nil
+	}
+	// Promotion PRs without metadata predate deployment schedules and are merged right away
+	schedule, _ := promotionScheduleByKey(config, ghPrClientDetails.PrMetadata.PromotionKey)
+	scheduleStatus, err := schedule.Status(now)
+	if err != nil {
+		return err
+	}
+	if !scheduleStatus.Open {
+		return holdPromotionPrAutoMerge(ghPrClientDetails, pull, scheduleStatus)
+	}
+	ghPrClientDetails.PrLogger.Infof("Auto-merging (no diff) PR %d", pull.Number)
+	return MergePr(ghPrClientDetails, &pull.Number)
+}
+
+// holdPromotionPrAutoMerge labels a promotion PR that was opened outside of its deployment window and queues its merge to when the window opens
+func holdPromotionPrAutoMerge(ghPrClientDetails GhPrClientDetails, pull *PullRequest, status cfg.ScheduleStatus) error {
+	ghPrClientDetails.PrLogger.Infof("Holding auto merge of PR %d, %s", pull.Number, status.Reason)
+	err := ghPrClientDetails.repoProvider().AddLabels(ghPrClientDetails.Ctx, pull.Number, []string{blockedByWindowLabel})
+	if err != nil {
+		return fmt.Errorf("labeling PR %d: %w", pull.Number, err)
+	}
+	templateData := map[string]interface{}{
+		"prNumber": pull.Number,
+		"reason":   status.Reason,
+		"label":    blockedByWindowLabel,
+	}
+	if !status.NextOpen.IsZero() {
+		templateData["nextOpen"] = status.NextOpen.UTC().Format(time.RFC1123)
+	}
+	templateOutput, err := executeTemplate("blockedByWindow", defaultTemplatesFullPath("blocked-by-window-comment.gotmpl"), templateData)
+	if err != nil {
+		return err
+	}
+	err = commentPR(ghPrClientDetails, templateOutput)
+	if err != nil {
+		return err
+	}
+	windowedMerges.schedule(ghPrClientDetails, pull.Number, status.NextOpen)
+	return nil
+}
+
+// mergeWindowBlockedPr merges a held promotion PR if its deployment window is open at now, otherwise the merge is queued again.
+// PRs that were merged, closed or unlabeled in the meantime are left alone, as are PRs blocked by diff policy violations.
+func mergeWindowBlockedPr(ghPrClientDetails GhPrClientDetails, config *cfg.Config, pull *PullRequest, now time.Time) error {
+	if pull.State != "open" || !slices.Contains(pull.Labels, blockedByWindowLabel) {
+		return nil
+	}
+	if slices.Contains(pull.Labels, blockedByPolicyLabel) {
+		ghPrClientDetails.PrLogger.Infof("PR %d has diff policy violations, leaving it blocked", pull.Number)
+		return nil
+	}
+	var metadata prMetadata
+	found, err := metadata.fromPrBody(pull.Body)
+	if err != nil {
+		return fmt.Errorf("reading PR %d metadata: %w", pull.Number, err)
+	}
+	schedule, ok := promotionScheduleByKey(config, metadata.PromotionKey)
+	if !found || !ok {
+		ghPrClientDetails.PrLogger.Warnf("PR %d doesn't match any configured promotion, leaving it blocked", pull.Number)
+		return nil
+	}
+	status, err := schedule.Status(now)
+	if err != nil {
+		return err
+	}
+	if !status.Open {
+		windowedMerges.schedule(ghPrClientDetails, pull.Number, status.NextOpen)
+		return nil
+	}
+
+	ghPrClientDetails.PrLogger.Infof("Deployment window is open, auto-merging PR %d", pull.Number)
+	err = ghPrClientDetails.repoProvider().RemoveLabel(ghPrClientDetails.Ctx, pull.Number, blockedByWindowLabel)
+	if err != nil {
+		return fmt.Errorf("removing %s label from PR %d: %w", blockedByWindowLabel, pull.Number, err)
+	}
+	return MergePr(ghPrClientDetails, &pull.Number)
+}
+
+// mergeOpenWindowBlockedPrs goes over all held promotion PRs, this catches up on merges queued by a previous Telefonistka process
+func mergeOpenWindowBlockedPrs(ghPrClientDetails GhPrClientDetails, config *cfg.Config, defaultBranch string, now time.Time) error {
+	pulls, err := ghPrClientDetails.repoProvider().ListOpenPullRequests(ghPrClientDetails.Ctx, defaultBranch)
+	if err != nil {
+		return err
+	}
+	for _, pull := range pulls {
+		err = mergeWindowBlockedPr(ghPrClientDetails, config, pull, now)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Queued merge of PR %d failed: err=%v", pull.Number, err)
+		}
+	}
+	return nil
+}
+
+// windowedMergeEventSource is the event queue source of held merges, they are delayed events persisted until the deployment window opens
+const windowedMergeEventSource = "windowed-merge"
+
+// windowedMergeEvent is the payload of a held merge event, Event is the PR event that held the merge.
+// The held merge is handled like Event, so the repo provider of its source is built the same way, but HandlePREvent merges PR PrNumber instead.
+type windowedMergeEvent struct {
+	Event    eventqueue.Event `json:"event"`
+	PrNumber int              `json:"prNumber"`
+}
+
+type (
+	queuedEventKey   struct{}
+	windowedMergeKey struct{}
+)
+
+// queuedEvent is the event being handled and the queue it came from, held merges are enqueued next to it
+type queuedEvent struct {
+	queue EventEnqueuer
+	event eventqueue.Event
+}
+
+func withQueuedEvent(ctx context.Context, queue EventEnqueuer, e eventqueue.Event) context.Context {
+	return context.WithValue(ctx, queuedEventKey{}, queuedEvent{queue: queue, event: e})
+}
+
+// enqueueWindowedMerge persists a held merge as an event delayed to at, one per PR and time
+func enqueueWindowedMerge(qe queuedEvent, ghPrClientDetails GhPrClientDetails, number int, at time.Time) error {
+	payload, err := json.Marshal(windowedMergeEvent{Event: qe.event, PrNumber: number})
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/%s/%s/%s#%d", windowedMergeEventSource, qe.event.Source, ghPrClientDetails.Owner, ghPrClientDetails.Repo, number)
+	_, err = qe.queue.Enqueue(eventqueue.Event{
+		ID:         fmt.Sprintf("%s@%d", key, at.Unix()),
+		Source:     windowedMergeEventSource,
+		Type:       qe.event.Type,
+		Payload:    payload,
+		ReceivedAt: time.Now(),
+		// Held merges of a PR are handled one at a time, without holding back the events of the PR itself
+		Key:       key,
+		NotBefore: at,
+	})
+	return err
+}
+
+// windowedMergeQueue holds the timers of queued merges, at most one per PR.
+// Merges are only queued in memory when the PR event isn't handled from the event queue, like in the event command,
+// merges queued by a process that exited are picked up by mergeOpenWindowBlockedPrs on the next merged PR event.
+type windowedMergeQueue struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+var windowedMerges = &windowedMergeQueue{timers: map[string]*time.Timer{}}
+
+func (q *windowedMergeQueue) schedule(ghPrClientDetails GhPrClientDetails, number int, at time.Time) {
+	if at.IsZero() {
+		ghPrClientDetails.PrLogger.Warnf("Deployment schedule of PR %d never opens, not queueing a merge", number)
+		return
+	}
+	if qe, ok := ghPrClientDetails.Ctx.Value(queuedEventKey{}).(queuedEvent); ok {
+		err := enqueueWindowedMerge(qe, ghPrClientDetails, number, at)
+		if err == nil {
+			ghPrClientDetails.PrLogger.Infof("Queued merge of PR %d for %s", number, at.UTC().Format(time.RFC3339))
+			return
+		}
+		ghPrClientDetails.PrLogger.Errorf("Failed to persist the queued merge of PR %d, queueing it in memory: err=%v", number, err)
+	}
+	key := fmt.Sprintf("%s/%s#%d", ghPrClientDetails.Owner, ghPrClientDetails.Repo, number)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t, ok := q.timers[key]; ok {
+		t.Stop()
+	}
+	ghPrClientDetails.PrLogger.Infof("Queued merge of PR %d for %s, in memory only", number, at.UTC().Format(time.RFC3339))
+	var timer *time.Timer
+	timer = time.AfterFunc(time.Until(at), func() {
+		q.mu.Lock()
+		if q.timers[key] == timer {
+			delete(q.timers, key)
+		}
+		q.mu.Unlock()
+		q.run(ghPrClientDetails, number)
+	})
+	q.timers[key] = timer
+}
+
+func (q *windowedMergeQueue) run(ghPrClientDetails GhPrClientDetails, number int) {
+	// The context of the event that queued the merge is long gone
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	ghPrClientDetails.Ctx = ctx
+	if err := runWindowedMerge(ghPrClientDetails, number); err != nil {
+		ghPrClientDetails.PrLogger.Errorf("Queued merge of PR %d failed: err=%v", number, err)
+	}
+}
+
+// runWindowedMerge runs a queued merge, it re-reads the configuration and the PR, both might have changed since the merge was queued
+func runWindowedMerge(ghPrClientDetails GhPrClientDetails, number int) error {
+	defaultBranch, _ := ghPrClientDetails.GetDefaultBranch()
+	config, err := GetInRepoConfig(ghPrClientDetails, defaultBranch)
+	if err != nil {
+		return fmt.Errorf("get in-repo configuration: %w", err)
+	}
+	pull, err := ghPrClientDetails.repoProvider().GetPullRequest(ghPrClientDetails.Ctx, number)
+	if err != nil {
+		return fmt.Errorf("getting PR %d: %w", number, err)
+	}
+	return mergeWindowBlockedPr(ghPrClientDetails, config, pull, time.Now())
+}
@@ -0,0 +1,265 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+)
+
+func TestHandleMergedPrEventHoldsAutoMergeOutsideOfDeploymentWindow(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    conditions:
+      autoMerge: true
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+        deploymentWindows:
+          - days: ["Mon", "Tue", "Wed", "Thu"]
+            start: "09:00"
+            end: "16:00"
+            timezone: "America/New_York"
+        freezeCalendars:
+          - "long-freeze"
+freezeCalendars:
+  long-freeze:
+    - start: "2000-01-01T00:00:00Z"
+      end: "2100-01-01T00:00:00Z"
+      reason: "Nothing ships this century"
+`,
+		"env/staging/app1/values.yaml": "replicas: 3\n",
+		"env/prod/app1/values.yaml":    "replicas: 1\n",
+	})
+	repo.AddPullRequest(
+		PullRequest{Number: 1, State: "closed", Merged: true, HeadRef: "scale-app1", BaseRef: "main", Author: "alice"},
+		[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+	)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 1,
+		Ref:      "scale-app1",
+		PrAuthor: "alice",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	err := handleMergedPrEvent(ghPrClientDetails, repo)
+	if err != nil {
+		t.Fatalf("handleMergedPrEvent failed: %v", err)
+	}
+
+	pulls := repo.PullRequests()
+	if !assert.Len(t, pulls, 2) {
+		t.FailNow()
+	}
+	promotionPr := pulls[1]
+	assert.Equal(t, "open", promotionPr.State, "Promotion PR should be opened but not merged")
+	assert.Contains(t, promotionPr.Labels, blockedByWindowLabel)
+	assert.Contains(t, strings.Join(repo.Comments(1), "\n"), "Auto merge is on hold, the long-freeze freeze calendar is in effect until 2100-01-01T00:00:00Z (Nothing ships this century)")
+
+	// The first Monday after the freeze, inside the deployment window
+	config, err := GetInRepoConfig(ghPrClientDetails, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = mergeOpenWindowBlockedPrs(ghPrClientDetails, config, "main", time.Date(2100, 1, 4, 15, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	promotionPr = repo.PullRequests()[1]
+	assert.True(t, promotionPr.Merged, "Promotion PR should be merged once the window opens")
+	assert.NotContains(t, promotionPr.Labels, blockedByWindowLabel)
+}
+
+func TestMergeNoDiffPromotionPrFollowsDeploymentSchedule(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+        freezeCalendars:
+          - "long-freeze"
+freezeCalendars:
+  long-freeze:
+    - start: "2000-01-01T00:00:00Z"
+      end: "2100-01-01T00:00:00Z"
+      reason: "Nothing ships this century"
+argocd:
+  autoMergeNoDiffPRs: true
+`,
+	})
+	unchanged := "replicas: 1\n"
+	commit, err := repo.CreateCommit(context.Background(), "main", []TreeEntry{{Path: "env/prod/app1/values.yaml", Mode: "100644", Type: "blob", Content: &unchanged}}, "Promote app1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch(context.Background(), "promotions/3-app1", commit); err != nil {
+		t.Fatal(err)
+	}
+	repo.AddPullRequest(PullRequest{Number: 1, State: "open", HeadRef: "promotions/1-app1", BaseRef: "main", Labels: []string{"promotion"}}, nil)
+	repo.AddPullRequest(PullRequest{Number: 2, State: "open", HeadRef: "promotions/2-app1", BaseRef: "main", Labels: []string{"promotion", blockedByWindowLabel}}, nil)
+	repo.AddPullRequest(PullRequest{Number: 3, State: "open", HeadRef: "promotions/3-app1", BaseRef: "main", Labels: []string{"promotion"}}, nil)
+	config, err := GetInRepoConfig(GhPrClientDetails{Ctx: context.Background(), Provider: repo}, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prClientDetails := func(number int) GhPrClientDetails {
+		return GhPrClientDetails{
+			Ctx:        context.Background(),
+			Provider:   repo,
+			PrNumber:   number,
+			PrLogger:   log.WithFields(log.Fields{}),
+			PrMetadata: prMetadata{PromotionKey: promotionKey("env/staging/", []string{"env/prod/"})},
+		}
+	}
+	frozen := time.Date(2050, 1, 3, 15, 0, 0, 0, time.UTC)
+
+	if err := mergeNoDiffPromotionPr(prClientDetails(1), config, frozen); err != nil {
+		t.Fatal(err)
+	}
+	pull := repo.PullRequests()[0]
+	assert.False(t, pull.Merged, "No diff PRs shouldn't be merged during a freeze")
+	assert.Contains(t, pull.Labels, blockedByWindowLabel)
+
+	if err := mergeNoDiffPromotionPr(prClientDetails(2), config, time.Date(2100, 1, 4, 15, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	pull = repo.PullRequests()[1]
+	assert.False(t, pull.Merged, "PRs held for their deployment window should be left to the queued merge")
+	assert.Empty(t, repo.Comments(2))
+
+	if err := mergeNoDiffPromotionPr(prClientDetails(3), config, time.Date(2100, 1, 4, 15, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, repo.PullRequests()[2].Merged, "No diff PRs should be merged after the freeze")
+}
+
+func TestHeldMergesArePersistedInTheEventQueue(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+        freezeCalendars:
+          - "long-freeze"
+freezeCalendars:
+  long-freeze:
+    - start: "2000-01-01T00:00:00Z"
+      end: "2100-01-01T00:00:00Z"
+      reason: "Nothing ships this century"
+`,
+	})
+	repo.AddPullRequest(PullRequest{Number: 1, State: "open", HeadRef: "promotions/1-app1", BaseRef: "main", Labels: []string{"promotion"}}, nil)
+	config, err := GetInRepoConfig(GhPrClientDetails{Ctx: context.Background(), Provider: repo}, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventQueue := &fakeEnqueuer{}
+	prEvent := eventqueue.Event{ID: "github/delivery-1", Source: githubEventSource, Type: "pull_request", Payload: []byte(`{"action":"synchronize"}`)}
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:        withQueuedEvent(context.Background(), eventQueue, prEvent),
+		Provider:   repo,
+		Owner:      "AnOwner",
+		Repo:       "Arepo",
+		PrNumber:   1,
+		PrLogger:   log.WithFields(log.Fields{}),
+		PrMetadata: prMetadata{PromotionKey: promotionKey("env/staging/", []string{"env/prod/"})},
+	}
+
+	if err := mergeNoDiffPromotionPr(ghPrClientDetails, config, time.Date(2050, 1, 3, 15, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, eventQueue.events, 1, "The held merge should be persisted as a delayed event") {
+		t.FailNow()
+	}
+	heldMerge := eventQueue.events[0]
+	assert.Equal(t, windowedMergeEventSource, heldMerge.Source)
+	assert.Equal(t, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), heldMerge.NotBefore.UTC())
+	var payload windowedMergeEvent
+	if assert.NoError(t, json.Unmarshal(heldMerge.Payload, &payload)) {
+		assert.Equal(t, 1, payload.PrNumber)
+		assert.Equal(t, prEvent.ID, payload.Event.ID, "The held merge should carry the event that held it, its repo provider is built from it")
+	}
+
+	// Re-queueing the same merge, like mergeOpenWindowBlockedPrs does on every merged PR, is deduplicated
+	windowedMerges.schedule(ghPrClientDetails, 1, heldMerge.NotBefore)
+	assert.Len(t, eventQueue.events, 1)
+}
+
+func TestHandlePREventRunsHeldMerges(t *testing.T) {
+	t.Parallel()
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+`,
+	})
+	commit, err := repo.CreateCommit(context.Background(), "main", nil, "Promote app1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch(context.Background(), "promotions/2-app1", commit); err != nil {
+		t.Fatal(err)
+	}
+	serializedMetadata, err := prMetadata{PromotionKey: promotionKey("env/staging/", []string{"env/prod/"})}.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo.AddPullRequest(PullRequest{Number: 1, State: "closed", Merged: true, HeadRef: "app1", BaseRef: "main"}, nil)
+	repo.AddPullRequest(PullRequest{Number: 2, State: "open", HeadRef: "promotions/2-app1", BaseRef: "main", Body: "<!--|Telefonistka data, do not delete|" + serializedMetadata + "|-->", Labels: []string{"promotion", blockedByWindowLabel}}, nil)
+	// The held merge carries the merged PR event that opened the promotion PR
+	eventPayload := &github.PullRequestEvent{
+		Action:      github.String("closed"),
+		PullRequest: &github.PullRequest{Number: github.Int(1), Merged: github.Bool(true), Body: github.String("")},
+	}
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		PrNumber: 1,
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	ctx := context.WithValue(context.Background(), windowedMergeKey{}, 2)
+	ghPrClientDetails.Ctx = ctx
+
+	if err := HandlePREvent(eventPayload, ghPrClientDetails, GhClientPair{}, repo, ctx); err != nil {
+		t.Fatal(err)
+	}
+	pulls := repo.PullRequests()
+	if assert.Len(t, pulls, 2, "The merged PR event shouldn't be handled again") {
+		assert.True(t, pulls[1].Merged, "The held promotion PR should be merged once its window is open")
+		assert.NotContains(t, pulls[1].Labels, blockedByWindowLabel)
+	}
+}
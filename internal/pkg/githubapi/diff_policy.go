@@ -0,0 +1,131 @@
+package githubapi
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+// blockedByPolicyLabel marks PRs with diff policy violations, Telefonistka doesn't auto merge them
+const blockedByPolicyLabel = "blocked-by-policy"
+
+// pendingPolicyCheckLabel marks auto merge promotion PRs whose merge waits for their diff to be checked against the diff policies
+const pendingPolicyCheckLabel = "pending-policy-check"
+
+// diffPolicyViolations checks the diff of every app against the diff policies of its component.
+func diffPolicyViolations(componentConfigs map[string]*cfg.ComponentConfig, diffResults []argocd.DiffResult, prLabels []*github.Label) []argocd.DiffPolicyViolation {
+	labels := make([]string, 0, len(prLabels))
+	for _, l := range prLabels {
+		labels = append(labels, l.GetName())
+	}
+	var violations []argocd.DiffPolicyViolation
+	for _, diffResult := range diffResults {
+		componentConfig, ok := componentConfigs[diffResult.ComponentPath]
+		if !ok {
+			continue
+		}
+		violations = append(violations, argocd.DiffPolicyViolations(diffResult, componentConfig.DiffPolicies, labels)...)
+	}
+	return violations
+}
+
+// setBlockedByPolicyLabel adds the blocked-by-policy label to PRs with violations and removes it once they are fixed or allowed.
+func setBlockedByPolicyLabel(ghPrClientDetails GhPrClientDetails, prLabels []*github.Label, blocked bool) error {
+	labeled := DoesPrHasLabel(prLabels, blockedByPolicyLabel)
+	switch {
+	case blocked && !labeled:
+		return ghPrClientDetails.repoProvider().AddLabels(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber, []string{blockedByPolicyLabel})
+	case !blocked && labeled:
+		return ghPrClientDetails.repoProvider().RemoveLabel(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber, blockedByPolicyLabel)
+	default:
+		return nil
+	}
+}
+
+// isDiffPolicyLabel reports whether label is required by a diff policy of a component changed in the PR, adding or removing it changes the policy violations.
+// Like the policies themselves, the required labels are read from the default branch.
+func isDiffPolicyLabel(ghPrClientDetails GhPrClientDetails, label string) (bool, error) {
+	defaultBranch, _ := ghPrClientDetails.GetDefaultBranch()
+	config, err := GetInRepoConfig(ghPrClientDetails, defaultBranch)
+	if err != nil {
+		return false, fmt.Errorf("get in-repo configuration: %w", err)
+	}
+	if !config.Argocd.CommentDiffonPR {
+		return false, nil
+	}
+	componentPathList, err := generateListOfChangedComponentPaths(ghPrClientDetails, config)
+	if err != nil {
+		return false, fmt.Errorf("generate list of changed components: %w", err)
+	}
+	for _, componentPath := range componentPathList {
+		c, err := getComponentConfig(ghPrClientDetails, componentPath, defaultBranch)
+		if err != nil {
+			return false, fmt.Errorf("get component (%s) config:  %w", componentPath, err)
+		}
+		for _, policy := range c.DiffPolicies {
+			if policy.RequireLabel != "" && policy.RequireLabel == label {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// promotionHasDiffPolicies reports whether a target component of promotion has diff policies on the default branch,
+// the promotion PR can't be auto merged before its diff is checked against them.
+func promotionHasDiffPolicies(ghPrClientDetails GhPrClientDetails, config *cfg.Config, promotion PromotionInstance, defaultBranch string) (bool, error) {
+	if !config.Argocd.CommentDiffonPR {
+		return false, nil
+	}
+	for targetPath := range promotion.ComputedSyncPaths {
+		c, err := getComponentConfig(ghPrClientDetails, targetPath, defaultBranch)
+		if err != nil {
+			return false, fmt.Errorf("get component (%s) config:  %w", targetPath, err)
+		}
+		if len(c.DiffPolicies) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// holdAutoMergeForPolicyCheck labels a promotion PR so its "changed" event merges it once its diff passes the diff policies
+func holdAutoMergeForPolicyCheck(ghPrClientDetails GhPrClientDetails, pull *PullRequest) error {
+	ghPrClientDetails.PrLogger.Infof("Holding auto merge of PR %d until its diff is checked against the diff policies", pull.Number)
+	err := ghPrClientDetails.repoProvider().AddLabels(ghPrClientDetails.Ctx, pull.Number, []string{pendingPolicyCheckLabel})
+	if err != nil {
+		return fmt.Errorf("labeling PR %d: %w", pull.Number, err)
+	}
+	return nil
+}
+
+// mergePolicyCheckedPr auto merges the PR of ghPrClientDetails if it was held for the diff policies check, the caller checked its diff has no violations.
+// The deployment schedule of the promotion still applies.
+func mergePolicyCheckedPr(ghPrClientDetails GhPrClientDetails, config *cfg.Config, now time.Time) error {
+	pull, err := ghPrClientDetails.repoProvider().GetPullRequest(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber)
+	if err != nil {
+		return fmt.Errorf("getting PR %d: %w", ghPrClientDetails.PrNumber, err)
+	}
+	if pull.State != "open" || !slices.Contains(pull.Labels, pendingPolicyCheckLabel) {
+		return nil
+	}
+	var metadata prMetadata
+	found, err := metadata.fromPrBody(pull.Body)
+	if err != nil {
+		return fmt.Errorf("reading PR %d metadata: %w", pull.Number, err)
+	}
+	schedule, ok := promotionScheduleByKey(config, metadata.PromotionKey)
+	if !found || !ok {
+		ghPrClientDetails.PrLogger.Warnf("PR %d doesn't match any configured promotion, leaving it for a manual merge", pull.Number)
+		return nil
+	}
+	err = ghPrClientDetails.repoProvider().RemoveLabel(ghPrClientDetails.Ctx, pull.Number, pendingPolicyCheckLabel)
+	if err != nil {
+		return fmt.Errorf("removing %s label from PR %d: %w", pendingPolicyCheckLabel, pull.Number, err)
+	}
+	return autoMergePromotionPr(ghPrClientDetails, pull, schedule, now)
+}
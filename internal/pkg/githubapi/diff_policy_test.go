@@ -0,0 +1,146 @@
+package githubapi
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsDiffPolicyLabelReadsDefaultBranch(t *testing.T) {
+	t.Parallel()
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+argocd:
+  commentDiffonPR: true
+`,
+		"env/staging/app1/values.yaml": "replicas: 2\n",
+		"env/staging/app1/telefonistka.yaml": `
+diffPolicies:
+  - kinds:
+      - Deployment
+    replicasDecrease: true
+    requireLabel: approved-scale-down
+`,
+	})
+	// The PR relaxes the policy of its own component
+	scaledDown := "replicas: 1\n"
+	relaxedConfig := `
+diffPolicies:
+  - kinds:
+      - Deployment
+    replicasDecrease: true
+    requireLabel: anything-goes
+`
+	commit, err := repo.CreateCommit(context.Background(), "main", []TreeEntry{
+		{Path: "env/staging/app1/values.yaml", Mode: "100644", Type: "blob", Content: &scaledDown},
+		{Path: "env/staging/app1/telefonistka.yaml", Mode: "100644", Type: "blob", Content: &relaxedConfig},
+	}, "Scale down")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch(context.Background(), "scale-down", commit); err != nil {
+		t.Fatal(err)
+	}
+	repo.AddPullRequest(
+		PullRequest{Number: 1, State: "open", HeadRef: "scale-down", BaseRef: "main"},
+		[]ChangedFile{
+			{Filename: "env/staging/app1/values.yaml", Status: "modified"},
+			{Filename: "env/staging/app1/telefonistka.yaml", Status: "modified"},
+		},
+	)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		PrNumber: 1,
+		Ref:      "scale-down",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+
+	isPolicyLabel, err := isDiffPolicyLabel(ghPrClientDetails, "approved-scale-down")
+	if assert.NoError(t, err) {
+		assert.True(t, isPolicyLabel)
+	}
+	isPolicyLabel, err = isDiffPolicyLabel(ghPrClientDetails, "anything-goes")
+	if assert.NoError(t, err) {
+		assert.False(t, isPolicyLabel, "Labels required by the PR branch policies shouldn't count")
+	}
+}
+
+func TestHandleMergedPrEventHoldsAutoMergeForDiffPolicies(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    conditions:
+      autoMerge: true
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+argocd:
+  commentDiffonPR: true
+`,
+		"env/staging/app1/values.yaml": "replicas: 1\n",
+		"env/prod/app1/values.yaml":    "replicas: 3\n",
+		"env/prod/app1/telefonistka.yaml": `
+diffPolicies:
+  - kinds:
+      - Deployment
+    replicasDecrease: true
+    requireLabel: approved-scale-down
+`,
+	})
+	repo.AddPullRequest(
+		PullRequest{Number: 1, State: "closed", Merged: true, HeadRef: "scale-down-app1", BaseRef: "main", Author: "alice"},
+		[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+	)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 1,
+		Ref:      "scale-down-app1",
+		PrAuthor: "alice",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	if err := handleMergedPrEvent(ghPrClientDetails, repo); err != nil {
+		t.Fatalf("handleMergedPrEvent failed: %v", err)
+	}
+
+	pulls := repo.PullRequests()
+	if !assert.Len(t, pulls, 2) {
+		t.FailNow()
+	}
+	promotionPr := pulls[1]
+	assert.Equal(t, "open", promotionPr.State, "The replica decrease has to be checked before the PR is merged")
+	assert.Contains(t, promotionPr.Labels, pendingPolicyCheckLabel)
+
+	// The "changed" event of the promotion PR found no violations, like after the approved-scale-down label was added
+	config, err := GetInRepoConfig(ghPrClientDetails, "main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	promotionPrClientDetails := ghPrClientDetails
+	promotionPrClientDetails.PrNumber = promotionPr.Number
+	promotionPrClientDetails.Ref = promotionPr.HeadRef
+	if err := mergePolicyCheckedPr(promotionPrClientDetails, config, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	promotionPr = repo.PullRequests()[1]
+	assert.True(t, promotionPr.Merged, "Promotion PR should be merged once its diff passes the policies")
+	assert.NotContains(t, promotionPr.Labels, pendingPolicyCheckLabel)
+}
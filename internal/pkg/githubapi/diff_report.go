@@ -0,0 +1,99 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+const (
+	diffReportCheckRunName = "Telefonistka ArgoCD diff report"
+	// githubCheckRunTextMaxSize is the GitHub limit of a check run output text
+	githubCheckRunTextMaxSize = 65535
+)
+
+type diffReportFileKey struct{}
+
+// WithDiffReportFile makes the PR events handled with ctx write their ArgoCD diff report, as JSON, to path.
+func WithDiffReportFile(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, diffReportFileKey{}, path)
+}
+
+func newDiffReport(ghPrClientDetails GhPrClientDetails, diffResults []argocd.DiffResult) argocd.DiffReport {
+	report := argocd.NewDiffReport(diffResults)
+	report.Repo = ghPrClientDetails.Owner + "/" + ghPrClientDetails.Repo
+	report.PrNumber = ghPrClientDetails.PrNumber
+	report.Revision = ghPrClientDetails.Ref
+	report.CommitSHA = ghPrClientDetails.PrSHA
+	return report
+}
+
+// publishDiffReport writes the machine readable ArgoCD diff report to the file set with WithDiffReportFile and to a check run when argocd.diffReportCheckRun is set.
+func publishDiffReport(ctx context.Context, ghPrClientDetails GhPrClientDetails, config *cfg.Config, diffResults []argocd.DiffResult) error {
+	report := newDiffReport(ghPrClientDetails, diffResults)
+	var errs []error
+	if path, _ := ctx.Value(diffReportFileKey{}).(string); path != "" {
+		reportJSON, err := json.MarshalIndent(report, "", "  ")
+		if err == nil {
+			err = os.WriteFile(path, reportJSON, 0o644) //nolint:gosec // G306: the report is meant to be read by other tools
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("writing diff report to %s: %w", path, err))
+		} else {
+			ghPrClientDetails.PrLogger.Infof("Wrote ArgoCD diff report to %s", path)
+		}
+	}
+	if config.Argocd.DiffReportCheckRun {
+		checkRun, err := diffReportCheckRun(report)
+		if err == nil {
+			err = createCheckRun(ghPrClientDetails, checkRun)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("creating diff report check run: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// diffReportCheckRun renders report as a neutral check run, the JSON document is in the output text.
+// Reports too large for a check run lose their textual diffs first and are left out completely if that's not enough.
+func diffReportCheckRun(report argocd.DiffReport) (CheckRun, error) {
+	checkRun := CheckRun{
+		Name:       diffReportCheckRunName,
+		HeadSHA:    report.CommitSHA,
+		Conclusion: "neutral",
+		Title:      argocdDiffCheckRunTitle(report),
+		Summary:    argocdDiffCheckRunSummary(report),
+	}
+
+	text, err := diffReportCheckRunText(report)
+	if err != nil {
+		return checkRun, err
+	}
+	if len(text) > githubCheckRunTextMaxSize {
+		if text, err = diffReportCheckRunText(report.WithoutDiffs()); err != nil {
+			return checkRun, err
+		}
+		if len(text) > githubCheckRunTextMaxSize {
+			text = ""
+			checkRun.Summary += "\nThe JSON report is too large for a check run.\n"
+		} else {
+			checkRun.Summary += "\nThe JSON report is too large for a check run, textual diffs were left out.\n"
+		}
+	}
+	checkRun.Text = text
+	return checkRun, nil
+}
+
+func diffReportCheckRunText(report argocd.DiffReport) (string, error) {
+	reportJSON, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return "```json\n" + string(reportJSON) + "\n```\n", nil
+}
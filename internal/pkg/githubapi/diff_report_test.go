@@ -0,0 +1,86 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+func TestPublishDiffReport(t *testing.T) {
+	t.Parallel()
+	repo := NewInMemoryRepoProvider("main", map[string]string{})
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 7,
+		Ref:      "scale-foo",
+		PrSHA:    "c0ffee",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	diffResults := []argocd.DiffResult{
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", HasDiff: true, DiffElements: []argocd.DiffElement{
+			{ObjectKind: "Deployment", ObjectName: "foo", ChangeType: argocd.ChangeTypeModified, Diff: "-replicas: 2\n+replicas: 3\n"},
+		}},
+		{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar"},
+	}
+	reportPath := filepath.Join(t.TempDir(), "diff-report.json")
+	ctx := WithDiffReportFile(context.Background(), reportPath)
+	config := &cfg.Config{Argocd: cfg.ArgocdConfig{DiffReportCheckRun: true}}
+
+	err := publishDiffReport(ctx, ghPrClientDetails, config, diffResults)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reportJSON, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report argocd.DiffReport
+	if err := json.Unmarshal(reportJSON, &report); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "AnOwner/Arepo", report.Repo)
+	assert.Equal(t, 7, report.PrNumber)
+	assert.Equal(t, "c0ffee", report.CommitSHA)
+	assert.True(t, report.HasDiff)
+	assert.Len(t, report.Apps, 2)
+
+	checkRuns := repo.CheckRuns("c0ffee")
+	if assert.Len(t, checkRuns, 1) {
+		assert.Equal(t, diffReportCheckRunName, checkRuns[0].Name)
+		assert.Equal(t, "neutral", checkRuns[0].Conclusion)
+		assert.Equal(t, "1 of 2 ArgoCD applications will change", checkRuns[0].Title)
+		assert.Contains(t, checkRuns[0].Summary, "`foo` @ `clusters/prod/foo`: 1 changed objects")
+		assert.Contains(t, checkRuns[0].Text, `"diff": "-replicas: 2\n+replicas: 3\n"`)
+	}
+}
+
+func TestDiffReportCheckRunSizeLimit(t *testing.T) {
+	t.Parallel()
+	hugeDiff := strings.Repeat("+a line of a huge ConfigMap\n", 5000)
+	report := argocd.NewDiffReport([]argocd.DiffResult{
+		{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", HasDiff: true, DiffElements: []argocd.DiffElement{
+			{ObjectKind: "ConfigMap", ObjectName: "huge", ChangeType: argocd.ChangeTypeAdded, Diff: hugeDiff},
+		}},
+	})
+
+	checkRun, err := diffReportCheckRun(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.LessOrEqual(t, len(checkRun.Text), githubCheckRunTextMaxSize)
+	assert.Contains(t, checkRun.Text, `"name": "huge"`)
+	assert.NotContains(t, checkRun.Text, "a line of a huge ConfigMap")
+	assert.Contains(t, checkRun.Summary, "textual diffs were left out")
+}
@@ -5,11 +5,9 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/google/go-github/v62/github"
 	"github.com/hexops/gotextdiff"
 	"github.com/hexops/gotextdiff/myers"
 	"github.com/hexops/gotextdiff/span"
-	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
 )
 
 func generateDiffOutput(ghPrClientDetails GhPrClientDetails, defaultBranch string, sourceFilesSHAs map[string]string, targetFilesSHAs map[string]string, sourcePath string, targetPath string) (bool, string, error) {
@@ -96,19 +94,15 @@ func CompareRepoDirectories(ghPrClientDetails GhPrClientDetails, sourcePath stri
 }
 
 func generateFlatMapfromFileTree(ghPrClientDetails *GhPrClientDetails, workingPath *string, rootPath *string, branch *string, listOfFiles map[string]string) {
-	getContentOpts := &github.RepositoryContentGetOptions{
-		Ref: *branch,
-	}
-	_, directoryContent, resp, _ := ghPrClientDetails.GhClientPair.v3Client.Repositories.GetContents(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *workingPath, getContentOpts)
-	prom.InstrumentGhCall(resp)
+	directoryContent, _ := ghPrClientDetails.repoProvider().ListDirectory(ghPrClientDetails.Ctx, *branch, *workingPath)
 	for _, elementInDir := range directoryContent {
-		if *elementInDir.Type == "file" {
-			relativeName := strings.TrimPrefix(*elementInDir.Path, *rootPath+"/")
-			listOfFiles[relativeName] = *elementInDir.SHA
-		} else if *elementInDir.Type == "dir" {
-			generateFlatMapfromFileTree(ghPrClientDetails, elementInDir.Path, rootPath, branch, listOfFiles)
+		if elementInDir.Type == "file" {
+			relativeName := strings.TrimPrefix(elementInDir.Path, *rootPath+"/")
+			listOfFiles[relativeName] = elementInDir.SHA
+		} else if elementInDir.Type == "dir" {
+			generateFlatMapfromFileTree(ghPrClientDetails, &elementInDir.Path, rootPath, branch, listOfFiles)
 		} else {
-			ghPrClientDetails.PrLogger.Infof("Ignoring type %s for path %s", *elementInDir.Type, *elementInDir.Path)
+			ghPrClientDetails.PrLogger.Infof("Ignoring type %s for path %s", elementInDir.Type, elementInDir.Path)
 		}
 	}
 }
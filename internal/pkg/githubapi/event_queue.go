@@ -0,0 +1,120 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+	lru "github.com/hashicorp/golang-lru/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+)
+
+const (
+	githubEventSource = "github"
+	gitlabEventSource = "gitlab"
+	giteaEventSource  = "gitea"
+)
+
+// EventEnqueuer persists received webhook events until they are handled, see eventqueue.FileQueue
+type EventEnqueuer interface {
+	Enqueue(e eventqueue.Event) (enqueued bool, err error)
+}
+
+// prEventKeys returns the event queue keys of a PR event, events of the same PR are handled in order.
+// Events that re-evaluate the PR head(opened/reopened/synchronize) supersede the older ones of the same PR, their diff and checks are for a stale SHA.
+func prEventKeys(source string, eventPayload *github.PullRequestEvent) (key string, supersedeKey string) {
+	key = fmt.Sprintf("%s/%s/%s#%d", source, eventPayload.GetRepo().GetOwner().GetLogin(), eventPayload.GetRepo().GetName(), eventPayload.GetPullRequest().GetNumber())
+	if stat, ok := eventToHandle(eventPayload); ok && stat == "changed" {
+		supersedeKey = key + "/changed"
+	}
+	return key, supersedeKey
+}
+
+// githubEventKeys returns the event queue keys of GitHub events, PR comments share the key of their PR.
+func githubEventKeys(eventPayloadInterface interface{}) (key string, supersedeKey string) {
+	switch eventPayload := eventPayloadInterface.(type) {
+	case *github.PullRequestEvent:
+		return prEventKeys(githubEventSource, eventPayload)
+	case *github.IssueCommentEvent:
+		return fmt.Sprintf("%s/%s/%s#%d", githubEventSource, eventPayload.GetRepo().GetOwner().GetLogin(), eventPayload.GetRepo().GetName(), eventPayload.GetIssue().GetNumber()), ""
+	default:
+		return "", ""
+	}
+}
+
+// enqueueEvent persists a validated webhook, deliveryID is the provider delivery ID and is used to ignore redeliveries of the same event.
+// Without a delivery ID the payload hash is used, identical payloads are the same event as far as Telefonistka is concerned.
+func enqueueEvent(eventQueue EventEnqueuer, e eventqueue.Event, deliveryID string) error {
+	if deliveryID == "" {
+		sum := sha256.Sum256(e.Payload)
+		deliveryID = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	e.ID = e.Source + "/" + deliveryID
+	e.Headers = e.Headers.Clone()
+	e.ReceivedAt = time.Now()
+	enqueued, err := eventQueue.Enqueue(e)
+	if err != nil {
+		log.Errorf("Failed to enqueue %s event %s: err=%s\n", e.Type, e.ID, err)
+		return err
+	}
+	if !enqueued {
+		log.Infof("Ignoring duplicate delivery %s", e.ID)
+	}
+	return nil
+}
+
+// NewEventHandler returns the event queue handler, it dispatches events to the handler of their source.
+// Parsing errors are permanent, the payload was already parsed successfully when it was received so retrying won't help.
+// Merges held until a deployment window opens are persisted in eventQueue, they are only queued in memory when it's nil.
+func NewEventHandler(mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair], eventQueue EventEnqueuer) eventqueue.Handler {
+	var handler eventqueue.Handler
+	handler = func(ctx context.Context, e eventqueue.Event) error {
+		if eventQueue != nil {
+			ctx = withQueuedEvent(ctx, eventQueue, e)
+		}
+		switch e.Source {
+		case windowedMergeEventSource:
+			var windowedMerge windowedMergeEvent
+			if err := json.Unmarshal(e.Payload, &windowedMerge); err != nil {
+				return eventqueue.Permanent(fmt.Errorf("parsing held merge event: %w", err))
+			}
+			return handler(context.WithValue(ctx, windowedMergeKey{}, windowedMerge.PrNumber), windowedMerge.Event)
+		case gitlabEventSource:
+			event, err := parseGitlabMergeRequestEvent(e.Payload)
+			if err != nil {
+				return eventqueue.Permanent(fmt.Errorf("parsing GitLab event: %w", err))
+			}
+			return handleGitlabMergeRequestEvent(ctx, event)
+		case giteaEventSource:
+			event, err := parseGiteaPullRequestEvent(e.Payload)
+			if err != nil {
+				return eventqueue.Permanent(fmt.Errorf("parsing Gitea event: %w", err))
+			}
+			return handleGiteaPullRequestEvent(ctx, event)
+		default:
+			eventPayloadInterface, err := github.ParseWebHook(e.Type, e.Payload)
+			if err != nil {
+				return eventqueue.Permanent(fmt.Errorf("parsing GitHub event: %w", err))
+			}
+			// The webhook proxy forwards the original request, so it's rebuilt from the stored headers and payload
+			r, err := http.NewRequestWithContext(ctx, http.MethodPost, "", io.NopCloser(bytes.NewReader(e.Payload)))
+			if err != nil {
+				return eventqueue.Permanent(err)
+			}
+			r.Header = e.Headers.Clone()
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			return handleEvent(ctx, eventPayloadInterface, mainGhClientCache, prApproverGhClientCache, r, e.Payload)
+		}
+	}
+	return handler
+}
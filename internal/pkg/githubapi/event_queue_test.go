@@ -0,0 +1,115 @@
+package githubapi
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-github/v62/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+)
+
+type fakeEnqueuer struct {
+	events []eventqueue.Event
+}
+
+func (f *fakeEnqueuer) Enqueue(e eventqueue.Event) (bool, error) {
+	for _, queued := range f.events {
+		if queued.ID == e.ID {
+			return false, nil
+		}
+	}
+	f.events = append(f.events, e)
+	return true, nil
+}
+
+func TestEnqueueEventIDs(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		source     string
+		deliveryID string
+		payload    string
+		expectedID string
+	}{
+		"Delivery ID": {
+			source:     githubEventSource,
+			deliveryID: "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			payload:    `{"action":"closed"}`,
+			expectedID: "github/72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		},
+		"No delivery ID": {
+			source:     gitlabEventSource,
+			payload:    `{"object_kind":"merge_request"}`,
+			expectedID: "gitlab/sha256:89b55ce7b5add30039309c52f9f6fc79f666d4ae8bd5e3f2bdc420d1936593e0",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			q := &fakeEnqueuer{}
+			headers := http.Header{"X-Test": []string{"a"}}
+			e := eventqueue.Event{Source: tc.source, Type: "pull_request", Headers: headers, Payload: []byte(tc.payload)}
+			err := enqueueEvent(q, e, tc.deliveryID)
+			assert.NoError(t, err)
+			// A redelivery is accepted but not queued again
+			err = enqueueEvent(q, e, tc.deliveryID)
+			assert.NoError(t, err)
+
+			if assert.Len(t, q.events, 1) {
+				assert.Equal(t, tc.expectedID, q.events[0].ID)
+				assert.Equal(t, tc.source, q.events[0].Source)
+				assert.Equal(t, "a", q.events[0].Headers.Get("X-Test"))
+				assert.Equal(t, []byte(tc.payload), q.events[0].Payload)
+			}
+		})
+	}
+}
+
+func TestGithubEventKeys(t *testing.T) {
+	t.Parallel()
+	repo := &github.Repository{Owner: &github.User{Login: github.String("AnOwner")}, Name: github.String("Arepo")}
+	prEvent := func(action string, merged bool) *github.PullRequestEvent {
+		return &github.PullRequestEvent{
+			Action:      github.String(action),
+			Repo:        repo,
+			PullRequest: &github.PullRequest{Number: github.Int(7), Merged: github.Bool(merged)},
+		}
+	}
+	tests := map[string]struct {
+		event                interface{}
+		expectedKey          string
+		expectedSupersedeKey string
+	}{
+		"Synchronize supersedes": {
+			event:                prEvent("synchronize", false),
+			expectedKey:          "github/AnOwner/Arepo#7",
+			expectedSupersedeKey: "github/AnOwner/Arepo#7/changed",
+		},
+		"Opened supersedes": {
+			event:                prEvent("opened", false),
+			expectedKey:          "github/AnOwner/Arepo#7",
+			expectedSupersedeKey: "github/AnOwner/Arepo#7/changed",
+		},
+		"Merge is only serialized": {
+			event:       prEvent("closed", true),
+			expectedKey: "github/AnOwner/Arepo#7",
+		},
+		"Comment shares the PR key": {
+			event:       &github.IssueCommentEvent{Repo: repo, Issue: &github.Issue{Number: github.Int(7)}},
+			expectedKey: "github/AnOwner/Arepo#7",
+		},
+		"Push isn't serialized": {
+			event: &github.PushEvent{},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			key, supersedeKey := githubEventKeys(tc.event)
+			assert.Equal(t, tc.expectedKey, key)
+			assert.Equal(t, tc.expectedSupersedeKey, supersedeKey)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestGiteaPromotionIntegration runs the whole promotion flow against a real Gitea instance, it only runs when GITEA_TEST_URL and GITEA_TEST_TOKEN are set:
+//
+//	docker run -d -p 3000:3000 -e GITEA__security__INSTALL_LOCK=true gitea/gitea:1.22
+//	docker exec -u git <container> gitea admin user create --admin --username telefonistka --password telefonistka --email telefonistka@example.com
+//	docker exec -u git <container> gitea admin user generate-access-token --username telefonistka --scopes all --raw
+//	GITEA_TEST_URL=http://localhost:3000 GITEA_TEST_TOKEN=<token> go test ./internal/pkg/githubapi -run TestGiteaPromotionIntegration
+func TestGiteaPromotionIntegration(t *testing.T) { //nolint:paralleltest // Talks to a shared external Gitea instance
+	giteaURL := os.Getenv("GITEA_TEST_URL")
+	giteaToken := os.Getenv("GITEA_TEST_TOKEN")
+	if giteaURL == "" || giteaToken == "" {
+		t.Skip("GITEA_TEST_URL and GITEA_TEST_TOKEN are not set")
+	}
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	giteaAPI := func(method string, apiPath string, requestBody interface{}, out interface{}) {
+		t.Helper()
+		b, _ := json.Marshal(requestBody)
+		req, err := http.NewRequestWithContext(ctx, method, giteaURL+"/api/v1"+apiPath, bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "token "+giteaToken)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			t.Fatalf("%s %s: %s", method, apiPath, resp.Status)
+		}
+		if out != nil {
+			if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	var user struct {
+		Login string `json:"login"`
+	}
+	giteaAPI(http.MethodGet, "/user", nil, &user)
+	repoName := fmt.Sprintf("telefonistka-it-%d", time.Now().Unix())
+	giteaAPI(http.MethodPost, "/user/repos", map[string]interface{}{"name": repoName, "auto_init": true, "default_branch": "main"}, nil)
+	t.Cleanup(func() { giteaAPI(http.MethodDelete, "/repos/"+user.Login+"/"+repoName, nil, nil) })
+
+	initialFiles := map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+`,
+		"env/staging/app1/values.yaml": "replicas: 1\n",
+		"env/prod/app1/values.yaml":    "replicas: 1\n",
+		"env/prod/app1/stale.yaml":     "stale: true\n",
+	}
+	files := []giteaFileOperation{}
+	for filePath, content := range initialFiles {
+		files = append(files, giteaFileOperation{Operation: "create", Path: filePath, Content: base64.StdEncoding.EncodeToString([]byte(content))})
+	}
+	giteaAPI(http.MethodPost, "/repos/"+user.Login+"/"+repoName+"/contents", map[string]interface{}{"branch": "main", "message": "Initial content", "files": files}, nil)
+
+	provider := newGiteaProvider(giteaURL, giteaToken, user.Login, repoName)
+	newValues := "replicas: 2\n"
+	commitSHA, err := provider.CreateCommit(ctx, "main", []TreeEntry{{Path: "env/staging/app1/values.yaml", Mode: "100644", Type: "blob", Content: &newValues}}, "Scale app1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.CreateBranch(ctx, "feature", commitSHA); err != nil {
+		t.Fatal(err)
+	}
+	pr, err := provider.CreatePullRequest(ctx, NewPullRequest{Title: "Scale app1", Base: "main", Head: "feature"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.MergePullRequest(ctx, pr.Number, "Scale app1"); err != nil {
+		t.Fatal(err)
+	}
+
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      ctx,
+		Provider: provider,
+		Owner:    user.Login,
+		Repo:     repoName,
+		PrNumber: pr.Number,
+		Ref:      "feature",
+		PrAuthor: user.Login,
+		PrLogger: log.WithFields(log.Fields{"repo": repoName}),
+	}
+	err = handleMergedPrEvent(ghPrClientDetails, provider)
+	if err != nil {
+		t.Fatalf("handleMergedPrEvent failed: %v", err)
+	}
+
+	promotionPr, err := provider.GetPullRequest(ctx, pr.Number+1)
+	if err != nil {
+		t.Fatalf("Promotion PR wasn't opened: %v", err)
+	}
+	assert.Equal(t, "🚀 Promotion: app1 ➡️  env/prod/", promotionPr.Title)
+	assert.Equal(t, []string{"promotion"}, promotionPr.Labels)
+	promotedValues, err := provider.GetFileContent(ctx, promotionPr.HeadRef, "env/prod/app1/values.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, newValues, promotedValues)
+	_, err = provider.GetFileContent(ctx, promotionPr.HeadRef, "env/prod/app1/stale.yaml")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,688 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+const giteaPageSize = 50
+
+// giteaProvider is the RepoProvider implementation for Gitea and Forgejo, it uses the REST(v1) API directly.
+//
+// Like GitLab, Gitea can only create commits through its "change files" API that also moves(or creates) a branch,
+// so CreateCommit stages the file operations and the following CreateBranch call creates the commit on the new branch.
+type giteaProvider struct {
+	httpClient *http.Client
+	apiURL     string
+	webURL     string
+	token      string
+	owner      string
+	repo       string
+
+	mu             sync.Mutex
+	pendingCommits map[string]giteaPendingCommit
+}
+
+type giteaPendingCommit struct {
+	baseBranch string
+	message    string
+	files      []giteaFileOperation
+}
+
+type giteaFileOperation struct {
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	Content   string `json:"content,omitempty"`
+	// SHA of the file being updated or deleted, Gitea rejects the operation if it doesn't match
+	SHA string `json:"sha,omitempty"`
+}
+
+type giteaTreeEntry struct {
+	Path string `json:"path"`
+	Type string `json:"type"`
+	SHA  string `json:"sha"`
+}
+
+type giteaPullRequest struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	Merged  bool   `json:"merged"`
+	Head    struct {
+		Ref string `json:"ref"`
+		SHA string `json:"sha"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+	User struct {
+		Login string `json:"login"`
+	} `json:"user"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Assignees []struct {
+		Login string `json:"login"`
+	} `json:"assignees"`
+}
+
+type giteaCommitStatus struct {
+	Status      string `json:"status"`
+	Context     string `json:"context"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url"`
+}
+
+type giteaAPIError struct {
+	method     string
+	apiPath    string
+	statusCode int
+	status     string
+	body       string
+}
+
+func (e *giteaAPIError) Error() string {
+	return fmt.Sprintf("Gitea API %s %s: %s %s", e.method, e.apiPath, e.status, e.body)
+}
+
+// newGiteaProvider creates a provider for owner/repo, baseURL is the Gitea root URL including scheme(and sub path if any)
+func newGiteaProvider(baseURL string, token string, owner string, repo string) *giteaProvider {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &giteaProvider{
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		apiURL:         baseURL + "/api/v1",
+		webURL:         fmt.Sprintf("%s/%s/%s", baseURL, owner, repo),
+		token:          token,
+		owner:          owner,
+		repo:           repo,
+		pendingCommits: map[string]giteaPendingCommit{},
+	}
+}
+
+// BlameURLPrefix relies on Gitea resolving the "HEAD" commit ref to the default branch head
+func (g *giteaProvider) BlameURLPrefix() string {
+	return g.webURL + "/blame/commit"
+}
+
+// escapeRepoPath escapes each path segment but keeps the slashes, as expected by the contents and raw APIs
+func escapeRepoPath(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// do sends a request to a repo scoped API path and returns the response body
+func (g *giteaProvider) do(ctx context.Context, method string, apiPath string, query url.Values, requestBody interface{}) ([]byte, error) {
+	apiPath = "/repos/" + url.PathEscape(g.owner) + "/" + url.PathEscape(g.repo) + apiPath
+	u := g.apiURL + apiPath
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var bodyReader io.Reader
+	if requestBody != nil {
+		b, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		bodyReader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "token "+g.token)
+	req.Header.Set("Accept", "application/json")
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		err := &giteaAPIError{method: method, apiPath: apiPath, statusCode: resp.StatusCode, status: resp.Status, body: strings.TrimSpace(string(respBody))}
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, err
+	}
+	return respBody, nil
+}
+
+func (g *giteaProvider) doJSON(ctx context.Context, method string, apiPath string, query url.Values, requestBody interface{}, out interface{}) error {
+	respBody, err := g.do(ctx, method, apiPath, query, requestBody)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (g *giteaProvider) GetDefaultBranch(ctx context.Context) (string, error) {
+	var repo struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := g.doJSON(ctx, http.MethodGet, "", nil, nil, &repo)
+	return repo.DefaultBranch, err
+}
+
+func (g *giteaProvider) GetFileContent(ctx context.Context, ref string, filePath string) (string, error) {
+	content, err := g.do(ctx, http.MethodGet, "/raw/"+escapeRepoPath(filePath), url.Values{"ref": {ref}}, nil)
+	return string(content), err
+}
+
+func (g *giteaProvider) ListDirectory(ctx context.Context, ref string, dirPath string) ([]RepoContent, error) {
+	apiPath := "/contents"
+	if p := escapeRepoPath(dirPath); p != "" && p != "." {
+		apiPath += "/" + p
+	}
+	var entries []struct {
+		Path string `json:"path"`
+		Type string `json:"type"`
+		SHA  string `json:"sha"`
+	}
+	err := g.doJSON(ctx, http.MethodGet, apiPath, url.Values{"ref": {ref}}, nil, &entries)
+	if err != nil {
+		return nil, err
+	}
+	contents := make([]RepoContent, 0, len(entries))
+	for _, e := range entries {
+		contents = append(contents, RepoContent{Path: e.Path, Type: e.Type, SHA: e.SHA})
+	}
+	return contents, nil
+}
+
+// listTreeFiles returns all the files under the tree object treeSHA, keyed by their relative path with their blob SHA as value
+func (g *giteaProvider) listTreeFiles(ctx context.Context, treeSHA string) (map[string]string, error) {
+	files := map[string]string{}
+	query := url.Values{"recursive": {"true"}, "per_page": {"1000"}}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var tree struct {
+			Tree      []giteaTreeEntry `json:"tree"`
+			Truncated bool             `json:"truncated"`
+		}
+		err := g.doJSON(ctx, http.MethodGet, "/git/trees/"+url.PathEscape(treeSHA), query, nil, &tree)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range tree.Tree {
+			if e.Type == "blob" {
+				files[e.Path] = e.SHA
+			}
+		}
+		if !tree.Truncated || len(tree.Tree) == 0 {
+			break
+		}
+	}
+	return files, nil
+}
+
+// listDirectoryFiles is listTreeFiles for a directory path on a branch, a missing directory has no files
+func (g *giteaProvider) listDirectoryFiles(ctx context.Context, ref string, dirPath string) (map[string]string, error) {
+	parentContents, err := g.ListDirectory(ctx, ref, path.Dir(strings.Trim(dirPath, "/")))
+	if errors.Is(err, ErrNotFound) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, c := range parentContents {
+		if c.Path == strings.Trim(dirPath, "/") && c.Type == "dir" {
+			return g.listTreeFiles(ctx, c.SHA)
+		}
+	}
+	return map[string]string{}, nil
+}
+
+// fileSHA returns the blob SHA of filePath on ref or an empty string if it doesn't exist
+func (g *giteaProvider) fileSHA(ctx context.Context, ref string, filePath string) (string, error) {
+	var content struct {
+		SHA string `json:"sha"`
+	}
+	err := g.doJSON(ctx, http.MethodGet, "/contents/"+escapeRepoPath(filePath), url.Values{"ref": {ref}}, nil, &content)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return content.SHA, err
+}
+
+// blobContent returns the base64 encoded content of a blob, this is already the encoding the change files API expects
+func (g *giteaProvider) blobContent(ctx context.Context, blobSHA string) (string, error) {
+	var blob struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	err := g.doJSON(ctx, http.MethodGet, "/git/blobs/"+url.PathEscape(blobSHA), nil, nil, &blob)
+	if err != nil {
+		return "", err
+	}
+	if blob.Encoding != "base64" {
+		return "", fmt.Errorf("unexpected blob %s encoding %s", blobSHA, blob.Encoding)
+	}
+	return strings.ReplaceAll(blob.Content, "\n", ""), nil
+}
+
+func writeOperation(filePath string, existingSHA string, base64Content string) giteaFileOperation {
+	operation := giteaFileOperation{Operation: "create", Path: filePath, Content: base64Content}
+	if existingSHA != "" {
+		operation.Operation = "update"
+		operation.SHA = existingSHA
+	}
+	return operation
+}
+
+// CreateCommit translates the GitHub style tree entries into Gitea file operations, see giteaProvider
+func (g *giteaProvider) CreateCommit(ctx context.Context, baseBranch string, treeEntries []TreeEntry, commitMsg string) (string, error) {
+	var operations []giteaFileOperation
+	operationIndex := map[string]int{} // later entries for the same path win, like in a Git tree
+	addOperation := func(operation giteaFileOperation) {
+		if i, ok := operationIndex[operation.Path]; ok {
+			operations[i] = operation
+			return
+		}
+		operationIndex[operation.Path] = len(operations)
+		operations = append(operations, operation)
+	}
+
+	for _, treeEntry := range treeEntries {
+		switch {
+		case treeEntry.Type == "tree":
+			sourceFiles, err := g.listTreeFiles(ctx, treeEntry.getSHA())
+			if err != nil {
+				return "", err
+			}
+			targetFiles, err := g.listDirectoryFiles(ctx, baseBranch, treeEntry.Path)
+			if err != nil {
+				return "", err
+			}
+			for relativePath, blobSHA := range sourceFiles {
+				targetBlobSHA := targetFiles[relativePath]
+				if targetBlobSHA == blobSHA {
+					continue
+				}
+				content, err := g.blobContent(ctx, blobSHA)
+				if err != nil {
+					return "", err
+				}
+				addOperation(writeOperation(path.Join(treeEntry.Path, relativePath), targetBlobSHA, content))
+			}
+		case treeEntry.Content != nil || treeEntry.SHA != nil:
+			existingSHA, err := g.fileSHA(ctx, baseBranch, treeEntry.Path)
+			if err != nil {
+				return "", err
+			}
+			if treeEntry.Content != nil {
+				addOperation(writeOperation(treeEntry.Path, existingSHA, base64.StdEncoding.EncodeToString([]byte(*treeEntry.Content))))
+				continue
+			}
+			content, err := g.blobContent(ctx, *treeEntry.SHA)
+			if err != nil {
+				return "", err
+			}
+			addOperation(writeOperation(treeEntry.Path, existingSHA, content))
+		default:
+			existingSHA, err := g.fileSHA(ctx, baseBranch, treeEntry.Path)
+			if err != nil {
+				return "", err
+			}
+			if existingSHA == "" {
+				continue
+			}
+			addOperation(giteaFileOperation{Operation: "delete", Path: treeEntry.Path, SHA: existingSHA})
+		}
+	}
+
+	commitSHA := pendingCommitSHA(baseBranch, commitMsg, operations)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pendingCommits[commitSHA] = giteaPendingCommit{baseBranch: baseBranch, message: commitMsg, files: operations}
+	return commitSHA, nil
+}
+
+func (g *giteaProvider) CreateBranch(ctx context.Context, branchName string, commitSHA string) error {
+	g.mu.Lock()
+	pendingCommit, isPending := g.pendingCommits[commitSHA]
+	delete(g.pendingCommits, commitSHA)
+	g.mu.Unlock()
+
+	if !isPending {
+		return g.doJSON(ctx, http.MethodPost, "/branches", nil, map[string]interface{}{"new_branch_name": branchName, "old_ref_name": commitSHA}, nil)
+	}
+	if len(pendingCommit.files) == 0 {
+		// Gitea rejects change requests without files, the branch content is identical to its base anyway
+		return g.doJSON(ctx, http.MethodPost, "/branches", nil, map[string]interface{}{"new_branch_name": branchName, "old_branch_name": pendingCommit.baseBranch}, nil)
+	}
+	changeFilesRequest := map[string]interface{}{
+		"branch":     pendingCommit.baseBranch,
+		"new_branch": branchName,
+		"message":    pendingCommit.message,
+		"files":      pendingCommit.files,
+	}
+	return g.doJSON(ctx, http.MethodPost, "/contents", nil, changeFilesRequest, nil)
+}
+
+// UpdateBranch can only apply a pending commit staged on top of branchName itself, see giteaProvider
+func (g *giteaProvider) UpdateBranch(ctx context.Context, branchName string, commitSHA string) error {
+	g.mu.Lock()
+	pendingCommit, isPending := g.pendingCommits[commitSHA]
+	delete(g.pendingCommits, commitSHA)
+	g.mu.Unlock()
+
+	if !isPending || pendingCommit.baseBranch != branchName {
+		return fmt.Errorf("Gitea can only update branch %s with a commit created on top of it", branchName)
+	}
+	if len(pendingCommit.files) == 0 {
+		return nil
+	}
+	changeFilesRequest := map[string]interface{}{
+		"branch":  branchName,
+		"message": pendingCommit.message,
+		"files":   pendingCommit.files,
+	}
+	return g.doJSON(ctx, http.MethodPost, "/contents", nil, changeFilesRequest, nil)
+}
+
+func (pr giteaPullRequest) toPullRequest() *PullRequest {
+	pullRequest := &PullRequest{
+		Number:  pr.Number,
+		HTMLURL: pr.HTMLURL,
+		Title:   pr.Title,
+		Body:    pr.Body,
+		State:   pr.State,
+		Merged:  pr.Merged,
+		HeadRef: pr.Head.Ref,
+		HeadSHA: pr.Head.SHA,
+		BaseRef: pr.Base.Ref,
+		Author:  pr.User.Login,
+	}
+	for _, l := range pr.Labels {
+		pullRequest.Labels = append(pullRequest.Labels, l.Name)
+	}
+	for _, a := range pr.Assignees {
+		pullRequest.Assignees = append(pullRequest.Assignees, a.Login)
+	}
+	return pullRequest
+}
+
+func (g *giteaProvider) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	pr := giteaPullRequest{}
+	err := g.doJSON(ctx, http.MethodGet, "/pulls/"+strconv.Itoa(number), nil, nil, &pr)
+	if err != nil {
+		return nil, err
+	}
+	return pr.toPullRequest(), nil
+}
+
+// ListOpenPullRequests filters by base branch on the client side, not all supported Gitea versions can do it in the API
+func (g *giteaProvider) ListOpenPullRequests(ctx context.Context, baseBranch string) ([]*PullRequest, error) {
+	pullRequests := []*PullRequest{}
+	query := url.Values{"state": {"open"}, "limit": {strconv.Itoa(giteaPageSize)}}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var prs []giteaPullRequest
+		err := g.doJSON(ctx, http.MethodGet, "/pulls", query, nil, &prs)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range prs {
+			if pr.Base.Ref == baseBranch {
+				pullRequests = append(pullRequests, pr.toPullRequest())
+			}
+		}
+		if len(prs) < giteaPageSize {
+			break
+		}
+	}
+	return pullRequests, nil
+}
+
+func (g *giteaProvider) ListPullRequestFiles(ctx context.Context, number int) ([]ChangedFile, error) {
+	changedFiles := []ChangedFile{}
+	query := url.Values{"limit": {strconv.Itoa(giteaPageSize)}}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var pageFiles []struct {
+			Filename string `json:"filename"`
+			Status   string `json:"status"`
+		}
+		err := g.doJSON(ctx, http.MethodGet, "/pulls/"+strconv.Itoa(number)+"/files", query, nil, &pageFiles)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range pageFiles {
+			status := f.Status
+			if status == "deleted" {
+				status = "removed"
+			}
+			changedFiles = append(changedFiles, ChangedFile{Filename: f.Filename, Status: status})
+		}
+		if len(pageFiles) < giteaPageSize {
+			break
+		}
+	}
+	return changedFiles, nil
+}
+
+func (g *giteaProvider) CreatePullRequest(ctx context.Context, newPr NewPullRequest) (*PullRequest, error) {
+	prRequest := map[string]interface{}{
+		"head":  strings.TrimPrefix(newPr.Head, "refs/heads/"),
+		"base":  newPr.Base,
+		"title": newPr.Title,
+		"body":  newPr.Body,
+	}
+	pr := giteaPullRequest{}
+	err := g.doJSON(ctx, http.MethodPost, "/pulls", nil, prRequest, &pr)
+	if err != nil {
+		return nil, err
+	}
+	return pr.toPullRequest(), nil
+}
+
+// MergePullRequest retries while Gitea answers "405 Method Not Allowed", this is what it does until the (asynchronous) conflict check of new PRs is done
+func (g *giteaProvider) MergePullRequest(ctx context.Context, number int, commitMsg string) error {
+	mergeRequest := map[string]interface{}{
+		"Do":                  "merge",
+		"merge_message_field": commitMsg,
+	}
+	merge := func() error {
+		err := g.doJSON(ctx, http.MethodPost, "/pulls/"+strconv.Itoa(number)+"/merge", nil, mergeRequest, nil)
+		var apiErr *giteaAPIError
+		if errors.As(err, &apiErr) && apiErr.statusCode == http.StatusMethodNotAllowed {
+			return err
+		} else if err != nil {
+			return backoff.Permanent(err)
+		}
+		return nil
+	}
+	mergeBackoff := backoff.NewExponentialBackOff()
+	mergeBackoff.MaxElapsedTime = time.Minute
+	return backoff.Retry(merge, backoff.WithContext(mergeBackoff, ctx))
+}
+
+func (g *giteaProvider) ClosePullRequest(ctx context.Context, number int) error {
+	return g.doJSON(ctx, http.MethodPatch, "/pulls/"+strconv.Itoa(number), nil, map[string]interface{}{"state": "closed"}, nil)
+}
+
+func (g *giteaProvider) UpdatePullRequest(ctx context.Context, number int, title string, body string) error {
+	return g.doJSON(ctx, http.MethodPatch, "/pulls/"+strconv.Itoa(number), nil, map[string]interface{}{"title": title, "body": body}, nil)
+}
+
+func (g *giteaProvider) ApprovePullRequest(ctx context.Context, number int) error {
+	return g.doJSON(ctx, http.MethodPost, "/pulls/"+strconv.Itoa(number)+"/reviews", nil, map[string]interface{}{"event": "APPROVED"}, nil)
+}
+
+// AddAssignees keeps the existing assignees, Gitea replaces the whole list on issue edit
+func (g *giteaProvider) AddAssignees(ctx context.Context, number int, assignees []string) error {
+	pr, err := g.GetPullRequest(ctx, number)
+	if err != nil {
+		return err
+	}
+	for _, a := range assignees {
+		if !slices.Contains(pr.Assignees, a) {
+			pr.Assignees = append(pr.Assignees, a)
+		}
+	}
+	return g.doJSON(ctx, http.MethodPatch, "/issues/"+strconv.Itoa(number), nil, map[string]interface{}{"assignees": pr.Assignees}, nil)
+}
+
+func (g *giteaProvider) CreateComment(ctx context.Context, number int, body string) error {
+	return g.doJSON(ctx, http.MethodPost, "/issues/"+strconv.Itoa(number)+"/comments", nil, map[string]interface{}{"body": body}, nil)
+}
+
+// lastLabelChange finds the label change behind a label_updated/label_cleared webhook in the PR timeline, the webhook payload only has the resulting labels.
+// Changes made after until(the PR update time in the payload) belong to later webhooks and are skipped.
+func (g *giteaProvider) lastLabelChange(ctx context.Context, number int, until time.Time) (label string, added bool, found bool, err error) {
+	query := url.Values{"limit": {strconv.Itoa(giteaPageSize)}}
+	if !until.IsZero() {
+		query.Set("since", until.Add(-time.Minute).Format(time.RFC3339))
+	}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var timeline []struct {
+			Type  string `json:"type"`
+			Body  string `json:"body"`
+			Label *struct {
+				Name string `json:"name"`
+			} `json:"label"`
+			CreatedAt time.Time `json:"created_at"`
+		}
+		err := g.doJSON(ctx, http.MethodGet, "/issues/"+strconv.Itoa(number)+"/timeline", query, nil, &timeline)
+		if err != nil {
+			return "", false, false, err
+		}
+		for _, c := range timeline {
+			if c.Type != "label" || c.Label == nil || (!until.IsZero() && c.CreatedAt.After(until)) {
+				continue
+			}
+			// Gitea marks added labels with a "1" body and removed ones with an empty body
+			label, added, found = c.Label.Name, c.Body == "1", true
+		}
+		if len(timeline) < giteaPageSize {
+			return label, added, found, nil
+		}
+	}
+}
+
+// repoLabelIDs maps the repo label names to their IDs, the Gitea issue label API only accepts IDs
+func (g *giteaProvider) repoLabelIDs(ctx context.Context) (map[string]int64, error) {
+	labelIDs := map[string]int64{}
+	query := url.Values{"limit": {strconv.Itoa(giteaPageSize)}}
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+		var repoLabels []struct {
+			ID   int64  `json:"id"`
+			Name string `json:"name"`
+		}
+		err := g.doJSON(ctx, http.MethodGet, "/labels", query, nil, &repoLabels)
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range repoLabels {
+			labelIDs[l.Name] = l.ID
+		}
+		if len(repoLabels) < giteaPageSize {
+			return labelIDs, nil
+		}
+	}
+}
+
+// AddLabels creates missing repo labels first, unlike GitHub Gitea doesn't create labels on first use
+func (g *giteaProvider) AddLabels(ctx context.Context, number int, labels []string) error {
+	labelIDs, err := g.repoLabelIDs(ctx)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, 0, len(labels))
+	for _, name := range labels {
+		if _, ok := labelIDs[name]; !ok {
+			var newLabel struct {
+				ID int64 `json:"id"`
+			}
+			err := g.doJSON(ctx, http.MethodPost, "/labels", nil, map[string]interface{}{"name": name, "color": "#ededed"}, &newLabel)
+			if err != nil {
+				return fmt.Errorf("create label %s: %w", name, err)
+			}
+			labelIDs[name] = newLabel.ID
+		}
+		ids = append(ids, labelIDs[name])
+	}
+	return g.doJSON(ctx, http.MethodPost, "/issues/"+strconv.Itoa(number)+"/labels", nil, map[string]interface{}{"labels": ids}, nil)
+}
+
+func (g *giteaProvider) RemoveLabel(ctx context.Context, number int, label string) error {
+	labelIDs, err := g.repoLabelIDs(ctx)
+	if err != nil {
+		return err
+	}
+	id, ok := labelIDs[label]
+	if !ok {
+		return nil
+	}
+	err = g.doJSON(ctx, http.MethodDelete, "/issues/"+strconv.Itoa(number)+"/labels/"+strconv.FormatInt(id, 10), nil, nil, nil)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+func (g *giteaProvider) ListCommitStatuses(ctx context.Context, ref string) ([]CommitStatus, error) {
+	var giteaStatuses []giteaCommitStatus
+	err := g.doJSON(ctx, http.MethodGet, "/commits/"+url.PathEscape(ref)+"/statuses", url.Values{"sort": {"recentupdate"}}, nil, &giteaStatuses)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]CommitStatus, 0, len(giteaStatuses))
+	for _, s := range giteaStatuses {
+		state := s.Status
+		if state == "warning" { // Gitea only state
+			state = "failure"
+		}
+		statuses = append(statuses, CommitStatus{
+			State:       state,
+			Context:     s.Context,
+			Description: s.Description,
+			TargetURL:   s.TargetURL,
+		})
+	}
+	return statuses, nil
+}
+
+func (g *giteaProvider) CreateCommitStatus(ctx context.Context, sha string, status CommitStatus) error {
+	statusRequest := map[string]interface{}{
+		"state":       status.State,
+		"context":     status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetURL,
+	}
+	return g.doJSON(ctx, http.MethodPost, "/statuses/"+url.PathEscape(sha), nil, statusRequest, nil)
+}
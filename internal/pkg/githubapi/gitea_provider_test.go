@@ -0,0 +1,175 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGiteaProvider(t *testing.T, handler http.HandlerFunc) *giteaProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return newGiteaProvider(server.URL+"/", "a-token", "AnOwner", "Arepo")
+}
+
+func TestGiteaProviderSyncCommit(t *testing.T) {
+	t.Parallel()
+	var changeFilesRequest struct {
+		Branch    string               `json:"branch"`
+		NewBranch string               `json:"new_branch"`
+		Message   string               `json:"message"`
+		Files     []giteaFileOperation `json:"files"`
+	}
+	g := newTestGiteaProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token a-token", r.Header.Get("Authorization"))
+		switch r.Method + " " + r.URL.RequestURI() {
+		case "GET /api/v1/repos/AnOwner/Arepo/git/trees/tree1?page=1&per_page=1000&recursive=true":
+			_, _ = w.Write([]byte(`{"tree": [{"path": "values.yaml", "type": "blob", "sha": "blob1"}, {"path": "config", "type": "tree", "sha": "tree3"}, {"path": "config/new.yaml", "type": "blob", "sha": "blob2"}, {"path": "same.yaml", "type": "blob", "sha": "blob4"}], "truncated": false}`))
+		case "GET /api/v1/repos/AnOwner/Arepo/contents/env/prod?ref=main":
+			_, _ = w.Write([]byte(`[{"path": "env/prod/app1", "type": "dir", "sha": "tree2"}]`))
+		case "GET /api/v1/repos/AnOwner/Arepo/git/trees/tree2?page=1&per_page=1000&recursive=true":
+			_, _ = w.Write([]byte(`{"tree": [{"path": "values.yaml", "type": "blob", "sha": "blob0"}, {"path": "stale.yaml", "type": "blob", "sha": "blob3"}, {"path": "same.yaml", "type": "blob", "sha": "blob4"}], "truncated": false}`))
+		case "GET /api/v1/repos/AnOwner/Arepo/git/blobs/blob1":
+			_, _ = w.Write([]byte(`{"content": "cmVwbGljYXM6IDIK", "encoding": "base64"}`))
+		case "GET /api/v1/repos/AnOwner/Arepo/git/blobs/blob2":
+			_, _ = w.Write([]byte(`{"content": "bmV3OiB0cnVlCg==", "encoding": "base64"}`))
+		case "GET /api/v1/repos/AnOwner/Arepo/contents/env/prod/app1/stale.yaml?ref=main":
+			_, _ = w.Write([]byte(`{"path": "env/prod/app1/stale.yaml", "type": "file", "sha": "blob3"}`))
+		case "GET /api/v1/repos/AnOwner/Arepo/contents/env/prod/app1/gone.yaml?ref=main":
+			http.NotFound(w, r)
+		case "POST /api/v1/repos/AnOwner/Arepo/contents":
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &changeFilesRequest); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.RequestURI())
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+
+	sourceSHA := "tree1"
+	pendingCommitSHA, err := g.CreateCommit(ctx, "main", []TreeEntry{
+		{Path: "env/prod/app1", Mode: "040000", Type: "tree", SHA: &sourceSHA},
+		{Path: "env/prod/app1/stale.yaml", Mode: "100644", Type: "blob"},
+		{Path: "env/prod/app1/gone.yaml", Mode: "100644", Type: "blob"},
+	}, "Syncing from env/staging/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.CreateBranch(ctx, "promotions/1-feature-abc", pendingCommitSHA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "main", changeFilesRequest.Branch)
+	assert.Equal(t, "promotions/1-feature-abc", changeFilesRequest.NewBranch)
+	assert.Equal(t, "Syncing from env/staging/", changeFilesRequest.Message)
+	sort.Slice(changeFilesRequest.Files, func(i, j int) bool { return changeFilesRequest.Files[i].Path < changeFilesRequest.Files[j].Path })
+	assert.Equal(t, []giteaFileOperation{
+		{Operation: "create", Path: "env/prod/app1/config/new.yaml", Content: base64.StdEncoding.EncodeToString([]byte("new: true\n"))},
+		{Operation: "delete", Path: "env/prod/app1/stale.yaml", SHA: "blob3"},
+		{Operation: "update", Path: "env/prod/app1/values.yaml", Content: base64.StdEncoding.EncodeToString([]byte("replicas: 2\n")), SHA: "blob0"},
+	}, changeFilesRequest.Files)
+}
+
+func TestGiteaProviderFileNotFound(t *testing.T) {
+	t.Parallel()
+	g := newTestGiteaProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/repos/AnOwner/Arepo/raw/env/prod/telefonistka.yaml", r.URL.Path)
+		http.NotFound(w, r)
+	})
+
+	_, err := g.GetFileContent(context.Background(), "main", "env/prod/telefonistka.yaml")
+	assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound, got %v", err)
+}
+
+func TestGiteaProviderAddLabelsCreatesMissingLabels(t *testing.T) {
+	t.Parallel()
+	var addedLabelIDs struct {
+		Labels []int64 `json:"labels"`
+	}
+	createdLabels := []string{}
+	g := newTestGiteaProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/AnOwner/Arepo/labels":
+			_, _ = w.Write([]byte(`[{"id": 7, "name": "show-plan"}]`))
+		case "POST /api/v1/repos/AnOwner/Arepo/labels":
+			var label struct {
+				Name string `json:"name"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &label)
+			createdLabels = append(createdLabels, label.Name)
+			_, _ = w.Write([]byte(`{"id": 9}`))
+		case "POST /api/v1/repos/AnOwner/Arepo/issues/3/labels":
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &addedLabelIDs)
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+
+	err := g.AddLabels(context.Background(), 3, []string{"promotion", "show-plan"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"promotion"}, createdLabels)
+	assert.Equal(t, []int64{9, 7}, addedLabelIDs.Labels)
+}
+
+func TestGiteaProviderMergeRetriesWhileNotMergeable(t *testing.T) {
+	t.Parallel()
+	mergeAttempts := 0
+	g := newTestGiteaProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST /api/v1/repos/AnOwner/Arepo/pulls/3/merge", r.Method+" "+r.URL.Path)
+		mergeAttempts++
+		if mergeAttempts < 3 {
+			http.Error(w, `{"message": "Please try again later"}`, http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	err := g.MergePullRequest(context.Background(), 3, "Auto-merge: Promotion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, mergeAttempts)
+}
+
+func TestGiteaProviderLastLabelChange(t *testing.T) {
+	t.Parallel()
+	g := newTestGiteaProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET /api/v1/repos/AnOwner/Arepo/issues/3/timeline", r.Method+" "+r.URL.Path)
+		assert.Equal(t, "2024-05-01T10:00:00Z", r.URL.Query().Get("since"))
+		_, _ = w.Write([]byte(`[
+			{"type": "label", "body": "1", "label": {"name": "show-plan"}, "created_at": "2024-05-01T10:00:30Z"},
+			{"type": "comment", "body": "LGTM", "created_at": "2024-05-01T10:00:40Z"},
+			{"type": "label", "body": "", "label": {"name": "approved-crd-change"}, "created_at": "2024-05-01T10:01:00Z"},
+			{"type": "label", "body": "1", "label": {"name": "later-label"}, "created_at": "2024-05-01T10:02:00Z"}
+		]`))
+	})
+
+	label, added, found, err := g.lastLabelChange(context.Background(), 3, time.Date(2024, 5, 1, 10, 1, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, found)
+	assert.Equal(t, "approved-crd-change", label)
+	assert.False(t, added)
+}
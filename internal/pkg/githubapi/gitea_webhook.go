@@ -0,0 +1,218 @@
+package githubapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
+)
+
+// giteaPullRequestEventType is the event type to use when handling Gitea event files outside of Gitea Actions,
+// Gitea itself reuses the GitHub "pull_request" name.
+const giteaPullRequestEventType = "gitea_pull_request"
+
+type giteaPullRequestEvent struct {
+	Action      string           `json:"action"`
+	PullRequest giteaPullRequest `json:"pull_request"`
+	Repository  struct {
+		Name     string `json:"name"`
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+		Owner    struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
+
+	// changedLabel isn't part of the payload, Gitea doesn't say which label changed so it's looked up in the PR timeline, see handleGiteaPullRequestEvent
+	changedLabel *giteaLabelChange
+}
+
+type giteaLabelChange struct {
+	name  string
+	added bool
+}
+
+// toPullRequestEvent translates the Gitea pull request event to the GitHub event the rest of Telefonistka understands,
+// the payloads are quite similar but some actions have different names.
+func (e giteaPullRequestEvent) toPullRequestEvent() *github.PullRequestEvent {
+	pr := e.PullRequest
+	var action string
+	switch e.Action {
+	case "synchronized":
+		action = "synchronize"
+	case "label_updated":
+		action = "labeled"
+		if e.changedLabel != nil && !e.changedLabel.added {
+			action = "unlabeled"
+		}
+	case "label_cleared":
+		action = "unlabeled"
+	default:
+		action = e.Action
+	}
+	var label *github.Label
+	if e.changedLabel != nil {
+		label = &github.Label{Name: github.String(e.changedLabel.name)}
+	}
+
+	labels := []*github.Label{}
+	for _, l := range pr.Labels {
+		labels = append(labels, &github.Label{Name: github.String(l.Name)})
+	}
+
+	return &github.PullRequestEvent{
+		Action: github.String(action),
+		Label:  label,
+		PullRequest: &github.PullRequest{
+			Number: github.Int(pr.Number),
+			Merged: github.Bool(pr.Merged),
+			Body:   github.String(pr.Body),
+			Labels: labels,
+			User:   &github.User{Login: github.String(pr.User.Login)},
+			Head: &github.PullRequestBranch{
+				Ref: github.String(pr.Head.Ref),
+				SHA: github.String(pr.Head.SHA),
+			},
+			Base: &github.PullRequestBranch{
+				Ref: github.String(pr.Base.Ref),
+			},
+		},
+		Repo: &github.Repository{
+			Owner:   &github.User{Login: github.String(e.Repository.Owner.Login)},
+			Name:    github.String(e.Repository.Name),
+			HTMLURL: github.String(e.Repository.HTMLURL),
+		},
+	}
+}
+
+// giteaBaseURL returns the Gitea root URL, GITEA_URL is only needed when the URL Telefonistka should use differs from the public one
+func (e giteaPullRequestEvent) giteaBaseURL() string {
+	return getEnv("GITEA_URL", strings.TrimSuffix(e.Repository.HTMLURL, "/"+e.Repository.FullName))
+}
+
+// isGiteaEvent also matches Forgejo, which sends the Gitea headers in addition to its own
+func isGiteaEvent(r *http.Request) bool {
+	return r.Header.Get("X-Gitea-Event") != ""
+}
+
+// reciveGiteaWebhook is the Gitea counterpart of ReciveWebhook, the signature is a plain hex HMAC-SHA256 of the payload
+func reciveGiteaWebhook(r *http.Request, eventQueue EventEnqueuer) error {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("error reading request body: err=%s\n", err)
+		prom.InstrumentWebhookHit("validation_failed")
+		return err
+	}
+	err = validateGiteaSignature(r.Header.Get("X-Gitea-Signature"), payload, []byte(getEnv("GITEA_WEBHOOK_SECRET", "")))
+	if err != nil {
+		prom.InstrumentWebhookHit("validation_failed")
+		return err
+	}
+	eventType := r.Header.Get("X-Gitea-Event")
+	if eventType != "pull_request" {
+		log.Debugf("Ignoring Gitea %s event", eventType)
+		prom.InstrumentWebhookHit("successful")
+		return nil
+	}
+
+	event, err := parseGiteaPullRequestEvent(payload)
+	if err != nil {
+		log.Errorf("could not parse webhook: err=%s\n", err)
+		prom.InstrumentWebhookHit("parsing_failed")
+		return err
+	}
+	prom.InstrumentWebhookHit("successful")
+
+	key, supersedeKey := prEventKeys(giteaEventSource, event.toPullRequestEvent())
+	return enqueueEvent(eventQueue, eventqueue.Event{
+		Source:       giteaEventSource,
+		Type:         eventType,
+		Headers:      r.Header,
+		Payload:      payload,
+		Key:          key,
+		SupersedeKey: supersedeKey,
+	}, r.Header.Get("X-Gitea-Delivery"))
+}
+
+func validateGiteaSignature(signature string, payload []byte, secret []byte) error {
+	if len(secret) == 0 {
+		return errors.New("Gitea webhook signature validation failed, is GITEA_WEBHOOK_SECRET set?")
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	expectedSignature := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(signature), []byte(expectedSignature)) {
+		return errors.New("Gitea webhook signature validation failed, payload signature doesn't match")
+	}
+	return nil
+}
+
+func parseGiteaPullRequestEvent(payload []byte) (giteaPullRequestEvent, error) {
+	var event giteaPullRequestEvent
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		return event, err
+	}
+	if event.PullRequest.Number == 0 {
+		return event, fmt.Errorf("payload has no pull request")
+	}
+	return event, nil
+}
+
+func handleGiteaPullRequestEvent(ctx context.Context, event giteaPullRequestEvent) error {
+	log.Infof("is Gitea PullRequestEvent(%s)", event.Action)
+	prLogger := log.WithFields(log.Fields{
+		"repo":       event.Repository.FullName,
+		"prNumber":   event.PullRequest.Number,
+		"event_type": "pr",
+	})
+
+	baseURL := event.giteaBaseURL()
+	owner := event.Repository.Owner.Login
+	repo := event.Repository.Name
+	provider := newGiteaProvider(baseURL, getCrucialEnv("GITEA_TOKEN"), owner, repo)
+
+	if event.Action == "label_updated" || event.Action == "label_cleared" {
+		label, added, found, err := provider.lastLabelChange(ctx, event.PullRequest.Number, event.PullRequest.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("find changed label: %w", err)
+		}
+		if found {
+			event.changedLabel = &giteaLabelChange{name: label, added: added}
+		} else {
+			prLogger.Infof("No label change found in the PR timeline, ignoring %s event", event.Action)
+		}
+	}
+	eventPayload := event.toPullRequestEvent()
+	var approver RepoProvider = provider
+	if approverToken := getEnv("APPROVER_GITEA_TOKEN", ""); approverToken != "" {
+		approver = newGiteaProvider(baseURL, approverToken, owner, repo)
+	}
+
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      ctx,
+		Provider: provider,
+		Labels:   eventPayload.PullRequest.Labels,
+		Owner:    owner,
+		Repo:     repo,
+		RepoURL:  event.Repository.HTMLURL,
+		PrNumber: event.PullRequest.Number,
+		Ref:      event.PullRequest.Head.Ref,
+		PrAuthor: event.PullRequest.User.Login,
+		PrLogger: prLogger,
+		PrSHA:    event.PullRequest.Head.SHA,
+	}
+
+	return HandlePREvent(eventPayload, ghPrClientDetails, GhClientPair{}, approver, ctx)
+}
@@ -0,0 +1,100 @@
+package githubapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGiteaPullRequestEventToPullRequestEvent(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		payload          string
+		changedLabel     *giteaLabelChange
+		expectedAction   string
+		expectedToHandle string
+	}{
+		"New PR": {
+			payload:          `{"action": "opened", "pull_request": {"number": 3}}`,
+			expectedAction:   "opened",
+			expectedToHandle: "changed",
+		},
+		"New commits pushed": {
+			payload:          `{"action": "synchronized", "pull_request": {"number": 3}}`,
+			expectedAction:   "synchronize",
+			expectedToHandle: "changed",
+		},
+		"show-plan label added": {
+			payload:          `{"action": "label_updated", "pull_request": {"number": 3, "labels": [{"name": "show-plan"}]}}`,
+			changedLabel:     &giteaLabelChange{name: "show-plan", added: true},
+			expectedAction:   "labeled",
+			expectedToHandle: "show-plan",
+		},
+		"Other label added to a PR with show-plan": {
+			payload:          `{"action": "label_updated", "pull_request": {"number": 3, "labels": [{"name": "show-plan"}, {"name": "approved-crd-change"}]}}`,
+			changedLabel:     &giteaLabelChange{name: "approved-crd-change", added: true},
+			expectedAction:   "labeled",
+			expectedToHandle: "diff-policy-label",
+		},
+		"Label removed": {
+			payload:          `{"action": "label_updated", "pull_request": {"number": 3, "labels": [{"name": "show-plan"}]}}`,
+			changedLabel:     &giteaLabelChange{name: "approved-crd-change", added: false},
+			expectedAction:   "unlabeled",
+			expectedToHandle: "diff-policy-label",
+		},
+		"Label change not found": {
+			payload:        `{"action": "label_updated", "pull_request": {"number": 3, "labels": [{"name": "show-plan"}]}}`,
+			expectedAction: "labeled",
+		},
+		"PR merged": {
+			payload:          `{"action": "closed", "pull_request": {"number": 3, "merged": true}}`,
+			expectedAction:   "closed",
+			expectedToHandle: "merged",
+		},
+		"PR closed without merging": {
+			payload:        `{"action": "closed", "pull_request": {"number": 3, "merged": false}}`,
+			expectedAction: "closed",
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			event, err := parseGiteaPullRequestEvent([]byte(tc.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			event.changedLabel = tc.changedLabel
+			eventPayload := event.toPullRequestEvent()
+			assert.Equal(t, tc.expectedAction, eventPayload.GetAction())
+			toHandle, _ := eventToHandle(eventPayload)
+			assert.Equal(t, tc.expectedToHandle, toHandle)
+		})
+	}
+}
+
+func TestGiteaPullRequestEventBaseURL(t *testing.T) {
+	t.Parallel()
+	event, err := parseGiteaPullRequestEvent([]byte(`{
+  "action": "opened",
+  "pull_request": {"number": 3},
+  "repository": {"name": "k8s-apps", "full_name": "infra/k8s-apps", "html_url": "http://gitea.local:3000/git/infra/k8s-apps", "owner": {"login": "infra"}}
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "http://gitea.local:3000/git", event.giteaBaseURL())
+}
+
+func TestValidateGiteaSignature(t *testing.T) {
+	t.Parallel()
+	payload := []byte(`{"action": "opened"}`)
+	secret := []byte("a-secret")
+	// echo -n '{"action": "opened"}' | openssl dgst -sha256 -hmac a-secret
+	validSignature := "975cfb422cc39c1dd8062b07be2674c5829c2d7ee0e5e831f40776b0c6e5e479"
+
+	assert.NoError(t, validateGiteaSignature(validSignature, payload, secret))
+	assert.Error(t, validateGiteaSignature(validSignature, payload, nil), "Missing secret should fail validation")
+	assert.Error(t, validateGiteaSignature("bad", payload, secret))
+}
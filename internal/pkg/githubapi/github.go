@@ -8,8 +8,8 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"path"
@@ -27,6 +27,7 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
 	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
 	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
 	"golang.org/x/exp/maps"
 )
@@ -34,6 +35,8 @@ import (
 const (
 	githubCommentMaxSize = 65536
 	githubPublicBaseURL  = "https://github.com"
+
+	diffCommentTruncatedNote = "\n\n⚠️ Truncated to fit the comment size limit, some changed objects are missing.\n"
 )
 
 type DiffCommentData struct {
@@ -41,6 +44,19 @@ type DiffCommentData struct {
 	DisplaySyncBranchCheckBox bool
 	BranchName                string
 	Header                    string
+	PolicyViolations          []argocd.DiffPolicyViolation
+	// FullDiffCheckRunName is set when the concise comment stands in for a full diff posted in that check run
+	FullDiffCheckRunName string
+}
+
+// ComponentDiffs groups the diff results by component, a component can feed several ArgoCD apps(like one per cluster)
+func (d DiffCommentData) ComponentDiffs() []argocd.ComponentDiffResults {
+	return argocd.GroupDiffResultsByComponent(d.DiffOfChangedComponents)
+}
+
+// InstanceDiffs groups the component diffs by ArgoCD instance, when components are mapped to several instances
+func (d DiffCommentData) InstanceDiffs() []argocd.InstanceDiffResults {
+	return argocd.GroupDiffResultsByInstance(d.DiffOfChangedComponents)
 }
 
 type promotionInstanceMetaData struct {
@@ -50,6 +66,8 @@ type promotionInstanceMetaData struct {
 
 type GhPrClientDetails struct {
 	GhClientPair *GhClientPair
+	// Provider is used for all repo level API calls, when nil a GitHub provider is built from GhClientPair
+	Provider RepoProvider
 	// This whole struct describe the metadata of the PR, so it makes sense to share the context with everything to generate HTTP calls related to that PR, right?
 	Ctx           context.Context //nolint:containedctx
 	DefaultBranch string
@@ -66,10 +84,17 @@ type GhPrClientDetails struct {
 }
 
 type prMetadata struct {
-	OriginalPrAuthor          string                            `json:"originalPrAuthor"`
-	OriginalPrNumber          int                               `json:"originalPrNumber"`
-	PromotedPaths             []string                          `json:"promotedPaths"`
+	OriginalPrAuthor string   `json:"originalPrAuthor"`
+	OriginalPrNumber int      `json:"originalPrNumber"`
+	PromotedPaths    []string `json:"promotedPaths"`
+	// PromotedSources maps each of PromotedPaths to the source path it was synced from
+	PromotedSources           map[string]string                 `json:"promotedSources,omitempty"`
 	PreviousPromotionMetadata map[int]promotionInstanceMetaData `json:"previousPromotionPaths"`
+	// AdditionalPrAuthors are the original authors of promotion PRs that were superseded by this one
+	AdditionalPrAuthors []string `json:"additionalPrAuthors,omitempty"`
+	// PromotionKey identifies the promotion source and targets combination, used to find the PR to update when a PromotionPath has updateExistingPromotionPrs set
+	PromotionKey   string   `json:"promotionKey,omitempty"`
+	ComponentNames []string `json:"componentNames,omitempty"`
 }
 
 func (pm prMetadata) serialize() (string, error) {
@@ -81,20 +106,29 @@ func (pm prMetadata) serialize() (string, error) {
 }
 
 func (ghPrClientDetails *GhPrClientDetails) getPrMetadata(prBody string) {
+	found, err := ghPrClientDetails.PrMetadata.fromPrBody(prBody)
+	if found {
+		ghPrClientDetails.PrLogger.Info("Found PR metadata")
+	}
+	if err != nil {
+		ghPrClientDetails.PrLogger.Errorf("Fail to parser PR metadata %v", err)
+	}
+}
+
+// fromPrBody deserializes the metadata Telefonistka embeds in promotion PR bodies, found is false for PRs without metadata
+func (pm *prMetadata) fromPrBody(prBody string) (found bool, err error) {
 	prMetadataRegex := regexp.MustCompile(`<!--\|.*\|(.*)\|-->`)
 	serializedPrMetadata := prMetadataRegex.FindStringSubmatch(prBody)
-	if len(serializedPrMetadata) == 2 {
-		if serializedPrMetadata[1] != "" {
-			ghPrClientDetails.PrLogger.Info("Found PR metadata")
-			err := ghPrClientDetails.PrMetadata.DeSerialize(serializedPrMetadata[1])
-			if err != nil {
-				ghPrClientDetails.PrLogger.Errorf("Fail to parser PR metadata %v", err)
-			}
-		}
+	if len(serializedPrMetadata) != 2 || serializedPrMetadata[1] == "" {
+		return false, nil
 	}
+	return true, pm.DeSerialize(serializedPrMetadata[1])
 }
 
 func (ghPrClientDetails *GhPrClientDetails) getBlameURLPrefix() string {
+	if p, ok := ghPrClientDetails.Provider.(interface{ BlameURLPrefix() string }); ok {
+		return p.BlameURLPrefix()
+	}
 	githubHost := getEnv("GITHUB_HOST", "")
 	if githubHost == "" {
 		githubHost = githubPublicBaseURL
@@ -124,45 +158,78 @@ func shouldSyncBranchCheckBoxBeDisplayed(componentPathList []string, allowSyncfr
 	return false
 }
 
-func HandlePREvent(eventPayload *github.PullRequestEvent, ghPrClientDetails GhPrClientDetails, mainGithubClientPair GhClientPair, approverGithubClientPair GhClientPair, ctx context.Context) {
+// HandlePREvent returns the handling error so the event queue can retry it
+func HandlePREvent(eventPayload *github.PullRequestEvent, ghPrClientDetails GhPrClientDetails, mainGithubClientPair GhClientPair, approver RepoProvider, ctx context.Context) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			ghPrClientDetails.PrLogger.Errorf("Recovered: %v", r)
+			err = fmt.Errorf("recovered: %v", r)
 		}
 	}()
 
+	if number, ok := ctx.Value(windowedMergeKey{}).(int); ok {
+		// A held merge, the event only carries the repo details
+		return runWindowedMerge(ghPrClientDetails, number)
+	}
+
 	ghPrClientDetails.getPrMetadata(eventPayload.PullRequest.GetBody())
 
 	stat, ok := eventToHandle(eventPayload)
 	if !ok {
 		// nothing to do
-		return
+		return nil
 	}
 
-	SetCommitStatus(ghPrClientDetails, "pending")
+	if stat == "diff-policy-label" {
+		// Adding or removing a label required by a diff policy changes the policy violations, other labels are ignored.
+		// The opened event of a promotion PR can be handled before its pending-policy-check label is added, adding it checks the policies again.
+		isPolicyLabel := eventPayload.GetAction() == "labeled" && eventPayload.GetLabel().GetName() == pendingPolicyCheckLabel
+		if !isPolicyLabel {
+			isPolicyLabel, err = isDiffPolicyLabel(ghPrClientDetails, eventPayload.GetLabel().GetName())
+		}
+		if err != nil || !isPolicyLabel {
+			return err
+		}
+		stat = "changed"
+	}
 
-	var err error
+	// A missing or broken configuration is reported by the event handlers, the commit status just falls back to the defaults
+	var statusConfig cfg.CommitStatusConfig
+	defaultBranch, _ := ghPrClientDetails.GetDefaultBranch()
+	if config, err := GetInRepoConfig(ghPrClientDetails, defaultBranch); err == nil {
+		statusConfig = config.CommitStatus
+	}
+	SetCommitStatus(ghPrClientDetails, statusConfig, "pending", statusConfig.DescriptionText())
 
+	var statusFailures []string
 	defer func() {
-		if err != nil {
-			SetCommitStatus(ghPrClientDetails, "error")
-			return
+		switch {
+		case err != nil:
+			SetCommitStatus(ghPrClientDetails, statusConfig, "error", statusConfig.DescriptionText())
+		case len(statusFailures) > 0:
+			SetCommitStatus(ghPrClientDetails, statusConfig, "failure", commitStatusFailureDescription(statusConfig, statusFailures))
+		default:
+			SetCommitStatus(ghPrClientDetails, statusConfig, "success", statusConfig.DescriptionText())
 		}
-		SetCommitStatus(ghPrClientDetails, "success")
 	}()
 
 	switch stat {
 	case "merged":
-		err = handleMergedPrEvent(ghPrClientDetails, approverGithubClientPair.v3Client)
+		err = handleMergedPrEvent(ghPrClientDetails, approver)
 	case "changed":
-		err = handleChangedPREvent(ctx, mainGithubClientPair, ghPrClientDetails, eventPayload)
+		statusFailures, err = handleChangedPREvent(ctx, mainGithubClientPair, ghPrClientDetails, eventPayload)
 	case "show-plan":
 		err = handleShowPlanPREvent(ctx, ghPrClientDetails, eventPayload)
 	}
 
 	if err != nil {
 		ghPrClientDetails.PrLogger.Errorf("Handling of PR event failed: err=%s\n", err)
+		if errors.Is(err, ErrNotFound) {
+			// Retrying won't make a missing file or PR appear
+			err = eventqueue.Permanent(err)
+		}
 	}
+	return err
 }
 
 // eventToHandle returns the event to be handled, translated from a Github
@@ -174,8 +241,11 @@ func eventToHandle(eventPayload *github.PullRequestEvent) (event string, ok bool
 		return "merged", true
 	case *eventPayload.Action == "opened" || *eventPayload.Action == "reopened" || *eventPayload.Action == "synchronize":
 		return "changed", true
-	case *eventPayload.Action == "labeled" && DoesPrHasLabel(eventPayload.PullRequest.Labels, "show-plan"):
+	case *eventPayload.Action == "labeled" && eventPayload.GetLabel().GetName() == "show-plan":
 		return "show-plan", true
+	case (*eventPayload.Action == "labeled" || *eventPayload.Action == "unlabeled") && eventPayload.GetLabel().GetName() != "":
+		// Only labels required by diff policies are handled, see HandlePREvent
+		return "diff-policy-label", true
 	default:
 		return "", false
 	}
@@ -193,30 +263,53 @@ func handleShowPlanPREvent(ctx context.Context, ghPrClientDetails GhPrClientDeta
 	return nil
 }
 
-func handleChangedPREvent(ctx context.Context, mainGithubClientPair GhClientPair, ghPrClientDetails GhPrClientDetails, eventPayload *github.PullRequestEvent) error {
-	botIdentity, _ := GetBotGhIdentity(mainGithubClientPair.v4Client, ctx)
-	err := MimizeStalePrComments(ghPrClientDetails, mainGithubClientPair.v4Client, botIdentity)
-	if err != nil {
-		return fmt.Errorf("minimizing stale PR comments: %w", err)
+func handleChangedPREvent(ctx context.Context, mainGithubClientPair GhClientPair, ghPrClientDetails GhPrClientDetails, eventPayload *github.PullRequestEvent) (statusFailures []string, err error) {
+	// Comment minimization is a GitHub(GraphQL) only feature, other providers just keep the old comments
+	if mainGithubClientPair.v4Client != nil {
+		botIdentity, _ := GetBotGhIdentity(mainGithubClientPair.v4Client, ctx)
+		err := MimizeStalePrComments(ghPrClientDetails, mainGithubClientPair.v4Client, botIdentity)
+		if err != nil {
+			return nil, fmt.Errorf("minimizing stale PR comments: %w", err)
+		}
 	}
 	defaultBranch, _ := ghPrClientDetails.GetDefaultBranch()
-	config, err := GetInRepoConfig(ghPrClientDetails, defaultBranch)
+	config, configErr := GetInRepoConfig(ghPrClientDetails, defaultBranch)
+	// The changed files are validated even when the default branch configuration is broken, the PR might be the fix
+	err = validateChangedConfigFiles(ghPrClientDetails, config)
 	if err != nil {
-		return fmt.Errorf("get in-repo configuration: %w", err)
+		ghPrClientDetails.PrLogger.Errorf("Failed to validate changed configuration files: err=%s\n", err)
+	}
+	if configErr != nil {
+		return nil, fmt.Errorf("get in-repo configuration: %w", configErr)
+	}
+	if checkRunsEnabled(config) {
+		publishPromotionPlanCheckRun(ghPrClientDetails, config)
 	}
 	if config.Argocd.CommentDiffonPR {
 		componentPathList, err := generateListOfChangedComponentPaths(ghPrClientDetails, config)
 		if err != nil {
-			return fmt.Errorf("generate list of changed components: %w", err)
+			return nil, fmt.Errorf("generate list of changed components: %w", err)
 		}
 
 		// Building a map component's path and a boolean value that indicates if we should diff it not.
 		// I'm avoiding doing this in the ArgoCD package to avoid circular dependencies and keep package scope clean
 		componentsToDiff := map[string]bool{}
+		// Diff policies are read from the default branch, a PR can't relax the policies its own diff is checked against
+		policyConfigs := map[string]*cfg.ComponentConfig{}
+		diffSettings := map[string]argocd.DiffSettings{}
 		for _, componentPath := range componentPathList {
 			c, err := getComponentConfig(ghPrClientDetails, componentPath, ghPrClientDetails.Ref)
 			if err != nil {
-				return fmt.Errorf("get component (%s) config:  %w", componentPath, err)
+				return nil, fmt.Errorf("get component (%s) config:  %w", componentPath, err)
+			}
+			policyConfigs[componentPath], err = getComponentConfig(ghPrClientDetails, componentPath, defaultBranch)
+			if err != nil {
+				return nil, fmt.Errorf("get component (%s) config:  %w", componentPath, err)
+			}
+			diffSettings[componentPath] = argocd.DiffSettings{
+				IgnoreDifferences: c.IgnoreDifferences,
+				RedactionRules:    config.Argocd.RedactionRules,
+				DiffFormat:        c.DiffFormat,
 			}
 			componentsToDiff[componentPath] = true
 			if c.DisableArgoCDDiff {
@@ -224,64 +317,141 @@ func handleChangedPREvent(ctx context.Context, mainGithubClientPair GhClientPair
 				ghPrClientDetails.PrLogger.Debugf("ArgoCD diff disabled for %s\n", componentPath)
 			}
 		}
-		argoClients, err := argocd.CreateArgoCdClients()
-		if err != nil {
-			return fmt.Errorf("error creating ArgoCD clients: %w", err)
-		}
-
-		hasComponentDiff, hasComponentDiffErrors, diffOfChangedComponents, err := argocd.GenerateDiffOfChangedComponents(ctx, componentsToDiff, ghPrClientDetails.Ref, ghPrClientDetails.RepoURL, config.Argocd.UseSHALabelForAppDiscovery, config.Argocd.CreateTempAppObjectFroNewApps, argoClients)
+		hasComponentDiff, hasComponentDiffErrors, diffOfChangedComponents, err := generateArgoCdDiffs(ctx, ghPrClientDetails, config, componentsToDiff, diffSettings)
 		if err != nil {
-			return fmt.Errorf("getting diff information: %w", err)
+			publishPhaseCheckRun(ghPrClientDetails, config, failedPhaseCheckRun(argocdDiffCheckRunName, "Failed to get the ArgoCD diff", err))
+			return nil, fmt.Errorf("getting diff information: %w", err)
 		}
 		ghPrClientDetails.PrLogger.Debugf("Successfully got ArgoCD diff(comparing live objects against objects rendered form git ref %s)", ghPrClientDetails.Ref)
+		prom.PublishDiffMetrics(diffCounters(diffOfChangedComponents), ghPrClientDetails.Owner+"/"+ghPrClientDetails.Repo, ghPrClientDetails.PrSHA)
+		if err := publishDiffReport(ctx, ghPrClientDetails, config, diffOfChangedComponents); err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Failed to publish ArgoCD diff report: err=%s\n", err)
+		}
+		statusFailures = append(statusFailures, diffStatusFailures(config.CommitStatus.FailOn, hasComponentDiffErrors, diffOfChangedComponents)...)
+		policyViolations := diffPolicyViolations(policyConfigs, diffOfChangedComponents, eventPayload.PullRequest.Labels)
+		if len(policyViolations) > 0 {
+			ghPrClientDetails.PrLogger.Infof("Found %d diff policy violations", len(policyViolations))
+			statusFailures = append(statusFailures, "diff policy violations")
+		}
+		if err := setBlockedByPolicyLabel(ghPrClientDetails, eventPayload.PullRequest.Labels, len(policyViolations) > 0); err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Could not update the %s label: err=%s\n", blockedByPolicyLabel, err)
+		}
 		if !hasComponentDiffErrors && !hasComponentDiff {
 			ghPrClientDetails.PrLogger.Debugf("ArgoCD diff is empty, this PR will not change cluster state\n")
-			prLables, resp, err := ghPrClientDetails.GhClientPair.v3Client.Issues.AddLabelsToIssue(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *eventPayload.PullRequest.Number, []string{"noop"})
-			prom.InstrumentGhCall(resp)
+			err := ghPrClientDetails.repoProvider().AddLabels(ghPrClientDetails.Ctx, *eventPayload.PullRequest.Number, []string{"noop"})
 			if err != nil {
-				ghPrClientDetails.PrLogger.Errorf("Could not label GitHub PR: err=%s\n%v\n", err, resp)
+				ghPrClientDetails.PrLogger.Errorf("Could not label GitHub PR: err=%s\n", err)
 			} else {
-				ghPrClientDetails.PrLogger.Debugf("PR %v labeled\n%+v", *eventPayload.PullRequest.Number, prLables)
+				ghPrClientDetails.PrLogger.Debugf("PR %v labeled", *eventPayload.PullRequest.Number)
 			}
 			// If the PR is a promotion PR and the diff is empty, we can auto-merge it
 			// "len(componentPathList) > 0"  validates we are not auto-merging a PR that we failed to understand which apps it affects
 			if DoesPrHasLabel(eventPayload.PullRequest.Labels, "promotion") && config.Argocd.AutoMergeNoDiffPRs && len(componentPathList) > 0 {
-				ghPrClientDetails.PrLogger.Infof("Auto-merging (no diff) PR %d", *eventPayload.PullRequest.Number)
-				err := MergePr(ghPrClientDetails, eventPayload.PullRequest.Number)
+				err := mergeNoDiffPromotionPr(ghPrClientDetails, config, time.Now())
 				if err != nil {
-					return fmt.Errorf("PR auto merge: %w", err)
+					return nil, fmt.Errorf("PR auto merge: %w", err)
 				}
 			}
 		}
 
-		if len(diffOfChangedComponents) > 0 {
-			diffCommentData := DiffCommentData{
-				DiffOfChangedComponents: diffOfChangedComponents,
-				BranchName:              ghPrClientDetails.Ref,
-			}
+		diffCommentData := DiffCommentData{
+			DiffOfChangedComponents: diffOfChangedComponents,
+			BranchName:              ghPrClientDetails.Ref,
+			PolicyViolations:        policyViolations,
+		}
+		var diffInCheckRun bool
+		if checkRunsEnabled(config) {
+			diffInCheckRun = publishArgoCdDiffCheckRun(ghPrClientDetails, diffCommentData)
+		}
 
+		if len(diffOfChangedComponents) > 0 {
 			diffCommentData.DisplaySyncBranchCheckBox = shouldSyncBranchCheckBoxBeDisplayed(componentPathList, config.Argocd.AllowSyncfromBranchPathRegex, diffOfChangedComponents)
 			componentsToDiffJSON, _ := json.Marshal(componentsToDiff)
 			log.Infof("Generating ArgoCD Diff Comment for components: %+v, length of diff elements: %d", string(componentsToDiffJSON), len(diffCommentData.DiffOfChangedComponents))
-			comments, err := generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+			maxCommentSize := githubCommentMaxSize
+			if config.Comments.Sticky {
+				maxCommentSize -= stickyCommentMaxOverhead
+			}
+			comments, err := generateArgoCdDiffComments(diffCommentData, maxCommentSize)
 			if err != nil {
-				return fmt.Errorf("generate diff comment: %w", err)
+				return nil, fmt.Errorf("generate diff comment: %w", err)
 			}
-			for _, comment := range comments {
-				err = commentPR(ghPrClientDetails, comment)
+			if len(comments) > 1 && diffInCheckRun && config.CheckRuns.LargeArgocdDiffInCheckRun {
+				comments, err = checkRunArgoCdDiffComments(diffCommentData, comments)
 				if err != nil {
-					return fmt.Errorf("commenting on PR: %w", err)
+					return nil, fmt.Errorf("generate diff comment: %w", err)
 				}
 			}
+			err = postComments(ghPrClientDetails, config, stickyCommentKindArgoCdDiff, comments)
+			if err != nil {
+				return nil, fmt.Errorf("commenting on PR: %w", err)
+			}
 		} else {
 			ghPrClientDetails.PrLogger.Debugf("Diff not find affected ArogCD apps")
+			// A sticky diff comment of a previous commit would be stale otherwise
+			err = postComments(ghPrClientDetails, config, stickyCommentKindArgoCdDiff, nil)
+			if err != nil {
+				return nil, fmt.Errorf("commenting on PR: %w", err)
+			}
+		}
+		// Auto merge promotion PRs wait for their diff to pass the diff policies, a PR with diff errors waits for the next event
+		if len(policyViolations) == 0 && !hasComponentDiffErrors {
+			err = mergePolicyCheckedPr(ghPrClientDetails, config, time.Now())
+			if err != nil {
+				return nil, fmt.Errorf("PR auto merge: %w", err)
+			}
 		}
 	}
-	err = DetectDrift(ghPrClientDetails)
+	hasDrift, err := DetectDrift(ghPrClientDetails)
 	if err != nil {
-		return fmt.Errorf("detecting drift: %w", err)
+		return nil, fmt.Errorf("detecting drift: %w", err)
 	}
-	return nil
+	if hasDrift && config.CommitStatus.FailOn.Drift {
+		statusFailures = append(statusFailures, "drift between environments")
+	}
+	return statusFailures, nil
+}
+
+// generateArgoCdDiffs diffs every component against the ArgoCD instance it's mapped to, results are ordered by instance, default instance first
+func generateArgoCdDiffs(ctx context.Context, ghPrClientDetails GhPrClientDetails, config *cfg.Config, componentsToDiff map[string]bool, diffSettings map[string]argocd.DiffSettings) (hasComponentDiff bool, hasComponentDiffErrors bool, diffResults []argocd.DiffResult, err error) {
+	componentsByInstance := map[cfg.ArgocdInstance]map[string]bool{}
+	for componentPath, shouldDiff := range componentsToDiff {
+		instance, err := config.Argocd.InstanceForComponent(componentPath)
+		if err != nil {
+			return false, true, nil, err
+		}
+		if componentsByInstance[instance] == nil {
+			componentsByInstance[instance] = map[string]bool{}
+		}
+		componentsByInstance[instance][componentPath] = shouldDiff
+	}
+	instances := maps.Keys(componentsByInstance)
+	sort.Slice(instances, func(i, j int) bool { return instances[i].Name < instances[j].Name })
+
+	var errs []error
+	for _, instance := range instances {
+		argoClients, err := argocd.GetInstanceClients(instance)
+		if err != nil {
+			return false, true, nil, fmt.Errorf("error creating ArgoCD clients: %w", err)
+		}
+		instanceHasDiff, instanceHasDiffErrors, instanceDiffResults, err := argocd.GenerateDiffOfChangedComponents(ctx, componentsByInstance[instance], diffSettings, ghPrClientDetails.Ref, ghPrClientDetails.RepoURL, config.Argocd.UseSHALabelForAppDiscovery, config.Argocd.CreateTempAppObjectFroNewApps, argoClients)
+		hasComponentDiff = hasComponentDiff || instanceHasDiff
+		hasComponentDiffErrors = hasComponentDiffErrors || instanceHasDiffErrors
+		diffResults = append(diffResults, instanceDiffResults...)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return hasComponentDiff, hasComponentDiffErrors, diffResults, errors.Join(errs...)
+}
+
+// setArgoCDAppRevision sets the target revision of the ArgoCD apps of componentPath in the ArgoCD instance the component is mapped to
+func setArgoCDAppRevision(ghPrClientDetails GhPrClientDetails, config *cfg.Config, componentPath string, revision string) error {
+	instance, err := config.Argocd.InstanceForComponent(componentPath)
+	if err != nil {
+		return err
+	}
+	return argocd.SetArgoCDAppRevision(ghPrClientDetails.Ctx, instance, componentPath, revision, ghPrClientDetails.RepoURL, config.Argocd.UseSHALabelForAppDiscovery)
 }
 
 func generateArgoCdDiffComments(diffCommentData DiffCommentData, githubCommentMaxSize int) (comments []string, err error) {
@@ -296,12 +466,22 @@ func generateArgoCdDiffComments(diffCommentData DiffCommentData, githubCommentMa
 		return comments, nil
 	}
 
-	// If the diff comment is too large, we'll split it into multiple comments, one per component
-	totalComponents := len(diffCommentData.DiffOfChangedComponents)
-	for i, singleComponentDiff := range diffCommentData.DiffOfChangedComponents {
+	// If the diff comment is too large, we'll split it into multiple comments, one per component(with all of its apps)
+	componentDiffs := diffCommentData.ComponentDiffs()
+	totalComponents := len(componentDiffs)
+	for i, singleComponentDiff := range componentDiffs {
 		componentTemplateData := diffCommentData
-		componentTemplateData.DiffOfChangedComponents = []argocd.DiffResult{singleComponentDiff}
+		componentTemplateData.DiffOfChangedComponents = singleComponentDiff.AppDiffResults
+		componentTemplateData.PolicyViolations = nil
+		for _, violation := range diffCommentData.PolicyViolations {
+			if violation.ComponentPath == singleComponentDiff.ComponentPath && violation.ArgoCdInstance == singleComponentDiff.ArgoCdInstance {
+				componentTemplateData.PolicyViolations = append(componentTemplateData.PolicyViolations, violation)
+			}
+		}
 		componentTemplateData.Header = fmt.Sprintf("Component %d/%d: %s (Split for comment size)", i+1, totalComponents, singleComponentDiff.ComponentPath)
+		if singleComponentDiff.ArgoCdInstance != "" {
+			componentTemplateData.Header = fmt.Sprintf("Component %d/%d: %s on ArgoCD instance %s (Split for comment size)", i+1, totalComponents, singleComponentDiff.ComponentPath, singleComponentDiff.ArgoCdInstance)
+		}
 		templateOutput, err := executeTemplate("argoCdDiff", defaultTemplatesFullPath("argoCD-diff-pr-comment.gotmpl"), componentTemplateData)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate ArgoCD diff comment template: %w", err)
@@ -319,14 +499,28 @@ func generateArgoCdDiffComments(diffCommentData DiffCommentData, githubCommentMa
 		if err != nil {
 			return comments, fmt.Errorf("failed to generate ArgoCD diff comment template: %w", err)
 		}
+		// Components with a huge number of changed objects or fields can still be too large, a truncated comment beats a rejected one
+		if len(templateOutput) >= githubCommentMaxSize {
+			templateOutput = truncateDiffComment(templateOutput, githubCommentMaxSize)
+		}
 		comments = append(comments, templateOutput)
 	}
 
 	return comments, nil
 }
 
+// truncateDiffComment cuts comment at a line end so it's shorter than maxSize, with a note
+func truncateDiffComment(comment string, maxSize int) string {
+	cut := comment[:maxSize-len(diffCommentTruncatedNote)-1]
+	if i := strings.LastIndex(cut, "\n"); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + diffCommentTruncatedNote
+}
+
 // ReciveEventFile this one is similar to ReciveWebhook but it's used for CLI triggering, i  simulates a webhook event to use the same code path as the webhook handler.
-func ReciveEventFile(eventType string, eventFilePath string, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair]) {
+// The event is handled synchronously, without the event queue.
+func ReciveEventFile(eventType string, eventFilePath string, diffReportFile string, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair]) {
 	log.Infof("Event type: %s", eventType)
 	log.Infof("Proccesing file: %s", eventFilePath)
 
@@ -334,22 +528,45 @@ func ReciveEventFile(eventType string, eventFilePath string, mainGhClientCache *
 	if err != nil {
 		panic(err)
 	}
-	eventPayloadInterface, err := github.ParseWebHook(eventType, payload)
-	if err != nil {
-		log.Errorf("could not parse webhook: err=%s\n", err)
-		prom.InstrumentWebhookHit("parsing_failed")
-		return
+	source := githubEventSource
+	if eventType == gitlabMergeRequestEventType {
+		source = gitlabEventSource
 	}
-	r, _ := http.NewRequest("POST", "", nil) //nolint:noctx
-	r.Body = io.NopCloser(bytes.NewReader(payload))
-	r.Header.Set("Content-Type", "application/json")
-	r.Header.Set("X-GitHub-Event", eventType)
+	// Gitea Actions is GitHub Actions compatible, so the event type is "pull_request" but the payload is a Gitea one
+	if eventType == giteaPullRequestEventType || (eventType == "pull_request" && getEnv("GITEA_ACTIONS", "") == "true") {
+		source = giteaEventSource
+		eventType = "pull_request"
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json")
+	headers.Set("X-GitHub-Event", eventType)
 
-	handleEvent(eventPayloadInterface, mainGhClientCache, prApproverGhClientCache, r, payload)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if diffReportFile != "" {
+		ctx = WithDiffReportFile(ctx, diffReportFile)
+	}
+	err = NewEventHandler(mainGhClientCache, prApproverGhClientCache, nil)(ctx, eventqueue.Event{
+		Source:  source,
+		Type:    eventType,
+		Headers: headers,
+		Payload: payload,
+	})
+	if err != nil {
+		log.Errorf("Handling event file failed: err=%s\n", err)
+	}
 }
 
-// ReciveWebhook is the main entry point for the webhook handling it starts parases the webhook payload and start a thread to handle the event success/failure are dependant on the payload parsing only
-func ReciveWebhook(r *http.Request, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair], githubWebhookSecret []byte) error {
+// ReciveWebhook is the main entry point for the webhook handling, it validates and parses the webhook payload and persists it in the event queue.
+// success/failure are dependant on the payload parsing and persistence only, the event is handled by the queue workers.
+func ReciveWebhook(r *http.Request, eventQueue EventEnqueuer, githubWebhookSecret []byte) error {
+	if isGitlabEvent(r) {
+		return reciveGitlabWebhook(r, eventQueue)
+	}
+	// Gitea also sends the X-GitHub-Event header, so it has to be checked before the GitHub handling
+	if isGiteaEvent(r) {
+		return reciveGiteaWebhook(r, eventQueue)
+	}
 	payload, err := github.ValidatePayload(r, githubWebhookSecret)
 	if err != nil {
 		log.Errorf("error reading request body: err=%s\n", err)
@@ -366,15 +583,18 @@ func ReciveWebhook(r *http.Request, mainGhClientCache *lru.Cache[string, GhClien
 	}
 	prom.InstrumentWebhookHit("successful")
 
-	go handleEvent(eventPayloadInterface, mainGhClientCache, prApproverGhClientCache, r, payload)
-	return nil
+	key, supersedeKey := githubEventKeys(eventPayloadInterface)
+	return enqueueEvent(eventQueue, eventqueue.Event{
+		Source:       githubEventSource,
+		Type:         eventType,
+		Headers:      r.Header,
+		Payload:      payload,
+		Key:          key,
+		SupersedeKey: supersedeKey,
+	}, github.DeliveryID(r))
 }
 
-func handleEvent(eventPayloadInterface interface{}, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair], r *http.Request, payload []byte) {
-	// We don't use the request context as it might have a short deadline and we don't want to stop event handling based on that
-	// But we do want to stop the event handling after a certain point, so:
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-	defer cancel()
+func handleEvent(ctx context.Context, eventPayloadInterface interface{}, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair], r *http.Request, payload []byte) error {
 	var mainGithubClientPair GhClientPair
 	var approverGithubClientPair GhClientPair
 
@@ -399,7 +619,9 @@ func handleEvent(eventPayloadInterface interface{}, mainGhClientCache *lru.Cache
 			PrLogger:     prLogger,
 		}
 
+		// Webhook proxying is best effort, failures aren't retried
 		handlePushEvent(ctx, eventPayload, r, payload, ghPrClientDetails)
+		return nil
 	case *github.PullRequestEvent:
 		log.Infof("is PullRequestEvent(%s)", *eventPayload.Action)
 
@@ -428,7 +650,7 @@ func handleEvent(eventPayloadInterface interface{}, mainGhClientCache *lru.Cache
 			PrSHA:        *eventPayload.PullRequest.Head.SHA,
 		}
 
-		HandlePREvent(eventPayload, ghPrClientDetails, mainGithubClientPair, approverGithubClientPair, ctx)
+		return HandlePREvent(eventPayload, ghPrClientDetails, mainGithubClientPair, newGithubProvider(&approverGithubClientPair, repoOwner, *eventPayload.Repo.Name), ctx)
 
 	case *github.IssueCommentEvent:
 		repoOwner := *eventPayload.Repo.Owner.Login
@@ -452,13 +674,13 @@ func handleEvent(eventPayloadInterface interface{}, mainGhClientCache *lru.Cache
 				PrAuthor:     *eventPayload.Issue.User.Login,
 				PrLogger:     prLogger,
 			}
-			_ = handleCommentPrEvent(ghPrClientDetails, eventPayload, botIdentity)
-		} else {
-			log.Debug("Ignoring self comment")
+			return handleCommentPrEvent(ghPrClientDetails, eventPayload, botIdentity)
 		}
+		log.Debug("Ignoring self comment")
+		return nil
 
 	default:
-		return
+		return nil
 	}
 }
 
@@ -518,7 +740,7 @@ func handleCommentPrEvent(ghPrClientDetails GhPrClientDetails, ce *github.IssueC
 
 				for _, componentPath := range componentPathList {
 					if isSyncFromBranchAllowedForThisPath(config.Argocd.AllowSyncfromBranchPathRegex, componentPath) {
-						err := argocd.SetArgoCDAppRevision(ghPrClientDetails.Ctx, componentPath, ghPrClientDetails.Ref, ghPrClientDetails.RepoURL, config.Argocd.UseSHALabelForAppDiscovery)
+						err := setArgoCDAppRevision(ghPrClientDetails, config, componentPath, ghPrClientDetails.Ref)
 						if err != nil {
 							ghPrClientDetails.PrLogger.Errorf("Failed to sync ArgoCD app from branch: err=%s\n", err)
 						}
@@ -544,8 +766,13 @@ func handleCommentPrEvent(ghPrClientDetails GhPrClientDetails, ce *github.IssueC
 	return err
 }
 
+// RenderPromotionPlan renders a promotion plan with the same template used for dry-run PR comments.
+func RenderPromotionPlan(promotions map[string]PromotionInstance) (string, error) {
+	return executeTemplate("dryRunMsg", defaultTemplatesFullPath("dry-run-pr-comment.gotmpl"), promotions)
+}
+
 func commentPlanInPR(ghPrClientDetails GhPrClientDetails, promotions map[string]PromotionInstance) {
-	templateOutput, err := executeTemplate("dryRunMsg", defaultTemplatesFullPath("dry-run-pr-comment.gotmpl"), promotions)
+	templateOutput, err := RenderPromotionPlan(promotions)
 	if err != nil {
 		ghPrClientDetails.PrLogger.Errorf("Failed to generate dry-run comment template: err=%s\n", err)
 		return
@@ -580,7 +807,7 @@ func commentPR(ghPrClientDetails GhPrClientDetails, commentBody string) error {
 }
 
 func BumpVersion(ghPrClientDetails GhPrClientDetails, defaultBranch string, filePath string, newFileContent string, triggeringRepo string, triggeringRepoSHA string, triggeringActor string, autoMerge bool) error {
-	var treeEntries []*github.TreeEntry
+	var treeEntries []TreeEntry
 
 	generateBumpTreeEntiesForCommit(&treeEntries, ghPrClientDetails, defaultBranch, filePath, newFileContent)
 
@@ -597,17 +824,17 @@ func BumpVersion(ghPrClientDetails GhPrClientDetails, defaultBranch string, file
 
 	newPrTitle := triggeringRepo + "🚠 Bumping version @ " + filePath
 	newPrBody := fmt.Sprintf("Bumping version triggered by %s@%s", triggeringRepo, triggeringRepoSHA)
-	pr, err := createPrObject(ghPrClientDetails, newBranchRef, newPrTitle, newPrBody, defaultBranch, triggeringActor)
+	pr, err := createPrObject(ghPrClientDetails, newBranchRef, newPrTitle, newPrBody, defaultBranch, []string{triggeringActor})
 	if err != nil {
 		ghPrClientDetails.PrLogger.Errorf("PR opening failed: err=%v", err)
 		return err
 	}
 
-	ghPrClientDetails.PrLogger.Infof("New PR URL: %s", *pr.HTMLURL)
+	ghPrClientDetails.PrLogger.Infof("New PR URL: %s", pr.HTMLURL)
 
 	if autoMerge {
-		ghPrClientDetails.PrLogger.Infof("Auto-merging PR %d", *pr.Number)
-		err := MergePr(ghPrClientDetails, pr.Number)
+		ghPrClientDetails.PrLogger.Infof("Auto-merging PR %d", pr.Number)
+		err := MergePr(ghPrClientDetails, &pr.Number)
 		if err != nil {
 			ghPrClientDetails.PrLogger.Errorf("PR auto merge failed: err=%v", err)
 			return err
@@ -617,12 +844,13 @@ func BumpVersion(ghPrClientDetails GhPrClientDetails, defaultBranch string, file
 	return nil
 }
 
-func handleMergedPrEvent(ghPrClientDetails GhPrClientDetails, prApproverGithubClient *github.Client) error {
+func handleMergedPrEvent(ghPrClientDetails GhPrClientDetails, prApprover RepoProvider) error {
 	defaultBranch, _ := ghPrClientDetails.GetDefaultBranch()
 	config, err := GetInRepoConfig(ghPrClientDetails, defaultBranch)
 	if err != nil {
 		_ = ghPrClientDetails.CommentOnPr(fmt.Sprintf("Failed to get configuration\n```\n%s\n```\n", err))
-		return err
+		// Retrying would repeat the comment above, the PR author has to fix the configuration
+		return eventqueue.Permanent(err)
 	}
 
 	// configBranch = default branch as the PR is closed at this and its branch deleted.
@@ -634,10 +862,37 @@ func handleMergedPrEvent(ghPrClientDetails GhPrClientDetails, prApproverGithubCl
 
 			// because I use GitHub low level (tree) API the order of operation is somewhat different compared to regular git CLI flow:
 			// I create the sync commit against HEAD, create a new branch based on that commit and finally open a PR based on that branch
+			// When the promotion path is configured to update existing PRs, the sync commit is created on top of the existing PR branch instead
 
-			var treeEntries []*github.TreeEntry
+			var existingPr *supersededPromotionPr
+			var existingPrHeadRef string
+			if promotion.Metadata.UpdateExistingPr {
+				existingPr, existingPrHeadRef, err = findExistingPromotionPr(ghPrClientDetails, promotion, defaultBranch)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Failed to look for an existing promotion PR, opening a new one: err=%v", err)
+				}
+			}
+			commitBaseBranch := defaultBranch
+			newBranchName := generateSafePromotionBranchName(ghPrClientDetails.PrNumber, ghPrClientDetails.Ref, promotion.Metadata.TargetPaths)
+			// An event queue retry finds the branch and PR a previous attempt created, they are updated instead of created again
+			var retriedPr *PullRequest
+			var retriedBranchExists bool
+			if existingPr != nil {
+				commitBaseBranch = existingPrHeadRef
+			} else {
+				retriedPr, retriedBranchExists, err = findPromotionBranch(ghPrClientDetails, newBranchName, defaultBranch)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Failed to look for promotion branch %s: err=%v", newBranchName, err)
+					return err
+				}
+				if retriedBranchExists {
+					commitBaseBranch = newBranchName
+				}
+			}
+
+			var treeEntries []TreeEntry
 			for trgt, src := range promotion.ComputedSyncPaths {
-				err = GenerateSyncTreeEntriesForCommit(&treeEntries, ghPrClientDetails, src, trgt, defaultBranch)
+				err = generateSyncTreeEntries(&treeEntries, ghPrClientDetails, src, trgt, defaultBranch, commitBaseBranch)
 				if err != nil {
 					ghPrClientDetails.PrLogger.Errorf("Failed to generate treeEntries for %s > %s,  err=%v", src, trgt, err)
 				} else {
@@ -650,23 +905,36 @@ func handleMergedPrEvent(ghPrClientDetails GhPrClientDetails, prApproverGithubCl
 				continue
 			}
 
-			commit, err := createCommit(ghPrClientDetails, treeEntries, defaultBranch, "Syncing from "+promotion.Metadata.SourcePath)
+			commit, err := createCommit(ghPrClientDetails, treeEntries, commitBaseBranch, "Syncing from "+promotion.Metadata.SourcePath)
 			if err != nil {
 				ghPrClientDetails.PrLogger.Errorf("Commit creation failed: err=%v", err)
 				return err
 			}
 
-			newBranchName := generateSafePromotionBranchName(ghPrClientDetails.PrNumber, ghPrClientDetails.Ref, promotion.Metadata.TargetPaths)
-
-			newBranchRef, err := createBranch(ghPrClientDetails, commit, newBranchName)
-			if err != nil {
-				ghPrClientDetails.PrLogger.Errorf("Branch creation failed: err=%v", err)
-				return err
+			var newBranchRef string
+			if existingPr != nil {
+				err = ghPrClientDetails.repoProvider().UpdateBranch(ghPrClientDetails.Ctx, existingPrHeadRef, commit)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Updating branch %s of PR #%d failed: err=%v", existingPrHeadRef, existingPr.number, err)
+					return err
+				}
+				ghPrClientDetails.PrLogger.Infof("Pushed sync commit to existing promotion PR #%d", existingPr.number)
+			} else if retriedBranchExists {
+				err = ghPrClientDetails.repoProvider().UpdateBranch(ghPrClientDetails.Ctx, newBranchName, commit)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Updating branch %s failed: err=%v", newBranchName, err)
+					return err
+				}
+				ghPrClientDetails.PrLogger.Infof("Pushed sync commit to existing branch %s", newBranchName)
+				newBranchRef = "refs/heads/" + newBranchName
+			} else {
+				newBranchRef, err = createBranch(ghPrClientDetails, commit, newBranchName)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Branch creation failed: err=%v", err)
+					return err
+				}
 			}
 
-			components := strings.Join(promotion.Metadata.ComponentNames, ",")
-			newPrTitle := fmt.Sprintf("🚀 Promotion: %s ➡️  %s", components, promotion.Metadata.TargetDescription)
-
 			var originalPrAuthor string
 			// If the triggering PR was opened manually and it doesn't include in-body metadata, use the PR author
 			// If the triggering PR as opened by Telefonistka and it has in-body metadata, fetch the original author from there
@@ -676,41 +944,99 @@ func handleMergedPrEvent(ghPrClientDetails GhPrClientDetails, prApproverGithubCl
 				originalPrAuthor = ghPrClientDetails.PrAuthor
 			}
 
-			newPrBody := generatePromotionPrBody(ghPrClientDetails, components, promotion, originalPrAuthor)
-
-			pull, err := createPrObject(ghPrClientDetails, newBranchRef, newPrTitle, newPrBody, defaultBranch, originalPrAuthor)
+			supersededPrs, err := findSupersededPromotionPrs(ghPrClientDetails, promotion, defaultBranch)
 			if err != nil {
-				ghPrClientDetails.PrLogger.Errorf("PR opening failed: err=%v", err)
-				return err
+				// Not being able to clean up older promotion PRs shouldn't block the promotion itself
+				ghPrClientDetails.PrLogger.Errorf("Failed to look for superseded promotion PRs: err=%v", err)
+			}
+			if retriedPr != nil {
+				// The PR of a previous attempt promotes the same paths, it's reused rather than superseded
+				var otherPrs []supersededPromotionPr
+				for _, supersededPr := range supersededPrs {
+					if supersededPr.number != retriedPr.Number {
+						otherPrs = append(otherPrs, supersededPr)
+					}
+				}
+				supersededPrs = otherPrs
+			}
+			// The updated PR history and authors are carried over just like the ones of superseded PRs
+			inheritedPrs := supersededPrs
+			if existingPr != nil {
+				inheritedPrs = []supersededPromotionPr{*existingPr}
+				for _, supersededPr := range supersededPrs {
+					if supersededPr.number != existingPr.number {
+						inheritedPrs = append(inheritedPrs, supersededPr)
+					}
+				}
+				supersededPrs = inheritedPrs[1:]
+			}
+
+			components := strings.Join(promotionComponentNames(promotion, inheritedPrs), ",")
+			newPrTitle := fmt.Sprintf("🚀 Promotion: %s ➡️  %s", components, promotion.Metadata.TargetDescription)
+			newPrBody := generatePromotionPrBody(ghPrClientDetails, components, promotion, originalPrAuthor, inheritedPrs)
+			assignees := append([]string{originalPrAuthor}, supersededPrAuthors(originalPrAuthor, ghPrClientDetails.PrMetadata, inheritedPrs)...)
+
+			var pull *PullRequest
+			if existingPr != nil {
+				pull, err = updatePromotionPr(ghPrClientDetails, existingPr.number, newPrTitle, newPrBody, assignees)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Updating promotion PR #%d failed: err=%v", existingPr.number, err)
+					return err
+				}
+			} else if retriedPr != nil {
+				pull, err = updatePromotionPr(ghPrClientDetails, retriedPr.Number, newPrTitle, newPrBody, assignees)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Updating promotion PR #%d failed: err=%v", retriedPr.Number, err)
+					return err
+				}
+				// The previous attempt might have failed before labeling the PR
+				err = ghPrClientDetails.repoProvider().AddLabels(ghPrClientDetails.Ctx, pull.Number, []string{"promotion"})
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Could not label GitHub PR: err=%s\n", err)
+					return err
+				}
+			} else {
+				pull, err = createPrObject(ghPrClientDetails, newBranchRef, newPrTitle, newPrBody, defaultBranch, assignees)
+				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("PR opening failed: err=%v", err)
+					return err
+				}
 			}
+			closeSupersededPromotionPrs(ghPrClientDetails, supersededPrs, pull)
 			if config.AutoApprovePromotionPrs {
-				err := ApprovePr(prApproverGithubClient, ghPrClientDetails, pull.Number)
+				err := ApprovePr(prApprover, ghPrClientDetails, &pull.Number)
 				if err != nil {
 					ghPrClientDetails.PrLogger.Errorf("PR auto approval failed: err=%v", err)
 					return err
 				}
 			}
 			if promotion.Metadata.AutoMerge {
-				ghPrClientDetails.PrLogger.Infof("Auto-merging PR %d", *pull.Number)
-				templateData := map[string]interface{}{
-					"prNumber": *pull.Number,
-				}
-				templateOutput, err := executeTemplate("autoMerge", defaultTemplatesFullPath("auto-merge-comment.gotmpl"), templateData)
+				hasDiffPolicies, err := promotionHasDiffPolicies(ghPrClientDetails, config, promotion, defaultBranch)
 				if err != nil {
+					ghPrClientDetails.PrLogger.Errorf("Failed to get the diff policies of the promotion targets: err=%v", err)
 					return err
 				}
-				err = commentPR(ghPrClientDetails, templateOutput)
-				if err != nil {
-					return err
+				if hasDiffPolicies {
+					// The diff of the PR isn't known yet, its "changed" event merges it once the diff passes the policies
+					err = holdAutoMergeForPolicyCheck(ghPrClientDetails, pull)
+					if err != nil {
+						ghPrClientDetails.PrLogger.Errorf("Holding PR auto merge failed: err=%v", err)
+						return err
+					}
+					continue
 				}
-
-				err = MergePr(ghPrClientDetails, pull.Number)
+				err = autoMergePromotionPr(ghPrClientDetails, pull, promotion.Metadata.DeploymentSchedule, time.Now())
 				if err != nil {
-					ghPrClientDetails.PrLogger.Errorf("PR auto merge failed: err=%v", err)
 					return err
 				}
 			}
 		}
+		if configHasDeploymentSchedules(config) {
+			err = mergeOpenWindowBlockedPrs(ghPrClientDetails, config, defaultBranch, time.Now())
+			if err != nil {
+				ghPrClientDetails.PrLogger.Errorf("Failed to merge promotion PRs blocked by deployment windows: err=%v", err)
+			}
+		}
 	} else {
 		commentPlanInPR(ghPrClientDetails, promotions)
 	}
@@ -723,7 +1049,7 @@ func handleMergedPrEvent(ghPrClientDetails GhPrClientDetails, prApproverGithubCl
 		for _, componentPath := range componentPathList {
 			if isSyncFromBranchAllowedForThisPath(config.Argocd.AllowSyncfromBranchPathRegex, componentPath) {
 				ghPrClientDetails.PrLogger.Infof("Ensuring ArgoCD app %s is set to HEAD\n", componentPath)
-				err := argocd.SetArgoCDAppRevision(ghPrClientDetails.Ctx, componentPath, "HEAD", ghPrClientDetails.RepoURL, config.Argocd.UseSHALabelForAppDiscovery)
+				err := setArgoCDAppRevision(ghPrClientDetails, config, componentPath, "HEAD")
 				if err != nil {
 					ghPrClientDetails.PrLogger.Errorf("Failed to set ArgoCD app @  %s, to HEAD: err=%s\n", componentPath, err)
 				}
@@ -779,9 +1105,7 @@ func MergePr(details GhPrClientDetails, number *int) error {
 }
 
 func tryMergePR(details GhPrClientDetails, number *int) error {
-	_, resp, err := details.GhClientPair.v3Client.PullRequests.Merge(details.Ctx, details.Owner, details.Repo, *number, "Auto-merge", nil)
-	prom.InstrumentGhCall(resp)
-	return err
+	return details.repoProvider().MergePullRequest(details.Ctx, *number, "Auto-merge")
 }
 
 func isMergeErrorRetryable(errMessage string) bool {
@@ -798,13 +1122,11 @@ func (pm *prMetadata) DeSerialize(s string) error {
 }
 
 func (p GhPrClientDetails) CommentOnPr(commentBody string) error {
-	commentBody = "<!-- telefonistka_tag -->\n" + commentBody
+	commentBody = commentTag + "\n" + commentBody
 
-	comment := &github.IssueComment{Body: &commentBody}
-	_, resp, err := p.GhClientPair.v3Client.Issues.CreateComment(p.Ctx, p.Owner, p.Repo, p.PrNumber, comment)
-	prom.InstrumentGhCall(resp)
+	err := p.repoProvider().CreateComment(p.Ctx, p.PrNumber, commentBody)
 	if err != nil {
-		p.PrLogger.Errorf("Could not comment in PR: err=%s\n%v\n", err, resp)
+		p.PrLogger.Errorf("Could not comment in PR: err=%s\n", err)
 	}
 	return err
 }
@@ -820,31 +1142,27 @@ func DoesPrHasLabel(labels []*github.Label, name string) bool {
 
 func (p *GhPrClientDetails) ToggleCommitStatus(context string, user string) error {
 	var r error
-	listOpts := &github.ListOptions{}
 
-	initialStatuses, resp, err := p.GhClientPair.v3Client.Repositories.ListStatuses(p.Ctx, p.Owner, p.Repo, p.Ref, listOpts)
-	prom.InstrumentGhCall(resp)
+	initialStatuses, err := p.repoProvider().ListCommitStatuses(p.Ctx, p.Ref)
 	if err != nil {
 		p.PrLogger.Errorf("Failed to fetch  existing statuses for commit  %s, err=%s", p.Ref, err)
 		r = err
 	}
 
 	for _, commitStatus := range initialStatuses {
-		if *commitStatus.Context == context {
-			if *commitStatus.State != "success" {
-				p.PrLogger.Infof("%s Toggled  %s(%s) to success", user, context, *commitStatus.State)
-				*commitStatus.State = "success"
-				_, resp, err := p.GhClientPair.v3Client.Repositories.CreateStatus(p.Ctx, p.Owner, p.Repo, p.PrSHA, commitStatus)
-				prom.InstrumentGhCall(resp)
+		if commitStatus.Context == context {
+			if commitStatus.State != "success" {
+				p.PrLogger.Infof("%s Toggled  %s(%s) to success", user, context, commitStatus.State)
+				commitStatus.State = "success"
+				err := p.repoProvider().CreateCommitStatus(p.Ctx, p.PrSHA, commitStatus)
 				if err != nil {
 					p.PrLogger.Errorf("Failed to create context %s, err=%s", context, err)
 					r = err
 				}
 			} else {
-				p.PrLogger.Infof("%s Toggled %s(%s) to failure", user, context, *commitStatus.State)
-				*commitStatus.State = "failure"
-				_, resp, err := p.GhClientPair.v3Client.Repositories.CreateStatus(p.Ctx, p.Owner, p.Repo, p.PrSHA, commitStatus)
-				prom.InstrumentGhCall(resp)
+				p.PrLogger.Infof("%s Toggled %s(%s) to failure", user, context, commitStatus.State)
+				commitStatus.State = "failure"
+				err := p.repoProvider().CreateCommitStatus(p.Ctx, p.PrSHA, commitStatus)
 				if err != nil {
 					p.PrLogger.Errorf("Failed to create context %s, err=%s", context, err)
 					r = err
@@ -857,21 +1175,20 @@ func (p *GhPrClientDetails) ToggleCommitStatus(context string, user string) erro
 	return r
 }
 
-func SetCommitStatus(ghPrClientDetails GhPrClientDetails, state string) {
-	// TODO change all these values
-	tcontext := "telefonistka"
+// SetCommitStatus sets the commit status of the PR head commit, its context is commitStatus.context from the repo configuration.
+func SetCommitStatus(ghPrClientDetails GhPrClientDetails, statusConfig cfg.CommitStatusConfig, state string, description string) {
+	tcontext := statusConfig.ContextName()
 	avatarURL := "https://avatars.githubusercontent.com/u/1616153?s=64"
-	description := "Telefonistka GitOps Bot"
 	tmplFile := os.Getenv("CUSTOM_COMMIT_STATUS_URL_TEMPLATE_PATH")
 
 	targetURL := commitStatusTargetURL(time.Now(), tmplFile)
 
-	commitStatus := &github.RepoStatus{
-		TargetURL:   &targetURL,
-		Description: &description,
-		State:       &state,
-		Context:     &tcontext,
-		AvatarURL:   &avatarURL,
+	commitStatus := CommitStatus{
+		TargetURL:   targetURL,
+		Description: description,
+		State:       state,
+		Context:     tcontext,
+		AvatarURL:   avatarURL,
 	}
 	ghPrClientDetails.PrLogger.Debugf("Setting commit %s status to %s", ghPrClientDetails.PrSHA, state)
 
@@ -880,24 +1197,22 @@ func SetCommitStatus(ghPrClientDetails GhPrClientDetails, state string) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
 	defer cancel()
 
-	_, resp, err := ghPrClientDetails.GhClientPair.v3Client.Repositories.CreateStatus(ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, ghPrClientDetails.PrSHA, commitStatus)
-	prom.InstrumentGhCall(resp)
+	err := ghPrClientDetails.repoProvider().CreateCommitStatus(ctx, ghPrClientDetails.PrSHA, commitStatus)
 	repoSlug := ghPrClientDetails.Owner + "/" + ghPrClientDetails.Repo
 	prom.IncCommitStatusUpdateCounter(repoSlug, state)
 	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Failed to set commit status: err=%s\n%v", err, resp)
+		ghPrClientDetails.PrLogger.Errorf("Failed to set commit status: err=%s\n", err)
 	}
 }
 
 func (p *GhPrClientDetails) GetSHA() (string, error) {
 	if p.PrSHA == "" {
-		prObject, resp, err := p.GhClientPair.v3Client.PullRequests.Get(p.Ctx, p.Owner, p.Repo, p.PrNumber)
-		prom.InstrumentGhCall(resp)
+		prObject, err := p.repoProvider().GetPullRequest(p.Ctx, p.PrNumber)
 		if err != nil {
-			p.PrLogger.Errorf("Could not get pr data: err=%s\n%v\n", err, resp)
+			p.PrLogger.Errorf("Could not get pr data: err=%s\n", err)
 			return "", err
 		}
-		p.PrSHA = *prObject.Head.SHA
+		p.PrSHA = prObject.HeadSHA
 		return p.PrSHA, err
 	} else {
 		return p.PrSHA, nil
@@ -906,13 +1221,12 @@ func (p *GhPrClientDetails) GetSHA() (string, error) {
 
 func (p *GhPrClientDetails) GetRef() (string, error) {
 	if p.Ref == "" {
-		prObject, resp, err := p.GhClientPair.v3Client.PullRequests.Get(p.Ctx, p.Owner, p.Repo, p.PrNumber)
-		prom.InstrumentGhCall(resp)
+		prObject, err := p.repoProvider().GetPullRequest(p.Ctx, p.PrNumber)
 		if err != nil {
-			p.PrLogger.Errorf("Could not get pr data: err=%s\n%v\n", err, resp)
+			p.PrLogger.Errorf("Could not get pr data: err=%s\n", err)
 			return "", err
 		}
-		p.Ref = *prObject.Head.Ref
+		p.Ref = prObject.HeadRef
 		return p.Ref, err
 	} else {
 		return p.Ref, nil
@@ -921,128 +1235,124 @@ func (p *GhPrClientDetails) GetRef() (string, error) {
 
 func (p *GhPrClientDetails) GetDefaultBranch() (string, error) {
 	if p.DefaultBranch == "" {
-		repo, resp, err := p.GhClientPair.v3Client.Repositories.Get(p.Ctx, p.Owner, p.Repo)
+		defaultBranch, err := p.repoProvider().GetDefaultBranch(p.Ctx)
 		if err != nil {
-			p.PrLogger.Errorf("Could not get repo default branch: err=%s\n%v\n", err, resp)
+			p.PrLogger.Errorf("Could not get repo default branch: err=%s\n", err)
 			return "", err
 		}
-		prom.InstrumentGhCall(resp)
-		p.DefaultBranch = *repo.DefaultBranch
-		return *repo.DefaultBranch, err
+		p.DefaultBranch = defaultBranch
+		return defaultBranch, err
 	} else {
 		return p.DefaultBranch, nil
 	}
 }
 
-func generateDeletionTreeEntries(ghPrClientDetails *GhPrClientDetails, path *string, branch *string, treeEntries *[]*github.TreeEntry) error {
+func generateDeletionTreeEntries(ghPrClientDetails *GhPrClientDetails, path *string, branch *string, treeEntries *[]TreeEntry) error {
 	// GH tree API doesn't allow deletion a whole dir, so this recursive function traverse the whole tree
 	// and create a tree entry array that would delete all the files in that path
-	getContentOpts := &github.RepositoryContentGetOptions{
-		Ref: *branch,
-	}
-	_, directoryContent, resp, err := ghPrClientDetails.GhClientPair.v3Client.Repositories.GetContents(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *path, getContentOpts)
-	prom.InstrumentGhCall(resp)
-	if resp.StatusCode == 404 {
+	directoryContent, err := ghPrClientDetails.repoProvider().ListDirectory(ghPrClientDetails.Ctx, *branch, *path)
+	if errors.Is(err, ErrNotFound) {
 		ghPrClientDetails.PrLogger.Infof("Skipping deletion of non-existing  %s", *path)
 		return nil
 	} else if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Could not fetch %s content  err=%s\n%v\n", *path, err, resp)
+		ghPrClientDetails.PrLogger.Errorf("Could not fetch %s content  err=%s\n", *path, err)
 		return err
 	}
 	for _, elementInDir := range directoryContent {
-		if *elementInDir.Type == "file" {
-			treeEntry := github.TreeEntry{ // https://docs.github.com/en/rest/git/trees?apiVersion=2022-11-28#create-a-tree
-				Path:    github.String(*elementInDir.Path),
-				Mode:    github.String("100644"),
-				Type:    github.String("blob"),
+		if elementInDir.Type == "file" {
+			treeEntry := TreeEntry{ // https://docs.github.com/en/rest/git/trees?apiVersion=2022-11-28#create-a-tree
+				Path:    elementInDir.Path,
+				Mode:    "100644",
+				Type:    "blob",
 				SHA:     nil,
 				Content: nil,
 			}
-			*treeEntries = append(*treeEntries, &treeEntry)
-		} else if *elementInDir.Type == "dir" {
-			err := generateDeletionTreeEntries(ghPrClientDetails, elementInDir.Path, branch, treeEntries)
+			*treeEntries = append(*treeEntries, treeEntry)
+		} else if elementInDir.Type == "dir" {
+			err := generateDeletionTreeEntries(ghPrClientDetails, &elementInDir.Path, branch, treeEntries)
 			if err != nil {
 				return err
 			}
 		} else {
-			ghPrClientDetails.PrLogger.Infof("Ignoring type %s for path %s", *elementInDir.Type, *elementInDir.Path)
+			ghPrClientDetails.PrLogger.Infof("Ignoring type %s for path %s", elementInDir.Type, elementInDir.Path)
 		}
 	}
 	return nil
 }
 
-func generateBumpTreeEntiesForCommit(treeEntries *[]*github.TreeEntry, ghPrClientDetails GhPrClientDetails, defaultBranch string, filePath string, fileContent string) {
-	treeEntry := github.TreeEntry{
-		Path:    github.String(filePath),
-		Mode:    github.String("100644"),
-		Type:    github.String("blob"),
-		Content: github.String(fileContent),
+func generateBumpTreeEntiesForCommit(treeEntries *[]TreeEntry, ghPrClientDetails GhPrClientDetails, defaultBranch string, filePath string, fileContent string) {
+	treeEntry := TreeEntry{
+		Path:    filePath,
+		Mode:    "100644",
+		Type:    "blob",
+		Content: &fileContent,
 	}
-	*treeEntries = append(*treeEntries, &treeEntry)
+	*treeEntries = append(*treeEntries, treeEntry)
 }
 
 func getDirecotyGitObjectSha(ghPrClientDetails GhPrClientDetails, dirPath string, branch string) (string, error) {
-	repoContentGetOptions := github.RepositoryContentGetOptions{
-		Ref: branch,
-	}
-
 	direcotyGitObjectSha := ""
 	// in GH API/go-github, to get directory SHA you need to scan the whole parent Dir 🤷
-	_, directoryContent, resp, err := ghPrClientDetails.GhClientPair.v3Client.Repositories.GetContents(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, path.Dir(dirPath), &repoContentGetOptions)
-	prom.InstrumentGhCall(resp)
-	if err != nil && resp.StatusCode != 404 {
-		ghPrClientDetails.PrLogger.Errorf("Could not fetch source directory SHA err=%s\n%v\n", err, resp)
+	directoryContent, err := ghPrClientDetails.repoProvider().ListDirectory(ghPrClientDetails.Ctx, branch, path.Dir(dirPath))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		ghPrClientDetails.PrLogger.Errorf("Could not fetch source directory SHA err=%s\n", err)
 		return "", err
 	} else if err == nil { // scaning the parent dir
 		for _, dirElement := range directoryContent {
-			if *dirElement.Path == dirPath {
-				direcotyGitObjectSha = *dirElement.SHA
+			if dirElement.Path == dirPath {
+				direcotyGitObjectSha = dirElement.SHA
 				break
 			}
 		}
-	} // leaving out statusCode 404, this means the whole parent dir is missing, but the behavior is similar to the case we didn't find the dir
+	} // leaving out ErrNotFound, this means the whole parent dir is missing, but the behavior is similar to the case we didn't find the dir
 
 	return direcotyGitObjectSha, nil
 }
 
-func GenerateSyncTreeEntriesForCommit(treeEntries *[]*github.TreeEntry, ghPrClientDetails GhPrClientDetails, sourcePath string, targetPath string, defaultBranch string) error {
-	sourcePathSHA, err := getDirecotyGitObjectSha(ghPrClientDetails, sourcePath, defaultBranch)
+func GenerateSyncTreeEntriesForCommit(treeEntries *[]TreeEntry, ghPrClientDetails GhPrClientDetails, sourcePath string, targetPath string, defaultBranch string) error {
+	return generateSyncTreeEntries(treeEntries, ghPrClientDetails, sourcePath, targetPath, defaultBranch, defaultBranch)
+}
+
+// generateSyncTreeEntries reads the source directory from sourceBranch and compares it with the target directory on targetBranch,
+// targetBranch is the branch the sync commit will be created on top of.
+func generateSyncTreeEntries(treeEntries *[]TreeEntry, ghPrClientDetails GhPrClientDetails, sourcePath string, targetPath string, sourceBranch string, targetBranch string) error {
+	sourcePathSHA, err := getDirecotyGitObjectSha(ghPrClientDetails, sourcePath, sourceBranch)
 
 	if sourcePathSHA == "" {
 		ghPrClientDetails.PrLogger.Infoln("Source directory wasn't found, assuming a deletion PR")
-		err := generateDeletionTreeEntries(&ghPrClientDetails, &targetPath, &defaultBranch, treeEntries)
+		err := generateDeletionTreeEntries(&ghPrClientDetails, &targetPath, &targetBranch, treeEntries)
 		if err != nil {
 			ghPrClientDetails.PrLogger.Errorf("Failed to build deletion tree: err=%s\n", err)
 			return err
 		}
 	} else {
-		syncTreeEntry := github.TreeEntry{
-			Path: github.String(targetPath),
-			Mode: github.String("040000"),
-			Type: github.String("tree"),
-			SHA:  github.String(sourcePathSHA),
+		syncTreeEntry := TreeEntry{
+			Path: targetPath,
+			Mode: "040000",
+			Type: "tree",
+			SHA:  &sourcePathSHA,
 		}
-		*treeEntries = append(*treeEntries, &syncTreeEntry)
+		*treeEntries = append(*treeEntries, syncTreeEntry)
 
 		// Aperntly... the way we sync directories(set the target dir git tree object SHA) doesn't delete files!!!! GH just "merges" the old and new tree objects.
 		// So for now, I'll just go over all the files and add explicitly add  delete tree  entries  :(
 		// TODO compare sourcePath targetPath Git object SHA to avoid costly tree compare where possible?
 		sourceFilesSHAs := make(map[string]string)
 		targetFilesSHAs := make(map[string]string)
-		generateFlatMapfromFileTree(&ghPrClientDetails, &sourcePath, &sourcePath, &defaultBranch, sourceFilesSHAs)
-		generateFlatMapfromFileTree(&ghPrClientDetails, &targetPath, &targetPath, &defaultBranch, targetFilesSHAs)
+		generateFlatMapfromFileTree(&ghPrClientDetails, &sourcePath, &sourcePath, &sourceBranch, sourceFilesSHAs)
+		generateFlatMapfromFileTree(&ghPrClientDetails, &targetPath, &targetPath, &targetBranch, targetFilesSHAs)
 
 		for filename := range targetFilesSHAs {
 			if _, found := sourceFilesSHAs[filename]; !found {
 				ghPrClientDetails.PrLogger.Debugf("%s -- was NOT found on %s, marking as a deletion!", filename, sourcePath)
-				fileDeleteTreeEntry := github.TreeEntry{
-					Path:    github.String(targetPath + "/" + filename),
-					Mode:    github.String("100644"),
-					Type:    github.String("blob"),
+				fileDeleteTreeEntry := TreeEntry{
+					Path:    targetPath + "/" + filename,
+					Mode:    "100644",
+					Type:    "blob",
 					SHA:     nil, // this is how you delete a file https://docs.github.com/en/rest/git/trees?apiVersion=2022-11-28#create-a-tree
 					Content: nil,
 				}
-				*treeEntries = append(*treeEntries, &fileDeleteTreeEntry)
+				*treeEntries = append(*treeEntries, fileDeleteTreeEntry)
 			}
 		}
 	}
@@ -1050,81 +1360,60 @@ func GenerateSyncTreeEntriesForCommit(treeEntries *[]*github.TreeEntry, ghPrClie
 	return err
 }
 
-func createCommit(ghPrClientDetails GhPrClientDetails, treeEntries []*github.TreeEntry, defaultBranch string, commitMsg string) (*github.Commit, error) {
+func createCommit(ghPrClientDetails GhPrClientDetails, treeEntries []TreeEntry, defaultBranch string, commitMsg string) (string, error) {
 	// To avoid cloning the repo locally, I'm using GitHub low level GIT Tree API to sync the source folder "over" the target folders
 	// This works by getting the source dir git object SHA, and overwriting(Git.CreateTree) the target directory git object SHA with the source's SHA.
-
-	ref, resp, err := ghPrClientDetails.GhClientPair.v3Client.Git.GetRef(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, "heads/"+defaultBranch)
-	prom.InstrumentGhCall(resp)
-	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Failed to get main branch ref: err=%s\n", err)
-		return nil, err
-	}
-	baseTreeSHA := ref.Object.SHA
-	tree, resp, err := ghPrClientDetails.GhClientPair.v3Client.Git.CreateTree(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *baseTreeSHA, treeEntries)
-	prom.InstrumentGhCall(resp)
-	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Failed to create Git Tree object: err=%s\n%+v", err, resp)
-		ghPrClientDetails.PrLogger.Errorf("These are the treeEntries: %+v", treeEntries)
-		return nil, err
-	}
-	parentCommit, resp, err := ghPrClientDetails.GhClientPair.v3Client.Git.GetCommit(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *baseTreeSHA)
-	prom.InstrumentGhCall(resp)
-	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Failed to get parent commit: err=%s\n", err)
-		return nil, err
-	}
-
-	newCommitConfig := &github.Commit{
-		Message: github.String(commitMsg),
-		Parents: []*github.Commit{parentCommit},
-		Tree:    tree,
-	}
-
-	commit, resp, err := ghPrClientDetails.GhClientPair.v3Client.Git.CreateCommit(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, newCommitConfig, nil)
-	prom.InstrumentGhCall(resp)
+	commitSHA, err := ghPrClientDetails.repoProvider().CreateCommit(ghPrClientDetails.Ctx, defaultBranch, treeEntries, commitMsg)
 	if err != nil {
 		ghPrClientDetails.PrLogger.Errorf("Failed to create Git commit: err=%s\n", err) // TODO comment this error to PR
-		return nil, err
+		ghPrClientDetails.PrLogger.Errorf("These are the treeEntries: %+v", treeEntries)
+		return "", err
 	}
 
-	return commit, err
+	return commitSHA, err
 }
 
-func createBranch(ghPrClientDetails GhPrClientDetails, commit *github.Commit, newBranchName string) (string, error) {
+func createBranch(ghPrClientDetails GhPrClientDetails, commitSHA string, newBranchName string) (string, error) {
 	newBranchRef := "refs/heads/" + newBranchName
 	ghPrClientDetails.PrLogger.Infof("New branch name will be: %s", newBranchName)
 
-	newRefGitObjct := &github.GitObject{
-		SHA: commit.SHA,
-	}
-
-	newRefConfig := &github.Reference{
-		Ref:    github.String(newBranchRef),
-		Object: newRefGitObjct,
-	}
-
-	_, resp, err := ghPrClientDetails.GhClientPair.v3Client.Git.CreateRef(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, newRefConfig)
-	prom.InstrumentGhCall(resp)
+	err := ghPrClientDetails.repoProvider().CreateBranch(ghPrClientDetails.Ctx, newBranchName, commitSHA)
 	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Could not create Git Ref: err=%s\n%v\n", err, resp)
+		ghPrClientDetails.PrLogger.Errorf("Could not create Git Ref: err=%s\n", err)
 		return "", err
 	}
 	ghPrClientDetails.PrLogger.Infof("New branch ref: %s", newBranchRef)
 	return newBranchRef, err
 }
 
-func generatePromotionPrBody(ghPrClientDetails GhPrClientDetails, components string, promotion PromotionInstance, originalPrAuthor string) string {
+func generatePromotionPrBody(ghPrClientDetails GhPrClientDetails, components string, promotion PromotionInstance, originalPrAuthor string, supersededPrs []supersededPromotionPr) string {
 	// newPrMetadata will be serialized and persisted in the PR body for use when the PR is merged
 	var newPrMetadata prMetadata
 	var newPrBody string
 
 	newPrMetadata.OriginalPrAuthor = originalPrAuthor
-
-	if ghPrClientDetails.PrMetadata.PreviousPromotionMetadata != nil {
-		newPrMetadata.PreviousPromotionMetadata = ghPrClientDetails.PrMetadata.PreviousPromotionMetadata
-	} else {
-		newPrMetadata.PreviousPromotionMetadata = make(map[int]promotionInstanceMetaData)
+	newPrMetadata.AdditionalPrAuthors = supersededPrAuthors(originalPrAuthor, ghPrClientDetails.PrMetadata, supersededPrs)
+
+	newPrMetadata.PromotionKey = promotion.Metadata.Key
+	newPrMetadata.ComponentNames = promotionComponentNames(promotion, supersededPrs)
+
+	newPrMetadata.PreviousPromotionMetadata = make(map[int]promotionInstanceMetaData)
+	// The superseded PRs promotion history is carried over, so the chain of PRs that led to this promotion stays complete
+	promotedPaths := map[string]bool{}
+	newPrMetadata.PromotedSources = map[string]string{}
+	for _, supersededPr := range supersededPrs {
+		for k, v := range supersededPr.metadata.PreviousPromotionMetadata {
+			newPrMetadata.PreviousPromotionMetadata[k] = v
+		}
+		for _, p := range supersededPr.metadata.PromotedPaths {
+			promotedPaths[p] = true
+		}
+		for trgt, src := range supersededPr.metadata.PromotedSources {
+			newPrMetadata.PromotedSources[trgt] = src
+		}
+	}
+	for k, v := range ghPrClientDetails.PrMetadata.PreviousPromotionMetadata {
+		newPrMetadata.PreviousPromotionMetadata[k] = v
 	}
 
 	newPrMetadata.PreviousPromotionMetadata[ghPrClientDetails.PrNumber] = promotionInstanceMetaData{
@@ -1134,7 +1423,12 @@ func generatePromotionPrBody(ghPrClientDetails GhPrClientDetails, components str
 	// newPrMetadata.PreviousPromotionMetadata[ghPrClientDetails.PrNumber].TargetPaths = targetPaths
 	// newPrMetadata.PreviousPromotionMetadata[ghPrClientDetails.PrNumber].SourcePath = sourcePath
 
-	newPrMetadata.PromotedPaths = maps.Keys(promotion.ComputedSyncPaths)
+	for trgt, src := range promotion.ComputedSyncPaths {
+		promotedPaths[trgt] = true
+		newPrMetadata.PromotedSources[trgt] = src
+	}
+	newPrMetadata.PromotedPaths = maps.Keys(promotedPaths)
+	sort.Strings(newPrMetadata.PromotedPaths)
 
 	promotionSkipPaths := getPromotionSkipPaths(promotion)
 
@@ -1148,6 +1442,16 @@ func generatePromotionPrBody(ghPrClientDetails GhPrClientDetails, components str
 
 	newPrBody = prBody(keys, newPrMetadata, newPrBody, promotionSkipPaths)
 
+	supersededPrRefs := []string{}
+	for _, supersededPr := range supersededPrs {
+		if !supersededPr.updatedInPlace {
+			supersededPrRefs = append(supersededPrRefs, fmt.Sprintf("#%d", supersededPr.number))
+		}
+	}
+	if len(supersededPrRefs) > 0 {
+		newPrBody = newPrBody + fmt.Sprintf("\nSupersedes %s\n", strings.Join(supersededPrRefs, ", "))
+	}
+
 	prMetadataString, _ := newPrMetadata.serialize()
 
 	newPrBody = newPrBody + "\n<!--|Telefonistka data, do not delete|" + prMetadataString + "|-->"
@@ -1237,53 +1541,46 @@ func filterSkipPaths(targetPaths []string, promotionSkipPaths map[string]bool) [
 	return paths
 }
 
-func createPrObject(ghPrClientDetails GhPrClientDetails, newBranchRef string, newPrTitle string, newPrBody string, defaultBranch string, assignee string) (*github.PullRequest, error) {
-	newPrConfig := &github.NewPullRequest{
-		Body:  github.String(newPrBody),
-		Title: github.String(newPrTitle),
-		Base:  github.String(defaultBranch),
-		Head:  github.String(newBranchRef),
+func createPrObject(ghPrClientDetails GhPrClientDetails, newBranchRef string, newPrTitle string, newPrBody string, defaultBranch string, assignees []string) (*PullRequest, error) {
+	newPrConfig := NewPullRequest{
+		Body:  newPrBody,
+		Title: newPrTitle,
+		Base:  defaultBranch,
+		Head:  newBranchRef,
 	}
 
-	pull, resp, err := ghPrClientDetails.GhClientPair.v3Client.PullRequests.Create(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, newPrConfig)
-	prom.InstrumentGhCall(resp)
+	provider := ghPrClientDetails.repoProvider()
+	pull, err := provider.CreatePullRequest(ghPrClientDetails.Ctx, newPrConfig)
 	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Could not create GitHub PR: err=%s\n%v\n", err, resp)
+		ghPrClientDetails.PrLogger.Errorf("Could not create GitHub PR: err=%s\n", err)
 		return nil, err
 	} else {
-		ghPrClientDetails.PrLogger.Infof("PR %d opened", *pull.Number)
+		ghPrClientDetails.PrLogger.Infof("PR %d opened", pull.Number)
 	}
 
-	prLables, resp, err := ghPrClientDetails.GhClientPair.v3Client.Issues.AddLabelsToIssue(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *pull.Number, []string{"promotion"})
-	prom.InstrumentGhCall(resp)
+	err = provider.AddLabels(ghPrClientDetails.Ctx, pull.Number, []string{"promotion"})
 	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Could not label GitHub PR: err=%s\n%v\n", err, resp)
+		ghPrClientDetails.PrLogger.Errorf("Could not label GitHub PR: err=%s\n", err)
 		return pull, err
 	} else {
-		ghPrClientDetails.PrLogger.Debugf("PR %v labeled\n%+v", pull.Number, prLables)
+		ghPrClientDetails.PrLogger.Debugf("PR %v labeled", pull.Number)
 	}
 
-	_, resp, err = ghPrClientDetails.GhClientPair.v3Client.Issues.AddAssignees(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *pull.Number, []string{assignee})
-	prom.InstrumentGhCall(resp)
+	err = provider.AddAssignees(ghPrClientDetails.Ctx, pull.Number, assignees)
 	if err != nil {
-		ghPrClientDetails.PrLogger.Warnf("Could not set %s as assignee on PR,  err=%s", assignee, err)
+		ghPrClientDetails.PrLogger.Warnf("Could not set %v as assignees on PR,  err=%s", assignees, err)
 		// return pull, err
 	} else {
-		ghPrClientDetails.PrLogger.Debugf(" %s was set as assignee on PR", assignee)
+		ghPrClientDetails.PrLogger.Debugf(" %v were set as assignees on PR", assignees)
 	}
 
 	return pull, nil // TODO
 }
 
-func ApprovePr(approverClient *github.Client, ghPrClientDetails GhPrClientDetails, prNumber *int) error {
-	reviewRequest := &github.PullRequestReviewRequest{
-		Event: github.String("APPROVE"),
-	}
-
-	_, resp, err := approverClient.PullRequests.CreateReview(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, *prNumber, reviewRequest)
-	prom.InstrumentGhCall(resp)
+func ApprovePr(approver RepoProvider, ghPrClientDetails GhPrClientDetails, prNumber *int) error {
+	err := approver.ApprovePullRequest(ghPrClientDetails.Ctx, *prNumber)
 	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Could not create review: err=%s\n%v\n", err, resp)
+		ghPrClientDetails.PrLogger.Errorf("Could not create review: err=%s\n", err)
 		return err
 	}
 
@@ -1303,25 +1600,17 @@ func GetInRepoConfig(ghPrClientDetails GhPrClientDetails, defaultBranch string)
 	return c, err
 }
 
+// GetFileContent returns the file content and an HTTP like status code, 404 means the file doesn't exist in branch.
 func GetFileContent(ghPrClientDetails GhPrClientDetails, branch string, filePath string) (string, int, error) {
-	rGetContentOps := github.RepositoryContentGetOptions{Ref: branch}
-	fileContent, _, resp, err := ghPrClientDetails.GhClientPair.v3Client.Repositories.GetContents(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, filePath, &rGetContentOps)
-	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Fail to get file:%s\n%v\n", err, resp)
-		if resp == nil {
-			return "", 0, err
-		}
-		prom.InstrumentGhCall(resp)
-		return "", resp.StatusCode, err
-	} else {
-		prom.InstrumentGhCall(resp)
-	}
-	fileContentString, err := fileContent.GetContent()
-	if err != nil {
-		ghPrClientDetails.PrLogger.Errorf("Fail to serlize file:%s\n", err)
-		return "", resp.StatusCode, err
+	fileContentString, err := ghPrClientDetails.repoProvider().GetFileContent(ghPrClientDetails.Ctx, branch, filePath)
+	if errors.Is(err, ErrNotFound) {
+		ghPrClientDetails.PrLogger.Errorf("Fail to get file:%s\n", err)
+		return "", http.StatusNotFound, err
+	} else if err != nil {
+		ghPrClientDetails.PrLogger.Errorf("Fail to get file:%s\n", err)
+		return "", 0, err
 	}
-	return fileContentString, resp.StatusCode, nil
+	return fileContentString, http.StatusOK, nil
 }
 
 // commitStatusTargetURL generates a target URL based on an optional
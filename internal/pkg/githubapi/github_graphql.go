@@ -71,7 +71,9 @@ func MimizeStalePrComments(ghPrClientDetails GhPrClientDetails, githubGraphQlCli
 	bi := githubv4.String(strings.TrimSuffix(botIdentity, "[bot]"))
 	for _, prComment := range getCommentNodeIdsQuery.Repository.PullRequest.Comments.Edges {
 		if !prComment.Node.IsMinimized && prComment.Node.Author.Login == bi {
-			if strings.Contains(string(prComment.Node.Body), "<!-- telefonistka_tag -->") {
+			if isStickyComment(string(prComment.Node.Body)) {
+				ghPrClientDetails.PrLogger.Debugln("Ignoring sticky comment, it's edited in place")
+			} else if strings.Contains(string(prComment.Node.Body), commentTag) {
 				ghPrClientDetails.PrLogger.Infof("Minimizing Comment %s", prComment.Node.Id)
 				minimizeCommentInput := githubv4.MinimizeCommentInput{
 					SubjectID:        prComment.Node.Id,
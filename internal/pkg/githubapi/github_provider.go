@@ -0,0 +1,397 @@
+package githubapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/google/go-github/v62/github"
+	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
+)
+
+// githubProvider is the RepoProvider implementation for GitHub(and GHE), it uses the REST(v3) client only.
+type githubProvider struct {
+	client *github.Client
+	owner  string
+	repo   string
+}
+
+func newGithubProvider(ghClientPair *GhClientPair, owner string, repo string) *githubProvider {
+	var client *github.Client
+	if ghClientPair != nil {
+		client = ghClientPair.v3Client
+	}
+	return &githubProvider{client: client, owner: owner, repo: repo}
+}
+
+// wrapNotFound lets callers check for missing objects with errors.Is(err, ErrNotFound) regardless of the provider
+func wrapNotFound(resp *github.Response, err error) error {
+	if err != nil && resp != nil && resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	return err
+}
+
+func (g *githubProvider) GetDefaultBranch(ctx context.Context) (string, error) {
+	repo, resp, err := g.client.Repositories.Get(ctx, g.owner, g.repo)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return "", err
+	}
+	return repo.GetDefaultBranch(), nil
+}
+
+func (g *githubProvider) GetFileContent(ctx context.Context, ref string, filePath string) (string, error) {
+	fileContent, _, resp, err := g.client.Repositories.GetContents(ctx, g.owner, g.repo, filePath, &github.RepositoryContentGetOptions{Ref: ref})
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return "", wrapNotFound(resp, err)
+	}
+	if fileContent == nil {
+		return "", fmt.Errorf("%s is a directory", filePath)
+	}
+	return fileContent.GetContent()
+}
+
+func (g *githubProvider) ListDirectory(ctx context.Context, ref string, dirPath string) ([]RepoContent, error) {
+	_, directoryContent, resp, err := g.client.Repositories.GetContents(ctx, g.owner, g.repo, dirPath, &github.RepositoryContentGetOptions{Ref: ref})
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return nil, wrapNotFound(resp, err)
+	}
+	contents := make([]RepoContent, 0, len(directoryContent))
+	for _, elementInDir := range directoryContent {
+		contents = append(contents, RepoContent{
+			Path: elementInDir.GetPath(),
+			Type: elementInDir.GetType(),
+			SHA:  elementInDir.GetSHA(),
+		})
+	}
+	return contents, nil
+}
+
+func (g *githubProvider) CreateCommit(ctx context.Context, baseBranch string, treeEntries []TreeEntry, commitMsg string) (string, error) {
+	ref, resp, err := g.client.Git.GetRef(ctx, g.owner, g.repo, "heads/"+baseBranch)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return "", fmt.Errorf("get %s branch ref: %w", baseBranch, wrapNotFound(resp, err))
+	}
+	baseTreeSHA := ref.GetObject().GetSHA()
+
+	ghTreeEntries := make([]*github.TreeEntry, 0, len(treeEntries))
+	for _, treeEntry := range treeEntries {
+		ghTreeEntries = append(ghTreeEntries, &github.TreeEntry{ // https://docs.github.com/en/rest/git/trees?apiVersion=2022-11-28#create-a-tree
+			Path:    github.String(treeEntry.Path),
+			Mode:    github.String(treeEntry.Mode),
+			Type:    github.String(treeEntry.Type),
+			SHA:     treeEntry.SHA,
+			Content: treeEntry.Content,
+		})
+	}
+	tree, resp, err := g.client.Git.CreateTree(ctx, g.owner, g.repo, baseTreeSHA, ghTreeEntries)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return "", fmt.Errorf("create Git Tree object: %w", err)
+	}
+	parentCommit, resp, err := g.client.Git.GetCommit(ctx, g.owner, g.repo, baseTreeSHA)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return "", fmt.Errorf("get parent commit: %w", err)
+	}
+
+	newCommitConfig := &github.Commit{
+		Message: github.String(commitMsg),
+		Parents: []*github.Commit{parentCommit},
+		Tree:    tree,
+	}
+	commit, resp, err := g.client.Git.CreateCommit(ctx, g.owner, g.repo, newCommitConfig, nil)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return "", fmt.Errorf("create Git commit: %w", err)
+	}
+	return commit.GetSHA(), nil
+}
+
+func (g *githubProvider) CreateBranch(ctx context.Context, branchName string, commitSHA string) error {
+	newRefConfig := &github.Reference{
+		Ref:    github.String("refs/heads/" + branchName),
+		Object: &github.GitObject{SHA: github.String(commitSHA)},
+	}
+	_, resp, err := g.client.Git.CreateRef(ctx, g.owner, g.repo, newRefConfig)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) UpdateBranch(ctx context.Context, branchName string, commitSHA string) error {
+	refConfig := &github.Reference{
+		Ref:    github.String("refs/heads/" + branchName),
+		Object: &github.GitObject{SHA: github.String(commitSHA)},
+	}
+	_, resp, err := g.client.Git.UpdateRef(ctx, g.owner, g.repo, refConfig, false)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	pull, resp, err := g.client.PullRequests.Get(ctx, g.owner, g.repo, number)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return nil, wrapNotFound(resp, err)
+	}
+	return pullRequestFromGithub(pull), nil
+}
+
+func pullRequestFromGithub(pull *github.PullRequest) *PullRequest {
+	pr := &PullRequest{
+		Number:  pull.GetNumber(),
+		HTMLURL: pull.GetHTMLURL(),
+		Title:   pull.GetTitle(),
+		Body:    pull.GetBody(),
+		State:   pull.GetState(),
+		Merged:  pull.GetMerged(),
+		HeadRef: pull.GetHead().GetRef(),
+		HeadSHA: pull.GetHead().GetSHA(),
+		BaseRef: pull.GetBase().GetRef(),
+		Author:  pull.GetUser().GetLogin(),
+	}
+	for _, l := range pull.Labels {
+		pr.Labels = append(pr.Labels, l.GetName())
+	}
+	for _, a := range pull.Assignees {
+		pr.Assignees = append(pr.Assignees, a.GetLogin())
+	}
+	return pr
+}
+
+func (g *githubProvider) ListOpenPullRequests(ctx context.Context, baseBranch string) ([]*PullRequest, error) {
+	opts := &github.PullRequestListOptions{State: "open", Base: baseBranch, ListOptions: github.ListOptions{PerPage: 100}}
+	pullRequests := []*PullRequest{}
+
+	for {
+		perPagePulls, resp, err := g.client.PullRequests.List(ctx, g.owner, g.repo, opts)
+		prom.InstrumentGhCall(resp)
+		if err != nil {
+			return nil, wrapNotFound(resp, err)
+		}
+		for _, pull := range perPagePulls {
+			pullRequests = append(pullRequests, pullRequestFromGithub(pull))
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return pullRequests, nil
+}
+
+func (g *githubProvider) ListPullRequestFiles(ctx context.Context, number int) ([]ChangedFile, error) {
+	opts := &github.ListOptions{}
+	changedFiles := []ChangedFile{}
+
+	for {
+		perPagePrFiles, resp, err := g.client.PullRequests.ListFiles(ctx, g.owner, g.repo, number, opts)
+		prom.InstrumentGhCall(resp)
+		if err != nil {
+			return nil, wrapNotFound(resp, err)
+		}
+		for _, prFile := range perPagePrFiles {
+			changedFiles = append(changedFiles, ChangedFile{Filename: prFile.GetFilename(), Status: prFile.GetStatus()})
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	return changedFiles, nil
+}
+
+func (g *githubProvider) CreatePullRequest(ctx context.Context, newPr NewPullRequest) (*PullRequest, error) {
+	newPrConfig := &github.NewPullRequest{
+		Body:  github.String(newPr.Body),
+		Title: github.String(newPr.Title),
+		Base:  github.String(newPr.Base),
+		Head:  github.String(newPr.Head),
+	}
+	pull, resp, err := g.client.PullRequests.Create(ctx, g.owner, g.repo, newPrConfig)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return nil, err
+	}
+	return pullRequestFromGithub(pull), nil
+}
+
+func (g *githubProvider) MergePullRequest(ctx context.Context, number int, commitMsg string) error {
+	_, resp, err := g.client.PullRequests.Merge(ctx, g.owner, g.repo, number, commitMsg, nil)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) ClosePullRequest(ctx context.Context, number int) error {
+	_, resp, err := g.client.PullRequests.Edit(ctx, g.owner, g.repo, number, &github.PullRequest{State: github.String("closed")})
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) UpdatePullRequest(ctx context.Context, number int, title string, body string) error {
+	_, resp, err := g.client.PullRequests.Edit(ctx, g.owner, g.repo, number, &github.PullRequest{Title: github.String(title), Body: github.String(body)})
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) ApprovePullRequest(ctx context.Context, number int) error {
+	reviewRequest := &github.PullRequestReviewRequest{
+		Event: github.String("APPROVE"),
+	}
+	_, resp, err := g.client.PullRequests.CreateReview(ctx, g.owner, g.repo, number, reviewRequest)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) AddAssignees(ctx context.Context, number int, assignees []string) error {
+	_, resp, err := g.client.Issues.AddAssignees(ctx, g.owner, g.repo, number, assignees)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) CreateComment(ctx context.Context, number int, body string) error {
+	comment := &github.IssueComment{Body: &body}
+	_, resp, err := g.client.Issues.CreateComment(ctx, g.owner, g.repo, number, comment)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) ListComments(ctx context.Context, number int) ([]Comment, error) {
+	var comments []Comment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		issueComments, resp, err := g.client.Issues.ListComments(ctx, g.owner, g.repo, number, opts)
+		prom.InstrumentGhCall(resp)
+		if err != nil {
+			return nil, wrapNotFound(resp, err)
+		}
+		for _, c := range issueComments {
+			comments = append(comments, Comment{ID: c.GetID(), Body: c.GetBody(), Author: c.GetUser().GetLogin()})
+		}
+		if resp.NextPage == 0 {
+			return comments, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *githubProvider) EditComment(ctx context.Context, commentID int64, body string) error {
+	comment := &github.IssueComment{Body: &body}
+	_, resp, err := g.client.Issues.EditComment(ctx, g.owner, g.repo, commentID, comment)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) AddLabels(ctx context.Context, number int, labels []string) error {
+	_, resp, err := g.client.Issues.AddLabelsToIssue(ctx, g.owner, g.repo, number, labels)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) RemoveLabel(ctx context.Context, number int, label string) error {
+	resp, err := g.client.Issues.RemoveLabelForIssue(ctx, g.owner, g.repo, number, label)
+	prom.InstrumentGhCall(resp)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+func (g *githubProvider) ListCommitStatuses(ctx context.Context, ref string) ([]CommitStatus, error) {
+	repoStatuses, resp, err := g.client.Repositories.ListStatuses(ctx, g.owner, g.repo, ref, &github.ListOptions{})
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return nil, wrapNotFound(resp, err)
+	}
+	statuses := make([]CommitStatus, 0, len(repoStatuses))
+	for _, s := range repoStatuses {
+		statuses = append(statuses, CommitStatus{
+			State:       s.GetState(),
+			Context:     s.GetContext(),
+			Description: s.GetDescription(),
+			TargetURL:   s.GetTargetURL(),
+			AvatarURL:   s.GetAvatarURL(),
+		})
+	}
+	return statuses, nil
+}
+
+func (g *githubProvider) CreateCommitStatus(ctx context.Context, sha string, status CommitStatus) error {
+	repoStatus := &github.RepoStatus{
+		State:   github.String(status.State),
+		Context: github.String(status.Context),
+	}
+	if status.Description != "" {
+		repoStatus.Description = github.String(status.Description)
+	}
+	if status.TargetURL != "" {
+		repoStatus.TargetURL = github.String(status.TargetURL)
+	}
+	if status.AvatarURL != "" {
+		repoStatus.AvatarURL = github.String(status.AvatarURL)
+	}
+	_, resp, err := g.client.Repositories.CreateStatus(ctx, g.owner, g.repo, sha, repoStatus)
+	prom.InstrumentGhCall(resp)
+	return err
+}
+
+func (g *githubProvider) CreateCheckRun(ctx context.Context, checkRun CheckRun) error {
+	opts := github.CreateCheckRunOptions{
+		Name:       checkRun.Name,
+		HeadSHA:    checkRun.HeadSHA,
+		Status:     github.String("completed"),
+		Conclusion: github.String(checkRun.Conclusion),
+		Output: &github.CheckRunOutput{
+			Title:   github.String(checkRun.Title),
+			Summary: github.String(checkRun.Summary),
+		},
+	}
+	if checkRun.Text != "" {
+		opts.Output.Text = github.String(checkRun.Text)
+	}
+	// GitHub accepts up to 50 annotations per request, the rest are added by updating the check run
+	annotations := githubCheckRunAnnotations(checkRun.Annotations)
+	batchSize := min(len(annotations), githubCheckRunAnnotationsPerRequest)
+	opts.Output.Annotations = annotations[:batchSize]
+	createdCheckRun, resp, err := g.client.Checks.CreateCheckRun(ctx, g.owner, g.repo, opts)
+	prom.InstrumentGhCall(resp)
+	if err != nil {
+		return err
+	}
+	for annotations = annotations[batchSize:]; len(annotations) > 0; annotations = annotations[batchSize:] {
+		batchSize = min(len(annotations), githubCheckRunAnnotationsPerRequest)
+		_, resp, err = g.client.Checks.UpdateCheckRun(ctx, g.owner, g.repo, createdCheckRun.GetID(), github.UpdateCheckRunOptions{
+			Name:   checkRun.Name,
+			Output: &github.CheckRunOutput{Title: opts.Output.Title, Summary: opts.Output.Summary, Annotations: annotations[:batchSize]},
+		})
+		prom.InstrumentGhCall(resp)
+		if err != nil {
+			return fmt.Errorf("adding check run annotations: %w", err)
+		}
+	}
+	return nil
+}
+
+const githubCheckRunAnnotationsPerRequest = 50
+
+func githubCheckRunAnnotations(annotations []CheckRunAnnotation) []*github.CheckRunAnnotation {
+	ghAnnotations := make([]*github.CheckRunAnnotation, 0, len(annotations))
+	for _, a := range annotations {
+		ghAnnotation := &github.CheckRunAnnotation{
+			Path:            github.String(a.Path),
+			StartLine:       github.Int(a.Line),
+			EndLine:         github.Int(a.Line),
+			AnnotationLevel: github.String(a.Level),
+			Message:         github.String(a.Message),
+		}
+		if a.Title != "" {
+			ghAnnotation.Title = github.String(a.Title)
+		}
+		ghAnnotations = append(ghAnnotations, ghAnnotation)
+	}
+	return ghAnnotations
+}
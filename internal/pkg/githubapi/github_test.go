@@ -2,14 +2,19 @@ package githubapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
 )
 
 func TestGenerateSafePromotionBranchName(t *testing.T) {
@@ -133,6 +138,56 @@ foobar`,
 	}
 }
 
+func TestEventToHandle(t *testing.T) {
+	t.Parallel()
+	label := func(name string) *github.Label { return &github.Label{Name: github.String(name)} }
+	tests := map[string]struct {
+		action           string
+		label            *github.Label
+		prLabels         []*github.Label
+		expectedToHandle string
+	}{
+		"show-plan label added": {
+			action:           "labeled",
+			label:            label("show-plan"),
+			prLabels:         []*github.Label{label("show-plan")},
+			expectedToHandle: "show-plan",
+		},
+		"Other label added to a PR with show-plan": {
+			action:           "labeled",
+			label:            label("approved-scale-down"),
+			prLabels:         []*github.Label{label("show-plan"), label("approved-scale-down")},
+			expectedToHandle: "diff-policy-label",
+		},
+		"Label removed": {
+			action:           "unlabeled",
+			label:            label("approved-scale-down"),
+			expectedToHandle: "diff-policy-label",
+		},
+		"Label event without the label": {
+			action:   "labeled",
+			prLabels: []*github.Label{label("show-plan")},
+		},
+		"New commits pushed": {
+			action:           "synchronize",
+			prLabels:         []*github.Label{label("show-plan")},
+			expectedToHandle: "changed",
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			toHandle, _ := eventToHandle(&github.PullRequestEvent{
+				Action:      github.String(tc.action),
+				Label:       tc.label,
+				PullRequest: &github.PullRequest{Merged: github.Bool(false), Labels: tc.prLabels},
+			})
+			assert.Equal(t, tc.expectedToHandle, toHandle)
+		})
+	}
+}
+
 func TestIsSyncFromBranchAllowedForThisPath(t *testing.T) {
 	t.Parallel()
 	tests := map[string]struct {
@@ -217,6 +272,248 @@ func TestGenerateArgoCdDiffComments(t *testing.T) {
 	}
 }
 
+func TestArgoCdDiffCommentGroupsAppsByComponent(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar"},
+			{ComponentPath: "clusters/prod/us-east/foo", ArgoCdAppName: "foo-cluster-a", HasDiff: true, DiffElements: []argocd.DiffElement{{ObjectKind: "Deployment", ObjectName: "foo", Diff: strings.Repeat("-replicas: 2\n+replicas: 3\n", 20)}}},
+			{ComponentPath: "clusters/prod/us-east/foo", ArgoCdAppName: "foo-cluster-b"},
+		},
+	}
+
+	comments, err := generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 1) {
+		assert.Contains(t, comments[0], "`clusters/prod/us-east/foo` is deployed by 2 ArgoCD applications")
+		assert.NotContains(t, comments[0], "`clusters/prod/bar` is deployed by")
+		assert.Less(t, strings.Index(comments[0], "foo-cluster-a"), strings.Index(comments[0], "foo-cluster-b"))
+	}
+
+	// When splitting, all the apps of a component stay in the same comment
+	comments, err = generateArgoCdDiffComments(diffCommentData, len(comments[0])-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 2) {
+		assert.Contains(t, comments[1], "Component 2/2: clusters/prod/us-east/foo")
+		assert.Contains(t, comments[1], "foo-cluster-a")
+		assert.Contains(t, comments[1], "foo-cluster-b")
+	}
+}
+
+func TestArgoCdDiffCommentGroupsComponentsByInstance(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			{ComponentPath: "clusters/us-east1/foo", ArgoCdAppName: "foo-us"},
+			{ArgoCdInstance: "eu", ComponentPath: "clusters/eu-west1/foo", ArgoCdAppName: "foo-eu"},
+		},
+	}
+
+	comments, err := generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 1) {
+		// The apps are also listed in the summary table above the diffs
+		diffs := comments[0][strings.Index(comments[0], "Diff of ArgoCD applications:"):]
+		assert.Less(t, strings.Index(diffs, "Default ArgoCD instance"), strings.Index(diffs, "foo-us"))
+		assert.Less(t, strings.Index(diffs, "foo-us"), strings.Index(diffs, "ArgoCD instance `eu`"))
+		assert.Less(t, strings.Index(diffs, "ArgoCD instance `eu`"), strings.Index(diffs, "foo-eu"))
+	}
+
+	// A single instance doesn't need a header
+	diffCommentData.DiffOfChangedComponents = diffCommentData.DiffOfChangedComponents[:1]
+	comments, err = generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 1) {
+		assert.NotContains(t, comments[0], "ArgoCD instance")
+	}
+}
+
+func TestArgoCdDiffCommentPolicyViolations(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", HasDiff: true},
+			{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar", HasDiff: true},
+		},
+		PolicyViolations: []argocd.DiffPolicyViolation{
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", ObjectKind: "CustomResourceDefinition", ObjectName: "foos.example.com", Reason: "modifying it requires the `approved-crd-change` label"},
+		},
+	}
+
+	comments, err := generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedViolation := "> * **foo** @ `clusters/prod/foo`, `/CustomResourceDefinition/foos.example.com`: modifying it requires the `approved-crd-change` label"
+	if assert.Len(t, comments, 1) {
+		assert.Contains(t, comments[0], expectedViolation)
+		assert.Less(t, strings.Index(comments[0], "Diff policy violations"), strings.Index(comments[0], "Diff of ArgoCD applications"), "Violations should be listed first")
+	}
+
+	// Split comments only list the violations of their component
+	comments, err = generateArgoCdDiffComments(diffCommentData, 500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 2) {
+		assert.Contains(t, comments[0], expectedViolation)
+		assert.Contains(t, comments[1], "clusters/prod/bar")
+		assert.NotContains(t, comments[1], "Diff policy violations")
+	}
+}
+
+func TestArgoCdDiffCommentIgnoredResources(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", IgnoredResources: 3},
+			{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar", HasDiff: true},
+		},
+	}
+
+	comments, err := generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 1) {
+		assert.Contains(t, comments[0], "@ `clusters/prod/foo`\n\n🙈 3 object(s) with only ignored differences(`ignoreDifferences`) are hidden\n")
+		assert.Equal(t, 1, strings.Count(comments[0], "🙈"), "Apps without ignored differences shouldn't mention them")
+	}
+}
+
+func TestArgoCdDiffCommentSummaryTable(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar", ArgoCdAppURL: "https://argocd/applications/bar"},
+			{ComponentPath: "clusters/prod/baz", ArgoCdAppName: "baz", ArgoCdAppURL: "https://argocd/applications/baz", DiffError: fmt.Errorf("boom")},
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", ArgoCdAppURL: "https://argocd/applications/foo", HasDiff: true, Stats: argocd.DiffStats{
+				Kinds:           []argocd.KindDiffStats{{Kind: "ConfigMap", Added: 1}, {Kind: "Deployment", Modified: 1}},
+				Added:           1,
+				Modified:        1,
+				LinesAdded:      12,
+				LinesRemoved:    2,
+				ImageChanged:    true,
+				ReplicasChanged: true,
+			}},
+		},
+	}
+
+	comments, err := generateArgoCdDiffComments(diffCommentData, githubCommentMaxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, comments, 1) {
+		assert.Contains(t, comments[0], "| [bar](https://argocd/applications/bar) | `clusters/prod/bar` | No diff |  |  |\n")
+		assert.Contains(t, comments[0], "| [baz](https://argocd/applications/baz) | `clusters/prod/baz` | ⚠️ Diff failed |  |  |\n")
+		assert.Contains(t, comments[0], "| [foo](https://argocd/applications/foo) | `clusters/prod/foo` | ConfigMap: 1 added<br>Deployment: 1 modified | +12 -2 | image, replicas |\n")
+		assert.Less(t, strings.Index(comments[0], "| Application |"), strings.Index(comments[0], "Diff of ArgoCD applications:"))
+	}
+
+	// Split comments hold a single component, they don't need a summary
+	comments, err = generateArgoCdDiffComments(diffCommentData, len(comments[0])-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, comment := range comments {
+		assert.NotContains(t, comment, "| Application |")
+	}
+}
+
+func TestArgoCdDiffConciseCommentSemanticFormat(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			{ComponentPath: "clusters/prod/foo", ArgoCdAppName: "foo", HasDiff: true, DiffFormat: cfg.DiffFormatSemantic, DiffElements: []argocd.DiffElement{
+				{ObjectNamespace: "foo", ObjectKind: "Deployment", ObjectName: "foo", ChangeType: argocd.ChangeTypeModified, Diff: "! spec.replicas: 2 → 3\n", ChangedFields: []string{"! spec.replicas"}},
+			}},
+			{ComponentPath: "clusters/prod/bar", ArgoCdAppName: "bar", HasDiff: true, DiffFormat: cfg.DiffFormatUnified, DiffElements: []argocd.DiffElement{
+				{ObjectNamespace: "bar", ObjectKind: "Deployment", ObjectName: "bar", ChangeType: argocd.ChangeTypeModified, Diff: "-    replicas: 2\n+    replicas: 3\n"},
+			}},
+		},
+	}
+
+	comment, err := executeTemplate("argoCdDiffConcise", defaultTemplatesFullPath("argoCD-diff-pr-comment-concise.gotmpl"), diffCommentData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, comment, "foo/Deployment/foo:\n! spec.replicas\n", "The changed fields of semantic components are listed in the concise comment")
+	assert.NotContains(t, comment, "2 → 3", "Field values are left out of the concise comment")
+	assert.Contains(t, comment, "`bar/Deployment/bar`")
+	assert.NotContains(t, comment, "replicas: 2\n", "Unified diffs are left out of the concise comment")
+}
+
+func TestGenerateArgoCdDiffCommentsOversizedSemanticDiff(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	const maxCommentLength = 20000
+	bigDiffResult := func(name string, objects int) argocd.DiffResult {
+		diffResult := argocd.DiffResult{ComponentPath: "clusters/prod/" + name, ArgoCdAppName: name, HasDiff: true, DiffFormat: cfg.DiffFormatSemantic}
+		for i := 0; i < objects; i++ {
+			diffResult.DiffElements = append(diffResult.DiffElements, argocd.DiffElement{
+				ObjectNamespace: name,
+				ObjectKind:      "ConfigMap",
+				ObjectName:      fmt.Sprintf("%s-%d", name, i),
+				ChangeType:      argocd.ChangeTypeModified,
+				Diff:            "! data[\"config.yaml\"]:\n" + strings.Repeat("-old line of a big embedded file\n+new line of a big embedded file\n", 20),
+				ChangedFields:   []string{`! data["config.yaml"]`},
+			})
+		}
+		return diffResult
+	}
+	diffCommentData := DiffCommentData{
+		DiffOfChangedComponents: []argocd.DiffResult{
+			// The changed fields of these fit the concise comment
+			bigDiffResult("foo", 50),
+			bigDiffResult("bar", 50),
+			// Even the list of changed fields of this one is too large
+			bigDiffResult("baz", 1000),
+		},
+	}
+
+	comments, err := generateArgoCdDiffComments(diffCommentData, maxCommentLength)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, comments, 3) {
+		t.FailNow()
+	}
+	for _, comment := range comments {
+		assert.Less(t, len(comment), maxCommentLength)
+		assert.NotContains(t, comment, "big embedded file", "Multi-line diffs are left out of the concise comment")
+	}
+	assert.Contains(t, comments[0], "foo/ConfigMap/foo-49:\n! data[\"config.yaml\"]\n")
+	assert.Contains(t, comments[2], diffCommentTruncatedNote)
+}
+
 func readJSONFromFile(t *testing.T, filename string, data interface{}) {
 	t.Helper()
 	// Read the JSON from the file
@@ -499,3 +796,187 @@ func Test_getPromotionSkipPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleMergedPrEvent(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		autoMerge            bool
+		dryRunMode           bool
+		expectedPrs          int
+		expectedMainValues   string
+		expectedCommentParts []string
+	}{
+		"Promotion PR is opened and approved": {
+			expectedPrs:        2,
+			expectedMainValues: "replicas: 1\n",
+		},
+		"Promotion PR is auto-merged": {
+			autoMerge:            true,
+			expectedPrs:          2,
+			expectedMainValues:   "replicas: 2\n",
+			expectedCommentParts: []string{"Merging promotion PR: #2"},
+		},
+		"Dry run mode only comments the plan": {
+			dryRunMode:           true,
+			expectedPrs:          1,
+			expectedMainValues:   "replicas: 1\n",
+			expectedCommentParts: []string{"env/staging/app1 ➡️  env/prod/app1"},
+		},
+	}
+
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			repo := NewInMemoryRepoProvider("main", map[string]string{
+				"telefonistka.yaml": fmt.Sprintf(`
+promotionPaths:
+  - sourcePath: "env/staging/"
+    conditions:
+      autoMerge: %t
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+autoApprovePromotionPrs: true
+dryRunMode: %t
+`, tc.autoMerge, tc.dryRunMode),
+				"env/staging/app1/values.yaml":    "replicas: 2\n",
+				"env/staging/app1/configmap.yaml": "new: true\n",
+				"env/staging/app2/values.yaml":    "replicas: 3\n",
+				"env/prod/app1/values.yaml":       "replicas: 1\n",
+				"env/prod/app1/stale.yaml":        "stale: true\n",
+				"env/prod/app2/values.yaml":       "replicas: 5\n",
+			})
+			repo.AddPullRequest(
+				PullRequest{Number: 1, State: "closed", Merged: true, HeadRef: "feature-branch", BaseRef: "main", Author: "original-author"},
+				[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+			)
+			ghPrClientDetails := GhPrClientDetails{
+				Ctx:      context.Background(),
+				Provider: repo,
+				Owner:    "AnOwner",
+				Repo:     "Arepo",
+				PrNumber: 1,
+				Ref:      "feature-branch",
+				PrAuthor: "original-author",
+				PrLogger: log.WithFields(log.Fields{}),
+			}
+
+			err := handleMergedPrEvent(ghPrClientDetails, repo)
+			if err != nil {
+				t.Fatalf("handleMergedPrEvent failed: %v", err)
+			}
+
+			pulls := repo.PullRequests()
+			assert.Len(t, pulls, tc.expectedPrs)
+			mainFiles, err := repo.BranchFiles("main")
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.expectedMainValues, mainFiles["env/prod/app1/values.yaml"])
+			for _, commentPart := range tc.expectedCommentParts {
+				assert.Contains(t, strings.Join(repo.Comments(1), "\n"), commentPart)
+			}
+			if tc.expectedPrs < 2 {
+				return
+			}
+
+			promotionPr := pulls[1]
+			assert.Equal(t, "🚀 Promotion: app1 ➡️  env/prod/", promotionPr.Title)
+			assert.Equal(t, generateSafePromotionBranchName(1, "feature-branch", []string{"env/prod/"}), promotionPr.HeadRef)
+			assert.Equal(t, "main", promotionPr.BaseRef)
+			assert.Equal(t, []string{"promotion"}, promotionPr.Labels)
+			assert.Equal(t, []string{"original-author"}, promotionPr.Assignees)
+			assert.Equal(t, 1, repo.Approvals(promotionPr.Number))
+			assert.Equal(t, tc.autoMerge, promotionPr.Merged)
+
+			promotedFiles, err := repo.BranchFiles(promotionPr.HeadRef)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "replicas: 2\n", promotedFiles["env/prod/app1/values.yaml"])
+			assert.Equal(t, "new: true\n", promotedFiles["env/prod/app1/configmap.yaml"])
+			assert.NotContains(t, promotedFiles, "env/prod/app1/stale.yaml")
+			assert.Equal(t, "replicas: 5\n", promotedFiles["env/prod/app2/values.yaml"], "Unchanged components shouldn't be promoted")
+		})
+	}
+}
+
+func TestHandleMergedPrEventRetry(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		// leftBranchOnly simulates a previous attempt that failed after creating the branch but before opening the PR
+		leftBranchOnly bool
+	}{
+		"Previous attempt opened the PR":    {},
+		"Previous attempt created a branch": {leftBranchOnly: true},
+	}
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			repo := NewInMemoryRepoProvider("main", map[string]string{
+				"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+`,
+				"env/staging/app1/values.yaml": "replicas: 2\n",
+				"env/prod/app1/values.yaml":    "replicas: 1\n",
+			})
+			repo.AddPullRequest(
+				PullRequest{Number: 1, State: "closed", Merged: true, HeadRef: "feature-branch", BaseRef: "main", Author: "original-author"},
+				[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+			)
+			ghPrClientDetails := GhPrClientDetails{
+				Ctx:      context.Background(),
+				Provider: repo,
+				Owner:    "AnOwner",
+				Repo:     "Arepo",
+				PrNumber: 1,
+				Ref:      "feature-branch",
+				PrAuthor: "original-author",
+				PrLogger: log.WithFields(log.Fields{}),
+			}
+			branchName := generateSafePromotionBranchName(1, "feature-branch", []string{"env/prod/"})
+			if tc.leftBranchOnly {
+				stale := "replicas: 0\n"
+				commit, err := repo.CreateCommit(context.Background(), "main", []TreeEntry{{Path: "env/prod/app1/values.yaml", Mode: "100644", Type: "blob", Content: &stale}}, "Partial attempt")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := repo.CreateBranch(context.Background(), branchName, commit); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := handleMergedPrEvent(ghPrClientDetails, repo); err != nil {
+				t.Fatalf("First handleMergedPrEvent failed: %v", err)
+			}
+
+			if err := handleMergedPrEvent(ghPrClientDetails, repo); err != nil {
+				t.Fatalf("Retried handleMergedPrEvent failed: %v", err)
+			}
+			pulls := repo.PullRequests()
+			if !assert.Len(t, pulls, 2, "The retry should reuse the promotion PR") {
+				t.FailNow()
+			}
+			assert.Equal(t, branchName, pulls[1].HeadRef)
+			assert.Equal(t, "open", pulls[1].State)
+			assert.Equal(t, []string{"promotion"}, pulls[1].Labels)
+			promotedFiles, err := repo.BranchFiles(branchName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, "replicas: 2\n", promotedFiles["env/prod/app1/values.yaml"])
+		})
+	}
+}
@@ -0,0 +1,613 @@
+package githubapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// gitlabProvider is the RepoProvider implementation for GitLab merge requests, it uses the REST(v4) API directly.
+//
+// GitLab can't create a commit that isn't on a branch, so CreateCommit only stages the changes as commit actions
+// and returns a placeholder SHA, the commit is created by the following CreateBranch call.
+type gitlabProvider struct {
+	httpClient *http.Client
+	apiURL     string
+	webURL     string
+	token      string
+	project    string
+
+	mu sync.Mutex
+	// GitLab has no API to read a tree object by its id, so directory ids seen in ListDirectory are mapped back to their ref and path
+	treeSources    map[string]gitlabTreeSource
+	pendingCommits map[string]gitlabPendingCommit
+}
+
+type gitlabTreeSource struct {
+	ref  string
+	path string
+}
+
+type gitlabPendingCommit struct {
+	baseBranch string
+	message    string
+	actions    []gitlabCommitAction
+}
+
+type gitlabCommitAction struct {
+	Action   string `json:"action"`
+	FilePath string `json:"file_path"`
+	Content  string `json:"content,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type gitlabTreeNode struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Path string `json:"path"`
+}
+
+type gitlabMergeRequest struct {
+	IID          int      `json:"iid"`
+	WebURL       string   `json:"web_url"`
+	Title        string   `json:"title"`
+	Description  string   `json:"description"`
+	State        string   `json:"state"`
+	SourceBranch string   `json:"source_branch"`
+	TargetBranch string   `json:"target_branch"`
+	SHA          string   `json:"sha"`
+	Labels       []string `json:"labels"`
+	Author       struct {
+		Username string `json:"username"`
+	} `json:"author"`
+	Assignees []struct {
+		ID       int    `json:"id"`
+		Username string `json:"username"`
+	} `json:"assignees"`
+	DetailedMergeStatus string `json:"detailed_merge_status"`
+}
+
+type gitlabCommitStatus struct {
+	Name        string `json:"name"`
+	Status      string `json:"status"`
+	Description string `json:"description"`
+	TargetURL   string `json:"target_url"`
+}
+
+// newGitlabProvider creates a provider for project(the "namespace/project" path), host is the GitLab host name without scheme.
+func newGitlabProvider(host string, token string, project string, webURL string) *gitlabProvider {
+	return &gitlabProvider{
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		apiURL:         fmt.Sprintf("https://%s/api/v4", host),
+		webURL:         webURL,
+		token:          token,
+		project:        project,
+		treeSources:    map[string]gitlabTreeSource{},
+		pendingCommits: map[string]gitlabPendingCommit{},
+	}
+}
+
+func (g *gitlabProvider) BlameURLPrefix() string {
+	return g.webURL + "/-/blame"
+}
+
+// do sends a request to a project scoped API path and returns the response body and the "X-Next-Page" pagination header
+func (g *gitlabProvider) do(ctx context.Context, method string, apiPath string, query url.Values, requestBody interface{}) ([]byte, string, error) {
+	return g.doAPI(ctx, method, "/projects/"+url.PathEscape(g.project)+apiPath, query, requestBody)
+}
+
+func (g *gitlabProvider) doAPI(ctx context.Context, method string, apiPath string, query url.Values, requestBody interface{}) ([]byte, string, error) {
+	u := g.apiURL + apiPath
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var bodyReader io.Reader
+	if requestBody != nil {
+		b, err := json.Marshal(requestBody)
+		if err != nil {
+			return nil, "", err
+		}
+		bodyReader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("PRIVATE-TOKEN", g.token)
+	if requestBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := g.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode >= 300 {
+		err := fmt.Errorf("GitLab API %s %s: %s %s", method, apiPath, resp.Status, strings.TrimSpace(string(respBody)))
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, "", fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, "", err
+	}
+	return respBody, resp.Header.Get("X-Next-Page"), nil
+}
+
+func (g *gitlabProvider) doJSON(ctx context.Context, method string, apiPath string, query url.Values, requestBody interface{}, out interface{}) error {
+	respBody, _, err := g.do(ctx, method, apiPath, query, requestBody)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+func (g *gitlabProvider) GetDefaultBranch(ctx context.Context) (string, error) {
+	var project struct {
+		DefaultBranch string `json:"default_branch"`
+	}
+	err := g.doJSON(ctx, http.MethodGet, "", nil, nil, &project)
+	return project.DefaultBranch, err
+}
+
+func (g *gitlabProvider) GetFileContent(ctx context.Context, ref string, filePath string) (string, error) {
+	content, _, err := g.do(ctx, http.MethodGet, "/repository/files/"+url.PathEscape(filePath)+"/raw", url.Values{"ref": {ref}}, nil)
+	return string(content), err
+}
+
+func (g *gitlabProvider) listTree(ctx context.Context, ref string, dirPath string, recursive bool) ([]gitlabTreeNode, error) {
+	var nodes []gitlabTreeNode
+	query := url.Values{"ref": {ref}, "per_page": {"100"}, "recursive": {strconv.FormatBool(recursive)}}
+	if dirPath != "." && dirPath != "/" {
+		query.Set("path", strings.Trim(dirPath, "/"))
+	}
+	for {
+		respBody, nextPage, err := g.do(ctx, http.MethodGet, "/repository/tree", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page []gitlabTreeNode
+		if err := json.Unmarshal(respBody, &page); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, page...)
+		if nextPage == "" {
+			break
+		}
+		query.Set("page", nextPage)
+	}
+	return nodes, nil
+}
+
+func (g *gitlabProvider) ListDirectory(ctx context.Context, ref string, dirPath string) ([]RepoContent, error) {
+	nodes, err := g.listTree(ctx, ref, dirPath, false)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	contents := make([]RepoContent, 0, len(nodes))
+	for _, node := range nodes {
+		contentType := node.Type
+		switch node.Type {
+		case "blob":
+			contentType = "file"
+		case "tree":
+			contentType = "dir"
+			g.treeSources[node.ID] = gitlabTreeSource{ref: ref, path: node.Path}
+		}
+		contents = append(contents, RepoContent{Path: node.Path, Type: contentType, SHA: node.ID})
+	}
+	return contents, nil
+}
+
+// listFiles returns all the files under dirPath, keyed by their path relative to dirPath, with their blob id as value
+func (g *gitlabProvider) listFiles(ctx context.Context, ref string, dirPath string) (map[string]string, error) {
+	nodes, err := g.listTree(ctx, ref, dirPath, true)
+	if errors.Is(err, ErrNotFound) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for _, node := range nodes {
+		if node.Type == "blob" {
+			files[strings.TrimPrefix(node.Path, strings.Trim(dirPath, "/")+"/")] = node.ID
+		}
+	}
+	return files, nil
+}
+
+func (g *gitlabProvider) fileExists(ctx context.Context, ref string, filePath string) (bool, error) {
+	_, _, err := g.do(ctx, http.MethodHead, "/repository/files/"+url.PathEscape(filePath), url.Values{"ref": {ref}}, nil)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (g *gitlabProvider) blobAction(ctx context.Context, exists bool, filePath string, blobSHA string) (gitlabCommitAction, error) {
+	content, _, err := g.do(ctx, http.MethodGet, "/repository/blobs/"+url.PathEscape(blobSHA)+"/raw", nil, nil)
+	if err != nil {
+		return gitlabCommitAction{}, err
+	}
+	return contentAction(exists, filePath, string(content)), nil
+}
+
+func contentAction(exists bool, filePath string, content string) gitlabCommitAction {
+	action := gitlabCommitAction{Action: "create", FilePath: filePath, Content: base64.StdEncoding.EncodeToString([]byte(content)), Encoding: "base64"}
+	if exists {
+		action.Action = "update"
+	}
+	return action
+}
+
+// CreateCommit translates the GitHub style tree entries into GitLab commit actions, see gitlabProvider
+func (g *gitlabProvider) CreateCommit(ctx context.Context, baseBranch string, treeEntries []TreeEntry, commitMsg string) (string, error) {
+	var actions []gitlabCommitAction
+	actionIndex := map[string]int{} // later entries for the same path win, like in a Git tree
+	addAction := func(action gitlabCommitAction) {
+		if i, ok := actionIndex[action.FilePath]; ok {
+			actions[i] = action
+			return
+		}
+		actionIndex[action.FilePath] = len(actions)
+		actions = append(actions, action)
+	}
+
+	for _, treeEntry := range treeEntries {
+		switch {
+		case treeEntry.Type == "tree":
+			g.mu.Lock()
+			source, ok := g.treeSources[treeEntry.getSHA()]
+			g.mu.Unlock()
+			if !ok {
+				return "", fmt.Errorf("unknown directory object %s for %s", treeEntry.getSHA(), treeEntry.Path)
+			}
+			sourceFiles, err := g.listFiles(ctx, source.ref, source.path)
+			if err != nil {
+				return "", err
+			}
+			targetFiles, err := g.listFiles(ctx, baseBranch, treeEntry.Path)
+			if err != nil {
+				return "", err
+			}
+			for relativePath, blobSHA := range sourceFiles {
+				targetBlobSHA, exists := targetFiles[relativePath]
+				if exists && targetBlobSHA == blobSHA {
+					continue
+				}
+				action, err := g.blobAction(ctx, exists, path.Join(treeEntry.Path, relativePath), blobSHA)
+				if err != nil {
+					return "", err
+				}
+				addAction(action)
+			}
+		case treeEntry.Content != nil || treeEntry.SHA != nil:
+			exists, err := g.fileExists(ctx, baseBranch, treeEntry.Path)
+			if err != nil {
+				return "", err
+			}
+			if treeEntry.Content != nil {
+				addAction(contentAction(exists, treeEntry.Path, *treeEntry.Content))
+				continue
+			}
+			action, err := g.blobAction(ctx, exists, treeEntry.Path, *treeEntry.SHA)
+			if err != nil {
+				return "", err
+			}
+			addAction(action)
+		default:
+			addAction(gitlabCommitAction{Action: "delete", FilePath: treeEntry.Path})
+		}
+	}
+
+	commitSHA := pendingCommitSHA(baseBranch, commitMsg, actions)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pendingCommits[commitSHA] = gitlabPendingCommit{baseBranch: baseBranch, message: commitMsg, actions: actions}
+	return commitSHA, nil
+}
+
+func (g *gitlabProvider) CreateBranch(ctx context.Context, branchName string, commitSHA string) error {
+	g.mu.Lock()
+	pendingCommit, isPending := g.pendingCommits[commitSHA]
+	delete(g.pendingCommits, commitSHA)
+	g.mu.Unlock()
+
+	if !isPending {
+		return g.doJSON(ctx, http.MethodPost, "/repository/branches", url.Values{"branch": {branchName}, "ref": {commitSHA}}, nil, nil)
+	}
+	if len(pendingCommit.actions) == 0 {
+		// GitLab rejects empty commits, the branch content is identical to its base anyway
+		return g.doJSON(ctx, http.MethodPost, "/repository/branches", url.Values{"branch": {branchName}, "ref": {pendingCommit.baseBranch}}, nil, nil)
+	}
+	commitRequest := map[string]interface{}{
+		"branch":         branchName,
+		"start_branch":   pendingCommit.baseBranch,
+		"commit_message": pendingCommit.message,
+		"actions":        pendingCommit.actions,
+	}
+	return g.doJSON(ctx, http.MethodPost, "/repository/commits", nil, commitRequest, nil)
+}
+
+// UpdateBranch can only apply a pending commit staged on top of branchName itself, GitLab can't move a branch to an arbitrary commit
+func (g *gitlabProvider) UpdateBranch(ctx context.Context, branchName string, commitSHA string) error {
+	g.mu.Lock()
+	pendingCommit, isPending := g.pendingCommits[commitSHA]
+	delete(g.pendingCommits, commitSHA)
+	g.mu.Unlock()
+
+	if !isPending || pendingCommit.baseBranch != branchName {
+		return fmt.Errorf("GitLab can only update branch %s with a commit created on top of it", branchName)
+	}
+	if len(pendingCommit.actions) == 0 {
+		return nil
+	}
+	commitRequest := map[string]interface{}{
+		"branch":         branchName,
+		"commit_message": pendingCommit.message,
+		"actions":        pendingCommit.actions,
+	}
+	return g.doJSON(ctx, http.MethodPost, "/repository/commits", nil, commitRequest, nil)
+}
+
+func (mr gitlabMergeRequest) toPullRequest() *PullRequest {
+	pr := &PullRequest{
+		Number:  mr.IID,
+		HTMLURL: mr.WebURL,
+		Title:   mr.Title,
+		Body:    mr.Description,
+		State:   "open",
+		Merged:  mr.State == "merged",
+		HeadRef: mr.SourceBranch,
+		HeadSHA: mr.SHA,
+		BaseRef: mr.TargetBranch,
+		Author:  mr.Author.Username,
+		Labels:  mr.Labels,
+	}
+	if mr.State != "opened" {
+		pr.State = "closed"
+	}
+	for _, a := range mr.Assignees {
+		pr.Assignees = append(pr.Assignees, a.Username)
+	}
+	return pr
+}
+
+func (g *gitlabProvider) getMergeRequest(ctx context.Context, number int) (*gitlabMergeRequest, error) {
+	mr := &gitlabMergeRequest{}
+	err := g.doJSON(ctx, http.MethodGet, "/merge_requests/"+strconv.Itoa(number), nil, nil, mr)
+	if err != nil {
+		return nil, err
+	}
+	return mr, nil
+}
+
+func (g *gitlabProvider) GetPullRequest(ctx context.Context, number int) (*PullRequest, error) {
+	mr, err := g.getMergeRequest(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return mr.toPullRequest(), nil
+}
+
+func (g *gitlabProvider) ListOpenPullRequests(ctx context.Context, baseBranch string) ([]*PullRequest, error) {
+	pullRequests := []*PullRequest{}
+	query := url.Values{"state": {"opened"}, "target_branch": {baseBranch}, "per_page": {"100"}}
+	for {
+		respBody, nextPage, err := g.do(ctx, http.MethodGet, "/merge_requests", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var mrs []gitlabMergeRequest
+		if err := json.Unmarshal(respBody, &mrs); err != nil {
+			return nil, err
+		}
+		for _, mr := range mrs {
+			pullRequests = append(pullRequests, mr.toPullRequest())
+		}
+		if nextPage == "" {
+			break
+		}
+		query.Set("page", nextPage)
+	}
+	return pullRequests, nil
+}
+
+func (g *gitlabProvider) ListPullRequestFiles(ctx context.Context, number int) ([]ChangedFile, error) {
+	changedFiles := []ChangedFile{}
+	query := url.Values{"per_page": {"100"}}
+	for {
+		respBody, nextPage, err := g.do(ctx, http.MethodGet, "/merge_requests/"+strconv.Itoa(number)+"/diffs", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var diffs []struct {
+			NewPath     string `json:"new_path"`
+			NewFile     bool   `json:"new_file"`
+			RenamedFile bool   `json:"renamed_file"`
+			DeletedFile bool   `json:"deleted_file"`
+		}
+		if err := json.Unmarshal(respBody, &diffs); err != nil {
+			return nil, err
+		}
+		for _, d := range diffs {
+			status := "modified"
+			switch {
+			case d.NewFile:
+				status = "added"
+			case d.DeletedFile:
+				status = "removed"
+			case d.RenamedFile:
+				status = "renamed"
+			}
+			changedFiles = append(changedFiles, ChangedFile{Filename: d.NewPath, Status: status})
+		}
+		if nextPage == "" {
+			break
+		}
+		query.Set("page", nextPage)
+	}
+	return changedFiles, nil
+}
+
+func (g *gitlabProvider) CreatePullRequest(ctx context.Context, newPr NewPullRequest) (*PullRequest, error) {
+	mrRequest := map[string]interface{}{
+		"source_branch": strings.TrimPrefix(newPr.Head, "refs/heads/"),
+		"target_branch": newPr.Base,
+		"title":         newPr.Title,
+		"description":   newPr.Body,
+	}
+	mr := &gitlabMergeRequest{}
+	err := g.doJSON(ctx, http.MethodPost, "/merge_requests", nil, mrRequest, mr)
+	if err != nil {
+		return nil, err
+	}
+	return mr.toPullRequest(), nil
+}
+
+// MergePullRequest waits for GitLab to finish the (asynchronous) mergeability check of new MRs before merging
+func (g *gitlabProvider) MergePullRequest(ctx context.Context, number int, commitMsg string) error {
+	waitForMergeStatus := func() error {
+		mr, err := g.getMergeRequest(ctx, number)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if mr.DetailedMergeStatus == "checking" || mr.DetailedMergeStatus == "unchecked" || mr.DetailedMergeStatus == "preparing" {
+			return fmt.Errorf("MR %d merge status is %s", number, mr.DetailedMergeStatus)
+		}
+		return nil
+	}
+	mergeStatusBackoff := backoff.NewExponentialBackOff()
+	mergeStatusBackoff.MaxElapsedTime = time.Minute
+	err := backoff.Retry(waitForMergeStatus, backoff.WithContext(mergeStatusBackoff, ctx))
+	if err != nil {
+		return err
+	}
+	return g.doJSON(ctx, http.MethodPut, "/merge_requests/"+strconv.Itoa(number)+"/merge", nil, map[string]interface{}{"merge_commit_message": commitMsg}, nil)
+}
+
+func (g *gitlabProvider) ClosePullRequest(ctx context.Context, number int) error {
+	return g.doJSON(ctx, http.MethodPut, "/merge_requests/"+strconv.Itoa(number), nil, map[string]interface{}{"state_event": "close"}, nil)
+}
+
+func (g *gitlabProvider) UpdatePullRequest(ctx context.Context, number int, title string, body string) error {
+	return g.doJSON(ctx, http.MethodPut, "/merge_requests/"+strconv.Itoa(number), nil, map[string]interface{}{"title": title, "description": body}, nil)
+}
+
+func (g *gitlabProvider) ApprovePullRequest(ctx context.Context, number int) error {
+	return g.doJSON(ctx, http.MethodPost, "/merge_requests/"+strconv.Itoa(number)+"/approve", nil, nil, nil)
+}
+
+func (g *gitlabProvider) AddAssignees(ctx context.Context, number int, assignees []string) error {
+	mr, err := g.getMergeRequest(ctx, number)
+	if err != nil {
+		return err
+	}
+	assigneeIDs := []int{}
+	for _, a := range mr.Assignees {
+		assigneeIDs = append(assigneeIDs, a.ID)
+	}
+	for _, username := range assignees {
+		var users []struct {
+			ID int `json:"id"`
+		}
+		respBody, _, err := g.doAPI(ctx, http.MethodGet, "/users", url.Values{"username": {username}}, nil)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(respBody, &users); err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return fmt.Errorf("GitLab user %s: %w", username, ErrNotFound)
+		}
+		assigneeIDs = append(assigneeIDs, users[0].ID)
+	}
+	return g.doJSON(ctx, http.MethodPut, "/merge_requests/"+strconv.Itoa(number), nil, map[string]interface{}{"assignee_ids": assigneeIDs}, nil)
+}
+
+func (g *gitlabProvider) CreateComment(ctx context.Context, number int, body string) error {
+	return g.doJSON(ctx, http.MethodPost, "/merge_requests/"+strconv.Itoa(number)+"/notes", nil, map[string]interface{}{"body": body}, nil)
+}
+
+func (g *gitlabProvider) AddLabels(ctx context.Context, number int, labels []string) error {
+	return g.doJSON(ctx, http.MethodPut, "/merge_requests/"+strconv.Itoa(number), nil, map[string]interface{}{"add_labels": strings.Join(labels, ",")}, nil)
+}
+
+func (g *gitlabProvider) RemoveLabel(ctx context.Context, number int, label string) error {
+	return g.doJSON(ctx, http.MethodPut, "/merge_requests/"+strconv.Itoa(number), nil, map[string]interface{}{"remove_labels": label}, nil)
+}
+
+// GitLab commit statuses have their own set of states, these are mapped to and from the GitHub ones Telefonistka uses
+func gitlabCommitState(githubState string) string {
+	switch githubState {
+	case "failure", "error":
+		return "failed"
+	default:
+		return githubState
+	}
+}
+
+func githubCommitState(gitlabState string) string {
+	switch gitlabState {
+	case "failed":
+		return "failure"
+	case "canceled", "skipped":
+		return "error"
+	case "created", "running", "waiting_for_resource", "preparing", "scheduled", "manual":
+		return "pending"
+	default:
+		return gitlabState
+	}
+}
+
+func (g *gitlabProvider) ListCommitStatuses(ctx context.Context, ref string) ([]CommitStatus, error) {
+	var gitlabStatuses []gitlabCommitStatus
+	err := g.doJSON(ctx, http.MethodGet, "/repository/commits/"+url.PathEscape(ref)+"/statuses", url.Values{"all": {"true"}}, nil, &gitlabStatuses)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]CommitStatus, 0, len(gitlabStatuses))
+	for _, s := range gitlabStatuses {
+		statuses = append(statuses, CommitStatus{
+			State:       githubCommitState(s.Status),
+			Context:     s.Name,
+			Description: s.Description,
+			TargetURL:   s.TargetURL,
+		})
+	}
+	return statuses, nil
+}
+
+func (g *gitlabProvider) CreateCommitStatus(ctx context.Context, sha string, status CommitStatus) error {
+	statusRequest := map[string]interface{}{
+		"state":       gitlabCommitState(status.State),
+		"name":        status.Context,
+		"description": status.Description,
+		"target_url":  status.TargetURL,
+	}
+	return g.doJSON(ctx, http.MethodPost, "/statuses/"+url.PathEscape(sha), nil, statusRequest, nil)
+}
@@ -0,0 +1,145 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestGitlabProvider(t *testing.T, handler http.HandlerFunc) *gitlabProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	g := newGitlabProvider("gitlab.example.com", "a-token", "group/repo", "https://gitlab.example.com/group/repo")
+	g.apiURL = server.URL + "/api/v4"
+	return g
+}
+
+func TestGitlabProviderSyncCommit(t *testing.T) {
+	t.Parallel()
+	var commitRequest struct {
+		Branch        string               `json:"branch"`
+		StartBranch   string               `json:"start_branch"`
+		CommitMessage string               `json:"commit_message"`
+		Actions       []gitlabCommitAction `json:"actions"`
+	}
+	g := newTestGitlabProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "a-token", r.Header.Get("PRIVATE-TOKEN"))
+		query := r.URL.Query()
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/projects/group%2Frepo/repository/tree":
+			switch query.Get("path") {
+			case "env/staging":
+				_, _ = w.Write([]byte(`[{"id": "tree1", "type": "tree", "path": "env/staging/app1"}, {"id": "blob9", "type": "blob", "path": "env/staging/README.md"}]`))
+			case "env/staging/app1":
+				_, _ = w.Write([]byte(`[{"id": "blob1", "type": "blob", "path": "env/staging/app1/values.yaml"}, {"id": "blob2", "type": "blob", "path": "env/staging/app1/new.yaml"}, {"id": "blob4", "type": "blob", "path": "env/staging/app1/same.yaml"}]`))
+			case "env/prod/app1":
+				_, _ = w.Write([]byte(`[{"id": "blob0", "type": "blob", "path": "env/prod/app1/values.yaml"}, {"id": "blob3", "type": "blob", "path": "env/prod/app1/stale.yaml"}, {"id": "blob4", "type": "blob", "path": "env/prod/app1/same.yaml"}]`))
+			default:
+				http.NotFound(w, r)
+			}
+		case "GET /api/v4/projects/group%2Frepo/repository/blobs/blob1/raw":
+			_, _ = w.Write([]byte("replicas: 2\n"))
+		case "GET /api/v4/projects/group%2Frepo/repository/blobs/blob2/raw":
+			_, _ = w.Write([]byte("new: true\n"))
+		case "POST /api/v4/projects/group%2Frepo/repository/commits":
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &commitRequest); err != nil {
+				t.Error(err)
+			}
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id": "c0ffee"}`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+			http.NotFound(w, r)
+		}
+	})
+	ctx := context.Background()
+
+	contents, err := g.ListDirectory(ctx, "main", "env/staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []RepoContent{
+		{Path: "env/staging/app1", Type: "dir", SHA: "tree1"},
+		{Path: "env/staging/README.md", Type: "file", SHA: "blob9"},
+	}, contents)
+
+	sourceSHA := "tree1"
+	pendingCommitSHA, err := g.CreateCommit(ctx, "main", []TreeEntry{
+		{Path: "env/prod/app1", Mode: "040000", Type: "tree", SHA: &sourceSHA},
+		{Path: "env/prod/app1/stale.yaml", Mode: "100644", Type: "blob"},
+	}, "Syncing from env/staging/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = g.CreateBranch(ctx, "promotions/1-feature-abc", pendingCommitSHA)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, "promotions/1-feature-abc", commitRequest.Branch)
+	assert.Equal(t, "main", commitRequest.StartBranch)
+	assert.Equal(t, "Syncing from env/staging/", commitRequest.CommitMessage)
+	sort.Slice(commitRequest.Actions, func(i, j int) bool { return commitRequest.Actions[i].FilePath < commitRequest.Actions[j].FilePath })
+	assert.Equal(t, []gitlabCommitAction{
+		{Action: "create", FilePath: "env/prod/app1/new.yaml", Content: base64.StdEncoding.EncodeToString([]byte("new: true\n")), Encoding: "base64"},
+		{Action: "delete", FilePath: "env/prod/app1/stale.yaml"},
+		{Action: "update", FilePath: "env/prod/app1/values.yaml", Content: base64.StdEncoding.EncodeToString([]byte("replicas: 2\n")), Encoding: "base64"},
+	}, commitRequest.Actions)
+}
+
+func TestGitlabProviderFileNotFound(t *testing.T) {
+	t.Parallel()
+	g := newTestGitlabProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v4/projects/group%2Frepo/repository/files/env%2Fprod%2Ftelefonistka.yaml/raw", r.URL.EscapedPath())
+		assert.Equal(t, "main", r.URL.Query().Get("ref"))
+		http.Error(w, `{"message":"404 File Not Found"}`, http.StatusNotFound)
+	})
+
+	_, err := g.GetFileContent(context.Background(), "main", "env/prod/telefonistka.yaml")
+	assert.True(t, errors.Is(err, ErrNotFound), "expected ErrNotFound, got %v", err)
+}
+
+func TestGitlabProviderCommitStatus(t *testing.T) {
+	t.Parallel()
+	var statusRequest map[string]string
+	g := newTestGitlabProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "POST /api/v4/projects/group%2Frepo/statuses/abc123":
+			body, _ := io.ReadAll(r.Body)
+			if err := json.Unmarshal(body, &statusRequest); err != nil {
+				t.Error(err)
+			}
+			_, _ = w.Write([]byte(`{}`))
+		case "GET /api/v4/projects/group%2Frepo/repository/commits/feature/statuses":
+			_, _ = w.Write([]byte(`[{"name": "telefonistka", "status": "failed", "description": "Telefonistka GitOps Bot"}, {"name": "ci", "status": "running"}]`))
+		default:
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.EscapedPath())
+		}
+	})
+	ctx := context.Background()
+
+	err := g.CreateCommitStatus(ctx, "abc123", CommitStatus{State: "error", Context: "telefonistka", Description: "Telefonistka GitOps Bot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]string{"state": "failed", "name": "telefonistka", "description": "Telefonistka GitOps Bot", "target_url": ""}, statusRequest)
+
+	statuses, err := g.ListCommitStatuses(ctx, "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []CommitStatus{
+		{State: "failure", Context: "telefonistka", Description: "Telefonistka GitOps Bot"},
+		{State: "pending", Context: "ci"},
+	}, statuses)
+}
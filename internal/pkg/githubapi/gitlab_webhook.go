@@ -0,0 +1,233 @@
+package githubapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/google/go-github/v62/github"
+	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
+)
+
+const gitlabMergeRequestEventType = "Merge Request Hook"
+
+type gitlabMergeRequestEvent struct {
+	ObjectKind string `json:"object_kind"`
+	User       struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+		WebURL            string `json:"web_url"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID          int    `json:"iid"`
+		Action       string `json:"action"`
+		State        string `json:"state"`
+		Description  string `json:"description"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		OldRev       string `json:"oldrev"`
+		LastCommit   struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+	Labels  []gitlabLabel `json:"labels"`
+	Changes struct {
+		Labels *struct {
+			Previous []gitlabLabel `json:"previous"`
+			Current  []gitlabLabel `json:"current"`
+		} `json:"labels"`
+	} `json:"changes"`
+}
+
+type gitlabLabel struct {
+	Title string `json:"title"`
+}
+
+// changedLabel returns the first label that is in labels but not in otherLabels, nil when there is none
+func changedLabel(labels []gitlabLabel, otherLabels []gitlabLabel) *github.Label {
+	for _, l := range labels {
+		found := false
+		for _, other := range otherLabels {
+			found = found || other.Title == l.Title
+		}
+		if !found {
+			return &github.Label{Name: github.String(l.Title)}
+		}
+	}
+	return nil
+}
+
+// toPullRequestEvent translates the GitLab merge request event to the GitHub event the rest of Telefonistka understands,
+// only the fields Telefonistka reads are populated.
+func (e gitlabMergeRequestEvent) toPullRequestEvent() *github.PullRequestEvent {
+	attributes := e.ObjectAttributes
+	merged := false
+	var action string
+	// label is the added or removed label of label events, like GitHub, the event only carries a single one
+	var label *github.Label
+	switch attributes.Action {
+	case "open":
+		action = "opened"
+	case "reopen":
+		action = "reopened"
+	case "update":
+		if attributes.OldRev != "" {
+			action = "synchronize"
+		} else if e.Changes.Labels != nil {
+			if label = changedLabel(e.Changes.Labels.Current, e.Changes.Labels.Previous); label != nil {
+				action = "labeled"
+			} else if label = changedLabel(e.Changes.Labels.Previous, e.Changes.Labels.Current); label != nil {
+				action = "unlabeled"
+			} else {
+				action = "edited"
+			}
+		} else {
+			action = "edited"
+		}
+	case "merge":
+		action = "closed"
+		merged = true
+	case "close":
+		action = "closed"
+	default:
+		action = attributes.Action
+	}
+
+	labels := []*github.Label{}
+	for _, l := range e.Labels {
+		labels = append(labels, &github.Label{Name: github.String(l.Title)})
+	}
+
+	owner, repo := path.Split(e.Project.PathWithNamespace)
+	return &github.PullRequestEvent{
+		Action: github.String(action),
+		Label:  label,
+		PullRequest: &github.PullRequest{
+			Number: github.Int(attributes.IID),
+			Merged: github.Bool(merged),
+			Body:   github.String(attributes.Description),
+			Labels: labels,
+			Head: &github.PullRequestBranch{
+				Ref: github.String(attributes.SourceBranch),
+				SHA: github.String(attributes.LastCommit.ID),
+			},
+			Base: &github.PullRequestBranch{
+				Ref: github.String(attributes.TargetBranch),
+			},
+		},
+		Repo: &github.Repository{
+			Owner:   &github.User{Login: github.String(path.Clean(owner))},
+			Name:    github.String(repo),
+			HTMLURL: github.String(e.Project.WebURL),
+		},
+	}
+}
+
+func isGitlabEvent(r *http.Request) bool {
+	return r.Header.Get("X-Gitlab-Event") != ""
+}
+
+// reciveGitlabWebhook is the GitLab counterpart of ReciveWebhook, GitLab doesn't sign payloads but sends the configured secret token as a header
+func reciveGitlabWebhook(r *http.Request, eventQueue EventEnqueuer) error {
+	gitlabWebhookToken := getEnv("GITLAB_WEBHOOK_TOKEN", "")
+	if gitlabWebhookToken == "" || subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), []byte(gitlabWebhookToken)) != 1 {
+		prom.InstrumentWebhookHit("validation_failed")
+		return errors.New("GitLab webhook token validation failed, is GITLAB_WEBHOOK_TOKEN set?")
+	}
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		log.Errorf("error reading request body: err=%s\n", err)
+		prom.InstrumentWebhookHit("validation_failed")
+		return err
+	}
+	eventType := r.Header.Get("X-Gitlab-Event")
+	if eventType != gitlabMergeRequestEventType {
+		log.Debugf("Ignoring GitLab %s event", eventType)
+		prom.InstrumentWebhookHit("successful")
+		return nil
+	}
+
+	event, err := parseGitlabMergeRequestEvent(payload)
+	if err != nil {
+		log.Errorf("could not parse webhook: err=%s\n", err)
+		prom.InstrumentWebhookHit("parsing_failed")
+		return err
+	}
+	prom.InstrumentWebhookHit("successful")
+
+	deliveryID := r.Header.Get("X-Gitlab-Webhook-UUID")
+	if deliveryID == "" {
+		deliveryID = r.Header.Get("X-Gitlab-Event-UUID")
+	}
+	key, supersedeKey := prEventKeys(gitlabEventSource, event.toPullRequestEvent())
+	return enqueueEvent(eventQueue, eventqueue.Event{
+		Source:       gitlabEventSource,
+		Type:         eventType,
+		Headers:      r.Header,
+		Payload:      payload,
+		Key:          key,
+		SupersedeKey: supersedeKey,
+	}, deliveryID)
+}
+
+func parseGitlabMergeRequestEvent(payload []byte) (gitlabMergeRequestEvent, error) {
+	var event gitlabMergeRequestEvent
+	err := json.Unmarshal(payload, &event)
+	if err != nil {
+		return event, err
+	}
+	if event.ObjectKind != "merge_request" {
+		return event, fmt.Errorf("unexpected object_kind %s", event.ObjectKind)
+	}
+	return event, nil
+}
+
+func handleGitlabMergeRequestEvent(ctx context.Context, event gitlabMergeRequestEvent) error {
+	eventPayload := event.toPullRequestEvent()
+	log.Infof("is GitLab MergeRequestEvent(%s)", event.ObjectAttributes.Action)
+	prLogger := log.WithFields(log.Fields{
+		"repo":       event.Project.PathWithNamespace,
+		"prNumber":   event.ObjectAttributes.IID,
+		"event_type": "pr",
+	})
+
+	gitlabHost := getEnv("GITLAB_HOST", "gitlab.com")
+	provider := newGitlabProvider(gitlabHost, getCrucialEnv("GITLAB_TOKEN"), event.Project.PathWithNamespace, event.Project.WebURL)
+	var approver RepoProvider = provider
+	if approverToken := getEnv("APPROVER_GITLAB_TOKEN", ""); approverToken != "" {
+		approver = newGitlabProvider(gitlabHost, approverToken, event.Project.PathWithNamespace, event.Project.WebURL)
+	}
+
+	// The hook user is whoever triggered the event, the MR author is only available from the API
+	mr, err := provider.GetPullRequest(ctx, event.ObjectAttributes.IID)
+	if err != nil {
+		prLogger.Errorf("Failed to get MR details: err=%s\n", err)
+		return fmt.Errorf("getting MR details: %w", err)
+	}
+	eventPayload.PullRequest.User = &github.User{Login: github.String(mr.Author)}
+
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      ctx,
+		Provider: provider,
+		Labels:   eventPayload.PullRequest.Labels,
+		Owner:    eventPayload.Repo.Owner.GetLogin(),
+		Repo:     eventPayload.Repo.GetName(),
+		RepoURL:  event.Project.WebURL,
+		PrNumber: event.ObjectAttributes.IID,
+		Ref:      event.ObjectAttributes.SourceBranch,
+		PrAuthor: mr.Author,
+		PrLogger: prLogger,
+		PrSHA:    event.ObjectAttributes.LastCommit.ID,
+	}
+
+	return HandlePREvent(eventPayload, ghPrClientDetails, GhClientPair{}, approver, ctx)
+}
@@ -0,0 +1,98 @@
+package githubapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitlabMergeRequestEventToPullRequestEvent(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		payload          string
+		expectedAction   string
+		expectedMerged   bool
+		expectedToHandle string
+	}{
+		"New MR": {
+			payload:          `{"object_kind": "merge_request", "object_attributes": {"action": "open"}}`,
+			expectedAction:   "opened",
+			expectedToHandle: "changed",
+		},
+		"New commits pushed": {
+			payload:          `{"object_kind": "merge_request", "object_attributes": {"action": "update", "oldrev": "aaaa"}}`,
+			expectedAction:   "synchronize",
+			expectedToHandle: "changed",
+		},
+		"show-plan label added": {
+			payload:          `{"object_kind": "merge_request", "object_attributes": {"action": "update"}, "labels": [{"title": "show-plan"}], "changes": {"labels": {"previous": [], "current": [{"title": "show-plan"}]}}}`,
+			expectedAction:   "labeled",
+			expectedToHandle: "show-plan",
+		},
+		"Label added to an MR with show-plan": {
+			payload:          `{"object_kind": "merge_request", "object_attributes": {"action": "update"}, "labels": [{"title": "show-plan"}, {"title": "approved-scale-down"}], "changes": {"labels": {"previous": [{"title": "show-plan"}], "current": [{"title": "show-plan"}, {"title": "approved-scale-down"}]}}}`,
+			expectedAction:   "labeled",
+			expectedToHandle: "diff-policy-label",
+		},
+		"Label removed": {
+			payload:          `{"object_kind": "merge_request", "object_attributes": {"action": "update"}, "labels": [], "changes": {"labels": {"previous": [{"title": "approved-scale-down"}], "current": []}}}`,
+			expectedAction:   "unlabeled",
+			expectedToHandle: "diff-policy-label",
+		},
+		"Description edited": {
+			payload:        `{"object_kind": "merge_request", "object_attributes": {"action": "update"}, "changes": {"description": {}}}`,
+			expectedAction: "edited",
+		},
+		"MR merged": {
+			payload:          `{"object_kind": "merge_request", "object_attributes": {"action": "merge"}}`,
+			expectedAction:   "closed",
+			expectedMerged:   true,
+			expectedToHandle: "merged",
+		},
+		"MR closed without merging": {
+			payload:        `{"object_kind": "merge_request", "object_attributes": {"action": "close"}}`,
+			expectedAction: "closed",
+		},
+	}
+
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			event, err := parseGitlabMergeRequestEvent([]byte(tc.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			eventPayload := event.toPullRequestEvent()
+			assert.Equal(t, tc.expectedAction, eventPayload.GetAction())
+			assert.Equal(t, tc.expectedMerged, eventPayload.GetPullRequest().GetMerged())
+			toHandle, _ := eventToHandle(eventPayload)
+			assert.Equal(t, tc.expectedToHandle, toHandle)
+		})
+	}
+}
+
+func TestGitlabMergeRequestEventRepoDetails(t *testing.T) {
+	t.Parallel()
+	payload := `{
+  "object_kind": "merge_request",
+  "project": {"path_with_namespace": "infra/gitops/k8s-apps", "web_url": "https://gitlab.example.com/infra/gitops/k8s-apps"},
+  "object_attributes": {"iid": 42, "action": "open", "source_branch": "feature", "target_branch": "main", "last_commit": {"id": "abc123"}}
+}`
+	event, err := parseGitlabMergeRequestEvent([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eventPayload := event.toPullRequestEvent()
+	assert.Equal(t, "infra/gitops", eventPayload.GetRepo().GetOwner().GetLogin())
+	assert.Equal(t, "k8s-apps", eventPayload.GetRepo().GetName())
+	assert.Equal(t, 42, eventPayload.GetPullRequest().GetNumber())
+	assert.Equal(t, "feature", eventPayload.GetPullRequest().GetHead().GetRef())
+	assert.Equal(t, "abc123", eventPayload.GetPullRequest().GetHead().GetSHA())
+}
+
+func TestParseGitlabMergeRequestEventWrongKind(t *testing.T) {
+	t.Parallel()
+	_, err := parseGitlabMergeRequestEvent([]byte(`{"object_kind": "note"}`))
+	assert.Error(t, err)
+}
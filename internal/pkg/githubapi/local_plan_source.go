@@ -0,0 +1,34 @@
+package githubapi
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// LocalPlanSource is a PromotionPlanSource backed by a local checkout of the repo.
+// It allows simulating a promotion plan without opening a PR, in-component configuration is read from the working tree, regardless of branch.
+type LocalPlanSource struct {
+	RepoDir string
+	Files   []string
+}
+
+func (s LocalPlanSource) ChangedFiles() ([]string, error) {
+	changedFiles := make([]string, 0, len(s.Files))
+	for _, f := range s.Files {
+		// The planner expects repo relative paths with forward slashes, like the GitHub API returns
+		changedFiles = append(changedFiles, filepath.ToSlash(filepath.Clean(f)))
+	}
+	return changedFiles, nil
+}
+
+func (s LocalPlanSource) ComponentConfigContent(componentPath string, _ string) (string, bool, error) {
+	b, err := os.ReadFile(filepath.Join(s.RepoDir, filepath.FromSlash(componentPath), "telefonistka.yaml"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return string(b), true, nil
+}
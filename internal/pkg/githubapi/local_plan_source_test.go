@@ -0,0 +1,68 @@
+package githubapi
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+	log "github.com/sirupsen/logrus"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+func TestGeneratePromotionPlanFromLocalSource(t *testing.T) {
+	t.Parallel()
+	repoDir := t.TempDir()
+	componentDir := filepath.Join(repoDir, "workspace", "componentA")
+	if err := os.MkdirAll(componentDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	err := os.WriteFile(filepath.Join(componentDir, "telefonistka.yaml"), []byte("promotionTargetBlockList:\n  - env/prod/us-east4/.*\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &cfg.Config{
+		PromotionPaths: []cfg.PromotionPath{
+			{
+				SourcePath: "workspace/",
+				PromotionPrs: []cfg.PromotionPr{
+					{
+						TargetPaths: []string{"env/prod/us-east4/", "env/prod/us-west1/"},
+					},
+				},
+			},
+		},
+	}
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	src := LocalPlanSource{
+		RepoDir: repoDir,
+		Files: []string{
+			"workspace/componentA/values.yaml",
+			"./workspace/componentB/values.yaml",
+			"README.md",
+		},
+	}
+
+	promotions, err := GeneratePromotionPlanFromSource(ghPrClientDetails, src, config, "")
+	if err != nil {
+		t.Fatalf("Failed to generate promotion plan: err=%s", err)
+	}
+
+	expectedPromotions := map[string]PromotionInstance{
+		"workspace/>env/prod/us-east4/|env/prod/us-west1/": {
+			ComputedSyncPaths: map[string]string{
+				"env/prod/us-west1/componentA": "workspace/componentA",
+				"env/prod/us-east4/componentB": "workspace/componentB",
+				"env/prod/us-west1/componentB": "workspace/componentB",
+			},
+		},
+	}
+	if diff := deep.Equal(expectedPromotions, promotions); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,554 @@
+package githubapi
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InMemoryRepoProvider is a RepoProvider that keeps a whole repo(branches, commits, PRs, comments, statuses and check runs) in memory.
+// It's meant for unit tests of complete event flows, merges are simple fast-forwards of the base branch to the PR head content.
+type InMemoryRepoProvider struct {
+	mu            sync.Mutex
+	defaultBranch string
+	branches      map[string]string            // branch name -> commit SHA
+	commits       map[string]map[string]string // commit SHA -> file path -> blob SHA
+	blobs         map[string]string            // blob SHA -> content
+	trees         map[string]map[string]string // directory object SHA -> relative file path -> blob SHA
+	pullRequests  map[int]*PullRequest
+	prFiles       map[int][]ChangedFile
+	comments      map[int][]Comment
+	approvals     map[int]int
+	statuses      map[string][]CommitStatus // commit SHA -> statuses, newest last
+	checkRuns     map[string][]CheckRun     // commit SHA -> check runs, newest last
+	nextPrNumber  int
+	lastCommentID int64
+}
+
+// NewInMemoryRepoProvider creates a repo with a single commit on defaultBranch holding files(path -> content).
+func NewInMemoryRepoProvider(defaultBranch string, files map[string]string) *InMemoryRepoProvider {
+	m := &InMemoryRepoProvider{
+		defaultBranch: defaultBranch,
+		branches:      map[string]string{},
+		commits:       map[string]map[string]string{},
+		blobs:         map[string]string{},
+		trees:         map[string]map[string]string{},
+		pullRequests:  map[int]*PullRequest{},
+		prFiles:       map[int][]ChangedFile{},
+		comments:      map[int][]Comment{},
+		approvals:     map[int]int{},
+		statuses:      map[string][]CommitStatus{},
+		checkRuns:     map[string][]CheckRun{},
+		nextPrNumber:  1,
+	}
+	tree := map[string]string{}
+	for filePath, content := range files {
+		tree[filePath] = m.storeBlob(content)
+	}
+	m.branches[defaultBranch] = m.storeCommit("", "Initial commit", tree)
+	return m
+}
+
+// AddPullRequest registers an existing PR, like the one triggering the event under test, with its list of changed files.
+func (m *InMemoryRepoProvider) AddPullRequest(pr PullRequest, files []ChangedFile) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pullRequests[pr.Number] = &pr
+	m.prFiles[pr.Number] = files
+	if pr.Number >= m.nextPrNumber {
+		m.nextPrNumber = pr.Number + 1
+	}
+}
+
+// BranchFiles returns the content of every file in branch, keyed by path.
+func (m *InMemoryRepoProvider) BranchFiles(branch string) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tree, err := m.resolve(branch)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string]string{}
+	for filePath, blobSHA := range tree {
+		files[filePath] = m.blobs[blobSHA]
+	}
+	return files, nil
+}
+
+// PullRequests returns a copy of all PRs, ordered by number.
+func (m *InMemoryRepoProvider) PullRequests() []PullRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	numbers := make([]int, 0, len(m.pullRequests))
+	for n := range m.pullRequests {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	pulls := make([]PullRequest, 0, len(numbers))
+	for _, n := range numbers {
+		pulls = append(pulls, *m.pullRequests[n])
+	}
+	return pulls
+}
+
+// Comments returns the bodies of the comments of a PR, oldest first.
+func (m *InMemoryRepoProvider) Comments(number int) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bodies := make([]string, 0, len(m.comments[number]))
+	for _, c := range m.comments[number] {
+		bodies = append(bodies, c.Body)
+	}
+	return bodies
+}
+
+// CheckRuns returns the check runs created for commitSHA, oldest first.
+func (m *InMemoryRepoProvider) CheckRuns(commitSHA string) []CheckRun {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]CheckRun{}, m.checkRuns[commitSHA]...)
+}
+
+func (m *InMemoryRepoProvider) Approvals(number int) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.approvals[number]
+}
+
+func hashObject(objectType string, content string) string {
+	hasher := sha1.New() //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
+	fmt.Fprintf(hasher, "%s %d\x00%s", objectType, len(content), content)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+func (m *InMemoryRepoProvider) storeBlob(content string) string {
+	sha := hashObject("blob", content)
+	m.blobs[sha] = content
+	return sha
+}
+
+// storeTree registers a directory object, identical content yields identical SHAs just like in Git
+func (m *InMemoryRepoProvider) storeTree(files map[string]string) string {
+	lines := make([]string, 0, len(files))
+	for relativePath, blobSHA := range files {
+		lines = append(lines, relativePath+" "+blobSHA)
+	}
+	sort.Strings(lines)
+	sha := hashObject("tree", strings.Join(lines, "\n"))
+	m.trees[sha] = files
+	return sha
+}
+
+func (m *InMemoryRepoProvider) storeCommit(parentSHA string, commitMsg string, tree map[string]string) string {
+	treeSHA := m.storeTree(tree)
+	sha := hashObject("commit", fmt.Sprintf("tree %s\nparent %s\n\n%s", treeSHA, parentSHA, commitMsg))
+	m.commits[sha] = tree
+	return sha
+}
+
+// resolve returns the file tree of ref, which can be a branch name or a commit SHA
+func (m *InMemoryRepoProvider) resolve(ref string) (map[string]string, error) {
+	if commitSHA, ok := m.branches[strings.TrimPrefix(ref, "refs/heads/")]; ok {
+		ref = commitSHA
+	}
+	tree, ok := m.commits[ref]
+	if !ok {
+		return nil, fmt.Errorf("ref %s: %w", ref, ErrNotFound)
+	}
+	return tree, nil
+}
+
+func (m *InMemoryRepoProvider) getPullRequest(number int) (*PullRequest, error) {
+	pr, ok := m.pullRequests[number]
+	if !ok {
+		return nil, fmt.Errorf("PR %d: %w", number, ErrNotFound)
+	}
+	return pr, nil
+}
+
+func (m *InMemoryRepoProvider) GetDefaultBranch(_ context.Context) (string, error) {
+	return m.defaultBranch, nil
+}
+
+func (m *InMemoryRepoProvider) GetFileContent(_ context.Context, ref string, filePath string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tree, err := m.resolve(ref)
+	if err != nil {
+		return "", err
+	}
+	blobSHA, ok := tree[filePath]
+	if !ok {
+		return "", fmt.Errorf("file %s@%s: %w", filePath, ref, ErrNotFound)
+	}
+	return m.blobs[blobSHA], nil
+}
+
+func (m *InMemoryRepoProvider) ListDirectory(_ context.Context, ref string, dirPath string) ([]RepoContent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tree, err := m.resolve(ref)
+	if err != nil {
+		return nil, err
+	}
+	prefix := strings.Trim(dirPath, "/") + "/"
+	if prefix == "/" || prefix == "./" {
+		prefix = ""
+	}
+
+	subDirs := map[string]map[string]string{}
+	contents := []RepoContent{}
+	for filePath, blobSHA := range tree {
+		if !strings.HasPrefix(filePath, prefix) {
+			continue
+		}
+		name, rest, isDir := strings.Cut(strings.TrimPrefix(filePath, prefix), "/")
+		if !isDir {
+			contents = append(contents, RepoContent{Path: filePath, Type: "file", SHA: blobSHA})
+			continue
+		}
+		if subDirs[name] == nil {
+			subDirs[name] = map[string]string{}
+		}
+		subDirs[name][rest] = blobSHA
+	}
+	for name, files := range subDirs {
+		contents = append(contents, RepoContent{Path: prefix + name, Type: "dir", SHA: m.storeTree(files)})
+	}
+	if len(contents) == 0 {
+		if _, isFile := tree[strings.Trim(dirPath, "/")]; isFile {
+			return contents, nil
+		}
+		return nil, fmt.Errorf("directory %s@%s: %w", dirPath, ref, ErrNotFound)
+	}
+	sort.Slice(contents, func(i, j int) bool { return contents[i].Path < contents[j].Path })
+	return contents, nil
+}
+
+func (m *InMemoryRepoProvider) CreateCommit(_ context.Context, baseBranch string, treeEntries []TreeEntry, commitMsg string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	parentSHA, ok := m.branches[baseBranch]
+	if !ok {
+		return "", fmt.Errorf("branch %s: %w", baseBranch, ErrNotFound)
+	}
+	tree := map[string]string{}
+	for filePath, blobSHA := range m.commits[parentSHA] {
+		tree[filePath] = blobSHA
+	}
+
+	for _, treeEntry := range treeEntries {
+		switch {
+		case treeEntry.Type == "tree":
+			// Like GitHub, setting a directory object merges it with the existing content instead of replacing it
+			dirFiles, ok := m.trees[treeEntry.getSHA()]
+			if !ok {
+				return "", fmt.Errorf("tree %s: %w", treeEntry.getSHA(), ErrNotFound)
+			}
+			for relativePath, blobSHA := range dirFiles {
+				tree[path.Join(treeEntry.Path, relativePath)] = blobSHA
+			}
+		case treeEntry.Content != nil:
+			tree[treeEntry.Path] = m.storeBlob(*treeEntry.Content)
+		case treeEntry.SHA != nil:
+			if _, ok := m.blobs[*treeEntry.SHA]; !ok {
+				return "", fmt.Errorf("blob %s: %w", *treeEntry.SHA, ErrNotFound)
+			}
+			tree[treeEntry.Path] = *treeEntry.SHA
+		default:
+			delete(tree, treeEntry.Path)
+		}
+	}
+	return m.storeCommit(parentSHA, commitMsg, tree), nil
+}
+
+func (t TreeEntry) getSHA() string {
+	if t.SHA == nil {
+		return ""
+	}
+	return *t.SHA
+}
+
+func (m *InMemoryRepoProvider) CreateBranch(_ context.Context, branchName string, commitSHA string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.branches[branchName]; exists {
+		return fmt.Errorf("branch %s already exists", branchName)
+	}
+	if _, ok := m.commits[commitSHA]; !ok {
+		return fmt.Errorf("commit %s: %w", commitSHA, ErrNotFound)
+	}
+	m.branches[branchName] = commitSHA
+	return nil
+}
+
+// UpdateBranch doesn't verify the update is a fast-forward, the in-memory commits don't track their parents
+func (m *InMemoryRepoProvider) UpdateBranch(_ context.Context, branchName string, commitSHA string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.branches[branchName]; !exists {
+		return fmt.Errorf("branch %s: %w", branchName, ErrNotFound)
+	}
+	headTree, ok := m.commits[commitSHA]
+	if !ok {
+		return fmt.Errorf("commit %s: %w", commitSHA, ErrNotFound)
+	}
+	m.branches[branchName] = commitSHA
+	for number, pr := range m.pullRequests {
+		if pr.State == "open" && pr.HeadRef == branchName {
+			pr.HeadSHA = commitSHA
+			m.prFiles[number] = diffTrees(m.commits[m.branches[pr.BaseRef]], headTree)
+		}
+	}
+	return nil
+}
+
+func (m *InMemoryRepoProvider) GetPullRequest(_ context.Context, number int) (*PullRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return nil, err
+	}
+	prCopy := *pr
+	return &prCopy, nil
+}
+
+func (m *InMemoryRepoProvider) ListOpenPullRequests(_ context.Context, baseBranch string) ([]*PullRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pulls := []*PullRequest{}
+	for _, pr := range m.pullRequests {
+		if pr.State == "open" && pr.BaseRef == baseBranch {
+			prCopy := *pr
+			pulls = append(pulls, &prCopy)
+		}
+	}
+	sort.Slice(pulls, func(i, j int) bool { return pulls[i].Number < pulls[j].Number })
+	return pulls, nil
+}
+
+func (m *InMemoryRepoProvider) ListPullRequestFiles(_ context.Context, number int) ([]ChangedFile, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.getPullRequest(number); err != nil {
+		return nil, err
+	}
+	return append([]ChangedFile{}, m.prFiles[number]...), nil
+}
+
+func (m *InMemoryRepoProvider) CreatePullRequest(_ context.Context, newPr NewPullRequest) (*PullRequest, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	headRef := strings.TrimPrefix(newPr.Head, "refs/heads/")
+	baseTree, err := m.resolve(newPr.Base)
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := m.resolve(headRef)
+	if err != nil {
+		return nil, err
+	}
+
+	pr := &PullRequest{
+		Number:  m.nextPrNumber,
+		HTMLURL: fmt.Sprintf("https://git.example.com/pulls/%d", m.nextPrNumber),
+		Title:   newPr.Title,
+		Body:    newPr.Body,
+		State:   "open",
+		HeadRef: headRef,
+		HeadSHA: m.branches[headRef],
+		BaseRef: newPr.Base,
+	}
+	m.nextPrNumber++
+	m.pullRequests[pr.Number] = pr
+	m.prFiles[pr.Number] = diffTrees(baseTree, headTree)
+
+	prCopy := *pr
+	return &prCopy, nil
+}
+
+func diffTrees(baseTree map[string]string, headTree map[string]string) []ChangedFile {
+	changedFiles := []ChangedFile{}
+	for filePath, blobSHA := range headTree {
+		if baseBlobSHA, ok := baseTree[filePath]; !ok {
+			changedFiles = append(changedFiles, ChangedFile{Filename: filePath, Status: "added"})
+		} else if baseBlobSHA != blobSHA {
+			changedFiles = append(changedFiles, ChangedFile{Filename: filePath, Status: "modified"})
+		}
+	}
+	for filePath := range baseTree {
+		if _, ok := headTree[filePath]; !ok {
+			changedFiles = append(changedFiles, ChangedFile{Filename: filePath, Status: "removed"})
+		}
+	}
+	sort.Slice(changedFiles, func(i, j int) bool { return changedFiles[i].Filename < changedFiles[j].Filename })
+	return changedFiles
+}
+
+func (m *InMemoryRepoProvider) MergePullRequest(_ context.Context, number int, commitMsg string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return err
+	}
+	if pr.State != "open" {
+		return fmt.Errorf("PR %d is %s", number, pr.State)
+	}
+	headTree, err := m.resolve(pr.HeadRef)
+	if err != nil {
+		return err
+	}
+	m.branches[pr.BaseRef] = m.storeCommit(m.branches[pr.BaseRef], commitMsg, headTree)
+	pr.State = "closed"
+	pr.Merged = true
+	return nil
+}
+
+func (m *InMemoryRepoProvider) ClosePullRequest(_ context.Context, number int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return err
+	}
+	pr.State = "closed"
+	return nil
+}
+
+func (m *InMemoryRepoProvider) UpdatePullRequest(_ context.Context, number int, title string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return err
+	}
+	pr.Title = title
+	pr.Body = body
+	return nil
+}
+
+func (m *InMemoryRepoProvider) ApprovePullRequest(_ context.Context, number int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.getPullRequest(number); err != nil {
+		return err
+	}
+	m.approvals[number]++
+	return nil
+}
+
+func (m *InMemoryRepoProvider) AddAssignees(_ context.Context, number int, assignees []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return err
+	}
+	for _, a := range assignees {
+		if !contains(pr.Assignees, a) {
+			pr.Assignees = append(pr.Assignees, a)
+		}
+	}
+	return nil
+}
+
+func (m *InMemoryRepoProvider) CreateComment(_ context.Context, number int, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.getPullRequest(number); err != nil {
+		return err
+	}
+	m.lastCommentID++
+	m.comments[number] = append(m.comments[number], Comment{ID: m.lastCommentID, Body: body})
+	return nil
+}
+
+func (m *InMemoryRepoProvider) ListComments(_ context.Context, number int) ([]Comment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.getPullRequest(number); err != nil {
+		return nil, err
+	}
+	return append([]Comment{}, m.comments[number]...), nil
+}
+
+func (m *InMemoryRepoProvider) EditComment(_ context.Context, commentID int64, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, comments := range m.comments {
+		for i := range comments {
+			if comments[i].ID == commentID {
+				comments[i].Body = body
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("comment %d: %w", commentID, ErrNotFound)
+}
+
+func (m *InMemoryRepoProvider) AddLabels(_ context.Context, number int, labels []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return err
+	}
+	for _, l := range labels {
+		if !contains(pr.Labels, l) {
+			pr.Labels = append(pr.Labels, l)
+		}
+	}
+	return nil
+}
+
+func (m *InMemoryRepoProvider) RemoveLabel(_ context.Context, number int, label string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pr, err := m.getPullRequest(number)
+	if err != nil {
+		return err
+	}
+	labels := []string{}
+	for _, l := range pr.Labels {
+		if l != label {
+			labels = append(labels, l)
+		}
+	}
+	pr.Labels = labels
+	return nil
+}
+
+func (m *InMemoryRepoProvider) ListCommitStatuses(_ context.Context, ref string) ([]CommitStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if commitSHA, ok := m.branches[ref]; ok {
+		ref = commitSHA
+	}
+	// GitHub lists statuses newest first
+	statuses := make([]CommitStatus, 0, len(m.statuses[ref]))
+	for i := len(m.statuses[ref]) - 1; i >= 0; i-- {
+		statuses = append(statuses, m.statuses[ref][i])
+	}
+	return statuses, nil
+}
+
+func (m *InMemoryRepoProvider) CreateCommitStatus(_ context.Context, sha string, status CommitStatus) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses[sha] = append(m.statuses[sha], status)
+	return nil
+}
+
+func (m *InMemoryRepoProvider) CreateCheckRun(_ context.Context, checkRun CheckRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.checkRuns[checkRun.HeadSHA] = append(m.checkRuns[checkRun.HeadSHA], checkRun)
+	return nil
+}
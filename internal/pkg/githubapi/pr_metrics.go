@@ -2,11 +2,14 @@ package githubapi
 
 import (
 	"context"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/google/go-github/v62/github"
 	lru "github.com/hashicorp/golang-lru/v2"
 	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
 	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
 )
 
@@ -106,3 +109,33 @@ func getPrMetrics(mainGhClientCache *lru.Cache[string, GhClientPair]) {
 		}
 	}
 }
+
+// diffCounters sums the stats of the ArgoCD diffs of a PR
+func diffCounters(diffResults []argocd.DiffResult) prom.DiffCounters {
+	dc := prom.DiffCounters{NotableChanges: map[string]int{}}
+	objectChanges := map[[2]string]int{}
+	for _, dr := range diffResults {
+		for _, kindStats := range dr.Stats.Kinds {
+			objectChanges[[2]string{kindStats.Kind, argocd.ChangeTypeAdded}] += kindStats.Added
+			objectChanges[[2]string{kindStats.Kind, argocd.ChangeTypeRemoved}] += kindStats.Removed
+			objectChanges[[2]string{kindStats.Kind, argocd.ChangeTypeModified}] += kindStats.Modified
+		}
+		dc.LinesAdded += dr.Stats.LinesAdded
+		dc.LinesRemoved += dr.Stats.LinesRemoved
+		for _, change := range dr.Stats.NotableChanges() {
+			dc.NotableChanges[strings.ReplaceAll(change, " ", "_")]++
+		}
+	}
+	for key, count := range objectChanges {
+		if count > 0 {
+			dc.ObjectChanges = append(dc.ObjectChanges, prom.DiffObjectChanges{Kind: key[0], ChangeType: key[1], Count: count})
+		}
+	}
+	sort.Slice(dc.ObjectChanges, func(i, j int) bool {
+		if dc.ObjectChanges[i].Kind != dc.ObjectChanges[j].Kind {
+			return dc.ObjectChanges[i].Kind < dc.ObjectChanges[j].Kind
+		}
+		return dc.ObjectChanges[i].ChangeType < dc.ObjectChanges[j].ChangeType
+	})
+	return dc
+}
@@ -5,6 +5,9 @@ import (
 	"time"
 
 	"github.com/google/go-github/v62/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/argocd"
+	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
 )
 
 func TestIsPrStalePending(t *testing.T) {
@@ -87,3 +90,33 @@ func TestIsPrStalePending(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffCounters(t *testing.T) {
+	t.Parallel()
+	diffResults := []argocd.DiffResult{
+		{ArgoCdAppName: "foo", HasDiff: true, Stats: argocd.DiffStats{
+			Kinds:        []argocd.KindDiffStats{{Kind: "Deployment", Modified: 1}, {Kind: "ConfigMap", Added: 1}},
+			LinesAdded:   5,
+			LinesRemoved: 2,
+			ImageChanged: true,
+		}},
+		{ArgoCdAppName: "bar", HasDiff: true, Stats: argocd.DiffStats{
+			Kinds:                   []argocd.KindDiffStats{{Kind: "Deployment", Modified: 2}},
+			LinesAdded:              1,
+			LinesRemoved:            1,
+			ImageChanged:            true,
+			ResourceRequestsChanged: true,
+		}},
+		{ArgoCdAppName: "baz"},
+	}
+	expected := prom.DiffCounters{
+		ObjectChanges: []prom.DiffObjectChanges{
+			{Kind: "ConfigMap", ChangeType: argocd.ChangeTypeAdded, Count: 1},
+			{Kind: "Deployment", ChangeType: argocd.ChangeTypeModified, Count: 3},
+		},
+		LinesAdded:     6,
+		LinesRemoved:   3,
+		NotableChanges: map[string]int{"image": 2, "resource_requests": 1},
+	}
+	assert.Equal(t, expected, diffCounters(diffResults))
+}
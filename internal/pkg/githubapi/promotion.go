@@ -1,15 +1,14 @@
 package githubapi
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
 	"strings"
 
-	"github.com/google/go-github/v62/github"
 	log "github.com/sirupsen/logrus"
 	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
-	prom "github.com/wayfair-incubator/telefonistka/internal/pkg/prometheus"
 	yaml "gopkg.in/yaml.v2"
 )
 
@@ -19,12 +18,24 @@ type PromotionInstance struct {
 }
 
 type PromotionInstanceMetaData struct {
+	// Key identifies the promotion source and targets combination, it is stable across PRs
+	Key                            string
 	SourcePath                     string
 	TargetPaths                    []string
 	TargetDescription              string
 	PerComponentSkippedTargetPaths map[string][]string // ComponentName is the key,
 	ComponentNames                 []string
 	AutoMerge                      bool
+	UpdateExistingPr               bool
+	// DeploymentSchedule limits when AutoMerge can merge the promotion PR
+	DeploymentSchedule cfg.DeploymentSchedule
+}
+
+// promotionKey is used to aggregate the PR based on source and target combination
+func promotionKey(sourcePath string, targetPaths []string) string {
+	sortedTargetPaths := append([]string{}, targetPaths...)
+	sort.Strings(sortedTargetPaths)
+	return sourcePath + ">" + strings.Join(sortedTargetPaths, "|")
 }
 
 func containMatchingRegex(patterns []string, str string) bool {
@@ -50,17 +61,18 @@ func contains(s []string, str string) bool {
 	return false
 }
 
-func DetectDrift(ghPrClientDetails GhPrClientDetails) error {
+// DetectDrift comments the differences between the promotion sources and targets of the PR, found in the default branch, and returns whether there are any.
+func DetectDrift(ghPrClientDetails GhPrClientDetails) (bool, error) {
 	ghPrClientDetails.PrLogger.Debugln("Checking for Drift")
 	if ghPrClientDetails.Ctx.Err() != nil {
-		return ghPrClientDetails.Ctx.Err()
+		return false, ghPrClientDetails.Ctx.Err()
 	}
 	diffOutputMap := make(map[string]string)
 	defaultBranch, _ := ghPrClientDetails.GetDefaultBranch()
 	config, err := GetInRepoConfig(ghPrClientDetails, defaultBranch)
 	if err != nil {
 		_ = ghPrClientDetails.CommentOnPr(fmt.Sprintf("Failed to get configuration\n```\n%s\n```\n", err))
-		return err
+		return false, err
 	}
 
 	promotions, _ := GeneratePromotionPlan(ghPrClientDetails, config, ghPrClientDetails.Ref)
@@ -79,33 +91,76 @@ func DetectDrift(ghPrClientDetails GhPrClientDetails) error {
 	if len(diffOutputMap) != 0 {
 		templateOutput, err := executeTemplate("driftMsg", defaultTemplatesFullPath("drift-pr-comment.gotmpl"), diffOutputMap)
 		if err != nil {
-			return err
+			return false, err
 		}
+		publishPhaseCheckRun(ghPrClientDetails, config, driftCheckRun(len(diffOutputMap), templateOutput))
 
-		err = commentPR(ghPrClientDetails, templateOutput)
+		err = postComments(ghPrClientDetails, config, stickyCommentKindDrift, []string{templateOutput})
 		if err != nil {
-			return err
+			return false, err
 		}
 	} else {
 		ghPrClientDetails.PrLogger.Infof("No drift found")
+		publishPhaseCheckRun(ghPrClientDetails, config, driftCheckRun(0, ""))
+		// A sticky drift comment of a previous commit would be stale otherwise
+		err = postComments(ghPrClientDetails, config, stickyCommentKindDrift, nil)
+		if err != nil {
+			return false, err
+		}
 	}
 
-	return nil
+	return len(diffOutputMap) != 0, nil
+}
+
+// PromotionPlanSource provides the promotion planner with the list of files changed in the PR and the content of in-component configuration files.
+// The default implementation uses the GitHub API, LocalPlanSource reads from a local checkout.
+type PromotionPlanSource interface {
+	ChangedFiles() ([]string, error)
+	// ComponentConfigContent returns the content of the in-component configuration file, found is false when the (optional) file doesn't exist.
+	ComponentConfigContent(componentPath string, branch string) (content string, found bool, err error)
+}
+
+type ghPlanSource struct {
+	ghPrClientDetails GhPrClientDetails
+}
+
+func (s ghPlanSource) ChangedFiles() ([]string, error) {
+	prFiles, err := getPrFiles(s.ghPrClientDetails)
+	if err != nil {
+		return nil, err
+	}
+	changedFiles := make([]string, 0, len(prFiles))
+	for _, prFile := range prFiles {
+		changedFiles = append(changedFiles, prFile.Filename)
+	}
+	return changedFiles, nil
+}
+
+func (s ghPlanSource) ComponentConfigContent(componentPath string, branch string) (string, bool, error) {
+	ghPrClientDetails := s.ghPrClientDetails
+	componentConfigFileContentString, err := ghPrClientDetails.repoProvider().GetFileContent(ghPrClientDetails.Ctx, branch, componentPath+"/telefonistka.yaml")
+	if errors.Is(err, ErrNotFound) { // The file is optional
+		return "", false, nil
+	} else if err != nil {
+		ghPrClientDetails.PrLogger.Errorf("could not get file list from GH API: err=%s\n", err)
+		return "", false, err
+	}
+	return componentConfigFileContentString, true, nil
 }
 
 func getComponentConfig(ghPrClientDetails GhPrClientDetails, componentPath string, branch string) (*cfg.ComponentConfig, error) {
+	return getComponentConfigFromSource(ghPrClientDetails, ghPlanSource{ghPrClientDetails}, componentPath, branch)
+}
+
+func getComponentConfigFromSource(ghPrClientDetails GhPrClientDetails, src PromotionPlanSource, componentPath string, branch string) (*cfg.ComponentConfig, error) {
 	componentConfig := &cfg.ComponentConfig{}
-	rGetContentOps := &github.RepositoryContentGetOptions{Ref: branch}
-	componentConfigFileContent, _, resp, err := ghPrClientDetails.GhClientPair.v3Client.Repositories.GetContents(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, componentPath+"/telefonistka.yaml", rGetContentOps)
-	prom.InstrumentGhCall(resp)
-	if (err != nil) && (resp.StatusCode != 404) { // The file is optional
-		ghPrClientDetails.PrLogger.Errorf("could not get file list from GH API: err=%s\nresponse=%v", err, resp)
+	componentConfigFileContentString, found, err := src.ComponentConfigContent(componentPath, branch)
+	if err != nil {
 		return nil, err
-	} else if resp.StatusCode == 404 {
+	} else if !found {
 		ghPrClientDetails.PrLogger.Debugf("No in-component config in %s", componentPath)
 		return &cfg.ComponentConfig{}, nil
 	}
-	componentConfigFileContentString, _ := componentConfigFileContent.GetContent()
 	err = yaml.Unmarshal([]byte(componentConfigFileContentString), componentConfig)
 	if err != nil {
 		ghPrClientDetails.PrLogger.Errorf("Failed to parse configuration: err=%s\n", err) // TODO comment this error to PR
@@ -114,31 +169,28 @@ func getComponentConfig(ghPrClientDetails GhPrClientDetails, componentPath strin
 	return componentConfig, nil
 }
 
+// getPrFiles returns the list of files changed in the PR
+func getPrFiles(ghPrClientDetails GhPrClientDetails) ([]ChangedFile, error) {
+	prFiles, err := ghPrClientDetails.repoProvider().ListPullRequestFiles(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber)
+	if err != nil {
+		ghPrClientDetails.PrLogger.Errorf("could not get file list from GH API: err=%s\n", err)
+		return nil, err
+	}
+	return prFiles, nil
+}
+
 // This function generates a list of "components" that where changed in the PR and are relevant for promotion)
-func generateListOfRelevantComponents(ghPrClientDetails GhPrClientDetails, config *cfg.Config) (relevantComponents map[relevantComponent]struct{}, err error) {
+func generateListOfRelevantComponents(src PromotionPlanSource, config *cfg.Config) (relevantComponents map[relevantComponent]struct{}, err error) {
 	relevantComponents = make(map[relevantComponent]struct{})
 
-	// Get the list of files in the PR, with pagination
-	opts := &github.ListOptions{}
-	prFiles := []*github.CommitFile{}
-
-	for {
-		perPagePrFiles, resp, err := ghPrClientDetails.GhClientPair.v3Client.PullRequests.ListFiles(ghPrClientDetails.Ctx, ghPrClientDetails.Owner, ghPrClientDetails.Repo, ghPrClientDetails.PrNumber, opts)
-		prom.InstrumentGhCall(resp)
-		if err != nil {
-			ghPrClientDetails.PrLogger.Errorf("could not get file list from GH API: err=%s\nstatus code=%v", err, resp.Response.Status)
-			return nil, err
-		}
-		prFiles = append(prFiles, perPagePrFiles...)
-		if resp.NextPage == 0 {
-			break
-		}
-		opts.Page = resp.NextPage
+	changedFiles, err := src.ChangedFiles()
+	if err != nil {
+		return nil, err
 	}
 
-	for _, changedFile := range prFiles {
+	for _, changedFile := range changedFiles {
 		for _, promotionPathConfig := range config.PromotionPaths {
-			if match, _ := regexp.MatchString("^"+promotionPathConfig.SourcePath+".*", *changedFile.Filename); match {
+			if match, _ := regexp.MatchString("^"+promotionPathConfig.SourcePath+".*", changedFile); match {
 				// "components" here are the sub directories of the SourcePath
 				// but with promotionPathConfig.ComponentPathExtraDepth we can grab multiple levels of subdirectories,
 				// to support cases where components are nested deeper(e.g. [SourcePath]/owningTeam/namespace/component1)
@@ -148,10 +200,10 @@ func generateListOfRelevantComponents(ghPrClientDetails GhPrClientDetails, confi
 				}
 				componentPathRegexSubString := strings.Join(componentPathRegexSubSstrings, "/")
 				getComponentRegexString := regexp.MustCompile("^" + promotionPathConfig.SourcePath + "(" + componentPathRegexSubString + ")/.*")
-				componentName := getComponentRegexString.ReplaceAllString(*changedFile.Filename, "${1}")
+				componentName := getComponentRegexString.ReplaceAllString(changedFile, "${1}")
 
 				getSourcePathRegexString := regexp.MustCompile("^(" + promotionPathConfig.SourcePath + ")" + componentName + "/.*")
-				compiledSourcePath := getSourcePathRegexString.ReplaceAllString(*changedFile.Filename, "${1}")
+				compiledSourcePath := getSourcePathRegexString.ReplaceAllString(changedFile, "${1}")
 				relevantComponentsElement := relevantComponent{
 					SourcePath:    compiledSourcePath,
 					ComponentName: componentName,
@@ -179,7 +231,7 @@ func generateListOfChangedComponentPaths(ghPrClientDetails GhPrClientDetails, co
 	}
 
 	// If not we will use in-repo config to generate it, and turns the map with struct keys into a list of strings
-	relevantComponents, err := generateListOfRelevantComponents(ghPrClientDetails, config)
+	relevantComponents, err := generateListOfRelevantComponents(ghPlanSource{ghPrClientDetails}, config)
 	if err != nil {
 		return nil, err
 	}
@@ -190,10 +242,10 @@ func generateListOfChangedComponentPaths(ghPrClientDetails GhPrClientDetails, co
 }
 
 // This function generates a promotion plan based on the list of relevant components that where "touched" and the in-repo telefonitka  configuration
-func generatePlanBasedOnChangeddComponent(ghPrClientDetails GhPrClientDetails, config *cfg.Config, relevantComponents map[relevantComponent]struct{}, configBranch string) (promotions map[string]PromotionInstance, err error) {
+func generatePlanBasedOnChangeddComponent(ghPrClientDetails GhPrClientDetails, src PromotionPlanSource, config *cfg.Config, relevantComponents map[relevantComponent]struct{}, configBranch string) (promotions map[string]PromotionInstance, err error) {
 	promotions = make(map[string]PromotionInstance)
 	for componentToPromote := range relevantComponents {
-		componentConfig, err := getComponentConfig(ghPrClientDetails, componentToPromote.SourcePath+componentToPromote.ComponentName, configBranch)
+		componentConfig, err := getComponentConfigFromSource(ghPrClientDetails, src, componentToPromote.SourcePath+componentToPromote.ComponentName, configBranch)
 		if err != nil {
 			ghPrClientDetails.PrLogger.Errorf("Failed to get in component configuration, err=%s\nskipping %s", err, componentToPromote.SourcePath+componentToPromote.ComponentName)
 		}
@@ -217,7 +269,7 @@ func generatePlanBasedOnChangeddComponent(ghPrClientDetails GhPrClientDetails, c
 				for _, ppr := range configPromotionPath.PromotionPrs {
 					sort.Strings(ppr.TargetPaths)
 
-					mapKey := configPromotionPath.SourcePath + ">" + strings.Join(ppr.TargetPaths, "|") // This key is used to aggregate the PR based on source and target combination
+					mapKey := promotionKey(configPromotionPath.SourcePath, ppr.TargetPaths)
 					if entry, ok := promotions[mapKey]; !ok {
 						ghPrClientDetails.PrLogger.Debugf("Adding key %s", mapKey)
 						if ppr.TargetDescription == "" {
@@ -225,12 +277,15 @@ func generatePlanBasedOnChangeddComponent(ghPrClientDetails GhPrClientDetails, c
 						}
 						promotions[mapKey] = PromotionInstance{
 							Metadata: PromotionInstanceMetaData{
+								Key:                            mapKey,
 								TargetPaths:                    ppr.TargetPaths,
 								TargetDescription:              ppr.TargetDescription,
 								SourcePath:                     componentToPromote.SourcePath,
 								ComponentNames:                 []string{componentToPromote.ComponentName},
 								PerComponentSkippedTargetPaths: map[string][]string{},
 								AutoMerge:                      componentToPromote.AutoMerge,
+								UpdateExistingPr:               configPromotionPath.UpdateExistingPromotionPrs,
+								DeploymentSchedule:             config.DeploymentSchedule(ppr),
 							},
 							ComputedSyncPaths: map[string]string{},
 						}
@@ -266,11 +321,17 @@ func generatePlanBasedOnChangeddComponent(ghPrClientDetails GhPrClientDetails, c
 }
 
 func GeneratePromotionPlan(ghPrClientDetails GhPrClientDetails, config *cfg.Config, configBranch string) (map[string]PromotionInstance, error) {
+	return GeneratePromotionPlanFromSource(ghPrClientDetails, ghPlanSource{ghPrClientDetails}, config, configBranch)
+}
+
+// GeneratePromotionPlanFromSource generates a promotion plan reading the changed files and in-component configuration from src.
+// ghPrClientDetails is only used for the PR labels and logger.
+func GeneratePromotionPlanFromSource(ghPrClientDetails GhPrClientDetails, src PromotionPlanSource, config *cfg.Config, configBranch string) (map[string]PromotionInstance, error) {
 	// TODO refactor tests to use the two functions below instead of this one
-	relevantComponents, err := generateListOfRelevantComponents(ghPrClientDetails, config)
+	relevantComponents, err := generateListOfRelevantComponents(src, config)
 	if err != nil {
 		return nil, err
 	}
-	promotions, err := generatePlanBasedOnChangeddComponent(ghPrClientDetails, config, relevantComponents, configBranch)
+	promotions, err := generatePlanBasedOnChangeddComponent(ghPrClientDetails, src, config, relevantComponents, configBranch)
 	return promotions, err
 }
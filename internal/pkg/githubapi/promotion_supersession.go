@@ -0,0 +1,182 @@
+package githubapi
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// supersededPromotionPr is an open promotion PR whose changes are fully included in a newer promotion
+type supersededPromotionPr struct {
+	number   int
+	metadata prMetadata
+	// updatedInPlace is set for the existing PR that receives the new promotion, it inherits its own history but isn't closed
+	updatedInPlace bool
+}
+
+// findExistingPromotionPr returns the oldest open promotion PR of the same source and targets combination, and its branch.
+// It returns nil if there is no such PR.
+func findExistingPromotionPr(ghPrClientDetails GhPrClientDetails, promotion PromotionInstance, defaultBranch string) (*supersededPromotionPr, string, error) {
+	pulls, err := ghPrClientDetails.repoProvider().ListOpenPullRequests(ghPrClientDetails.Ctx, defaultBranch)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(pulls, func(i, j int) bool { return pulls[i].Number < pulls[j].Number })
+	for _, pull := range pulls {
+		if !slices.Contains(pull.Labels, "promotion") {
+			continue
+		}
+		var metadata prMetadata
+		found, err := metadata.fromPrBody(pull.Body)
+		if err != nil || !found {
+			continue
+		}
+		if metadata.PromotionKey == promotion.Metadata.Key {
+			ghPrClientDetails.PrLogger.Infof("Found existing promotion PR #%d for %s", pull.Number, promotion.Metadata.Key)
+			return &supersededPromotionPr{number: pull.Number, metadata: metadata, updatedInPlace: true}, pull.HeadRef, nil
+		}
+	}
+	return nil, "", nil
+}
+
+// findPromotionBranch returns the open PR of branchName, nil if there is none, and whether branchName exists.
+// Promotion branch names are derived from the merged PR, so they only exist when handling the same event again, like an event queue retry.
+func findPromotionBranch(ghPrClientDetails GhPrClientDetails, branchName string, defaultBranch string) (*PullRequest, bool, error) {
+	pulls, err := ghPrClientDetails.repoProvider().ListOpenPullRequests(ghPrClientDetails.Ctx, defaultBranch)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, pull := range pulls {
+		if strings.TrimPrefix(pull.HeadRef, "refs/heads/") == branchName {
+			ghPrClientDetails.PrLogger.Infof("Found promotion PR #%d of branch %s", pull.Number, branchName)
+			return pull, true, nil
+		}
+	}
+	_, err = ghPrClientDetails.repoProvider().ListDirectory(ghPrClientDetails.Ctx, branchName, "")
+	if errors.Is(err, ErrNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	ghPrClientDetails.PrLogger.Infof("Found promotion branch %s without a PR", branchName)
+	return nil, true, nil
+}
+
+// updatePromotionPr refreshes the title and body(metadata) of a promotion PR that got a new sync commit
+func updatePromotionPr(ghPrClientDetails GhPrClientDetails, number int, title string, body string, assignees []string) (*PullRequest, error) {
+	provider := ghPrClientDetails.repoProvider()
+	err := provider.UpdatePullRequest(ghPrClientDetails.Ctx, number, title, body)
+	if err != nil {
+		return nil, err
+	}
+	err = provider.AddAssignees(ghPrClientDetails.Ctx, number, assignees)
+	if err != nil {
+		ghPrClientDetails.PrLogger.Warnf("Could not set %v as assignees on PR,  err=%s", assignees, err)
+	}
+	return provider.GetPullRequest(ghPrClientDetails.Ctx, number)
+}
+
+// promotionComponentNames returns the promoted components followed by any other component the inherited PRs promoted
+func promotionComponentNames(promotion PromotionInstance, inheritedPrs []supersededPromotionPr) []string {
+	componentNames := append([]string{}, promotion.Metadata.ComponentNames...)
+	for _, inheritedPr := range inheritedPrs {
+		for _, c := range inheritedPr.metadata.ComponentNames {
+			if !slices.Contains(componentNames, c) {
+				componentNames = append(componentNames, c)
+			}
+		}
+	}
+	return componentNames
+}
+
+// findSupersededPromotionPrs returns the open promotion PRs that only promote paths the new promotion also promotes, from the same source paths.
+// The new promotion PR carries the whole source directory, so these older PRs are redundant.
+// PRs that promote additional paths are left alone, closing them would drop those promotions.
+func findSupersededPromotionPrs(ghPrClientDetails GhPrClientDetails, promotion PromotionInstance, defaultBranch string) ([]supersededPromotionPr, error) {
+	pulls, err := ghPrClientDetails.repoProvider().ListOpenPullRequests(ghPrClientDetails.Ctx, defaultBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	var supersededPrs []supersededPromotionPr
+	for _, pull := range pulls {
+		if !slices.Contains(pull.Labels, "promotion") {
+			continue
+		}
+		var metadata prMetadata
+		found, err := metadata.fromPrBody(pull.Body)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Warnf("Failed to parse metadata of promotion PR #%d: err=%v", pull.Number, err)
+			continue
+		}
+		if !found || len(metadata.PromotedPaths) == 0 {
+			continue
+		}
+		superseded := true
+		for _, promotedPath := range metadata.PromotedPaths {
+			// A target synced from another source, or from an unknown one in PRs opened before sources were recorded, isn't covered by the new promotion
+			src, ok := promotion.ComputedSyncPaths[promotedPath]
+			if !ok || src != metadata.PromotedSources[promotedPath] {
+				superseded = false
+				break
+			}
+		}
+		if superseded {
+			ghPrClientDetails.PrLogger.Infof("Promotion PR #%d is superseded by the new promotion of %v", pull.Number, metadata.PromotedPaths)
+			supersededPrs = append(supersededPrs, supersededPromotionPr{number: pull.Number, metadata: metadata})
+		}
+	}
+	return supersededPrs, nil
+}
+
+// supersededPrAuthors returns the original authors of the superseded PRs(and of PRs they superseded) except for originalPrAuthor
+func supersededPrAuthors(originalPrAuthor string, triggeringPrMetadata prMetadata, supersededPrs []supersededPromotionPr) []string {
+	authors := map[string]bool{}
+	for _, a := range triggeringPrMetadata.AdditionalPrAuthors {
+		authors[a] = true
+	}
+	for _, supersededPr := range supersededPrs {
+		authors[supersededPr.metadata.OriginalPrAuthor] = true
+		for _, a := range supersededPr.metadata.AdditionalPrAuthors {
+			authors[a] = true
+		}
+	}
+	delete(authors, originalPrAuthor)
+	delete(authors, "")
+
+	additionalAuthors := make([]string, 0, len(authors))
+	for a := range authors {
+		additionalAuthors = append(additionalAuthors, a)
+	}
+	sort.Strings(additionalAuthors)
+	return additionalAuthors
+}
+
+func closeSupersededPromotionPrs(ghPrClientDetails GhPrClientDetails, supersededPrs []supersededPromotionPr, newPr *PullRequest) {
+	provider := ghPrClientDetails.repoProvider()
+	for _, supersededPr := range supersededPrs {
+		if supersededPr.updatedInPlace {
+			continue
+		}
+		templateData := map[string]interface{}{
+			"newPrNumber": newPr.Number,
+			"newPrURL":    newPr.HTMLURL,
+		}
+		comment, err := executeTemplate("supersededPromotionPr", defaultTemplatesFullPath("superseded-promotion-pr-comment.gotmpl"), templateData)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Failed to generate superseded PR comment: err=%v", err)
+			return
+		}
+		err = provider.CreateComment(ghPrClientDetails.Ctx, supersededPr.number, comment)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Failed to comment on superseded promotion PR #%d: err=%v", supersededPr.number, err)
+		}
+		err = provider.ClosePullRequest(ghPrClientDetails.Ctx, supersededPr.number)
+		if err != nil {
+			ghPrClientDetails.PrLogger.Errorf("Failed to close superseded promotion PR #%d: err=%v", supersededPr.number, err)
+		} else {
+			ghPrClientDetails.PrLogger.Infof("Closed promotion PR #%d, superseded by #%d", supersededPr.number, newPr.Number)
+		}
+	}
+}
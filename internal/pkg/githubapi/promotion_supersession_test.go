@@ -0,0 +1,205 @@
+package githubapi
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func promotionPrBodyWithMetadata(t *testing.T, metadata prMetadata) string {
+	t.Helper()
+	serializedMetadata, err := metadata.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Promotion path(app1):\n\n<!--|Telefonistka data, do not delete|" + serializedMetadata + "|-->"
+}
+
+func TestHandleMergedPrEventSupersedesOlderPromotionPrs(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+`,
+		"env/staging/app1/values.yaml": "replicas: 3\n",
+		"env/staging/app2/values.yaml": "replicas: 3\n",
+		"env/prod/app1/values.yaml":    "replicas: 1\n",
+		"env/prod/app2/values.yaml":    "replicas: 1\n",
+	})
+	repo.AddPullRequest(PullRequest{
+		Number: 2, State: "open", BaseRef: "main", HeadRef: "promotions/1-older-app1", Labels: []string{"promotion"},
+		Body: promotionPrBodyWithMetadata(t, prMetadata{
+			OriginalPrAuthor:          "alice",
+			AdditionalPrAuthors:       []string{"carol"},
+			PromotedPaths:             []string{"env/prod/app1"},
+			PromotedSources:           map[string]string{"env/prod/app1": "env/staging/app1"},
+			PreviousPromotionMetadata: map[int]promotionInstanceMetaData{1: {SourcePath: "env/staging/", TargetPaths: []string{"env/prod/"}}},
+		}),
+	}, nil)
+	repo.AddPullRequest(PullRequest{
+		Number: 3, State: "open", BaseRef: "main", HeadRef: "promotions/1-hotfix-app1", Labels: []string{"promotion"},
+		Body: promotionPrBodyWithMetadata(t, prMetadata{
+			OriginalPrAuthor: "frank",
+			PromotedPaths:    []string{"env/prod/app1"},
+			PromotedSources:  map[string]string{"env/prod/app1": "env/hotfix/app1"},
+		}),
+	}, nil)
+	repo.AddPullRequest(PullRequest{
+		Number: 4, State: "open", BaseRef: "main", HeadRef: "promotions/3-app1-and-app2", Labels: []string{"promotion"},
+		Body: promotionPrBodyWithMetadata(t, prMetadata{
+			OriginalPrAuthor: "dave",
+			PromotedPaths:    []string{"env/prod/app1", "env/prod/app2"},
+		}),
+	}, nil)
+	repo.AddPullRequest(PullRequest{
+		Number: 5, State: "open", BaseRef: "main", HeadRef: "unrelated-change",
+		Body: promotionPrBodyWithMetadata(t, prMetadata{OriginalPrAuthor: "erin", PromotedPaths: []string{"env/prod/app1"}}),
+	}, nil)
+	repo.AddPullRequest(
+		PullRequest{Number: 6, State: "closed", Merged: true, HeadRef: "newer-app1", BaseRef: "main", Author: "bob"},
+		[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+	)
+
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 6,
+		Ref:      "newer-app1",
+		PrAuthor: "bob",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	err := handleMergedPrEvent(ghPrClientDetails, repo)
+	if err != nil {
+		t.Fatalf("handleMergedPrEvent failed: %v", err)
+	}
+
+	pulls := repo.PullRequests()
+	if !assert.Len(t, pulls, 6) {
+		t.FailNow()
+	}
+	newPr := pulls[5]
+	assert.Equal(t, 7, newPr.Number)
+
+	assert.Equal(t, "closed", pulls[0].State, "Promotion PR of a subset of the new promotion paths should be closed")
+	assert.Contains(t, strings.Join(repo.Comments(2), "\n"), "superseded by [#7](https://git.example.com/pulls/7)")
+	assert.Equal(t, "open", pulls[1].State, "Promotion PR of the same paths from another source should stay open")
+	assert.Equal(t, "open", pulls[2].State, "Promotion PR with paths outside of the new promotion should stay open")
+	assert.Equal(t, "open", pulls[3].State, "PRs without the promotion label should stay open")
+
+	assert.Contains(t, newPr.Body, "Supersedes #2")
+	assert.Contains(t, newPr.Body, "#1  `env/staging/`", "Superseded PR promotion history should be carried over")
+	var newPrMetadata prMetadata
+	found, err := newPrMetadata.fromPrBody(newPr.Body)
+	assert.True(t, found)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", newPrMetadata.OriginalPrAuthor)
+	assert.Equal(t, []string{"alice", "carol"}, newPrMetadata.AdditionalPrAuthors)
+	assert.Contains(t, newPrMetadata.PreviousPromotionMetadata, 1)
+	assert.Contains(t, newPrMetadata.PreviousPromotionMetadata, 6)
+	assert.Equal(t, map[string]string{"env/prod/app1": "env/staging/app1"}, newPrMetadata.PromotedSources)
+	assert.Equal(t, []string{"bob", "alice", "carol"}, newPr.Assignees)
+}
+
+func TestHandleMergedPrEventUpdatesExistingPromotionPr(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    updateExistingPromotionPrs: true
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+`,
+		"env/staging/app1/values.yaml": "replicas: 2\n",
+		"env/staging/app2/values.yaml": "replicas: 1\n",
+		"env/prod/app1/values.yaml":    "replicas: 1\n",
+		"env/prod/app2/values.yaml":    "replicas: 1\n",
+	})
+	repo.AddPullRequest(
+		PullRequest{Number: 1, State: "closed", Merged: true, HeadRef: "scale-app1", BaseRef: "main", Author: "alice"},
+		[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+	)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      ctx,
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 1,
+		Ref:      "scale-app1",
+		PrAuthor: "alice",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	if err := handleMergedPrEvent(ghPrClientDetails, repo); err != nil {
+		t.Fatalf("handleMergedPrEvent failed: %v", err)
+	}
+	pulls := repo.PullRequests()
+	if !assert.Len(t, pulls, 2) {
+		t.FailNow()
+	}
+	promotionBranch := pulls[1].HeadRef
+
+	// A second change to the same source path is merged while the promotion PR is still open
+	newValues := "replicas: 2\n"
+	commitSHA, err := repo.CreateCommit(ctx, "main", []TreeEntry{{Path: "env/staging/app2/values.yaml", Mode: "100644", Type: "blob", Content: &newValues}}, "Scale app2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.UpdateBranch(ctx, "main", commitSHA); err != nil {
+		t.Fatal(err)
+	}
+	repo.AddPullRequest(
+		PullRequest{Number: 3, State: "closed", Merged: true, HeadRef: "scale-app2", BaseRef: "main", Author: "bob"},
+		[]ChangedFile{{Filename: "env/staging/app2/values.yaml", Status: "modified"}},
+	)
+	ghPrClientDetails.PrNumber = 3
+	ghPrClientDetails.Ref = "scale-app2"
+	ghPrClientDetails.PrAuthor = "bob"
+	if err := handleMergedPrEvent(ghPrClientDetails, repo); err != nil {
+		t.Fatalf("handleMergedPrEvent failed: %v", err)
+	}
+
+	pulls = repo.PullRequests()
+	assert.Len(t, pulls, 3, "No new promotion PR should be opened")
+	updatedPr := pulls[1]
+	assert.Equal(t, "open", updatedPr.State)
+	assert.Equal(t, promotionBranch, updatedPr.HeadRef)
+	assert.Equal(t, "🚀 Promotion: app2,app1 ➡️  env/prod/", updatedPr.Title)
+	assert.NotContains(t, updatedPr.Body, "Supersedes")
+	assert.ElementsMatch(t, []string{"alice", "bob"}, updatedPr.Assignees)
+
+	promotedFiles, err := repo.BranchFiles(promotionBranch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "replicas: 2\n", promotedFiles["env/prod/app1/values.yaml"])
+	assert.Equal(t, "replicas: 2\n", promotedFiles["env/prod/app2/values.yaml"])
+
+	var updatedPrMetadata prMetadata
+	_, err = updatedPrMetadata.fromPrBody(updatedPr.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", updatedPrMetadata.OriginalPrAuthor)
+	assert.Equal(t, []string{"alice"}, updatedPrMetadata.AdditionalPrAuthors)
+	assert.Equal(t, []string{"env/prod/app1", "env/prod/app2"}, updatedPrMetadata.PromotedPaths)
+	assert.Contains(t, updatedPrMetadata.PreviousPromotionMetadata, 1)
+	assert.Contains(t, updatedPrMetadata.PreviousPromotionMetadata, 3)
+}
@@ -619,6 +619,7 @@ func TestGeneratePromotionMetadataWithDesc(t *testing.T) {
 				"prod/eu-west-1/componentA": "prod/us-east-4/componentA",
 			},
 			Metadata: PromotionInstanceMetaData{
+				Key:                            "prod/us-east-4/>prod/eu-east-1/|prod/eu-west-1/",
 				SourcePath:                     "prod/us-east-4/",
 				TargetDescription:              "foobar2", // This is tested config key
 				TargetPaths:                    []string{"prod/eu-east-1/", "prod/eu-west-1/"},
@@ -676,6 +677,7 @@ func TestGeneratePromotionMetadataWithOutDesc(t *testing.T) {
 				"prod/eu-west-1/componentA": "prod/us-east-4/componentA",
 			},
 			Metadata: PromotionInstanceMetaData{
+				Key:                            "prod/us-east-4/>prod/eu-east-1/|prod/eu-west-1/",
 				SourcePath:                     "prod/us-east-4/",
 				TargetDescription:              "prod/eu-east-1/ prod/eu-west-1/", // This is tested config key
 				TargetPaths:                    []string{"prod/eu-east-1/", "prod/eu-west-1/"},
@@ -0,0 +1,341 @@
+package githubapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+	lru "github.com/hashicorp/golang-lru/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/wayfair-incubator/telefonistka/internal/pkg/eventqueue"
+)
+
+// ReplayOptions selects what the replay command feeds back into the event handling.
+type ReplayOptions struct {
+	Since time.Time
+	Until time.Time
+	// All replays every delivery in the time range, not only the failed ones
+	All bool
+	// DryRun only logs what would be replayed
+	DryRun bool
+}
+
+func (o ReplayOptions) inRange(t time.Time) bool {
+	return !t.Before(o.Since) && !t.After(o.Until)
+}
+
+func deliverySucceeded(d *github.HookDelivery) bool {
+	return d.GetStatusCode() >= 200 && d.GetStatusCode() < 300
+}
+
+// deliveriesToReplay picks a single delivery per event GUID, redeliveries share the GUID of the original delivery.
+// An event is replayed if none of its deliveries succeeded, or always when all is set. The result is ordered oldest first so events are handled in the order GitHub sent them.
+func deliveriesToReplay(deliveries []*github.HookDelivery, all bool) []*github.HookDelivery {
+	latest := map[string]*github.HookDelivery{}
+	succeeded := map[string]bool{}
+	for _, d := range deliveries {
+		guid := d.GetGUID()
+		if deliverySucceeded(d) {
+			succeeded[guid] = true
+		}
+		if l, ok := latest[guid]; !ok || d.GetDeliveredAt().After(l.GetDeliveredAt().Time) {
+			latest[guid] = d
+		}
+	}
+	selected := []*github.HookDelivery{}
+	for guid, d := range latest {
+		if all || !succeeded[guid] {
+			selected = append(selected, d)
+		}
+	}
+	sort.Slice(selected, func(i, j int) bool {
+		return selected[i].GetDeliveredAt().Before(selected[j].GetDeliveredAt().Time)
+	})
+	return selected
+}
+
+// listHookDeliveries lists the GitHub App webhook deliveries of the time range, GitHub returns them newest first.
+func listHookDeliveries(ctx context.Context, client *github.Client, opts ReplayOptions) ([]*github.HookDelivery, error) {
+	deliveries := []*github.HookDelivery{}
+	listOpts := &github.ListCursorOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Apps.ListHookDeliveries(ctx, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("listing webhook deliveries: %w", err)
+		}
+		reachedSince := false
+		for _, d := range page {
+			deliveredAt := d.GetDeliveredAt().Time
+			if deliveredAt.Before(opts.Since) {
+				reachedSince = true
+				continue
+			}
+			if opts.inRange(deliveredAt) {
+				deliveries = append(deliveries, d)
+			}
+		}
+		if reachedSince || resp.Cursor == "" {
+			return deliveries, nil
+		}
+		listOpts.Cursor = resp.Cursor
+	}
+}
+
+// ReplayHookDeliveries finds GitHub App webhook deliveries Telefonistka failed to receive and handles them, like ReciveEventFile does for a single event.
+// Listing deliveries requires the App JWT, so this isn't supported with OAuth token authentication.
+func ReplayHookDeliveries(ctx context.Context, opts ReplayOptions, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair]) error {
+	githubAppId := getEnv("GITHUB_APP_ID", "")
+	if githubAppId == "" {
+		return fmt.Errorf("replaying webhook deliveries requires GitHub App authentication, GITHUB_APP_ID is not set")
+	}
+	githubAppIdint, err := strconv.ParseInt(githubAppId, 10, 64)
+	if err != nil {
+		return fmt.Errorf("GITHUB_APP_ID value could not converted to int64: %w", err)
+	}
+	var githubRestAltURL string
+	if githubHost := getEnv("GITHUB_HOST", ""); githubHost != "" {
+		githubRestAltURL = fmt.Sprintf("https://%s/api/v3", githubHost)
+	}
+	client, err := createGithubAppJWTClient(getCrucialEnv("GITHUB_APP_PRIVATE_KEY_PATH"), githubAppIdint, githubRestAltURL)
+	if err != nil {
+		return err
+	}
+
+	deliveries, err := listHookDeliveries(ctx, client, opts)
+	if err != nil {
+		return err
+	}
+	selected := deliveriesToReplay(deliveries, opts.All)
+	log.Infof("Found %d webhook deliveries between %s and %s, %d events to replay", len(deliveries), opts.Since.Format(time.RFC3339), opts.Until.Format(time.RFC3339), len(selected))
+
+	handler := NewEventHandler(mainGhClientCache, prApproverGhClientCache, nil)
+	failed := 0
+	for _, d := range selected {
+		deliveryLogger := log.WithFields(log.Fields{
+			"delivery_guid": d.GetGUID(),
+			"event_type":    d.GetEvent(),
+			"status_code":   d.GetStatusCode(),
+		})
+		if opts.DryRun {
+			deliveryLogger.Infof("Dry run, would replay %s.%s event delivered at %s", d.GetEvent(), d.GetAction(), d.GetDeliveredAt().Format(time.RFC3339))
+			continue
+		}
+		// The list endpoint doesn't include the payload
+		full, _, err := client.Apps.GetHookDelivery(ctx, d.GetID())
+		if err != nil {
+			deliveryLogger.Errorf("Failed to get webhook delivery: err=%s", err)
+			failed++
+			continue
+		}
+		e := hookDeliveryEvent(full)
+		if len(e.Payload) == 0 {
+			deliveryLogger.Errorf("Webhook delivery has no payload")
+			failed++
+			continue
+		}
+		deliveryLogger.Infof("Replaying %s.%s event delivered at %s", d.GetEvent(), d.GetAction(), d.GetDeliveredAt().Format(time.RFC3339))
+		if err := handler(ctx, e); err != nil {
+			deliveryLogger.Errorf("Replaying webhook delivery failed: err=%s", err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d webhook deliveries failed to replay", failed, len(selected))
+	}
+	return nil
+}
+
+// hookDeliveryEvent rebuilds the received event from a webhook delivery, the same way the webhook endpoint persists it.
+func hookDeliveryEvent(d *github.HookDelivery) eventqueue.Event {
+	headers := http.Header{}
+	for k, v := range d.GetRequest().Headers {
+		headers.Set(k, v)
+	}
+	e := eventqueue.Event{
+		ID:         githubEventSource + "/" + d.GetGUID(),
+		Source:     githubEventSource,
+		Type:       d.GetEvent(),
+		Headers:    headers,
+		ReceivedAt: d.GetDeliveredAt().Time,
+	}
+	e.Payload = []byte(d.GetRequest().GetRawPayload())
+	return e
+}
+
+// listMergedPrs lists the PRs of the repo that were merged in the time range, oldest first.
+// PRs are listed by update time and merging updates a PR, so listing stops at the first PR updated before the range.
+func listMergedPrs(ctx context.Context, client *github.Client, owner string, repo string, opts ReplayOptions) ([]*github.PullRequest, error) {
+	merged := []*github.PullRequest{}
+	listOpts := &github.PullRequestListOptions{State: "closed", Sort: "updated", Direction: "desc", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		prs, resp, err := client.PullRequests.List(ctx, owner, repo, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("listing closed PRs of %s/%s: %w", owner, repo, err)
+		}
+		reachedSince := false
+		for _, pr := range prs {
+			if pr.GetUpdatedAt().Before(opts.Since) {
+				reachedSince = true
+				break
+			}
+			if pr.MergedAt != nil && opts.inRange(pr.GetMergedAt().Time) {
+				merged = append(merged, pr)
+			}
+		}
+		if reachedSince || resp.NextPage == 0 {
+			break
+		}
+		listOpts.Page = resp.NextPage
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].GetMergedAt().Before(merged[j].GetMergedAt().Time) })
+	return merged, nil
+}
+
+// listPromotionPrs lists open and closed promotion PRs created since the start of the range, a promotion PR is always created after the PR that triggered it was merged.
+func listPromotionPrs(ctx context.Context, client *github.Client, owner string, repo string, since time.Time) ([]*github.PullRequest, error) {
+	promotionPrs := []*github.PullRequest{}
+	listOpts := &github.PullRequestListOptions{State: "all", Sort: "created", Direction: "desc", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		prs, resp, err := client.PullRequests.List(ctx, owner, repo, listOpts)
+		if err != nil {
+			return nil, fmt.Errorf("listing PRs of %s/%s: %w", owner, repo, err)
+		}
+		reachedSince := false
+		for _, pr := range prs {
+			if pr.GetCreatedAt().Before(since) {
+				reachedSince = true
+				break
+			}
+			if DoesPrHasLabel(pr.Labels, "promotion") {
+				promotionPrs = append(promotionPrs, pr)
+			}
+		}
+		if reachedSince || resp.NextPage == 0 {
+			return promotionPrs, nil
+		}
+		listOpts.Page = resp.NextPage
+	}
+}
+
+// unpromotedMergedPrs returns the merged PRs no promotion PR was opened for.
+// Promotion PRs record the PRs they promote in their metadata, including the ones they superseded or were updated with.
+func unpromotedMergedPrs(merged []*github.PullRequest, promotionPrs []*github.PullRequest) []*github.PullRequest {
+	promoted := map[int]bool{}
+	for _, pr := range promotionPrs {
+		var metadata prMetadata
+		found, err := metadata.fromPrBody(pr.GetBody())
+		if err != nil {
+			log.Errorf("Failed to parse metadata of promotion PR #%d: err=%s", pr.GetNumber(), err)
+			continue
+		}
+		if !found {
+			continue
+		}
+		for n := range metadata.PreviousPromotionMetadata {
+			promoted[n] = true
+		}
+	}
+	unpromoted := []*github.PullRequest{}
+	for _, pr := range merged {
+		if !promoted[pr.GetNumber()] {
+			unpromoted = append(unpromoted, pr)
+		}
+	}
+	return unpromoted
+}
+
+// ReplayMergedPrs handles the merge of PRs that were merged in the time range but have no promotion PR, like a missed "closed" webhook would have.
+// PRs whose promotion plan is empty are skipped, they were never supposed to be promoted.
+func ReplayMergedPrs(ctx context.Context, owner string, repo string, opts ReplayOptions, mainGhClientCache *lru.Cache[string, GhClientPair], prApproverGhClientCache *lru.Cache[string, GhClientPair]) error {
+	var mainGithubClientPair GhClientPair
+	mainGithubClientPair.GetAndCache(mainGhClientCache, "GITHUB_APP_ID", "GITHUB_APP_PRIVATE_KEY_PATH", "GITHUB_OAUTH_TOKEN", owner, ctx)
+
+	merged, err := listMergedPrs(ctx, mainGithubClientPair.v3Client, owner, repo, opts)
+	if err != nil {
+		return err
+	}
+	promotionPrs, err := listPromotionPrs(ctx, mainGithubClientPair.v3Client, owner, repo, opts.Since)
+	if err != nil {
+		return err
+	}
+	unpromoted := unpromotedMergedPrs(merged, promotionPrs)
+	log.Infof("Found %d PRs merged in %s/%s between %s and %s, %d without a promotion PR", len(merged), owner, repo, opts.Since.Format(time.RFC3339), opts.Until.Format(time.RFC3339), len(unpromoted))
+
+	if len(unpromoted) == 0 {
+		return nil
+	}
+
+	repoDetails := GhPrClientDetails{
+		Ctx:          ctx,
+		GhClientPair: &mainGithubClientPair,
+		Owner:        owner,
+		Repo:         repo,
+		PrLogger:     log.WithFields(log.Fields{"repo": owner + "/" + repo}),
+	}
+	defaultBranch, _ := repoDetails.GetDefaultBranch()
+	config, err := GetInRepoConfig(repoDetails, defaultBranch)
+	if err != nil {
+		return fmt.Errorf("getting configuration of %s/%s: %w", owner, repo, err)
+	}
+
+	failed := 0
+	for _, pr := range unpromoted {
+		prLogger := log.WithFields(log.Fields{
+			"repo":     owner + "/" + repo,
+			"prNumber": pr.GetNumber(),
+		})
+		ghPrClientDetails := GhPrClientDetails{
+			Ctx:          ctx,
+			GhClientPair: &mainGithubClientPair,
+			Owner:        owner,
+			Repo:         repo,
+			RepoURL:      pr.GetBase().GetRepo().GetHTMLURL(),
+			PrNumber:     pr.GetNumber(),
+			Ref:          pr.GetHead().GetRef(),
+			PrAuthor:     pr.GetUser().GetLogin(),
+			PrLogger:     prLogger,
+			PrSHA:        pr.GetHead().GetSHA(),
+		}
+		promotions, err := GeneratePromotionPlan(ghPrClientDetails, config, defaultBranch)
+		if err != nil {
+			prLogger.Errorf("Failed to generate promotion plan: err=%s", err)
+			failed++
+			continue
+		}
+		if len(promotions) == 0 {
+			prLogger.Debugf("PR has nothing to promote")
+			continue
+		}
+		if opts.DryRun {
+			prLogger.Infof("Dry run, would handle the merge of PR #%d merged at %s, %d promotions", pr.GetNumber(), pr.GetMergedAt().Format(time.RFC3339), len(promotions))
+			continue
+		}
+
+		prLogger.Infof("Handling the merge of PR #%d merged at %s", pr.GetNumber(), pr.GetMergedAt().Format(time.RFC3339))
+		// The PR list API doesn't return the merged field, the event is built from what a "closed" webhook of a merged PR carries
+		mergedPr := *pr
+		mergedPr.Merged = github.Bool(true)
+		eventPayload := &github.PullRequestEvent{
+			Action:      github.String("closed"),
+			Number:      pr.Number,
+			PullRequest: &mergedPr,
+			Repo:        pr.GetBase().GetRepo(),
+		}
+		r, err := http.NewRequestWithContext(ctx, http.MethodPost, "", http.NoBody)
+		if err != nil {
+			return err
+		}
+		if err := handleEvent(ctx, eventPayload, mainGhClientCache, prApproverGhClientCache, r, nil); err != nil {
+			prLogger.Errorf("Handling the merge of PR #%d failed: err=%s", pr.GetNumber(), err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d merged PRs failed to replay", failed, len(unpromoted))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package githubapi
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v62/github"
+	"github.com/migueleliasweb/go-github-mock/src/mock"
+	"github.com/stretchr/testify/assert"
+)
+
+func hookDelivery(id int64, guid string, statusCode int, deliveredAt string) *github.HookDelivery {
+	t, _ := time.Parse(time.RFC3339, deliveredAt)
+	return &github.HookDelivery{
+		ID:          github.Int64(id),
+		GUID:        github.String(guid),
+		StatusCode:  github.Int(statusCode),
+		Event:       github.String("pull_request"),
+		DeliveredAt: &github.Timestamp{Time: t},
+	}
+}
+
+func TestDeliveriesToReplay(t *testing.T) {
+	t.Parallel()
+	deliveries := []*github.HookDelivery{
+		hookDelivery(5, "redelivered", 200, "2024-06-04T10:05:00Z"),
+		hookDelivery(4, "failed-twice", 503, "2024-06-04T10:04:00Z"),
+		hookDelivery(3, "ok", 200, "2024-06-04T10:03:00Z"),
+		hookDelivery(2, "failed-twice", 0, "2024-06-04T10:02:00Z"),
+		hookDelivery(1, "redelivered", 502, "2024-06-04T10:01:00Z"),
+		hookDelivery(0, "timed-out", 0, "2024-06-04T10:00:00Z"),
+	}
+	tests := map[string]struct {
+		all         bool
+		expectedIDs []int64
+	}{
+		"Failed events only": {
+			expectedIDs: []int64{0, 4},
+		},
+		"All events": {
+			all:         true,
+			expectedIDs: []int64{0, 3, 4, 5},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			ids := []int64{}
+			for _, d := range deliveriesToReplay(deliveries, tc.all) {
+				ids = append(ids, d.GetID())
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestListHookDeliveriesStopsAtSince(t *testing.T) {
+	t.Parallel()
+	mockedHTTPClient := mock.NewMockedHTTPClient(
+		mock.WithRequestMatch(
+			mock.GetAppHookDeliveries,
+			[]*github.HookDelivery{
+				hookDelivery(3, "after-until", 500, "2024-06-04T12:00:00Z"),
+				hookDelivery(2, "in-range", 500, "2024-06-04T10:00:00Z"),
+				hookDelivery(1, "before-since", 500, "2024-06-04T08:00:00Z"),
+			},
+		),
+	)
+	client := github.NewClient(mockedHTTPClient)
+	opts := ReplayOptions{
+		Since: time.Date(2024, 6, 4, 9, 0, 0, 0, time.UTC),
+		Until: time.Date(2024, 6, 4, 11, 0, 0, 0, time.UTC),
+	}
+	deliveries, err := listHookDeliveries(context.Background(), client, opts)
+	assert.NoError(t, err)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, "in-range", deliveries[0].GetGUID())
+	}
+}
+
+func TestHookDeliveryEvent(t *testing.T) {
+	t.Parallel()
+	payload := json.RawMessage(`{"action":"closed"}`)
+	d := hookDelivery(1, "72d3162e-cc78-11e3-81ab-4c9367dc0958", 502, "2024-06-04T10:00:00Z")
+	d.Request = &github.HookRequest{
+		Headers:    map[string]string{"X-GitHub-Event": "pull_request", "X-GitHub-Delivery": "72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+		RawPayload: &payload,
+	}
+	e := hookDeliveryEvent(d)
+	assert.Equal(t, "github/72d3162e-cc78-11e3-81ab-4c9367dc0958", e.ID)
+	assert.Equal(t, githubEventSource, e.Source)
+	assert.Equal(t, "pull_request", e.Type)
+	assert.Equal(t, []byte(`{"action":"closed"}`), e.Payload)
+	assert.Equal(t, "pull_request", e.Headers.Get("X-GitHub-Event"))
+}
+
+func promotionPrWithMetadata(t *testing.T, number int, promotedPrs ...int) *github.PullRequest {
+	t.Helper()
+	metadata := prMetadata{PreviousPromotionMetadata: map[int]promotionInstanceMetaData{}}
+	for _, n := range promotedPrs {
+		metadata.PreviousPromotionMetadata[n] = promotionInstanceMetaData{SourcePath: "workspace/", TargetPaths: []string{"env/prod/"}}
+	}
+	serialized, err := metadata.serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &github.PullRequest{
+		Number: github.Int(number),
+		Body:   github.String("Promotion of workspace/\n<!--|Telefonistka data, do not delete|" + serialized + "|-->"),
+	}
+}
+
+func TestUnpromotedMergedPrs(t *testing.T) {
+	t.Parallel()
+	merged := []*github.PullRequest{
+		{Number: github.Int(1)},
+		{Number: github.Int(2)},
+		{Number: github.Int(3)},
+		{Number: github.Int(4)},
+	}
+	tests := map[string]struct {
+		promotionPrs    []*github.PullRequest
+		expectedNumbers []int
+	}{
+		"No promotion PRs": {
+			promotionPrs:    []*github.PullRequest{},
+			expectedNumbers: []int{1, 2, 3, 4},
+		},
+		"Promotion PR history includes superseded promotions": {
+			promotionPrs: []*github.PullRequest{
+				promotionPrWithMetadata(t, 10, 1),
+				promotionPrWithMetadata(t, 11, 2, 3),
+			},
+			expectedNumbers: []int{4},
+		},
+		"PR without metadata is ignored": {
+			promotionPrs: []*github.PullRequest{
+				{Number: github.Int(12), Body: github.String("Manually opened")},
+				promotionPrWithMetadata(t, 13, 4),
+			},
+			expectedNumbers: []int{1, 2, 3},
+		},
+	}
+	for name, tc := range tests {
+		tc := tc // capture range variable
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			numbers := []int{}
+			for _, pr := range unpromotedMergedPrs(merged, tc.promotionPrs) {
+				numbers = append(numbers, pr.GetNumber())
+			}
+			assert.Equal(t, tc.expectedNumbers, numbers)
+		})
+	}
+}
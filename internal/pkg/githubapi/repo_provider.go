@@ -0,0 +1,163 @@
+package githubapi
+
+import (
+	"context"
+	"crypto/sha1" //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNotFound is returned (wrapped) by RepoProvider implementations when the requested file, directory, branch or PR doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// RepoProvider abstracts the Git hosting API calls Telefonistka makes against a single repo.
+// The GitHub implementation wraps go-github, InMemoryRepoProvider allows exercising whole event flows in unit tests.
+type RepoProvider interface {
+	GetDefaultBranch(ctx context.Context) (string, error)
+
+	// GetFileContent returns the content of filePath at ref(branch name or commit SHA).
+	GetFileContent(ctx context.Context, ref string, filePath string) (string, error)
+	// ListDirectory returns the direct children of dirPath at ref, this is also how directory git object SHAs are discovered.
+	ListDirectory(ctx context.Context, ref string, dirPath string) ([]RepoContent, error)
+
+	// CreateCommit applies treeEntries on top of baseBranch HEAD and returns the new commit SHA, baseBranch itself is not updated.
+	CreateCommit(ctx context.Context, baseBranch string, treeEntries []TreeEntry, commitMsg string) (string, error)
+	// CreateBranch creates a new branch pointing to commitSHA, branchName shouldn't include the "refs/heads/" prefix.
+	CreateBranch(ctx context.Context, branchName string, commitSHA string) error
+	// UpdateBranch fast-forwards branchName to commitSHA, a commit CreateCommit created on top of that same branch.
+	UpdateBranch(ctx context.Context, branchName string, commitSHA string) error
+
+	GetPullRequest(ctx context.Context, number int) (*PullRequest, error)
+	// ListOpenPullRequests returns all the open PRs targeting baseBranch
+	ListOpenPullRequests(ctx context.Context, baseBranch string) ([]*PullRequest, error)
+	ListPullRequestFiles(ctx context.Context, number int) ([]ChangedFile, error)
+	CreatePullRequest(ctx context.Context, newPr NewPullRequest) (*PullRequest, error)
+	MergePullRequest(ctx context.Context, number int, commitMsg string) error
+	ClosePullRequest(ctx context.Context, number int) error
+	UpdatePullRequest(ctx context.Context, number int, title string, body string) error
+	ApprovePullRequest(ctx context.Context, number int) error
+	AddAssignees(ctx context.Context, number int, assignees []string) error
+
+	CreateComment(ctx context.Context, number int, body string) error
+
+	AddLabels(ctx context.Context, number int, labels []string) error
+	// RemoveLabel removes label from the PR, removing a label the PR doesn't have isn't an error
+	RemoveLabel(ctx context.Context, number int, label string) error
+
+	ListCommitStatuses(ctx context.Context, ref string) ([]CommitStatus, error)
+	CreateCommitStatus(ctx context.Context, sha string, status CommitStatus) error
+}
+
+// CheckRunCreator is implemented by providers that support GitHub style check runs, check runs are skipped on the others.
+type CheckRunCreator interface {
+	CreateCheckRun(ctx context.Context, checkRun CheckRun) error
+}
+
+// CommentEditor is implemented by providers that can list and edit PR comments, sticky comments are posted as new comments on the others.
+type CommentEditor interface {
+	// ListComments returns all the comments of the PR, oldest first
+	ListComments(ctx context.Context, number int) ([]Comment, error)
+	EditComment(ctx context.Context, commentID int64, body string) error
+}
+
+// RepoContent is a single directory listing element.
+type RepoContent struct {
+	Path string
+	// Type is either "file" or "dir", other types(symlinks, submodules) are ignored by Telefonistka
+	Type string
+	SHA  string
+}
+
+// TreeEntry describes a single change in a commit, modeled after the GitHub Git Tree API.
+// A "tree" entry with SHA sets the directory at Path to an existing directory object,
+// a "blob" entry sets the file at Path to SHA or Content and a "blob" entry with neither deletes the file.
+type TreeEntry struct {
+	Path    string
+	Mode    string
+	Type    string
+	SHA     *string
+	Content *string
+}
+
+type PullRequest struct {
+	Number    int
+	HTMLURL   string
+	Title     string
+	Body      string
+	State     string
+	Merged    bool
+	HeadRef   string
+	HeadSHA   string
+	BaseRef   string
+	Author    string
+	Labels    []string
+	Assignees []string
+}
+
+type NewPullRequest struct {
+	Title string
+	Body  string
+	Base  string
+	Head  string
+}
+
+type ChangedFile struct {
+	Filename string
+	// Status follows the GitHub values: "added", "modified", "removed" or "renamed"
+	Status string
+}
+
+type Comment struct {
+	ID     int64
+	Body   string
+	Author string
+}
+
+type CommitStatus struct {
+	State       string
+	Context     string
+	Description string
+	TargetURL   string
+	AvatarURL   string
+}
+
+// CheckRun is a completed check run, Summary and Text are markdown.
+type CheckRun struct {
+	Name    string
+	HeadSHA string
+	// Conclusion follows the GitHub values: "success", "failure", "neutral"...
+	Conclusion  string
+	Title       string
+	Summary     string
+	Text        string
+	Annotations []CheckRunAnnotation
+}
+
+// CheckRunAnnotation points at a line of a file in the check run head commit.
+type CheckRunAnnotation struct {
+	Path string
+	Line int
+	// Level is one of "notice", "warning" or "failure"
+	Level   string
+	Title   string
+	Message string
+}
+
+// repoProvider returns the injected RepoProvider, defaulting to GitHub when only a client pair was set.
+func (p GhPrClientDetails) repoProvider() RepoProvider {
+	if p.Provider != nil {
+		return p.Provider
+	}
+	return newGithubProvider(p.GhClientPair, p.Owner, p.Repo)
+}
+
+// pendingCommitSHA returns a placeholder SHA for providers that can only create a commit together with its branch(GitLab, Gitea),
+// their CreateCommit stages the changes under this SHA and the following CreateBranch call creates the actual commit.
+func pendingCommitSHA(baseBranch string, commitMsg string, changes interface{}) string {
+	hasher := sha1.New() //nolint:gosec // G505: Blocklisted import crypto/sha1: weak cryptographic primitive (gosec), this is not a cryptographic use case
+	changesJSON, _ := json.Marshal(changes)
+	fmt.Fprintf(hasher, "%s\n%s\n%s", baseBranch, commitMsg, changesJSON)
+	return "pending-commit-" + hex.EncodeToString(hasher.Sum(nil))
+}
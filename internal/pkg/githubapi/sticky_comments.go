@@ -0,0 +1,206 @@
+package githubapi
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+// Sticky comment kinds, each kind has its own comment(and overflow parts) on the PR
+const (
+	stickyCommentKindArgoCdDiff = "argocd-diff"
+	stickyCommentKindDrift      = "drift"
+)
+
+const (
+	commentTag = "<!-- telefonistka_tag -->"
+	// stickyRevisionsStart, stickyRevisionsEnd and stickyRevisionSeparator delimit the previous revisions so the next update can carry them over
+	stickyRevisionsStart    = "<!-- telefonistka-sticky-revisions -->"
+	stickyRevisionsEnd      = "<!-- telefonistka-sticky-revisions-end -->"
+	stickyRevisionSeparator = "<!-- telefonistka-sticky-revision -->"
+	// stickyCommentMaxOverhead is reserved for the comment tag and markers when splitting content into sticky comment parts
+	stickyCommentMaxOverhead = 256
+)
+
+// stickyCommentMarkerRegex matches the hidden marker identifying a sticky comment part and the commit its content was generated for
+var stickyCommentMarkerRegex = regexp.MustCompile(`<!-- telefonistka-sticky-comment kind=(\S+) part=(\d+) sha=(\S*) -->`)
+
+var htmlCommentRegex = regexp.MustCompile(`(?s)<!--.*?-->`)
+
+// stickyComment is an existing sticky comment part, parsed from its body
+type stickyComment struct {
+	id        int64
+	body      string
+	part      int
+	sha       string
+	content   string
+	revisions []string
+}
+
+func stickyCommentMarker(kind string, part int, sha string) string {
+	return fmt.Sprintf("<!-- telefonistka-sticky-comment kind=%s part=%d sha=%s -->", kind, part, sha)
+}
+
+func isStickyComment(body string) bool {
+	return stickyCommentMarkerRegex.MatchString(body)
+}
+
+// parseStickyComment returns nil for comments that aren't a part of a kind sticky comment
+func parseStickyComment(kind string, comment Comment) *stickyComment {
+	match := stickyCommentMarkerRegex.FindStringSubmatchIndex(comment.Body)
+	if match == nil || comment.Body[match[2]:match[3]] != kind {
+		return nil
+	}
+	part, err := strconv.Atoi(comment.Body[match[4]:match[5]])
+	if err != nil {
+		return nil
+	}
+	sc := &stickyComment{id: comment.ID, body: comment.Body, part: part, sha: comment.Body[match[6]:match[7]]}
+	content := strings.TrimPrefix(comment.Body[match[1]:], "\n")
+	content, revisions, found := strings.Cut(content, stickyRevisionsStart)
+	sc.content = strings.TrimSuffix(content, "\n")
+	if found {
+		revisions, _, _ = strings.Cut(revisions, stickyRevisionsEnd)
+		// The first element is the header of the "previous revisions" section
+		for _, revision := range strings.Split(revisions, stickyRevisionSeparator)[1:] {
+			sc.revisions = append(sc.revisions, strings.TrimSpace(revision))
+		}
+	}
+	return sc
+}
+
+// stickyCommentBody renders a sticky comment part, the oldest revisions are dropped when the comment doesn't fit maxSize
+func stickyCommentBody(kind string, part int, sha string, content string, revisions []string, maxSize int) string {
+	for {
+		var b strings.Builder
+		b.WriteString(commentTag + "\n")
+		b.WriteString(stickyCommentMarker(kind, part, sha) + "\n")
+		b.WriteString(content + "\n")
+		if len(revisions) > 0 {
+			b.WriteString(stickyRevisionsStart + "\n")
+			fmt.Fprintf(&b, "<details><summary>Previous revisions(%d)</summary>\n\n", len(revisions))
+			for _, revision := range revisions {
+				b.WriteString(stickyRevisionSeparator + "\n" + revision + "\n")
+			}
+			b.WriteString(stickyRevisionsEnd + "\n\n</details>\n")
+		}
+		if b.Len() <= maxSize || len(revisions) == 0 {
+			return b.String()
+		}
+		revisions = revisions[:len(revisions)-1]
+	}
+}
+
+// stickyRevision wraps the content a sticky comment part had for commit sha.
+// Hidden markers are removed from the content, a revision checkbox shouldn't be mistaken for the current one, like the ArgoCD branch sync checkbox.
+func stickyRevision(sha string, content string) string {
+	return fmt.Sprintf("<details><summary>Commit %s</summary>\n\n%s\n\n</details>", shortSHA(sha), htmlCommentRegex.ReplaceAllString(content, ""))
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// stickyCommentsAuthor returns the login of the GitHub identity Telefonistka comments as, empty when it's unknown and comments of any author are considered
+func stickyCommentsAuthor(ghPrClientDetails GhPrClientDetails) string {
+	if ghPrClientDetails.GhClientPair == nil || ghPrClientDetails.GhClientPair.v4Client == nil {
+		return ""
+	}
+	botIdentity, err := GetBotGhIdentity(ghPrClientDetails.GhClientPair.v4Client, ghPrClientDetails.Ctx)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(botIdentity, "[bot]")
+}
+
+// postComments posts comments as the kind sticky comment when sticky comments are enabled, as new PR comments otherwise
+func postComments(ghPrClientDetails GhPrClientDetails, config *cfg.Config, kind string, comments []string) error {
+	if config.Comments.Sticky {
+		return updateStickyComment(ghPrClientDetails, config, kind, comments)
+	}
+	for _, comment := range comments {
+		if err := commentPR(ghPrClientDetails, comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateStickyComment posts parts as the kind sticky comment of the PR: existing parts are edited in place, their previous content kept as a revision, and missing parts are created.
+// Existing parts beyond the new ones, or all of them when there are no parts, are edited to say there is nothing to report for the current commit.
+// Providers that can't edit comments get new comments, like when sticky comments are disabled.
+func updateStickyComment(ghPrClientDetails GhPrClientDetails, config *cfg.Config, kind string, parts []string) error {
+	commentEditor, ok := ghPrClientDetails.repoProvider().(CommentEditor)
+	if !ok {
+		for _, part := range parts {
+			if err := commentPR(ghPrClientDetails, part); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	comments, err := commentEditor.ListComments(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber)
+	if err != nil {
+		return fmt.Errorf("listing PR comments: %w", err)
+	}
+	author := stickyCommentsAuthor(ghPrClientDetails)
+	existingParts := map[int]*stickyComment{}
+	for _, comment := range comments {
+		if author != "" && strings.TrimSuffix(comment.Author, "[bot]") != author {
+			continue
+		}
+		sc := parseStickyComment(kind, comment)
+		// Parts are looked up in creation order, the oldest comment of a part is the sticky one
+		if sc != nil && existingParts[sc.part] == nil {
+			existingParts[sc.part] = sc
+		}
+	}
+
+	maxRevisions := config.Comments.MaxRevisions
+	if maxRevisions == 0 {
+		maxRevisions = cfg.DefaultStickyCommentMaxRevisions
+	}
+	sha := ghPrClientDetails.PrSHA
+	for part := 1; part <= len(parts) || existingParts[part] != nil; part++ {
+		existing := existingParts[part]
+		var content string
+		switch {
+		case part <= len(parts):
+			content = parts[part-1]
+		case part == 1:
+			content = "Nothing to report for the latest commit."
+		default:
+			content = "This part isn't needed for the latest commit."
+		}
+		if existing == nil {
+			body := stickyCommentBody(kind, part, sha, content, nil, githubCommentMaxSize)
+			if err := ghPrClientDetails.repoProvider().CreateComment(ghPrClientDetails.Ctx, ghPrClientDetails.PrNumber, body); err != nil {
+				return fmt.Errorf("creating sticky comment %s part %d: %w", kind, part, err)
+			}
+			continue
+		}
+		revisions := existing.revisions
+		if existing.content != content {
+			revisions = append([]string{stickyRevision(existing.sha, existing.content)}, revisions...)
+		}
+		if len(revisions) > maxRevisions {
+			revisions = revisions[:maxRevisions]
+		}
+		body := stickyCommentBody(kind, part, sha, content, revisions, githubCommentMaxSize)
+		if body == existing.body {
+			continue
+		}
+		ghPrClientDetails.PrLogger.Infof("Updating sticky comment %s part %d(comment ID %d)", kind, part, existing.id)
+		if err := commentEditor.EditComment(ghPrClientDetails.Ctx, existing.id, body); err != nil {
+			return fmt.Errorf("editing sticky comment %s part %d: %w", kind, part, err)
+		}
+	}
+	return nil
+}
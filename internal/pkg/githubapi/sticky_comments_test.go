@@ -0,0 +1,169 @@
+package githubapi
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	cfg "github.com/wayfair-incubator/telefonistka/internal/pkg/configuration"
+)
+
+func TestParseStickyComment(t *testing.T) {
+	t.Parallel()
+	revisions := []string{stickyRevision("bbbbbbbbbb", "old content"), stickyRevision("cccccccccc", "older content")}
+	body := stickyCommentBody(stickyCommentKindArgoCdDiff, 2, "aaaaaaaaaa", "current\ncontent", revisions, githubCommentMaxSize)
+
+	sc := parseStickyComment(stickyCommentKindArgoCdDiff, Comment{ID: 42, Body: body})
+	if assert.NotNil(t, sc) {
+		assert.Equal(t, int64(42), sc.id)
+		assert.Equal(t, 2, sc.part)
+		assert.Equal(t, "aaaaaaaaaa", sc.sha)
+		assert.Equal(t, "current\ncontent", sc.content)
+		assert.Equal(t, revisions, sc.revisions)
+	}
+	assert.Contains(t, body, "<details><summary>Previous revisions(2)</summary>")
+	assert.Contains(t, body, "<details><summary>Commit bbbbbbb</summary>\n\nold content\n\n</details>")
+
+	assert.Nil(t, parseStickyComment(stickyCommentKindDrift, Comment{ID: 42, Body: body}), "Other kinds shouldn't match")
+	assert.Nil(t, parseStickyComment(stickyCommentKindArgoCdDiff, Comment{ID: 43, Body: commentTag + "\nNot sticky"}))
+}
+
+func TestStickyCommentBodyDropsOldestRevisions(t *testing.T) {
+	t.Parallel()
+	revisions := []string{
+		stickyRevision("bbbbbbbbbb", strings.Repeat("b", 100)),
+		stickyRevision("cccccccccc", strings.Repeat("c", 100)),
+	}
+	body := stickyCommentBody(stickyCommentKindArgoCdDiff, 1, "aaaaaaaaaa", "current", revisions, 500)
+	assert.LessOrEqual(t, len(body), 500)
+	assert.Contains(t, body, "Commit bbbbbbb")
+	assert.NotContains(t, body, "Commit ccccccc")
+
+	// The current content is never dropped
+	body = stickyCommentBody(stickyCommentKindArgoCdDiff, 1, "aaaaaaaaaa", strings.Repeat("a", 600), revisions, 500)
+	assert.Contains(t, body, strings.Repeat("a", 600))
+	assert.NotContains(t, body, "Previous revisions")
+}
+
+func TestStickyRevisionDisablesCheckboxes(t *testing.T) {
+	t.Parallel()
+	revision := stickyRevision("aaaaaaaaaa", "- [x] <!-- telefonistka-argocd-branch-sync --> Set ArgoCD apps Target Revision")
+	wasChecked, isChecked := analyzeCommentUpdateCheckBox(revision, "", "telefonistka-argocd-branch-sync")
+	assert.False(t, wasChecked)
+	assert.False(t, isChecked)
+}
+
+func TestUpdateStickyComment(t *testing.T) {
+	t.Parallel()
+	repo := NewInMemoryRepoProvider("main", map[string]string{})
+	repo.AddPullRequest(PullRequest{Number: 1, State: "open", HeadRef: "feature-branch", BaseRef: "main"}, nil)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		PrNumber: 1,
+		PrSHA:    "1111111111",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+	config := &cfg.Config{Comments: cfg.CommentsConfig{Sticky: true, MaxRevisions: 2}}
+	update := func(sha string, parts ...string) {
+		t.Helper()
+		ghPrClientDetails.PrSHA = sha
+		if err := updateStickyComment(ghPrClientDetails, config, stickyCommentKindArgoCdDiff, parts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ghPrClientDetails.CommentOnPr("Unrelated comment"); err != nil {
+		t.Fatal(err)
+	}
+
+	update("1111111111", "diff 1, part 1", "diff 1, part 2")
+	comments := repo.Comments(1)
+	if assert.Len(t, comments, 3) {
+		assert.Contains(t, comments[1], "diff 1, part 1")
+		assert.Contains(t, comments[2], "diff 1, part 2")
+	}
+
+	// Parts are edited in place, the extra part is kept but emptied
+	update("2222222222", "diff 2")
+	comments = repo.Comments(1)
+	if assert.Len(t, comments, 3) {
+		assert.Equal(t, commentTag+"\nUnrelated comment", comments[0])
+		current, revisions, _ := strings.Cut(comments[1], stickyRevisionsStart)
+		assert.Contains(t, current, "diff 2")
+		assert.Contains(t, revisions, "<details><summary>Commit 1111111</summary>\n\ndiff 1, part 1\n\n</details>")
+		assert.Contains(t, comments[2], "This part isn't needed for the latest commit.")
+		assert.Contains(t, comments[2], "diff 1, part 2")
+	}
+
+	// An unchanged content doesn't add a revision
+	update("3333333333", "diff 2")
+	sc := parseStickyComment(stickyCommentKindArgoCdDiff, Comment{Body: repo.Comments(1)[1]})
+	if assert.NotNil(t, sc) {
+		assert.Equal(t, "3333333333", sc.sha)
+		assert.Len(t, sc.revisions, 1)
+	}
+
+	// No parts means nothing to report, only MaxRevisions revisions are kept
+	update("4444444444")
+	comments = repo.Comments(1)
+	if assert.Len(t, comments, 3) {
+		sc := parseStickyComment(stickyCommentKindArgoCdDiff, Comment{Body: comments[1]})
+		if assert.NotNil(t, sc) {
+			assert.Equal(t, "Nothing to report for the latest commit.", sc.content)
+			assert.Len(t, sc.revisions, 2)
+			assert.Contains(t, sc.revisions[0], "Commit 3333333")
+			assert.Contains(t, sc.revisions[1], "Commit 1111111")
+		}
+	}
+}
+
+func TestDetectDriftStickyComment(t *testing.T) {
+	t.Parallel()
+	if err := os.Setenv("TEMPLATES_PATH", "../../../templates/"); err != nil { //nolint:tenv
+		t.Fatal(err)
+	}
+	repo := NewInMemoryRepoProvider("main", map[string]string{
+		"telefonistka.yaml": `
+promotionPaths:
+  - sourcePath: "env/staging/"
+    promotionPrs:
+      - targetPaths:
+          - "env/prod/"
+comments:
+  sticky: true
+`,
+		"env/staging/app1/values.yaml": "replicas: 2\n",
+		"env/prod/app1/values.yaml":    "replicas: 1\n",
+	})
+	repo.AddPullRequest(
+		PullRequest{Number: 1, State: "open", HeadRef: "feature-branch", BaseRef: "main"},
+		[]ChangedFile{{Filename: "env/staging/app1/values.yaml", Status: "modified"}},
+	)
+	ghPrClientDetails := GhPrClientDetails{
+		Ctx:      context.Background(),
+		Provider: repo,
+		Owner:    "AnOwner",
+		Repo:     "Arepo",
+		PrNumber: 1,
+		Ref:      "feature-branch",
+		PrSHA:    "1111111111",
+		PrLogger: log.WithFields(log.Fields{}),
+	}
+
+	for _, sha := range []string{"1111111111", "2222222222"} {
+		ghPrClientDetails.PrSHA = sha
+		hasDrift, err := DetectDrift(ghPrClientDetails)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, hasDrift)
+	}
+	comments := repo.Comments(1)
+	if assert.Len(t, comments, 1, "The drift comment should be edited, not posted again") {
+		assert.Contains(t, comments[0], "kind=drift part=1 sha=2222222222")
+		assert.Contains(t, comments[0], "-replicas: 2")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/google/go-github/v62/github"
+	lru "github.com/hashicorp/golang-lru/v2"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -16,6 +17,25 @@ type PrCounters struct {
 	PrWithStaleChecks int
 }
 
+// DiffCounters are the changes found by the ArgoCD diffs of a PR
+type DiffCounters struct {
+	ObjectChanges []DiffObjectChanges
+	LinesAdded    int
+	LinesRemoved  int
+	// NotableChanges counts the diffed apps by notable change (image/replicas/resource_requests)
+	NotableChanges map[string]int
+}
+
+// DiffObjectChanges counts the changed objects of a kind by change type (added/removed/modified)
+type DiffObjectChanges struct {
+	Kind       string
+	ChangeType string
+	Count      int
+}
+
+// diffedCommits remembers the recently counted PR head commits(repo_slug@sha), bounded as it's only needed while a commit is being re-evaluated
+var diffedCommits, _ = lru.New[string, struct{}](4096)
+
 var (
 	webhookHitsVec = promauto.NewCounterVec(prometheus.CounterOpts{
 		Name:      "webhook_hits_total",
@@ -79,6 +99,69 @@ var (
 		Namespace: "telefonistka",
 		Subsystem: "webhook_proxy",
 	}, []string{"status", "method", "url"})
+
+	eventQueueEventsVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "events_total",
+		Help:      "The total number of queued webhook events by outcome (enqueued/duplicate/handled/superseded/retried/dead_lettered)",
+		Namespace: "telefonistka",
+		Subsystem: "event_queue",
+	}, []string{"result"})
+
+	eventQueueDepthGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "events",
+		Help:      "The number of webhook events in the queue, pending or dead-lettered",
+		Namespace: "telefonistka",
+		Subsystem: "event_queue",
+	}, []string{"state"})
+
+	argoCdDiffsVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "diffs_total",
+		Help:      "The total number of PR head commits diffed against ArgoCD",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_diff",
+	}, []string{"repo_slug"})
+
+	argoCdDiffObjectsVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "changed_objects_total",
+		Help:      "The total number of objects changed by PRs ArgoCD diffs by kind and change type (added/removed/modified)",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_diff",
+	}, []string{"repo_slug", "kind", "change_type"})
+
+	argoCdDiffLinesVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "changed_lines_total",
+		Help:      "The total number of lines changed by PRs ArgoCD diffs by direction (added/removed)",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_diff",
+	}, []string{"repo_slug", "direction"})
+
+	argoCdDiffNotableChangesVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "notable_changes_total",
+		Help:      "The total number of PRs ArgoCD app diffs with a notable change (image/replicas/resource_requests)",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_diff",
+	}, []string{"repo_slug", "change"})
+
+	argoCdClientConnectionsVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "connections_total",
+		Help:      "The total number of ArgoCD API connection attempts of the shared client managers by instance, reason (initial/token_rotated/unauthenticated/unavailable) and result (success/failure)",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_client",
+	}, []string{"instance", "reason", "result"})
+
+	argoCdClientHealthChecksVec = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name:      "health_checks_total",
+		Help:      "The total number of ArgoCD API health checks by instance and result (healthy/unhealthy)",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_client",
+	}, []string{"instance", "result"})
+
+	argoCdClientUpGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name:      "up",
+		Help:      "Whether the last ArgoCD API health check of the instance succeeded",
+		Namespace: "telefonistka",
+		Subsystem: "argocd_client",
+	}, []string{"instance"})
 )
 
 func IncCommitStatusUpdateCounter(repoSlug string, status string) {
@@ -97,11 +180,63 @@ func PublishPrMetrics(pc PrCounters, repoSlug string) {
 	ghOpenPrsWithPendingCheckGauge.With(metricLables).Set(float64(pc.PrWithStaleChecks))
 }
 
+// PublishDiffMetrics counts the changes of a PR head commit diff, a commit is only counted once so re-evaluating a PR(labels, retries) doesn't count its changes again
+func PublishDiffMetrics(dc DiffCounters, repoSlug string, headSHA string) {
+	if headSHA != "" {
+		if seen, _ := diffedCommits.ContainsOrAdd(repoSlug+"@"+headSHA, struct{}{}); seen {
+			return
+		}
+	}
+	argoCdDiffsVec.With(prometheus.Labels{"repo_slug": repoSlug}).Inc()
+	for _, objectChanges := range dc.ObjectChanges {
+		argoCdDiffObjectsVec.With(prometheus.Labels{
+			"repo_slug":   repoSlug,
+			"kind":        objectChanges.Kind,
+			"change_type": objectChanges.ChangeType,
+		}).Add(float64(objectChanges.Count))
+	}
+	argoCdDiffLinesVec.With(prometheus.Labels{"repo_slug": repoSlug, "direction": "added"}).Add(float64(dc.LinesAdded))
+	argoCdDiffLinesVec.With(prometheus.Labels{"repo_slug": repoSlug, "direction": "removed"}).Add(float64(dc.LinesRemoved))
+	for change, count := range dc.NotableChanges {
+		argoCdDiffNotableChangesVec.With(prometheus.Labels{"repo_slug": repoSlug, "change": change}).Add(float64(count))
+	}
+}
+
 // This function instrument Webhook hits and parsing of their content
 func InstrumentWebhookHit(parsing_status string) {
 	webhookHitsVec.With(prometheus.Labels{"parsing": parsing_status}).Inc()
 }
 
+// This function instrument the outcome of queued webhook events
+func InstrumentQueuedEvent(result string) {
+	eventQueueEventsVec.With(prometheus.Labels{"result": result}).Inc()
+}
+
+func PublishEventQueueDepth(pending int, dead int) {
+	eventQueueDepthGauge.With(prometheus.Labels{"state": "pending"}).Set(float64(pending))
+	eventQueueDepthGauge.With(prometheus.Labels{"state": "dead"}).Set(float64(dead))
+}
+
+// This function instrument ArgoCD API (re)connections of the shared client manager
+func InstrumentArgoCdConnect(instance string, reason string, success bool) {
+	result := "success"
+	if !success {
+		result = "failure"
+	}
+	argoCdClientConnectionsVec.With(prometheus.Labels{"instance": instance, "reason": reason, "result": result}).Inc()
+}
+
+// This function instrument ArgoCD API health checks, instance is empty for the default instance
+func InstrumentArgoCdHealthCheck(instance string, healthy bool) {
+	if healthy {
+		argoCdClientHealthChecksVec.With(prometheus.Labels{"instance": instance, "result": "healthy"}).Inc()
+		argoCdClientUpGauge.With(prometheus.Labels{"instance": instance}).Set(1)
+		return
+	}
+	argoCdClientHealthChecksVec.With(prometheus.Labels{"instance": instance, "result": "unhealthy"}).Inc()
+	argoCdClientUpGauge.With(prometheus.Labels{"instance": instance}).Set(0)
+}
+
 // This function instrument API calls to GitHub API
 func InstrumentGhCall(resp *github.Response) prometheus.Labels {
 	if resp == nil {
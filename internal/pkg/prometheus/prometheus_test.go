@@ -8,6 +8,8 @@ import (
 	"github.com/go-test/deep"
 	"github.com/google/go-github/v62/github"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestUserGetUrl(t *testing.T) {
@@ -132,3 +134,33 @@ func instrumentGhCallTestHelper(t *testing.T, httpURL string, expectedLabels pro
 		t.Error(diff)
 	}
 }
+
+func TestPublishDiffMetrics(t *testing.T) {
+	t.Parallel()
+	repoSlug := "AnOwner/diff-metrics-repo"
+	dc := DiffCounters{
+		ObjectChanges: []DiffObjectChanges{
+			{Kind: "Deployment", ChangeType: "modified", Count: 2},
+			{Kind: "ConfigMap", ChangeType: "added", Count: 1},
+		},
+		LinesAdded:     10,
+		LinesRemoved:   4,
+		NotableChanges: map[string]int{"image": 1},
+	}
+	PublishDiffMetrics(dc, repoSlug, "sha1")
+	// Re-evaluating the same commit(e.g. on a label change) doesn't count its changes again
+	PublishDiffMetrics(dc, repoSlug, "sha1")
+	PublishDiffMetrics(DiffCounters{
+		ObjectChanges: []DiffObjectChanges{
+			{Kind: "Deployment", ChangeType: "modified", Count: 1},
+		},
+		LinesAdded: 3,
+	}, repoSlug, "sha2")
+
+	assert.InDelta(t, 2, testutil.ToFloat64(argoCdDiffsVec.With(prometheus.Labels{"repo_slug": repoSlug})), 0)
+	assert.InDelta(t, 3, testutil.ToFloat64(argoCdDiffObjectsVec.With(prometheus.Labels{"repo_slug": repoSlug, "kind": "Deployment", "change_type": "modified"})), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(argoCdDiffObjectsVec.With(prometheus.Labels{"repo_slug": repoSlug, "kind": "ConfigMap", "change_type": "added"})), 0)
+	assert.InDelta(t, 13, testutil.ToFloat64(argoCdDiffLinesVec.With(prometheus.Labels{"repo_slug": repoSlug, "direction": "added"})), 0)
+	assert.InDelta(t, 4, testutil.ToFloat64(argoCdDiffLinesVec.With(prometheus.Labels{"repo_slug": repoSlug, "direction": "removed"})), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(argoCdDiffNotableChangesVec.With(prometheus.Labels{"repo_slug": repoSlug, "change": "image"})), 0)
+}